@@ -0,0 +1,260 @@
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"shark/bytecode"
+	"shark/compiler"
+	"shark/lexer"
+	"shark/object"
+	"shark/parser"
+	"shark/vm"
+	"strings"
+	"testing"
+)
+
+var inputs = []string{
+	`1 + 2; "hello" + "world";`,
+	`let mut a = [1, 2, 3]; a[0] = 5; let t = (1, "two", true);`,
+	`let add = (a: i64, b = 2): i64 => { return a + b; }; add(1);`,
+	`let f = (x: array<i64>) => { let g = () => { x }; g(); }; f([1]);`,
+	`type Names = array<string>; let p: Names = ["a"]; let h = {"a": 1}; let t = (1, "a");`,
+	`let fib = (n: i64) => { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10);`,
+	`let mut i = 0; while (i < 10) { i++; }`,
+	`let sq = @memo (n: i64) => { n * n }; let p = @nomemo (n: i64) => { puts(n); n }; sq(2) + p(2);`,
+	`let outer = () => { let inner = () => { "inner" }; inner() + "outer" }; let other = () => { "inner" }; outer();`,
+	`let same = (c: char): char => { c }; same('\'') == "é'"[1];`,
+	`let name = "shark"; puts("Hello ${name}, ${len(name) + 1}");`,
+	// The locals past 255 are read by wide instructions
+	manyLocals(300),
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, input := range inputs {
+		bc := compile(t, input)
+
+		text, err := Disassemble(bc)
+		if err != nil {
+			t.Fatalf("%q: could not disassemble: %s", input, err)
+		}
+		assembled, err := Assemble(strings.NewReader(text))
+		if err != nil {
+			t.Fatalf("%q: could not assemble:\n%s\n%s", input, err, text)
+		}
+
+		// The object files are the same without the debug information
+		options := bytecode.EncodeOptions{StripDebug: true}
+		expected, err := bc.ToObjWithOptions(bytecode.BcTypeNormal, bytecode.BcVersionLatest, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := assembled.ToObjWithOptions(bytecode.BcTypeNormal, bytecode.BcVersionLatest, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("%q: the assembled bytecode differs from the compiled one:\n%s", input, text)
+		}
+
+		again, err := Disassemble(assembled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != text {
+			t.Errorf("%q: expected the same text, got:\n%s\nwant:\n%s", input, again, text)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	text, err := Disassemble(compile(t, `let fib = (n: i64): i64 => { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; puts(fib(10));`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `.func fib params=1 locals=1 type=func<(i64),i64> pure
+	.const k0 2
+	.const k1 1
+	OpGetLocal 0
+	OpConstant k0
+	OpLessThan
+	OpJumpNotTruthy L0
+	OpGetLocal 0
+	OpReturnValue
+	OpJump L1
+L0:
+	OpNull
+L1:
+	OpPop
+	OpCurrentClosure
+	OpGetLocal 0
+	OpConstant k1
+	OpSub
+	OpCall 1
+	OpCurrentClosure
+	OpGetLocal 0
+	OpConstant k0
+	OpSub
+	OpCall 1
+	OpAdd
+	OpReturnValue
+.end
+
+.const k3 10
+
+.main
+	OpClosure fib 0
+	OpSetGlobal 0
+	OpGetBuiltin puts
+	OpGetGlobal 0
+	OpConstant k3
+	OpCall 1
+	OpCall 1
+	OpPop
+.end
+`
+	if text != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, text)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	t.Run("should run hand-written code", func(t *testing.T) {
+		bc, err := Assemble(strings.NewReader(`
+; counts down from 3 and returns the sum of the numbers
+.func sum params=1 locals=2 type=func<(i64),i64>
+	.const zero 0
+	OpConstant zero
+	OpSetLocal 1
+loop:
+	OpGetLocal 0
+	OpConstant zero
+	OpGreaterThan
+	OpJumpNotTruthy done
+	OpGetLocal 1
+	OpGetLocal 0
+	OpAdd
+	OpSetLocal 1
+	OpDecrementLocal 0
+	OpJump loop
+done:
+	OpGetLocal 1
+	OpReturnValue
+.end
+.const three 3
+.const values [1, (true, "a"), sum, null]
+
+.main
+	OpClosure sum 0   ; the function
+	OpConstant three
+	OpCall 1
+	OpPop
+.end
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		machine := vm.NewDefault(bc)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %+v", err)
+		}
+		result, ok := machine.LastPoppedStackElem().(*object.Int64)
+		if !ok || result.Value != 6 {
+			t.Errorf("expected 6, got %+v", machine.LastPoppedStackElem())
+		}
+
+		values := bc.Constants[3].(*object.Array)
+		if values.Elements[2] != bc.Constants[1] {
+			t.Errorf("expected the array to hold the function")
+		}
+	})
+
+	t.Run("should report errors with their line", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{".main\n\tOpAdd 1\n.end", "line 2: unexpected '1'"},
+			{".main\n\tOpConstant\n.end", "line 2: OpConstant expects 1 operands"},
+			{".main\n\tOpCall 256\n.end", "line 2: operand 256 of OpCall does not fit in 1 bytes"},
+			{".main\n\tOpWide OpCall 65536\n.end", "line 2: operand 65536 of OpCall does not fit in 2 bytes"},
+			{".main\n\tOpWide OpAdd\n.end", "line 2: OpWide cannot prefix OpAdd, it has no operands"},
+			{".main\n\tOpNope\n.end", "line 2: unknown opcode 'OpNope'"},
+			{".main\n\tOpJump nowhere\n.end", "line 2: unknown label 'nowhere'"},
+			{".main\n\tOpConstant nothing\n.end", "line 2: unknown constant 'nothing'"},
+			{".const a 1\n.const a 2", "line 2: 'a' is already declared on line 1"},
+			{".const a [1, b]", "line 1: unknown function 'b'"},
+			{".func f params=1 type=func<(i64),int>\n.end", "line 1: unknown type 'int'"},
+			{".func f\n\tOpReturn", "line 1: 'f' is never ended"},
+			{".end", "line 1: .end without a block"},
+			{"OpPop", "line 1: instruction 'OpPop' outside of a block"},
+			{".const s \"open", "line 1: unterminated string"},
+		}
+
+		for _, tt := range tests {
+			_, err := Assemble(strings.NewReader(tt.input))
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.input)
+				continue
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("%q: expected error %q, got %q", tt.input, tt.expected, err.Error())
+			}
+		}
+	})
+}
+
+func TestTypes(t *testing.T) {
+	for _, input := range []string{
+		"_", "any", "i64", "bool", "string", "char", "null", "error",
+		"array<i64>", "hashmap<string,array<bool>>", "optional<i64>", "spread<any>",
+		"closure<func<(),_>>", "variadic<_>",
+		"tuple<*>", "tuple<>", "tuple<i64,string>", "collection<spread<any>>",
+		"func<*,i64>", "func<(i64,optional<alias<Name,string>>),tuple<*>>",
+	} {
+		list, err := tokenize(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sharkType, err := parseType(&tokens{list: list}, 0)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		formatted, err := formatType(sharkType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formatted != input {
+			t.Errorf("expected %q, got %q", input, formatted)
+		}
+	}
+}
+
+func compile(t *testing.T, input string) *bytecode.Bytecode {
+	t.Helper()
+
+	l := lexer.New(&input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%q: parser errors: %+v", input, p.Errors())
+	}
+
+	comp := compiler.New()
+	if err, _ := comp.Compile(program); err != nil {
+		t.Fatalf("%q: compiler error: %+v", input, err)
+	}
+	return comp.Bytecode()
+}
+
+// Returns a function with n locals that returns the last one.
+func manyLocals(n int) string {
+	var out strings.Builder
+	out.WriteString("let f = () => {")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&out, " let v%d = %d;", i, i)
+	}
+	fmt.Fprintf(&out, " v%d }; f();", n-1)
+	return out.String()
+}
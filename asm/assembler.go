@@ -0,0 +1,482 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"shark/bytecode"
+	"shark/code"
+	"shark/object"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Error is an error in the text of an assembly file.
+type Error struct {
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// The opcodes by name.
+var opcodes = func() map[string]code.Opcode {
+	result := make(map[string]code.Opcode)
+	for op := 0; op < 256; op++ {
+		if def, err := code.Lookup(byte(op)); err == nil {
+			result[def.Name] = code.Opcode(op)
+		}
+	}
+	return result
+}()
+
+// The builtins by name.
+var builtins = func() map[string]int {
+	result := make(map[string]int)
+	for i, b := range object.Builtins {
+		result[b.Name] = i
+	}
+	return result
+}()
+
+// A function or the main program being assembled.
+type block struct {
+	fn     *object.CompiledFunction
+	name   string
+	line   int
+	ins    code.Instructions
+	labels map[string]int
+	// The operands that refer to a label or a constant, resolved once the file is read
+	jumps     []operandRef
+	constants []operandRef
+}
+
+// An operand of an instruction that refers to a name.
+type operandRef struct {
+	offset int
+	width  int
+	name   string
+	line   int
+}
+
+// A constant with a name, a function in the pool is only known by its index at its .end.
+type namedConstant struct {
+	obj   object.Object
+	index int
+	line  int
+}
+
+type assembler struct {
+	line      int
+	constants []object.Object
+	names     map[string]*namedConstant
+	blocks    []*block
+	done      []*block
+	main      *block
+	// The values that refer to a function, set once the file is read
+	refs []valueRef
+}
+
+type valueRef struct {
+	set  func(object.Object)
+	name string
+	line int
+}
+
+// Assemble reads the text of an assembly file, see the package documentation for its format.
+func Assemble(r io.Reader) (*bytecode.Bytecode, error) {
+	a := &assembler{names: make(map[string]*namedConstant)}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		a.line++
+		if err := a.assembleLine(scanner.Text()); err != nil {
+			return nil, &Error{Line: a.line, Message: err.Error()}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(a.blocks) > 0 {
+		b := a.blocks[len(a.blocks)-1]
+		return nil, &Error{Line: b.line, Message: fmt.Sprintf("'%s' is never ended", b.name)}
+	}
+	if err := a.resolve(); err != nil {
+		return nil, err
+	}
+
+	bc := &bytecode.Bytecode{Instructions: code.Instructions{}, Constants: a.constants}
+	if a.main != nil {
+		bc.Instructions = a.main.ins
+	}
+	return bc, nil
+}
+
+func (a *assembler) assembleLine(line string) error {
+	list, err := tokenize(line)
+	if err != nil {
+		return err
+	}
+	t := &tokens{list: list}
+
+	// A label
+	if len(list) >= 2 && list[0].kind == tokenName && list[1].kind == tokenPunct && list[1].text == ":" {
+		b := a.current()
+		if b == nil {
+			return fmt.Errorf("label '%s' outside of a block", list[0].text)
+		}
+		if _, ok := b.labels[list[0].text]; ok {
+			return fmt.Errorf("label '%s' is already declared", list[0].text)
+		}
+		b.labels[list[0].text] = len(b.ins)
+		t.pos = 2
+	}
+	if t.done() {
+		return nil
+	}
+
+	first, _ := t.next()
+	if first.kind != tokenName {
+		return fmt.Errorf("expected a directive or an instruction, got '%s'", first.text)
+	}
+
+	switch first.text {
+	case ".const":
+		err = a.constDirective(t)
+	case ".func":
+		err = a.funcDirective(t)
+	case ".main":
+		if a.main != nil {
+			return fmt.Errorf(".main is already declared")
+		}
+		a.main = &block{name: ".main", line: a.line, labels: make(map[string]int)}
+		a.blocks = append(a.blocks, a.main)
+	case ".end":
+		err = a.endDirective()
+	default:
+		err = a.instruction(first.text, t)
+	}
+	if err != nil {
+		return err
+	}
+
+	if tok, ok := t.peek(); ok {
+		return fmt.Errorf("unexpected '%s'", tok.text)
+	}
+	return nil
+}
+
+func (a *assembler) current() *block {
+	if len(a.blocks) == 0 {
+		return nil
+	}
+	return a.blocks[len(a.blocks)-1]
+}
+
+func (a *assembler) declare(name string, obj object.Object, index int) error {
+	if !isName(name) {
+		return fmt.Errorf("invalid name '%s'", name)
+	}
+	if previous, ok := a.names[name]; ok {
+		return fmt.Errorf("'%s' is already declared on line %d", name, previous.line)
+	}
+	a.names[name] = &namedConstant{obj: obj, index: index, line: a.line}
+	return nil
+}
+
+func (a *assembler) constDirective(t *tokens) error {
+	name, err := t.name()
+	if err != nil {
+		return err
+	}
+	index := len(a.constants)
+	a.constants = append(a.constants, nil)
+	value, err := a.value(t, 0, func(obj object.Object) { a.constants[index] = obj })
+	if err != nil {
+		return err
+	}
+	a.constants[index] = value
+	return a.declare(name, value, index)
+}
+
+// Reads a constant value. A value naming a function is only known once the file is read, set
+// is then called with the function.
+func (a *assembler) value(t *tokens, depth int, set func(object.Object)) (object.Object, error) {
+	if depth > maxNestingDepth {
+		return nil, fmt.Errorf("constant nesting exceeds %d levels", maxNestingDepth)
+	}
+
+	tok, err := t.next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tok.kind == tokenInt:
+		value, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer '%s'", tok.text)
+		}
+		return &object.Int64{Value: value}, nil
+	case tok.kind == tokenString:
+		return &object.String{Value: tok.text}, nil
+	case tok.kind == tokenChar:
+		value, _ := utf8.DecodeRuneInString(tok.text)
+		return &object.Char{Value: value}, nil
+	case tok.kind == tokenName && tok.text == "null":
+		return &object.Null{}, nil
+	case tok.kind == tokenName && (tok.text == "true" || tok.text == "false"):
+		return &object.Boolean{Value: tok.text == "true"}, nil
+	case tok.kind == tokenName:
+		a.refs = append(a.refs, valueRef{set: set, name: tok.text, line: a.line})
+		return nil, nil
+	case tok.text == "[":
+		elements, err := a.values(t, depth, "]")
+		return &object.Array{Elements: elements}, err
+	case tok.text == "(":
+		elements, err := a.values(t, depth, ")")
+		return &object.Tuple{Elements: elements}, err
+	default:
+		return nil, fmt.Errorf("expected a value, got '%s'", tok.text)
+	}
+}
+
+// Reads values separated by commas up to end.
+func (a *assembler) values(t *tokens, depth int, end string) ([]object.Object, error) {
+	var list []object.Object
+	if t.accept(end) {
+		return []object.Object{}, nil
+	}
+	for {
+		i := len(list)
+		list = append(list, nil)
+		value, err := a.value(t, depth+1, func(obj object.Object) { list[i] = obj })
+		if err != nil {
+			return nil, err
+		}
+		list[i] = value
+		if t.accept(end) {
+			return list, nil
+		}
+		if err := t.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (a *assembler) funcDirective(t *tokens) error {
+	name, err := t.name()
+	if err != nil {
+		return err
+	}
+	fn := &object.CompiledFunction{Name: name}
+	if err := a.declare(name, fn, -1); err != nil {
+		return err
+	}
+
+	for !t.done() {
+		attr, err := t.name()
+		if err != nil {
+			return err
+		}
+		if attr == "pure" {
+			fn.Pure = true
+			continue
+		}
+		if err := t.expect("="); err != nil {
+			return err
+		}
+		switch attr {
+		case "params", "locals", "defaults":
+			n, err := t.int()
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				return fmt.Errorf("%s cannot be negative", attr)
+			}
+			switch attr {
+			case "params":
+				fn.NumParameters = int(n)
+			case "locals":
+				fn.NumLocals = int(n)
+			default:
+				fn.NumDefaults = int(n)
+			}
+		case "type":
+			if fn.ObjType, err = parseType(t, 0); err != nil {
+				return err
+			}
+		case "memo":
+			mode, err := t.name()
+			if err != nil {
+				return err
+			}
+			switch mode {
+			case "auto":
+				fn.Memo = object.MemoAuto
+			case "always":
+				fn.Memo = object.MemoAlways
+			case "never":
+				fn.Memo = object.MemoNever
+			default:
+				return fmt.Errorf("unknown memo mode '%s', expected auto, always or never", mode)
+			}
+		case "name":
+			tok, err := t.next()
+			if err != nil {
+				return err
+			}
+			if tok.kind != tokenString {
+				return fmt.Errorf("expected a string, got '%s'", tok.text)
+			}
+			fn.Name = tok.text
+		default:
+			return fmt.Errorf("unknown attribute '%s'", attr)
+		}
+	}
+
+	a.blocks = append(a.blocks, &block{fn: fn, name: name, line: a.line, labels: make(map[string]int)})
+	return nil
+}
+
+func (a *assembler) endDirective() error {
+	b := a.current()
+	if b == nil {
+		return fmt.Errorf(".end without a block")
+	}
+	a.blocks = a.blocks[:len(a.blocks)-1]
+	a.done = append(a.done, b)
+
+	if b.fn != nil {
+		b.fn.Instructions = b.ins
+		a.names[b.name].index = len(a.constants)
+		a.constants = append(a.constants, b.fn)
+	}
+	return nil
+}
+
+func (a *assembler) instruction(name string, t *tokens) error {
+	b := a.current()
+	if b == nil {
+		return fmt.Errorf("instruction '%s' outside of a block", name)
+	}
+	// The operands of an instruction prefixed by OpWide are twice as wide
+	wide := name == "OpWide"
+	if wide {
+		tok, err := t.name()
+		if err != nil {
+			return fmt.Errorf("OpWide expects an instruction")
+		}
+		name = tok
+	}
+	op, ok := opcodes[name]
+	if !ok || op == code.OpWide {
+		return fmt.Errorf("unknown opcode '%s'", name)
+	}
+	def, _ := code.Lookup(byte(op))
+	widths := def.OperandWidths
+	offset := len(b.ins) + 1
+	if wide {
+		if len(widths) == 0 {
+			return fmt.Errorf("OpWide cannot prefix %s, it has no operands", def.Name)
+		}
+		widths = def.WideOperandWidths()
+		offset++
+	}
+
+	operands := make([]int, len(widths))
+	for i, width := range widths {
+		tok, err := t.next()
+		if err != nil {
+			return fmt.Errorf("%s expects %d operands", def.Name, len(widths))
+		}
+
+		switch {
+		case tok.kind == tokenInt:
+			value, err := strconv.ParseInt(tok.text, 10, 64)
+			if err != nil || value < 0 || value >= 1<<(8*width) {
+				return fmt.Errorf("operand %s of %s does not fit in %d bytes", tok.text, def.Name, width)
+			}
+			operands[i] = int(value)
+		case tok.kind == tokenName && isJumpTarget(op, i):
+			b.jumps = append(b.jumps, operandRef{offset: offset, width: width, name: tok.text, line: a.line})
+		case tok.kind == tokenName && isConstantOperand(op, i):
+			b.constants = append(b.constants, operandRef{offset: offset, width: width, name: tok.text, line: a.line})
+		case tok.kind == tokenName && op == code.OpGetBuiltin:
+			index, ok := builtins[tok.text]
+			if !ok {
+				return fmt.Errorf("unknown builtin '%s'", tok.text)
+			}
+			operands[i] = index
+		default:
+			return fmt.Errorf("invalid operand '%s' for %s", tok.text, def.Name)
+		}
+		offset += width
+	}
+
+	if wide {
+		b.ins = append(b.ins, code.MakeWide(op, operands...)...)
+	} else {
+		b.ins = append(b.ins, code.Make(op, operands...)...)
+	}
+	return nil
+}
+
+// Sets the operands and values that refer to names, now that all of them are declared.
+func (a *assembler) resolve() error {
+	for _, b := range a.done {
+		for _, ref := range b.jumps {
+			target, ok := b.labels[ref.name]
+			if !ok {
+				return &Error{Line: ref.line, Message: fmt.Sprintf("unknown label '%s'", ref.name)}
+			}
+			if err := setOperand(b.ins, ref, target); err != nil {
+				return err
+			}
+		}
+		for _, ref := range b.constants {
+			c, ok := a.names[ref.name]
+			if !ok {
+				return &Error{Line: ref.line, Message: fmt.Sprintf("unknown constant '%s'", ref.name)}
+			}
+			if err := setOperand(b.ins, ref, c.index); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, ref := range a.refs {
+		c, ok := a.names[ref.name]
+		if !ok {
+			return &Error{Line: ref.line, Message: fmt.Sprintf("unknown function '%s'", ref.name)}
+		}
+		fn, ok := c.obj.(*object.CompiledFunction)
+		if !ok {
+			return &Error{Line: ref.line, Message: fmt.Sprintf("'%s' is not a function", ref.name)}
+		}
+		ref.set(fn)
+	}
+	return nil
+}
+
+func setOperand(ins code.Instructions, ref operandRef, value int) error {
+	if value >= 1<<(8*ref.width) {
+		return &Error{Line: ref.line, Message: fmt.Sprintf("'%s' does not fit in %d bytes", ref.name, ref.width)}
+	}
+	switch ref.width {
+	case 1:
+		ins[ref.offset] = byte(value)
+	case 2:
+		ins[ref.offset] = byte(value >> 8)
+		ins[ref.offset+1] = byte(value)
+	case 4:
+		ins[ref.offset] = byte(value >> 24)
+		ins[ref.offset+1] = byte(value >> 16)
+		ins[ref.offset+2] = byte(value >> 8)
+		ins[ref.offset+3] = byte(value)
+	}
+	return nil
+}
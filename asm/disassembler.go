@@ -0,0 +1,368 @@
+package asm
+
+import (
+	"fmt"
+	"regexp"
+	"shark/bytecode"
+	"shark/code"
+	"shark/object"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The names Disassemble gives to the constants, a function keeps its own name unless it looks
+// like one of them.
+var generatedName = regexp.MustCompile(`^[kfL][0-9]+$`)
+
+type disassembler struct {
+	bc    *bytecode.Bytecode
+	names []string
+	// The pool index of each function, the first one when a function is in the pool twice
+	functions map[*object.CompiledFunction]int
+	// The function whose block declares a constant, -1 for the top level
+	parent []int
+	out    strings.Builder
+}
+
+// Disassemble writes the bytecode as the text of an assembly file. The constants used only by
+// a function are declared in its block, like the compiler adds them to the pool before it.
+func Disassemble(bc *bytecode.Bytecode) (string, error) {
+	d := &disassembler{bc: bc, functions: make(map[*object.CompiledFunction]int)}
+	d.nameConstants()
+	d.nest()
+
+	for i := range bc.Constants {
+		if d.parent[i] != -1 {
+			continue
+		}
+		if d.out.Len() > 0 {
+			d.out.WriteString("\n")
+		}
+		if err := d.declaration(i, 0); err != nil {
+			return "", err
+		}
+	}
+
+	if len(bc.Constants) > 0 {
+		d.out.WriteString("\n")
+	}
+	d.out.WriteString(".main\n")
+	if err := d.instructions(bc.Instructions, 0); err != nil {
+		return "", err
+	}
+	d.out.WriteString(".end\n")
+
+	return d.out.String(), nil
+}
+
+func (d *disassembler) nameConstants() {
+	counts := make(map[string]int)
+	for _, constant := range d.bc.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			counts[fn.Name]++
+		}
+	}
+
+	d.names = make([]string, len(d.bc.Constants))
+	for i, constant := range d.bc.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			d.names[i] = fmt.Sprintf("k%d", i)
+			continue
+		}
+		if _, seen := d.functions[fn]; seen {
+			d.names[i] = fmt.Sprintf("k%d", i)
+			continue
+		}
+		d.functions[fn] = i
+		if isName(fn.Name) && counts[fn.Name] == 1 && !generatedName.MatchString(fn.Name) {
+			d.names[i] = fn.Name
+		} else {
+			d.names[i] = fmt.Sprintf("f%d", i)
+		}
+	}
+}
+
+// Finds the constants to declare in the blocks of the functions. A function declares the
+// constants right before it in the pool that are only used by it and the functions it declares.
+func (d *disassembler) nest() {
+	constants := d.bc.Constants
+
+	// The functions using each constant, -1 for the main program or another constant
+	users := make([]map[int]bool, len(constants))
+	for i := range users {
+		users[i] = make(map[int]bool)
+	}
+	use := func(user int, ins code.Instructions) {
+		forEachInstruction(ins, func(offset int, in code.Instruction) {
+			for i, operand := range in.Operands {
+				if isConstantOperand(in.Op, i) && operand < len(constants) {
+					users[operand][user] = true
+				}
+			}
+		})
+	}
+	use(-1, d.bc.Instructions)
+	for i, constant := range constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok && d.functions[fn] == i {
+			use(i, fn.Instructions)
+		} else {
+			// The functions in the values of constants are kept at the top level
+			markReferences(constant, d.functions, users, 0)
+		}
+	}
+
+	d.parent = make([]int, len(constants))
+	start := make([]int, len(constants))
+	for i := range constants {
+		d.parent[i] = -1
+		start[i] = i
+
+		fn, ok := constants[i].(*object.CompiledFunction)
+		if !ok || d.functions[fn] != i {
+			continue
+		}
+		for j := i - 1; j >= 0 && d.parent[j] == -1; j = start[j] - 1 {
+			if len(users[j]) == 0 || !usedWithin(users[j], start[i], i) {
+				break
+			}
+			start[i] = start[j]
+			d.parent[j] = i
+		}
+	}
+}
+
+// Reports whether all the users are functions in [from, to], the ones declared in the block of
+// the function at to.
+func usedWithin(users map[int]bool, from, to int) bool {
+	for user := range users {
+		if user < from || user > to {
+			return false
+		}
+	}
+	return true
+}
+
+func markReferences(obj object.Object, functions map[*object.CompiledFunction]int, users []map[int]bool, depth int) {
+	if depth > maxNestingDepth {
+		return
+	}
+	var elements []object.Object
+	switch obj := obj.(type) {
+	case *object.CompiledFunction:
+		if i, ok := functions[obj]; ok {
+			users[i][-1] = true
+		}
+	case *object.Array:
+		elements = obj.Elements
+	case *object.Tuple:
+		elements = obj.Elements
+	}
+	for _, element := range elements {
+		markReferences(element, functions, users, depth+1)
+	}
+}
+
+// Writes the declaration of the constant at index, with the declarations nested in it.
+func (d *disassembler) declaration(index, indent int) error {
+	prefix := strings.Repeat("\t", indent)
+	constant := d.bc.Constants[index]
+
+	fn, ok := constant.(*object.CompiledFunction)
+	if !ok || d.functions[fn] != index {
+		value, err := d.value(constant, 0)
+		if err != nil {
+			return fmt.Errorf("constant %d: %w", index, err)
+		}
+		fmt.Fprintf(&d.out, "%s.const %s %s\n", prefix, d.names[index], value)
+		return nil
+	}
+
+	header, err := d.functionHeader(index, fn)
+	if err != nil {
+		return fmt.Errorf("constant %d: %w", index, err)
+	}
+	fmt.Fprintf(&d.out, "%s%s\n", prefix, header)
+	for i := range d.bc.Constants {
+		if d.parent[i] == index {
+			if err := d.declaration(i, indent+1); err != nil {
+				return err
+			}
+		}
+	}
+	if err := d.instructions(fn.Instructions, indent); err != nil {
+		return fmt.Errorf("function '%s': %w", d.names[index], err)
+	}
+	fmt.Fprintf(&d.out, "%s.end\n", prefix)
+	return nil
+}
+
+func (d *disassembler) functionHeader(index int, fn *object.CompiledFunction) (string, error) {
+	header := fmt.Sprintf(".func %s params=%d locals=%d", d.names[index], fn.NumParameters, fn.NumLocals)
+	if fn.NumDefaults != 0 {
+		header += fmt.Sprintf(" defaults=%d", fn.NumDefaults)
+	}
+	if fn.ObjType != nil {
+		sharkType, err := formatType(fn.ObjType)
+		if err != nil {
+			return "", err
+		}
+		header += " type=" + sharkType
+	}
+	if fn.Pure {
+		header += " pure"
+	}
+	switch fn.Memo {
+	case object.MemoAuto:
+	case object.MemoAlways:
+		header += " memo=always"
+	case object.MemoNever:
+		header += " memo=never"
+	default:
+		return "", fmt.Errorf("unknown memo mode %d", fn.Memo)
+	}
+	if fn.Name != d.names[index] {
+		header += " name=" + strconv.Quote(fn.Name)
+	}
+	return header, nil
+}
+
+func (d *disassembler) value(obj object.Object, depth int) (string, error) {
+	if depth > maxNestingDepth {
+		return "", fmt.Errorf("constant nesting exceeds %d levels", maxNestingDepth)
+	}
+
+	switch obj := obj.(type) {
+	case *object.Null:
+		return "null", nil
+	case *object.Int64:
+		return strconv.FormatInt(obj.Value, 10), nil
+	case *object.Boolean:
+		return strconv.FormatBool(obj.Value), nil
+	case *object.String:
+		return strconv.Quote(obj.Value), nil
+	case *object.Char:
+		return strconv.QuoteRune(obj.Value), nil
+	case *object.Array:
+		elements, err := d.values(obj.Elements, depth)
+		return "[" + elements + "]", err
+	case *object.Tuple:
+		elements, err := d.values(obj.Elements, depth)
+		return "(" + elements + ")", err
+	case *object.CompiledFunction:
+		index, ok := d.functions[obj]
+		if !ok {
+			return "", fmt.Errorf("the function is not in the constant pool")
+		}
+		return d.names[index], nil
+	default:
+		return "", fmt.Errorf("cannot write constant of type %T", obj)
+	}
+}
+
+func (d *disassembler) values(objs []object.Object, depth int) (string, error) {
+	parts := make([]string, len(objs))
+	for i, obj := range objs {
+		var err error
+		if parts[i], err = d.value(obj, depth+1); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// Writes the instructions of a block, the jump targets get a label.
+func (d *disassembler) instructions(ins code.Instructions, indent int) error {
+	prefix := strings.Repeat("\t", indent)
+
+	boundaries := map[int]bool{len(ins): true}
+	var targets []int
+	err := forEachInstruction(ins, func(offset int, in code.Instruction) {
+		boundaries[offset] = true
+	})
+	if err != nil {
+		return err
+	}
+	forEachInstruction(ins, func(offset int, in code.Instruction) {
+		if code.IsJump(in.Op) && boundaries[in.Operands[len(in.Operands)-1]] {
+			targets = append(targets, in.Operands[len(in.Operands)-1])
+		}
+	})
+	sort.Ints(targets)
+	labels := make(map[int]string)
+	for _, target := range targets {
+		if _, ok := labels[target]; !ok {
+			labels[target] = fmt.Sprintf("L%d", len(labels))
+		}
+	}
+
+	writeLabel := func(offset int) {
+		if label, ok := labels[offset]; ok {
+			fmt.Fprintf(&d.out, "%s%s:\n", prefix, label)
+		}
+	}
+	forEachInstruction(ins, func(offset int, in code.Instruction) {
+		writeLabel(offset)
+		op := in.Op
+		def, _ := code.Lookup(byte(op))
+
+		line := prefix + "\t" + def.Name
+		if in.Wide {
+			line = prefix + "\tOpWide " + def.Name
+		}
+		for i, operand := range in.Operands {
+			text := strconv.Itoa(operand)
+			switch {
+			case isJumpTarget(op, i):
+				if label, ok := labels[operand]; ok {
+					text = label
+				}
+			case isConstantOperand(op, i):
+				if operand < len(d.names) {
+					text = d.names[operand]
+				}
+			case op == code.OpGetBuiltin:
+				if operand < len(object.Builtins) {
+					text = object.Builtins[operand].Name
+				}
+			}
+			line += " " + text
+		}
+		d.out.WriteString(line + "\n")
+	})
+	writeLabel(len(ins))
+
+	return nil
+}
+
+// Reports whether operand i of the instruction is the offset it jumps to, its last one.
+func isJumpTarget(op code.Opcode, i int) bool {
+	def, err := code.Lookup(byte(op))
+	return err == nil && code.IsJump(op) && i == len(def.OperandWidths)-1
+}
+
+// Reports whether operand i of the instruction is the index of a constant.
+func isConstantOperand(op code.Opcode, i int) bool {
+	switch op {
+	case code.OpConstant, code.OpClosure:
+		return i == 0
+	case code.OpAddLocalConst, code.OpSubLocalConst, code.OpJumpIfLocalNotEqualConst:
+		return i == 1
+	default:
+		return false
+	}
+}
+
+// Calls f with each instruction, it fails on an unknown opcode or a truncated instruction.
+func forEachInstruction(ins code.Instructions, f func(offset int, in code.Instruction)) error {
+	for offset := 0; offset < len(ins); {
+		in, err := code.ReadInstruction(ins[offset:])
+		if err != nil {
+			return fmt.Errorf("offset %d: %w", offset, err)
+		}
+		f(offset, in)
+		offset += in.Size
+	}
+	return nil
+}
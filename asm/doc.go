@@ -0,0 +1,72 @@
+/*
+Package asm reads and writes Shark bytecode as text (.sasm files). Assemble turns the
+text into a Bytecode that can be written as an object file, Disassemble turns a
+Bytecode back into text. Disassembling assembled text gives the same text back when
+it is written the way Disassemble writes it.
+
+A file is a list of lines, ';' starts a comment that runs to the end of the line:
+
+	; the constants used by the code
+	.const k0 2
+	.const greeting "hello"
+
+	.func fib params=1 locals=1 type=func<(i64),i64> pure
+		OpGetLocal 0
+		OpConstant k0
+		OpGreaterThan
+		OpJumpNotTruthy L0
+		OpGetLocal 0
+		OpReturnValue
+	L0:
+		...
+	.end
+
+	.main
+		OpClosure fib 0
+		OpSetGlobal 0
+	.end
+
+Directives:
+
+	.const NAME VALUE    adds a constant to the constant pool
+	.func NAME ATTRS...  starts a function, it is added to the constant pool at its .end
+	.main                starts the instructions of the main program
+	.end                 ends the innermost .func or .main
+
+A VALUE is null, true, false, an integer, a double quoted Go string, a single quoted
+Go rune for a char, an array [V, ...], a tuple (V, ...) or the name of a function.
+The constants and functions are added to the pool in the order they are declared, or
+ended for functions, so a function can contain the declarations of the constants and
+functions it uses, like the compiler adds them before the function itself. Names are
+global to the file, whatever the block they are declared in.
+
+The attributes of a function are:
+
+	params=N       the number of parameters
+	locals=N       the number of locals, parameters included
+	defaults=N     the number of parameters with a default value
+	type=TYPE      the type of the function
+	pure           the compiler proved that the function is pure
+	memo=MODE      auto, always or never, see object.MemoMode
+	name="..."     the name in the debug information, the name of the block by default
+
+A TYPE is written like in the object files, see package bytecode:
+
+	_ (no type), any, i64, bool, string, char, null, error
+	array<T>, hashmap<K,V>, optional<T>, spread<T>, closure<T>, variadic<T>
+	tuple<T,...>, collection<T,...>    tuple<*> is any tuple
+	func<(T,...),R>                    func<*,R> takes any arguments
+	alias<NAME,T>
+
+An instruction is the name of an opcode followed by its operands. An operand is a
+number, the name of a constant for OpConstant, OpClosure and the superinstructions
+using a constant, a label for the last operand of a jump, or the name of a builtin
+for OpGetBuiltin. A label is declared by
+its name followed by ':' and points to the next instruction of its block. The
+operands of an instruction written after OpWide are twice as wide, like in
+'OpWide OpConstant 70000'.
+
+The debug information other than the names of the functions, like the source maps,
+is not part of the text.
+*/
+package asm
@@ -0,0 +1,157 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenName tokenKind = iota
+	tokenInt
+	tokenString
+	tokenChar
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// Splits a line into tokens, the comment at its end is left out.
+func tokenize(line string) ([]token, error) {
+	var tokens []token
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == ';':
+			return tokens, nil
+		case r == '"':
+			quoted, err := strconv.QuotedPrefix(string(runes[i:]))
+			if err != nil {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			value, _ := strconv.Unquote(quoted)
+			tokens = append(tokens, token{kind: tokenString, text: value})
+			i += len([]rune(quoted))
+		case r == '\'':
+			quoted, err := strconv.QuotedPrefix(string(runes[i:]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid char")
+			}
+			value, _ := strconv.Unquote(quoted)
+			tokens = append(tokens, token{kind: tokenChar, text: value})
+			i += len([]rune(quoted))
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i++; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+			}
+			tokens = append(tokens, token{kind: tokenInt, text: string(runes[start:i])})
+		case isNameStart(r):
+			start := i
+			for i++; i < len(runes) && isNamePart(runes[i]); i++ {
+			}
+			tokens = append(tokens, token{kind: tokenName, text: string(runes[start:i])})
+		case r == ':' || r == '=' || r == ',' || r == '[' || r == ']' || r == '(' || r == ')' ||
+			r == '<' || r == '>' || r == '*':
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isNameStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '.'
+}
+
+func isNamePart(r rune) bool {
+	return isNameStart(r) || unicode.IsDigit(r)
+}
+
+// Reports whether s can be written as a name.
+func isName(s string) bool {
+	for i, r := range s {
+		if (i == 0 && !isNameStart(r)) || !isNamePart(r) || r == '.' {
+			return false
+		}
+	}
+	return s != "" && s != "_" && s != "null" && s != "true" && s != "false"
+}
+
+// tokens reads the tokens of a line one by one.
+type tokens struct {
+	list []token
+	pos  int
+}
+
+func (t *tokens) done() bool {
+	return t.pos >= len(t.list)
+}
+
+func (t *tokens) peek() (token, bool) {
+	if t.done() {
+		return token{}, false
+	}
+	return t.list[t.pos], true
+}
+
+func (t *tokens) next() (token, error) {
+	if t.done() {
+		return token{}, fmt.Errorf("unexpected end of line")
+	}
+	t.pos++
+	return t.list[t.pos-1], nil
+}
+
+// Reports whether the next token is the punctuation p, and reads it if it is.
+func (t *tokens) accept(p string) bool {
+	if tok, ok := t.peek(); ok && tok.kind == tokenPunct && tok.text == p {
+		t.pos++
+		return true
+	}
+	return false
+}
+
+func (t *tokens) expect(p string) error {
+	if !t.accept(p) {
+		tok, ok := t.peek()
+		if !ok {
+			return fmt.Errorf("expected '%s' at the end of the line", p)
+		}
+		return fmt.Errorf("expected '%s', got '%s'", p, tok.text)
+	}
+	return nil
+}
+
+func (t *tokens) name() (string, error) {
+	tok, err := t.next()
+	if err != nil {
+		return "", err
+	}
+	if tok.kind != tokenName {
+		return "", fmt.Errorf("expected a name, got '%s'", tok.text)
+	}
+	return tok.text, nil
+}
+
+func (t *tokens) int() (int64, error) {
+	tok, err := t.next()
+	if err != nil {
+		return 0, err
+	}
+	if tok.kind != tokenInt {
+		return 0, fmt.Errorf("expected a number, got '%s'", tok.text)
+	}
+	return strconv.ParseInt(tok.text, 10, 64)
+}
@@ -0,0 +1,243 @@
+package asm
+
+import (
+	"fmt"
+	"shark/types"
+	"strings"
+)
+
+// The maximum nesting of types and values, like for the object files.
+const maxNestingDepth = 64
+
+// Writes a type the way parseType reads it.
+func formatType(sharkType types.ISharkType) (string, error) {
+	switch t := sharkType.(type) {
+	case nil:
+		return "_", nil
+	case types.TSharkAny:
+		return "any", nil
+	case types.TSharkI64:
+		return "i64", nil
+	case types.TSharkBool:
+		return "bool", nil
+	case types.TSharkString:
+		return "string", nil
+	case types.TSharkChar:
+		return "char", nil
+	case types.TSharkNull:
+		return "null", nil
+	case types.TSharkError:
+		return "error", nil
+	case types.TSharkArray:
+		return formatGeneric("array", t.Collection)
+	case types.TSharkHashMap:
+		return formatGeneric("hashmap", t.Indexes, t.Collects)
+	case types.TSharkOptional:
+		return formatGeneric("optional", t.Type)
+	case types.TSharkSpread:
+		return formatGeneric("spread", t.Type)
+	case types.TSharkClosure:
+		return formatGeneric("closure", t.FuncType)
+	case types.TSharkVariadic:
+		return formatGeneric("variadic", t.Enclosed)
+	case types.TSharkTuple:
+		list, err := formatTypeList(t.Collection)
+		return "tuple<" + list + ">", err
+	case types.TSharkCollection:
+		list, err := formatTypeList(t.Collection)
+		return "collection<" + list + ">", err
+	case types.TSharkFuncType:
+		args, err := formatTypeList(t.ArgsList)
+		if err != nil {
+			return "", err
+		}
+		if t.ArgsList != nil {
+			args = "(" + args + ")"
+		}
+		ret, err := formatType(t.ReturnT)
+		return "func<" + args + "," + ret + ">", err
+	case *types.TSharkFuncType:
+		return formatType(*t)
+	case types.TSharkAlias:
+		if !isName(t.Name) {
+			return "", fmt.Errorf("cannot write the alias name %q", t.Name)
+		}
+		aliased, err := formatType(t.Type)
+		return "alias<" + t.Name + "," + aliased + ">", err
+	default:
+		return "", fmt.Errorf("cannot write type %T", sharkType)
+	}
+}
+
+func formatGeneric(name string, params ...types.ISharkType) (string, error) {
+	list, err := formatTypeList(params)
+	return name + "<" + list + ">", err
+}
+
+// Writes the types separated by commas, a nil list is written as '*'.
+func formatTypeList(list []types.ISharkType) (string, error) {
+	if list == nil {
+		return "*", nil
+	}
+	parts := make([]string, len(list))
+	for i, t := range list {
+		var err error
+		if parts[i], err = formatType(t); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func parseType(t *tokens, depth int) (types.ISharkType, error) {
+	if depth > maxNestingDepth {
+		return nil, fmt.Errorf("type nesting exceeds %d levels", maxNestingDepth)
+	}
+	depth++
+
+	name, err := t.name()
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "_":
+		return nil, nil
+	case "any":
+		return types.TSharkAny{}, nil
+	case "i64":
+		return types.TSharkI64{}, nil
+	case "bool":
+		return types.TSharkBool{}, nil
+	case "string":
+		return types.TSharkString{}, nil
+	case "char":
+		return types.TSharkChar{}, nil
+	case "null":
+		return types.TSharkNull{}, nil
+	case "error":
+		return types.TSharkError{}, nil
+	case "array", "optional", "spread", "closure", "variadic":
+		params, err := parseTypeParams(t, depth, 1)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "array":
+			return types.TSharkArray{Collection: params[0]}, nil
+		case "optional":
+			return types.TSharkOptional{Type: params[0]}, nil
+		case "spread":
+			return types.TSharkSpread{Type: params[0]}, nil
+		case "closure":
+			return types.TSharkClosure{FuncType: params[0]}, nil
+		default:
+			return types.TSharkVariadic{Enclosed: params[0]}, nil
+		}
+	case "hashmap":
+		params, err := parseTypeParams(t, depth, 2)
+		if err != nil {
+			return nil, err
+		}
+		return types.TSharkHashMap{Indexes: params[0], Collects: params[1]}, nil
+	case "tuple", "collection":
+		if err := t.expect("<"); err != nil {
+			return nil, err
+		}
+		list, err := parseTypeList(t, depth, ">")
+		if err != nil {
+			return nil, err
+		}
+		if name == "tuple" {
+			return types.TSharkTuple{Collection: list}, nil
+		}
+		return types.TSharkCollection{Collection: list}, nil
+	case "func":
+		if err := t.expect("<"); err != nil {
+			return nil, err
+		}
+		var args []types.ISharkType
+		if !t.accept("*") {
+			if err := t.expect("("); err != nil {
+				return nil, err
+			}
+			if args, err = parseTypeList(t, depth, ")"); err != nil {
+				return nil, err
+			}
+			if args == nil {
+				args = []types.ISharkType{}
+			}
+		}
+		if err := t.expect(","); err != nil {
+			return nil, err
+		}
+		ret, err := parseType(t, depth)
+		if err != nil {
+			return nil, err
+		}
+		return types.TSharkFuncType{ArgsList: args, ReturnT: ret}, t.expect(">")
+	case "alias":
+		if err := t.expect("<"); err != nil {
+			return nil, err
+		}
+		aliasName, err := t.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := t.expect(","); err != nil {
+			return nil, err
+		}
+		aliased, err := parseType(t, depth)
+		if err != nil {
+			return nil, err
+		}
+		return types.TSharkAlias{Name: aliasName, Type: aliased}, t.expect(">")
+	default:
+		return nil, fmt.Errorf("unknown type '%s'", name)
+	}
+}
+
+// Reads the n types between angle brackets of a generic type.
+func parseTypeParams(t *tokens, depth, n int) ([]types.ISharkType, error) {
+	if err := t.expect("<"); err != nil {
+		return nil, err
+	}
+	params := make([]types.ISharkType, n)
+	for i := range params {
+		if i > 0 {
+			if err := t.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if params[i], err = parseType(t, depth); err != nil {
+			return nil, err
+		}
+	}
+	return params, t.expect(">")
+}
+
+// Reads types separated by commas up to end. A list written as '*' is nil, an empty one is
+// not.
+func parseTypeList(t *tokens, depth int, end string) ([]types.ISharkType, error) {
+	if t.accept("*") {
+		return nil, t.expect(end)
+	}
+	list := []types.ISharkType{}
+	if t.accept(end) {
+		return list, nil
+	}
+	for {
+		sharkType, err := parseType(t, depth)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sharkType)
+		if t.accept(end) {
+			return list, nil
+		}
+		if err := t.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"shark/token"
+	"strings"
 	"testing"
 )
 
@@ -28,3 +29,51 @@ func TestString(t *testing.T) {
 		}
 	})
 }
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	// if (a) { b } with no else block
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Expression: &IfExpression{
+					Condition:   ident("a"),
+					Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("b")}}},
+				},
+			},
+			&LetStatement{Name: ident("c"), Value: &FunctionLiteral{Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("d")}}}}},
+		},
+	}
+
+	t.Run("should visit every node in source order", func(t *testing.T) {
+		var names []string
+		Inspect(program, func(n Node) bool {
+			if ident, ok := n.(*Identifier); ok {
+				names = append(names, ident.Value)
+			}
+			return true
+		})
+
+		if strings.Join(names, " ") != "a b c d" {
+			t.Errorf("wrong identifiers visited. got=%q", names)
+		}
+	})
+
+	t.Run("should skip the children of a node when asked to", func(t *testing.T) {
+		var names []string
+		Inspect(program, func(n Node) bool {
+			if ident, ok := n.(*Identifier); ok {
+				names = append(names, ident.Value)
+			}
+			_, isFunction := n.(*FunctionLiteral)
+			return !isFunction
+		})
+
+		if strings.Join(names, " ") != "a b c" {
+			t.Errorf("wrong identifiers visited. got=%q", names)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+package ast
+
+import (
+	"shark/token"
+)
+
+type CharLiteral struct {
+	Value rune
+	Token token.Token
+}
+
+func (cl *CharLiteral) expressionNode() {}
+
+func (cl *CharLiteral) TokenPos() token.Position { return cl.Token.Pos }
+
+func (cl *CharLiteral) TokenLiteral() string { return cl.Token.Literal }
+
+func (cl *CharLiteral) String() string { return cl.Token.Literal }
@@ -12,10 +12,19 @@ type FunctionLiteral struct {
 	Body        *BlockStatement
 	Name        string
 	Parameters  []*Identifier
+	Annotations []*Annotation
 	Token       token.Token
 	DefinedType types.ISharkType
 }
 
+// Annotation is a '@name' written before a function literal, like '@memo'.
+type Annotation struct {
+	Token token.Token
+	Name  string
+}
+
+func (a *Annotation) String() string { return "@" + a.Name }
+
 func (fl *FunctionLiteral) expressionNode() {}
 
 func (fl *FunctionLiteral) TokenPos() token.Position { return fl.Token.Pos }
@@ -30,6 +39,9 @@ func (fl *FunctionLiteral) String() string {
 		params = append(params, p.String())
 	}
 
+	for _, a := range fl.Annotations {
+		out.WriteString(a.String() + " ")
+	}
 	out.WriteString(fl.TokenLiteral())
 	if fl.Name != "" {
 		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"shark/token"
+	"strings"
 )
 
 type StringLiteral struct {
@@ -16,3 +17,29 @@ func (sl *StringLiteral) TokenPos() token.Position { return sl.Token.Pos }
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
+
+// InterpolatedString is a string with interpolations, like "Hello ${name}". Its parts alternate
+// between the string literals of the text and the interpolated expressions, they start and end
+// with text, which can be empty.
+type InterpolatedString struct {
+	Parts []Expression
+	Token token.Token
+}
+
+func (is *InterpolatedString) expressionNode() {}
+
+func (is *InterpolatedString) TokenPos() token.Position { return is.Token.Pos }
+
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+
+func (is *InterpolatedString) String() string {
+	var out strings.Builder
+	for i, part := range is.Parts {
+		if i%2 == 0 {
+			out.WriteString(part.String())
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	return out.String()
+}
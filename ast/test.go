@@ -0,0 +1,30 @@
+package ast
+
+import (
+	"bytes"
+	"shark/token"
+)
+
+// TestStatement is a 'test "name" { ... }' block, run by 'shark test' and skipped otherwise.
+type TestStatement struct {
+	Name  *StringLiteral
+	Body  *BlockStatement
+	Token token.Token
+}
+
+func (ts *TestStatement) statementNode() {}
+
+func (ts *TestStatement) TokenPos() token.Position { return ts.Token.Pos }
+
+func (ts *TestStatement) TokenLiteral() string { return ts.Token.Literal }
+
+func (ts *TestStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	out.WriteString(ts.Name.String())
+	out.WriteString(" ")
+	out.WriteString(ts.Body.String())
+
+	return out.String()
+}
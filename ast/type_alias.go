@@ -0,0 +1,35 @@
+package ast
+
+import (
+	"bytes"
+	"shark/token"
+	"shark/types"
+)
+
+type TypeAliasStatement struct {
+	Name  *Identifier
+	Value types.ISharkType
+	Token token.Token
+}
+
+func (ta *TypeAliasStatement) statementNode() {}
+
+func (ta *TypeAliasStatement) TokenPos() token.Position { return ta.Token.Pos }
+
+func (ta *TypeAliasStatement) TokenLiteral() string { return ta.Token.Literal }
+
+func (ta *TypeAliasStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ta.TokenLiteral() + " ")
+	out.WriteString(ta.Name.String())
+	out.WriteString(" = ")
+
+	if ta.Value != nil {
+		out.WriteString(ta.Value.SharkTypeString())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
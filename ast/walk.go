@@ -0,0 +1,119 @@
+package ast
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Inspect traverses the tree of node in depth-first order, calling f on each node before its
+// children. The children of a node are skipped when f returns false. Children are visited in
+// the order they appear in the source.
+func Inspect(node Node, f func(Node) bool) {
+	if isNil(node) || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+	case *ExpressionStatement:
+		Inspect(node.Expression, f)
+	case *LetStatement:
+		Inspect(node.Name, f)
+		Inspect(node.Value, f)
+	case *ReturnStatement:
+		Inspect(node.ReturnValue, f)
+	case *WhileStatement:
+		Inspect(node.Condition, f)
+		Inspect(node.Body, f)
+	case *TypeAliasStatement:
+		Inspect(node.Name, f)
+	case *TestStatement:
+		Inspect(node.Name, f)
+		Inspect(node.Body, f)
+	case *TupleDeconstruction:
+		for _, name := range node.Names {
+			Inspect(name, f)
+		}
+		Inspect(node.Value, f)
+	case *Identifier:
+		if node.DefaultValue != nil {
+			Inspect(*node.DefaultValue, f)
+		}
+	case *PrefixExpression:
+		if node.RightIdent != nil {
+			Inspect(node.RightIdent, f)
+		} else {
+			Inspect(node.Right, f)
+		}
+	case *InfixExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Right, f)
+	case *PostfixExpression:
+		Inspect(node.Left, f)
+	case *IfExpression:
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+		Inspect(node.Alternative, f)
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		Inspect(node.Body, f)
+	case *CallExpression:
+		Inspect(node.Function, f)
+		for _, arg := range node.Arguments {
+			Inspect(arg, f)
+		}
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			Inspect(e, f)
+		}
+	case *TupleLiteral:
+		for _, e := range node.Elements {
+			Inspect(e, f)
+		}
+	case *InterpolatedString:
+		for _, part := range node.Parts {
+			Inspect(part, f)
+		}
+	case *HashLiteral:
+		keys := make([]Expression, 0, len(node.Pairs))
+		for key := range node.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i].TokenPos(), keys[j].TokenPos()
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.ColFrom < b.ColFrom
+		})
+		for _, key := range keys {
+			Inspect(key, f)
+			Inspect(node.Pairs[key], f)
+		}
+	case *IndexExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+	case *IndexAssignExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+		Inspect(node.Value, f)
+	}
+}
+
+// Reports whether the node is nil, or a nil pointer to a node like a missing else block.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
@@ -12,6 +12,11 @@ import (
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+
+	// Debug information, empty when it was stripped from the bytecode.
+	SourceName  string
+	GlobalNames []string
+	SourceMap   code.SourceMap
 }
 
 var magicNumber []byte = []byte{0x6e, 0x65, 0x78} // "nex"
@@ -41,60 +46,46 @@ func (b *Bytecode) GobDecode(buf []byte) error {
 }
 
 func FromBytes(data ObjCode) (*Bytecode, error) {
-	r := bytes.NewReader(data)
-
-	mn := make([]byte, len(magicNumber))
-	if err := binary.Read(r, binary.BigEndian, &mn); err != nil {
+	version, payload, err := data.payload()
+	if err != nil {
 		return nil, err
 	}
 
-	if !bytes.Equal(mn, magicNumber) {
-		return nil, fmt.Errorf("magic number mismatch")
-	}
-
-	var version Version
-	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
-		return nil, err
-	}
-
-	var bytecodeType Type
-	if err := binary.Read(r, binary.BigEndian, &bytecodeType); err != nil {
-		return nil, err
-	}
-
-	var bytecodeLength int64
-	if err := binary.Read(r, binary.BigEndian, &bytecodeLength); err != nil {
-		return nil, err
-	}
-
-	bytecodeData := make([]byte, bytecodeLength)
-	if _, err := r.Read(bytecodeData); err != nil {
-		return nil, err
-	}
-
-	switch bytecodeType {
-	case BcTypeNormal:
-		break
-	case BcTypeCompressedBrotli:
-		var err error
-		bytecodeData, err = decompressBrotli(bytecodeData)
+	var b *Bytecode
+	switch version {
+	case BcVersionOnos1:
+		b = &Bytecode{}
+		decoder := gob.NewDecoder(bytes.NewReader(payload))
+		if err := decoder.Decode(b); err != nil {
+			return nil, err
+		}
+	case BcVersionOnos2, BcVersionOnos3, BcVersionOnos4, BcVersionOnos5:
+		b, err = decodeOnos2(payload, version)
 		if err != nil {
 			return nil, err
 		}
 	default:
-		return nil, fmt.Errorf("unknown bytecode type: %d", bytecodeType)
+		return nil, fmt.Errorf("unknown bytecode version: %d", version)
 	}
 
-	b := &Bytecode{}
-	decoder := gob.NewDecoder(bytes.NewReader(bytecodeData))
-	if err := decoder.Decode(b); err != nil {
+	if err := version.checkOpcodes(b); err != nil {
 		return nil, err
 	}
-
 	return b, nil
 }
 
 func (b *Bytecode) ToObj(bytecodeType Type, version Version) (ObjCode, error) {
+	return b.ToObjWithOptions(bytecodeType, version, EncodeOptions{})
+}
+
+// ToObjWithOptions is like ToObj, but allows stripping the debug information and signing the object file.
+// The options are only supported by BcVersionOnos2 and later. Bytecode using opcodes added after the
+// version cannot be written.
+func (b *Bytecode) ToObjWithOptions(bytecodeType Type, version Version, options EncodeOptions) (ObjCode, error) {
+	if err := version.checkOpcodes(b); err != nil {
+		return nil, err
+	}
+
 	buf := new(bytes.Buffer)
 
 	// Write magic number
@@ -112,11 +103,24 @@ func (b *Bytecode) ToObj(bytecodeType Type, version Version) (ObjCode, error) {
 		return nil, err
 	}
 
-	gobEncoded := new(bytes.Buffer)
+	var payload []byte
 
-	encoder := gob.NewEncoder(gobEncoded)
-	if err := encoder.Encode(b); err != nil {
-		return nil, err
+	switch version {
+	case BcVersionOnos1:
+		gobEncoded := new(bytes.Buffer)
+		encoder := gob.NewEncoder(gobEncoded)
+		if err := encoder.Encode(b); err != nil {
+			return nil, err
+		}
+		payload = gobEncoded.Bytes()
+	case BcVersionOnos2, BcVersionOnos3, BcVersionOnos4, BcVersionOnos5:
+		var err error
+		payload, err = encodeOnos2(b, version, options)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown bytecode version: %d", version)
 	}
 
 	switch bytecodeType {
@@ -124,23 +128,21 @@ func (b *Bytecode) ToObj(bytecodeType Type, version Version) (ObjCode, error) {
 		break
 	case BcTypeCompressedBrotli:
 		var err error
-		gobEncodedBytes := gobEncoded.Bytes()
-		gobEncodedBytes, err = compressBrotli(gobEncodedBytes)
+		payload, err = compressBrotli(payload)
 		if err != nil {
 			return nil, err
 		}
-		gobEncoded = bytes.NewBuffer(gobEncodedBytes)
 	default:
 		return nil, fmt.Errorf("unknown bytecode type: %d", bytecodeType)
 	}
 
 	// Write bytecode length
-	if err := binary.Write(buf, binary.BigEndian, int64(gobEncoded.Len())); err != nil {
+	if err := binary.Write(buf, binary.BigEndian, int64(len(payload))); err != nil {
 		return nil, err
 	}
 
 	// Write bytecode
-	if _, err := buf.Write(gobEncoded.Bytes()); err != nil {
+	if _, err := buf.Write(payload); err != nil {
 		return nil, err
 	}
 
@@ -169,7 +171,7 @@ func (b *Bytecode) ToString() string {
 	for i, constant := range b.Constants {
 		switch constant := constant.(type) {
 		case *object.CompiledFunction:
-			fmt.Fprintf(&buf, "| %04d FUNC {\n", i)
+			fmt.Fprintf(&buf, "| %04d FUNC%s {\n", i, FunctionFlags(constant))
 			txt := constant.Instructions.String()
 			lines := bytes.Split([]byte(txt), []byte("\n"))
 			for i, line := range lines {
@@ -181,6 +183,8 @@ func (b *Bytecode) ToString() string {
 			fmt.Fprintf(&buf, "| }\n")
 		case *object.String:
 			fmt.Fprintf(&buf, "| %04d %s: \"%s\"\n", i, constant.Type().SharkTypeString(), constant.Inspect())
+		case *object.Char:
+			fmt.Fprintf(&buf, "| %04d %s: '%s'\n", i, constant.Type().SharkTypeString(), constant.Inspect())
 		default:
 			fmt.Fprintf(&buf, "| %04d %s: %s\n", i, constant.Type().SharkTypeString(), constant.Inspect())
 		}
@@ -188,3 +192,18 @@ func (b *Bytecode) ToString() string {
 
 	return buf.String()
 }
+
+// FunctionFlags describes the purity and memoization of a function for the decompiled output.
+func FunctionFlags(fn *object.CompiledFunction) string {
+	flags := ""
+	if fn.Pure {
+		flags += " pure"
+	}
+	switch fn.Memo {
+	case object.MemoAlways:
+		flags += " @memo"
+	case object.MemoNever:
+		flags += " @nomemo"
+	}
+	return flags
+}
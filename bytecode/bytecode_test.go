@@ -0,0 +1,509 @@
+package bytecode_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"reflect"
+	"shark/bytecode"
+	"shark/code"
+	"shark/compiler"
+	"shark/config"
+	"shark/exception"
+	"shark/lexer"
+	"shark/object"
+	"shark/parser"
+	"shark/token"
+	"shark/types"
+	"shark/vm"
+	"strings"
+	"testing"
+	"time"
+)
+
+var roundTripInputs = []string{
+	`1 + 2; "hello" + "world";`,
+	`let mut a = [1, 2, 3]; a[0] = 5; let t = (1, "two", true);`,
+	`let add = (a: i64, b = 2): i64 => { return a + b; }; add(1);`,
+	`let f = (x: array<i64>) => { let g = () => { x }; g(); }; f([1]);`,
+	`type Names = array<string>; let p: Names = ["a"]; let h = {"a": 1}; let t = (1, "a");`,
+	`let fib = (n: i64) => { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10);`,
+	`let mut i = 0; while (i < 10) { i++; }`,
+	`let sq = @memo (n: i64) => { n * n }; let p = @nomemo (n: i64) => { puts(n); n }; sq(2) + p(2);`,
+	`let same = (c: char): char => { c }; same('é') == "🦈"[0];`,
+	"let name = \"shark\"; \"Hello ${name}, ${len(name) + 1}\" == `Hello ${name}`;",
+}
+
+func compile(t testing.TB, input string) *bytecode.Bytecode {
+	l := lexer.New(&input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil
+	}
+	c := compiler.New()
+	if err, _ := c.Compile(program); err != nil {
+		return nil
+	}
+	return c.Bytecode()
+}
+
+func roundTrip(t testing.TB, bc *bytecode.Bytecode, bcType bytecode.Type, options bytecode.EncodeOptions) *bytecode.Bytecode {
+	obj, err := bc.ToObjWithOptions(bcType, bytecode.BcVersionLatest, options)
+	if err != nil {
+		t.Fatalf("could not encode bytecode: %s", err)
+	}
+	decoded, err := bytecode.FromBytes(obj)
+	if err != nil {
+		t.Fatalf("could not decode bytecode: %s", err)
+	}
+	return decoded
+}
+
+func TestObjFileRoundTrip(t *testing.T) {
+	t.Run("should decode the same bytecode as the one encoded", func(t *testing.T) {
+		for _, input := range roundTripInputs {
+			bc := compile(t, input)
+			if bc == nil {
+				t.Fatalf("could not compile %q", input)
+			}
+			bc.SourceName = "test.shark"
+			for _, bcType := range []bytecode.Type{bytecode.BcTypeNormal, bytecode.BcTypeCompressedBrotli} {
+				decoded := roundTrip(t, bc, bcType, bytecode.EncodeOptions{})
+				if !reflect.DeepEqual(bc, decoded) {
+					t.Errorf("round trip mismatch for %q.\nwant=%+v\ngot=%+v", input, bc, decoded)
+				}
+			}
+		}
+	})
+
+	t.Run("should keep the metadata of functions", func(t *testing.T) {
+		fnType := types.TSharkFuncType{
+			ArgsList: []types.ISharkType{types.TSharkI64{}, types.TSharkOptional{Type: types.TSharkAlias{Name: "Name", Type: types.TSharkString{}}}},
+			ReturnT:  types.TSharkTuple{},
+		}
+		fn := &object.CompiledFunction{
+			Instructions:  code.Instructions(code.Make(code.OpReturn)),
+			NumLocals:     3,
+			NumParameters: 2,
+			NumDefaults:   1,
+			ObjType:       fnType,
+			Name:          "greet",
+			LocalNames:    []string{"a", "b", "c"},
+			SourceMap:     code.SourceMap{{Offset: 0, Pos: token.Position{Line: 1, LineTo: 1, ColFrom: 2, ColTo: 8}}},
+		}
+		bc := &bytecode.Bytecode{
+			Instructions: code.Instructions(code.Make(code.OpClosure, 1, 0)),
+			Constants:    []object.Object{&object.Null{}, fn, &object.Array{Elements: []object.Object{fn, &object.Int64{Value: -42}}}},
+		}
+		decoded := roundTrip(t, bc, bytecode.BcTypeNormal, bytecode.EncodeOptions{})
+		if !reflect.DeepEqual(bc, decoded) {
+			t.Fatalf("round trip mismatch.\nwant=%+v\ngot=%+v", bc, decoded)
+		}
+		if decoded.Constants[1] != decoded.Constants[2].(*object.Array).Elements[0] {
+			t.Errorf("shared function constants are decoded as different objects")
+		}
+	})
+
+	t.Run("should strip the debug information", func(t *testing.T) {
+		bc := compile(t, roundTripInputs[2])
+		decoded := roundTrip(t, bc, bytecode.BcTypeNormal, bytecode.EncodeOptions{StripDebug: true})
+		if decoded.SourceMap != nil || decoded.GlobalNames != nil {
+			t.Errorf("debug information of the main program was not stripped")
+		}
+		var fn *object.CompiledFunction
+		for _, constant := range decoded.Constants {
+			if constant, ok := constant.(*object.CompiledFunction); ok {
+				fn = constant
+			}
+		}
+		if fn == nil {
+			t.Fatalf("no function in the constant pool")
+		}
+		if fn.Name != "" || fn.LocalNames != nil || fn.SourceMap != nil {
+			t.Errorf("debug information of the function was not stripped")
+		}
+		if fn.NumDefaults != 1 || fn.ObjType == nil {
+			t.Errorf("function metadata was stripped with the debug information")
+		}
+	})
+}
+
+func TestObjFileVersion(t *testing.T) {
+	t.Run("should write the instructions every version has in an earlier version", func(t *testing.T) {
+		bc := compile(t, roundTripInputs[0])
+		obj, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionOnos2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bytecode.FromBytes(obj); err != nil {
+			t.Errorf("could not decode bytecode: %s", err)
+		}
+	})
+
+	t.Run("should not write instructions the version does not have", func(t *testing.T) {
+		bc := compile(t, roundTripInputs[6])
+		_, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionOnos2)
+		if err == nil || !strings.Contains(err.Error(), "OpLessThan needs bytecode version onos3") {
+			t.Errorf("wrong error. got=%v", err)
+		}
+	})
+
+	t.Run("should not read instructions the version does not have", func(t *testing.T) {
+		bc := compile(t, roundTripInputs[6])
+		obj, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionLatest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The version follows the magic number
+		obj[3] = byte(bytecode.BcVersionOnos2)
+		if _, err := bytecode.FromBytes(obj); err == nil {
+			t.Errorf("instructions of a later version were accepted")
+		}
+	})
+
+	t.Run("should not write or read tail calls and wide operands before onos3", func(t *testing.T) {
+		wide := &bytecode.Bytecode{
+			Instructions: concat(code.MakeWide(code.OpConstant, 0), code.Make(code.OpPop)),
+			Constants:    []object.Object{&object.Int64{Value: 1}},
+		}
+		tests := []struct {
+			bytecode *bytecode.Bytecode
+			expected string
+		}{
+			// The call of g is the last expression of f
+			{compile(t, roundTripInputs[3]), "OpTailCall needs bytecode version onos3, not onos2"},
+			{wide, "OpWide needs bytecode version onos3, not onos2"},
+		}
+
+		for _, tt := range tests {
+			if _, err := tt.bytecode.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionOnos2); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("wrong error when writing. got=%v", err)
+			}
+
+			obj, err := tt.bytecode.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionLatest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := bytecode.FromBytes(obj); err != nil {
+				t.Fatalf("could not decode bytecode: %s", err)
+			}
+			obj[3] = byte(bytecode.BcVersionOnos2)
+			if _, err := bytecode.FromBytes(obj); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("wrong error when reading. got=%v", err)
+			}
+		}
+	})
+
+	t.Run("should not write chars before onos4", func(t *testing.T) {
+		bc := compile(t, roundTripInputs[8])
+		_, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionOnos3)
+		if err == nil || !strings.Contains(err.Error(), "needs bytecode version onos4, not onos3") {
+			t.Errorf("wrong error. got=%v", err)
+		}
+	})
+
+	t.Run("should not read chars before onos4", func(t *testing.T) {
+		bc := compile(t, roundTripInputs[8])
+		obj, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionLatest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj[3] = byte(bytecode.BcVersionOnos3)
+		if _, err := bytecode.FromBytes(obj); err == nil || !strings.Contains(err.Error(), "needs bytecode version onos4") {
+			t.Errorf("wrong error. got=%v", err)
+		}
+	})
+
+	t.Run("should not write interpolated strings before onos5", func(t *testing.T) {
+		bc := compile(t, roundTripInputs[9])
+		_, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionOnos4)
+		if err == nil || !strings.Contains(err.Error(), "OpConcat needs bytecode version onos5, not onos4") {
+			t.Errorf("wrong error. got=%v", err)
+		}
+	})
+}
+
+func TestObjFileSignature(t *testing.T) {
+	bc := compile(t, roundTripInputs[0])
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		options   bytecode.EncodeOptions
+		algorithm bytecode.SignatureAlgorithm
+	}{
+		{bytecode.EncodeOptions{Checksum: true}, bytecode.SigSHA256},
+		{bytecode.EncodeOptions{SigningKey: privateKey}, bytecode.SigEd25519},
+	}
+
+	for _, tt := range tests {
+		t.Run("should verify the "+tt.algorithm.String()+" signature", func(t *testing.T) {
+			obj, err := bc.ToObjWithOptions(bytecode.BcTypeNormal, bytecode.BcVersionLatest, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature, err := obj.Signature()
+			if err != nil {
+				t.Fatalf("could not verify signature: %s", err)
+			}
+			if signature == nil || signature.Algorithm != tt.algorithm {
+				t.Fatalf("wrong signature. want=%s, got=%+v", tt.algorithm.String(), signature)
+			}
+			if tt.algorithm == bytecode.SigEd25519 && !bytes.Equal(signature.PublicKey, publicKey) {
+				t.Errorf("wrong public key")
+			}
+
+			// Flip a bit of the constant pool
+			tampered := bytes.Clone(obj)
+			idx := bytes.Index(tampered, []byte("hello"))
+			tampered[idx] ^= 1
+			if _, err := bytecode.FromBytes(tampered); err == nil {
+				t.Errorf("tampered object file was accepted")
+			}
+		})
+	}
+
+	t.Run("should not have a signature by default", func(t *testing.T) {
+		obj, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionLatest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signature, err := obj.Signature(); err != nil || signature != nil {
+			t.Errorf("unexpected signature %+v, err=%v", signature, err)
+		}
+	})
+}
+
+func concat(instructions ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestVerify(t *testing.T) {
+	conf := config.NewDefaultVmConf()
+	conf.GlobalsSize = 64
+
+	t.Run("should accept compiled programs", func(t *testing.T) {
+		for _, input := range roundTripInputs {
+			bc := compile(t, input)
+			if err := bytecode.Verify(bc, &conf); err != nil {
+				t.Errorf("verify error for %q: %s", input, err.Error())
+			}
+		}
+	})
+
+	fn := func(numLocals int, instructions ...[]byte) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: concat(instructions...), NumLocals: numLocals}
+	}
+
+	tests := []struct {
+		name      string
+		bytecode  *bytecode.Bytecode
+		errorCode exception.SharkErrorCode
+	}{
+		{
+			name:      "unknown opcode",
+			bytecode:  &bytecode.Bytecode{Instructions: code.Instructions{255}},
+			errorCode: exception.SharkErrorInvalidOpcode,
+		},
+		{
+			name:      "truncated operand",
+			bytecode:  &bytecode.Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2]},
+			errorCode: exception.SharkErrorTruncatedInstruction,
+		},
+		{
+			name:      "constant out of range",
+			bytecode:  &bytecode.Bytecode{Instructions: concat(code.Make(code.OpConstant, 1), code.Make(code.OpPop)), Constants: []object.Object{&object.Int64{}}},
+			errorCode: exception.SharkErrorOperandOutOfRange,
+		},
+		{
+			name:      "closure of a non function",
+			bytecode:  &bytecode.Bytecode{Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)), Constants: []object.Object{&object.Int64{}}},
+			errorCode: exception.SharkErrorOperandOutOfRange,
+		},
+		{
+			name:      "global out of range",
+			bytecode:  &bytecode.Bytecode{Instructions: concat(code.Make(code.OpGetGlobal, conf.GlobalsSize), code.Make(code.OpPop))},
+			errorCode: exception.SharkErrorOperandOutOfRange,
+		},
+		{
+			name:      "local in main",
+			bytecode:  &bytecode.Bytecode{Instructions: concat(code.Make(code.OpGetLocal, 0), code.Make(code.OpPop))},
+			errorCode: exception.SharkErrorOperandOutOfRange,
+		},
+		{
+			name: "local out of range",
+			bytecode: &bytecode.Bytecode{Constants: []object.Object{
+				fn(1, code.Make(code.OpGetLocal, 1), code.Make(code.OpReturnValue)),
+			}},
+			errorCode: exception.SharkErrorOperandOutOfRange,
+		},
+		{
+			name: "free variable out of range",
+			bytecode: &bytecode.Bytecode{
+				Instructions: concat(code.Make(code.OpConstant, 1), code.Make(code.OpClosure, 0, 1), code.Make(code.OpPop)),
+				Constants: []object.Object{
+					fn(0, code.Make(code.OpGetFree, 1), code.Make(code.OpReturnValue)),
+					&object.Int64{},
+				},
+			},
+			errorCode: exception.SharkErrorOperandOutOfRange,
+		},
+		{
+			name:      "jump into an operand",
+			bytecode:  &bytecode.Bytecode{Instructions: concat(code.Make(code.OpJump, 4), code.Make(code.OpConstant, 0)), Constants: []object.Object{&object.Int64{}}},
+			errorCode: exception.SharkErrorInvalidJumpTarget,
+		},
+		{
+			name:      "jump past the end",
+			bytecode:  &bytecode.Bytecode{Instructions: code.Make(code.OpJump, 10)},
+			errorCode: exception.SharkErrorInvalidJumpTarget,
+		},
+		{
+			name:      "stack underflow",
+			bytecode:  &bytecode.Bytecode{Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpAdd))},
+			errorCode: exception.SharkErrorStackUnderflow,
+		},
+		{
+			name: "stack depth depends on the path",
+			bytecode: &bytecode.Bytecode{Instructions: concat(
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 5), // 0001
+				code.Make(code.OpTrue),             // 0004
+				code.Make(code.OpPop),              // 0005
+			)},
+			errorCode: exception.SharkErrorStackDepthMismatch,
+		},
+		{
+			name: "function without return",
+			bytecode: &bytecode.Bytecode{Constants: []object.Object{
+				fn(0, code.Make(code.OpNull), code.Make(code.OpPop)),
+			}},
+			errorCode: exception.SharkErrorMissingReturn,
+		},
+		{
+			name:      "return in main",
+			bytecode:  &bytecode.Bytecode{Instructions: code.Make(code.OpReturn)},
+			errorCode: exception.SharkErrorTopLeverReturn,
+		},
+		{
+			name: "more defaults than parameters",
+			bytecode: &bytecode.Bytecode{Constants: []object.Object{
+				&object.CompiledFunction{Instructions: code.Make(code.OpReturn), NumLocals: 1, NumParameters: 1, NumDefaults: 2},
+			}},
+			errorCode: exception.SharkErrorInvalidFunction,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("should reject "+tt.name, func(t *testing.T) {
+			err := bytecode.Verify(tt.bytecode, &conf)
+			if err == nil {
+				t.Fatalf("expected a verify error")
+			}
+			if err.ErrType != exception.SharkErrorTypeBytecode || err.ErrCode != tt.errorCode {
+				t.Errorf("wrong error. want code=%d, got code=%d (%s)", tt.errorCode, err.ErrCode, err.Error())
+			}
+		})
+	}
+
+	t.Run("should point to the source of the failing instruction", func(t *testing.T) {
+		pos := token.Position{Line: 3, LineTo: 3, ColFrom: 1, ColTo: 4}
+		bc := &bytecode.Bytecode{
+			Instructions: concat(code.Make(code.OpNull), code.Make(code.OpPop), code.Make(code.OpPop)),
+			SourceMap:    code.SourceMap{{Offset: 0, Pos: token.Position{Line: 1}}, {Offset: 2, Pos: pos}},
+		}
+		err := bytecode.Verify(bc, &conf)
+		if err == nil || len(err.ErrCause) != 1 || err.ErrCause[0].Pos != pos {
+			t.Errorf("wrong error cause: %+v", err)
+		}
+	})
+}
+
+func FuzzObjFileRoundTrip(f *testing.F) {
+	for _, input := range roundTripInputs {
+		f.Add(input)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		bc := compile(t, input)
+		if bc == nil {
+			return
+		}
+		decoded := roundTrip(t, bc, bytecode.BcTypeNormal, bytecode.EncodeOptions{})
+		if !reflect.DeepEqual(bc, decoded) {
+			t.Errorf("round trip mismatch for %q.\nwant=%+v\ngot=%+v", input, bc, decoded)
+		}
+	})
+}
+
+func FuzzFromBytes(f *testing.F) {
+	for _, input := range roundTripInputs {
+		bc := compile(f, input)
+		if bc == nil {
+			f.Fatalf("could not compile %q", input)
+		}
+		obj, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionLatest)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(obj))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bc, err := bytecode.FromBytes(data)
+		if err != nil {
+			return
+		}
+		// The verifier must reject malformed bytecode without panicking
+		conf := config.NewDefaultVmConf()
+		_ = bytecode.Verify(bc, &conf)
+		// Whatever decodes must encode again
+		if _, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionLatest); err != nil {
+			t.Errorf("could not encode decoded bytecode: %s", err)
+		}
+	})
+}
+
+func FuzzRunVerified(f *testing.F) {
+	add := func(bc *bytecode.Bytecode) {
+		obj, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionLatest)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(obj))
+	}
+	for _, input := range roundTripInputs {
+		add(compile(f, input))
+	}
+	// Globals and locals read before they are set
+	add(&bytecode.Bytecode{Instructions: concat(code.Make(code.OpIncrementGlobal, 0), code.Make(code.OpGetGlobal, 0), code.Make(code.OpPop))})
+	add(&bytecode.Bytecode{Instructions: concat(code.Make(code.OpGetGlobal, 0), code.Make(code.OpConcat, 1), code.Make(code.OpPop))})
+	add(&bytecode.Bytecode{
+		Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpCall, 0), code.Make(code.OpPop)),
+		Constants: []object.Object{&object.CompiledFunction{
+			Instructions: concat(code.Make(code.OpAddLocalConst, 0, 1), code.Make(code.OpReturnValue)),
+			NumLocals:    1,
+		}, &object.Int64{Value: 1}},
+	})
+
+	conf := config.NewDefaultVmConf()
+	conf.GlobalsSize = 64
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bc, err := bytecode.FromBytes(data)
+		if err != nil || bytecode.Verify(bc, &conf) != nil {
+			return
+		}
+		// Verified bytecode may fail, but must not crash the VM. Loops are stopped.
+		machine := vm.New(bc, &conf)
+		timer := time.AfterFunc(100*time.Millisecond, machine.Interrupt)
+		defer timer.Stop()
+		_ = machine.Run()
+	})
+}
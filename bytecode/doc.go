@@ -0,0 +1,83 @@
+/*
+Package bytecode reads and writes Shark object files (.egg).
+
+Every object file starts with the same header, whatever its version:
+
+	magic   [3]byte  "nex"
+	version byte     see Version
+	type    byte     see Type, the compression of the payload
+	length  int64    big endian, length of the (compressed) payload
+	payload [length]byte
+
+For BcVersionOnos1 the payload is the gob encoding of a Bytecode.
+
+For BcVersionOnos2 and the later versions the (decompressed) payload is a list of sections:
+
+	section  id byte | size uvarint | body [size]byte
+
+Integers are encoded as unsigned or zig-zag signed varints (encoding/binary),
+strings and byte slices are prefixed by their length as an uvarint, and lists
+are prefixed by their number of elements. The sections are:
+
+	1 HEADER     required, first section
+	             numFunctions uvarint | numConstants uvarint
+	2 CODE       required, the instructions of the main program
+	3 FUNCTIONS  the compiled functions, in the order they appear in the constant pool
+	             for each function:
+	               numLocals uvarint | numParameters uvarint | numDefaults uvarint |
+	               type TYPE | instructions bytes
+	4 CONSTANTS  the constant pool, each constant starts with a tag
+	             0 null
+	             1 i64      value varint
+	             2 bool     value byte
+	             3 string   value string
+	             4 array    elements list of constants
+	             5 tuple    elements list of constants
+	             6 function index uvarint into FUNCTIONS
+	             7 char     code point uvarint
+	5 DEBUG      optional, absent when the debug information is stripped
+	             sourceName string | sourceMap SOURCEMAP | globalNames list of strings |
+	             for each function: name string | localNames list of strings | sourceMap SOURCEMAP
+	6 SIGNATURE  optional, last section, covers all the payload bytes before it
+	             algorithm byte
+	             1 sha256   digest [32]byte
+	             2 ed25519  publicKey [32]byte | signature [64]byte
+	7 METADATA   optional, written before the signature
+	             for each function: flags byte
+	               bit 0     the function is pure
+	               bits 1-2  memo mode, see object.MemoMode
+	             without it no function is pure and no call is memoized
+
+A TYPE is a tag followed by the types it is made of:
+
+	0 none, 1 any, 2 i64, 3 bool, 4 string, 5 null, 6 error
+	7 array<T>            T
+	8 hashmap<K,V>        K | V
+	9 tuple<...>          list of types, the count is stored plus one and 0 means any tuple
+	10 func<(...)->R>     args like tuple | R
+	11 optional<T>        T
+	12 spread<T>          T
+	13 closure<F>         F
+	14 collection<...>    like tuple
+	15 variadic<T>        T
+	16 alias              name string | T
+	17 char
+
+A SOURCEMAP is a list of mappings: offset uvarint | line varint | lineTo varint | colFrom varint | colTo varint.
+
+BcVersionOnos3 only differs by the instructions it allows: OpTailCall, OpWide, OpLessThan,
+OpLessThanEqual and the superinstructions are rejected when writing or reading an object file
+of an earlier version. OpTailCall and OpWide were first written to onos2 files, which readers
+older than them cannot run.
+
+BcVersionOnos4 adds the char constants and the char type, they are rejected when writing or
+reading an object file of an earlier version.
+
+BcVersionOnos5 adds OpConcat, the instruction of the interpolated strings. Like the
+instructions of BcVersionOnos3, it is rejected when writing or reading an object file of an
+earlier version.
+
+Readers skip sections with an unknown id, so new optional sections can be added
+without a new version.
+*/
+package bytecode
@@ -40,7 +40,7 @@ func (o *ObjCode) Version() (Version, error) {
 		return 0, fmt.Errorf("object code is too short to contain a version")
 	}
 	version := Version((*o)[3])
-	if version != BcVersionOnos1 {
+	if !version.isKnown() {
 		return 0, fmt.Errorf("invalid version: %d", version)
 	}
 
@@ -57,3 +57,73 @@ func (o *ObjCode) InstructionLength() (uint64, error) {
 
 	return binary.BigEndian.Uint64((*o)[5:13]), nil
 }
+
+// Returns the version and the decompressed payload of the object file.
+func (o *ObjCode) payload() (Version, []byte, error) {
+	version, err := o.Version()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	bytecodeType, err := o.CompressionType()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, err := o.InstructionLength()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if length > uint64(len(*o)-13) {
+		return 0, nil, fmt.Errorf("object code is too short to contain %d bytes of bytecode", length)
+	}
+
+	data := (*o)[13 : 13+length]
+
+	switch bytecodeType {
+	case BcTypeNormal:
+		return version, data, nil
+	case BcTypeCompressedBrotli:
+		data, err := decompressBrotli(data)
+		return version, data, err
+	default:
+		return 0, nil, fmt.Errorf("unknown bytecode type: %d", bytecodeType)
+	}
+}
+
+// Signature verifies the signature section of the object file.
+// It returns nil if the object file is not signed.
+func (o *ObjCode) Signature() (*Signature, error) {
+	version, payload, err := o.payload()
+	if err != nil {
+		return nil, err
+	}
+
+	if version < BcVersionOnos2 {
+		return nil, nil
+	}
+
+	_, signature, err := readSections(payload)
+	return signature, err
+}
+
+// HasDebugInfo reports whether the debug section was kept in the object file.
+func (o *ObjCode) HasDebugInfo() (bool, error) {
+	version, payload, err := o.payload()
+	if err != nil {
+		return false, err
+	}
+
+	if version < BcVersionOnos2 {
+		return false, nil
+	}
+
+	sections, _, err := readSections(payload)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := sections[sectionDebug]
+	return ok, nil
+}
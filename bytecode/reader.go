@@ -0,0 +1,383 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"shark/code"
+	"shark/object"
+	"shark/token"
+	"shark/types"
+	"unicode/utf8"
+)
+
+// Limits the nesting of types and constants, so a malformed object file cannot exhaust the stack.
+const maxNestingDepth = 256
+
+// objReader decodes the values written by objWriter. The first error is kept
+// and every following read returns a zero value.
+type objReader struct {
+	err  error
+	data []byte
+	off  int
+	// The version of the object file, chars can only be read from BcVersionOnos4 on.
+	version Version
+}
+
+func (r *objReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (r *objReader) done() bool { return r.err != nil || r.off >= len(r.data) }
+
+func (r *objReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.off >= len(r.data) {
+		r.fail("unexpected end of data at offset %d", r.off)
+		return 0
+	}
+	b := r.data[r.off]
+	r.off++
+	return b
+}
+
+func (r *objReader) uvarint() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.off:])
+	if n <= 0 || v > math.MaxInt32 {
+		r.fail("invalid unsigned integer at offset %d", r.off)
+		return 0
+	}
+	r.off += n
+	return int(v)
+}
+
+func (r *objReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.off:])
+	if n <= 0 {
+		r.fail("invalid integer at offset %d", r.off)
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+// Reads the number of elements of a list. Every element takes at least one
+// byte, so a count larger than the remaining data is rejected before allocating.
+func (r *objReader) count() int {
+	n := r.uvarint()
+	if n > len(r.data)-r.off {
+		r.fail("invalid element count %d at offset %d", n, r.off)
+		return 0
+	}
+	return n
+}
+
+func (r *objReader) bytes() []byte {
+	n := r.count()
+	if r.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data[r.off:r.off+n])
+	r.off += n
+	return b
+}
+
+func (r *objReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *objReader) strings() []string {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	s := make([]string, n)
+	for i := range s {
+		s[i] = r.string()
+	}
+	return s
+}
+
+func (r *objReader) sourceMap() code.SourceMap {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	sm := make(code.SourceMap, n)
+	for i := range sm {
+		sm[i].Offset = r.uvarint()
+		sm[i].Pos = token.Position{
+			Line:    int(r.varint()),
+			LineTo:  int(r.varint()),
+			ColFrom: int(r.varint()),
+			ColTo:   int(r.varint()),
+		}
+	}
+	return sm
+}
+
+func (r *objReader) typeList(depth int) []types.ISharkType {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	list := make([]types.ISharkType, n-1)
+	for i := range list {
+		list[i] = r.sharkType(depth)
+	}
+	return list
+}
+
+func (r *objReader) sharkType(depth int) types.ISharkType {
+	if depth > maxNestingDepth {
+		r.fail("type nesting exceeds %d levels", maxNestingDepth)
+		return nil
+	}
+	depth++
+
+	switch tag := typeTag(r.byte()); tag {
+	case typeNone:
+		return nil
+	case typeAny:
+		return types.TSharkAny{}
+	case typeI64:
+		return types.TSharkI64{}
+	case typeBool:
+		return types.TSharkBool{}
+	case typeString:
+		return types.TSharkString{}
+	case typeChar:
+		if err := r.version.checkChars(fmt.Sprintf("the char type at offset %d", r.off-1)); err != nil {
+			r.fail("%w", err)
+			return nil
+		}
+		return types.TSharkChar{}
+	case typeNull:
+		return types.TSharkNull{}
+	case typeError:
+		return types.TSharkError{}
+	case typeArray:
+		return types.TSharkArray{Collection: r.sharkType(depth)}
+	case typeHashMap:
+		indexes := r.sharkType(depth)
+		return types.TSharkHashMap{Indexes: indexes, Collects: r.sharkType(depth)}
+	case typeTuple:
+		return types.TSharkTuple{Collection: r.typeList(depth)}
+	case typeFunc:
+		args := r.typeList(depth)
+		return types.TSharkFuncType{ArgsList: args, ReturnT: r.sharkType(depth)}
+	case typeOptional:
+		return types.TSharkOptional{Type: r.sharkType(depth)}
+	case typeSpread:
+		return types.TSharkSpread{Type: r.sharkType(depth)}
+	case typeClosure:
+		return types.TSharkClosure{FuncType: r.sharkType(depth)}
+	case typeCollection:
+		return types.TSharkCollection{Collection: r.typeList(depth)}
+	case typeVariadic:
+		return types.TSharkVariadic{Enclosed: r.sharkType(depth)}
+	case typeAlias:
+		name := r.string()
+		return types.TSharkAlias{Name: name, Type: r.sharkType(depth)}
+	default:
+		r.fail("unknown type tag %d at offset %d", tag, r.off-1)
+		return nil
+	}
+}
+
+func (r *objReader) constant(functions []*object.CompiledFunction, depth int) object.Object {
+	if depth > maxNestingDepth {
+		r.fail("constant nesting exceeds %d levels", maxNestingDepth)
+		return nil
+	}
+
+	switch tag := constantTag(r.byte()); tag {
+	case constantNull:
+		return &object.Null{}
+	case constantI64:
+		return object.NewInt64(r.varint())
+	case constantBool:
+		switch b := r.byte(); b {
+		case 0:
+			return &object.Boolean{Value: false}
+		case 1:
+			return &object.Boolean{Value: true}
+		default:
+			r.fail("invalid boolean value %d at offset %d", b, r.off-1)
+			return nil
+		}
+	case constantString:
+		return &object.String{Value: r.string()}
+	case constantChar:
+		if err := r.version.checkChars(fmt.Sprintf("the char constant at offset %d", r.off-1)); err != nil {
+			r.fail("%w", err)
+			return nil
+		}
+		value := r.uvarint()
+		if !utf8.ValidRune(rune(value)) {
+			r.fail("invalid char %d at offset %d", value, r.off)
+			return nil
+		}
+		return object.NewChar(rune(value))
+	case constantArray:
+		return &object.Array{Elements: r.constants(functions, depth+1)}
+	case constantTuple:
+		return &object.Tuple{Elements: r.constants(functions, depth+1)}
+	case constantFunction:
+		index := r.uvarint()
+		if index >= len(functions) {
+			r.fail("function index %d out of range", index)
+			return nil
+		}
+		return functions[index]
+	default:
+		r.fail("unknown constant tag %d at offset %d", tag, r.off-1)
+		return nil
+	}
+}
+
+func (r *objReader) constants(functions []*object.CompiledFunction, depth int) []object.Object {
+	n := r.count()
+	objs := make([]object.Object, n)
+	for i := range objs {
+		objs[i] = r.constant(functions, depth)
+	}
+	return objs
+}
+
+// Splits a BcVersionOnos2 payload into its sections and verifies the signature, if any.
+func readSections(payload []byte) (map[sectionID][]byte, *Signature, error) {
+	sections := make(map[sectionID][]byte)
+	var signature *Signature
+
+	r := &objReader{data: payload}
+	for !r.done() {
+		start := r.off
+		id := sectionID(r.byte())
+		body := r.bytes()
+		if r.err != nil {
+			return nil, nil, r.err
+		}
+		if start == 0 && id != sectionHeader {
+			return nil, nil, fmt.Errorf("the first section must be the header, got section %d", id)
+		}
+		if _, ok := sections[id]; ok {
+			return nil, nil, fmt.Errorf("duplicate section %d", id)
+		}
+		sections[id] = body
+
+		if id == sectionSignature {
+			if !r.done() {
+				return nil, nil, fmt.Errorf("the signature must be the last section")
+			}
+			var err error
+			if signature, err = verifySignature(body, payload[:start]); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+
+	for _, id := range []sectionID{sectionHeader, sectionCode} {
+		if _, ok := sections[id]; !ok {
+			return nil, nil, fmt.Errorf("missing required section %d", id)
+		}
+	}
+
+	return sections, signature, nil
+}
+
+// Decodes the sections of a BcVersionOnos2 payload, or of a later version with the same format.
+func decodeOnos2(payload []byte, version Version) (*Bytecode, error) {
+	sections, _, err := readSections(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &objReader{data: sections[sectionHeader]}
+	numFunctions := header.uvarint()
+	numConstants := header.uvarint()
+	if header.err != nil {
+		return nil, fmt.Errorf("header section: %w", header.err)
+	}
+
+	b := &Bytecode{Instructions: code.Instructions(sections[sectionCode])}
+
+	fns := &objReader{data: sections[sectionFunctions], version: version}
+	var functions []*object.CompiledFunction
+	if len(fns.data) > 0 {
+		functions = make([]*object.CompiledFunction, fns.count())
+		for i := range functions {
+			functions[i] = &object.CompiledFunction{
+				NumLocals:     fns.uvarint(),
+				NumParameters: fns.uvarint(),
+				NumDefaults:   fns.uvarint(),
+				ObjType:       fns.sharkType(0),
+				Instructions:  fns.bytes(),
+			}
+		}
+	}
+	if fns.err != nil {
+		return nil, fmt.Errorf("functions section: %w", fns.err)
+	}
+	if len(functions) != numFunctions {
+		return nil, fmt.Errorf("expected %d functions, got %d", numFunctions, len(functions))
+	}
+
+	consts := &objReader{data: sections[sectionConstants], version: version}
+	if len(consts.data) > 0 {
+		b.Constants = consts.constants(functions, 0)
+	}
+	if consts.err != nil {
+		return nil, fmt.Errorf("constants section: %w", consts.err)
+	}
+	if len(b.Constants) != numConstants {
+		return nil, fmt.Errorf("expected %d constants, got %d", numConstants, len(b.Constants))
+	}
+
+	if body, ok := sections[sectionMetadata]; ok {
+		metadata := &objReader{data: body}
+		if n := metadata.count(); n != len(functions) && metadata.err == nil {
+			return nil, fmt.Errorf("metadata section: expected %d functions, got %d", len(functions), n)
+		}
+		for _, fn := range functions {
+			flags := metadata.byte()
+			fn.Pure = flags&functionPure != 0
+			fn.Memo = object.MemoMode(flags & functionMemoMask >> 1)
+		}
+		if metadata.err != nil {
+			return nil, fmt.Errorf("metadata section: %w", metadata.err)
+		}
+	}
+
+	if body, ok := sections[sectionDebug]; ok {
+		debug := &objReader{data: body}
+		b.SourceName = debug.string()
+		b.SourceMap = debug.sourceMap()
+		b.GlobalNames = debug.strings()
+		for _, fn := range functions {
+			fn.Name = debug.string()
+			fn.LocalNames = debug.strings()
+			fn.SourceMap = debug.sourceMap()
+		}
+		if debug.err != nil {
+			return nil, fmt.Errorf("debug section: %w", debug.err)
+		}
+	}
+
+	return b, nil
+}
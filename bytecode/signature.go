@@ -0,0 +1,67 @@
+package bytecode
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+)
+
+type SignatureAlgorithm byte
+
+const (
+	SigSHA256 SignatureAlgorithm = iota + 1
+	SigEd25519
+)
+
+func (s SignatureAlgorithm) String() string {
+	switch s {
+	case SigSHA256:
+		return "sha256"
+	case SigEd25519:
+		return "ed25519"
+	default:
+		return "unknown"
+	}
+}
+
+// Signature describes the verified signature section of an object file.
+// A SHA-256 signature only guards against corruption, the public key of an
+// Ed25519 signature has to be compared with a trusted key by the caller.
+type Signature struct {
+	PublicKey ed25519.PublicKey
+	Algorithm SignatureAlgorithm
+}
+
+// Verifies the body of a signature section against the payload bytes before it.
+func verifySignature(body, signed []byte) (*Signature, error) {
+	if len(body) == 0 {
+		return nil, fmt.Errorf("empty signature section")
+	}
+
+	algorithm := SignatureAlgorithm(body[0])
+	body = body[1:]
+
+	switch algorithm {
+	case SigSHA256:
+		if len(body) != sha256.Size {
+			return nil, fmt.Errorf("invalid sha256 digest size: %d", len(body))
+		}
+		digest := sha256.Sum256(signed)
+		if !bytes.Equal(digest[:], body) {
+			return nil, fmt.Errorf("sha256 checksum mismatch")
+		}
+		return &Signature{Algorithm: algorithm}, nil
+	case SigEd25519:
+		if len(body) != ed25519.PublicKeySize+ed25519.SignatureSize {
+			return nil, fmt.Errorf("invalid ed25519 signature size: %d", len(body))
+		}
+		publicKey := ed25519.PublicKey(bytes.Clone(body[:ed25519.PublicKeySize]))
+		if !ed25519.Verify(publicKey, signed, body[ed25519.PublicKeySize:]) {
+			return nil, fmt.Errorf("ed25519 signature mismatch")
+		}
+		return &Signature{Algorithm: algorithm, PublicKey: publicKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown signature algorithm: %d", algorithm)
+	}
+}
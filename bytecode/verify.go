@@ -0,0 +1,271 @@
+package bytecode
+
+import (
+	"errors"
+	"fmt"
+	"shark/code"
+	"shark/config"
+	"shark/exception"
+	"shark/object"
+)
+
+// A sequence of instructions checked by the verifier, the main program or a compiled function.
+type verifyUnit struct {
+	sourceMap code.SourceMap
+	name      string
+	ins       code.Instructions
+	constant  int
+	numLocals int
+	// Smallest number of free variables the function is closed over with, -1 if unknown.
+	numFree int
+}
+
+func (u *verifyUnit) isMain() bool { return u.constant < 0 }
+
+func (u *verifyUnit) location(offset int) string {
+	if u.isMain() {
+		return fmt.Sprintf("%04d in main", offset)
+	}
+	if u.name != "" {
+		return fmt.Sprintf("%04d in function '%s' (constant %d)", offset, u.name, u.constant)
+	}
+	return fmt.Sprintf("%04d in function (constant %d)", offset, u.constant)
+}
+
+type verifiedInstruction struct {
+	operands []int
+	offset   int
+	next     int
+	op       code.Opcode
+}
+
+// Verify checks that the bytecode can be run by a VM with the given configuration without
+// reading past its constants, globals, locals or stack. Every instruction has to be a known
+// opcode with in range operands, every jump has to land on an instruction, and every path
+// reaching an instruction has to leave the same number of values on the stack. Functions
+// have to return on every path. Globals and locals read before they are set are not found
+// here, the VM reports them when it reads them.
+func Verify(b *Bytecode, conf *config.VmConf) *exception.SharkError {
+	units := []*verifyUnit{{ins: b.Instructions, constant: -1, sourceMap: b.SourceMap}}
+	fnUnits := make(map[int]*verifyUnit)
+
+	for i, constant := range b.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		unit := &verifyUnit{ins: fn.Instructions, constant: i, numLocals: fn.NumLocals, numFree: -1, name: fn.Name, sourceMap: fn.SourceMap}
+		if fn.NumParameters > fn.NumLocals || fn.NumDefaults > fn.NumParameters || fn.NumDefaults < 0 {
+			return newSharkError(unit, 0, exception.SharkErrorInvalidFunction, unit.location(0),
+				fmt.Sprintf("%d parameters with %d defaults and %d locals", fn.NumParameters, fn.NumDefaults, fn.NumLocals))
+		}
+		units = append(units, unit)
+		fnUnits[i] = unit
+	}
+
+	decoded := make([][]verifiedInstruction, len(units))
+
+	for i, unit := range units {
+		instructions, err := decodeUnit(unit)
+		if err != nil {
+			return err
+		}
+		decoded[i] = instructions
+
+		// Record how many free variables the closures of each function get
+		for _, ins := range instructions {
+			if ins.op != code.OpClosure {
+				continue
+			}
+			fnUnit, ok := fnUnits[ins.operands[0]]
+			if !ok {
+				continue
+			}
+			if fnUnit.numFree < 0 || ins.operands[1] < fnUnit.numFree {
+				fnUnit.numFree = ins.operands[1]
+			}
+		}
+	}
+
+	for i, unit := range units {
+		if err := verifyOperands(unit, decoded[i], b.Constants, conf); err != nil {
+			return err
+		}
+		if err := verifyStack(unit, decoded[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Splits the instructions of a unit, checking that every opcode exists and has all its operands.
+func decodeUnit(unit *verifyUnit) ([]verifiedInstruction, *exception.SharkError) {
+	var instructions []verifiedInstruction
+
+	for offset := 0; offset < len(unit.ins); {
+		in, err := code.ReadInstruction(unit.ins[offset:])
+		if errors.Is(err, code.ErrTruncatedInstruction) {
+			def, _ := code.Lookup(byte(in.Op))
+			return nil, newSharkError(unit, offset, exception.SharkErrorTruncatedInstruction, def.Name, unit.location(offset))
+		}
+		if err != nil {
+			return nil, newSharkError(unit, offset, exception.SharkErrorInvalidOpcode, byte(in.Op), unit.location(offset))
+		}
+
+		instructions = append(instructions, verifiedInstruction{
+			op:       in.Op,
+			operands: in.Operands,
+			offset:   offset,
+			next:     offset + in.Size,
+		})
+		offset += in.Size
+	}
+
+	return instructions, nil
+}
+
+// Checks that the operands of every instruction index into existing constants, globals, locals, builtins and free variables.
+func verifyOperands(unit *verifyUnit, instructions []verifiedInstruction, constants []object.Object, conf *config.VmConf) *exception.SharkError {
+	for _, ins := range instructions {
+		def, _ := code.Lookup(byte(ins.op))
+		outOfRange := func(kind string, index int) *exception.SharkError {
+			return newSharkError(unit, ins.offset, exception.SharkErrorOperandOutOfRange, kind, index, def.Name, unit.location(ins.offset))
+		}
+
+		// A superinstruction refers to what the instructions it stands for refer to
+		for _, part := range code.Expand(code.Instruction{Op: ins.op, Operands: ins.operands}) {
+			switch part.Op {
+			case code.OpConstant:
+				if part.Operands[0] >= len(constants) {
+					return outOfRange("constant", part.Operands[0])
+				}
+			case code.OpClosure:
+				if part.Operands[0] >= len(constants) {
+					return outOfRange("constant", part.Operands[0])
+				}
+				if _, ok := constants[part.Operands[0]].(*object.CompiledFunction); !ok {
+					return outOfRange("function", part.Operands[0])
+				}
+			case code.OpGetGlobal, code.OpSetGlobal, code.OpIncrementGlobal, code.OpDecrementGlobal:
+				if part.Operands[0] >= conf.GlobalsSize {
+					return outOfRange("global", part.Operands[0])
+				}
+			case code.OpGetLocal, code.OpSetLocal, code.OpIncrementLocal, code.OpDecrementLocal, code.OpSetLocalDefault:
+				if part.Operands[0] >= unit.numLocals {
+					return outOfRange("local", part.Operands[0])
+				}
+			case code.OpGetBuiltin:
+				if part.Operands[0] >= len(object.Builtins) {
+					return outOfRange("builtin", part.Operands[0])
+				}
+			case code.OpGetFree:
+				// Functions that are never closed over cannot run, so their free variables are not checked
+				if unit.numFree >= 0 && part.Operands[0] >= unit.numFree {
+					return outOfRange("free variable", part.Operands[0])
+				}
+			case code.OpHash:
+				if part.Operands[0]%2 != 0 {
+					return outOfRange("hash element count", part.Operands[0])
+				}
+			case code.OpReturn, code.OpReturnValue, code.OpTailCall:
+				if unit.isMain() {
+					return newSharkError(unit, ins.offset, exception.SharkErrorTopLeverReturn)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Follows every path through the instructions of a unit and checks that the stack never
+// underflows and that its depth is the same whichever path reaches an instruction.
+func verifyStack(unit *verifyUnit, instructions []verifiedInstruction) *exception.SharkError {
+	if len(instructions) == 0 {
+		if !unit.isMain() {
+			return newSharkError(unit, 0, exception.SharkErrorMissingReturn, unit.location(0))
+		}
+		return nil
+	}
+
+	indexOf := make(map[int]int, len(instructions))
+	for i, ins := range instructions {
+		indexOf[ins.offset] = i
+	}
+
+	depths := make([]int, len(instructions))
+	for i := range depths {
+		depths[i] = -1
+	}
+	depths[0] = 0
+	worklist := []int{0}
+
+	// Records the depth at the instruction starting at target, queuing it the first time it is reached
+	reach := func(from verifiedInstruction, target, depth int) *exception.SharkError {
+		if target == len(unit.ins) {
+			if !unit.isMain() {
+				return newSharkError(unit, from.offset, exception.SharkErrorMissingReturn, unit.location(from.offset))
+			}
+			return nil
+		}
+		i, ok := indexOf[target]
+		if !ok {
+			def, _ := code.Lookup(byte(from.op))
+			return newSharkError(unit, from.offset, exception.SharkErrorInvalidJumpTarget, target, def.Name, unit.location(from.offset))
+		}
+		if depths[i] < 0 {
+			depths[i] = depth
+			worklist = append(worklist, i)
+		} else if depths[i] != depth {
+			return newSharkError(unit, target, exception.SharkErrorStackDepthMismatch, depths[i], depth, unit.location(target))
+		}
+		return nil
+	}
+
+	for len(worklist) > 0 {
+		i := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		ins := instructions[i]
+		depth := depths[i]
+
+		pops, pushes := code.StackEffect(ins.op, ins.operands)
+		if pops > depth {
+			def, _ := code.Lookup(byte(ins.op))
+			return newSharkError(unit, ins.offset, exception.SharkErrorStackUnderflow, def.Name, pops, depth, unit.location(ins.offset))
+		}
+		depth = depth - pops + pushes
+
+		switch ins.op {
+		case code.OpReturn, code.OpReturnValue, code.OpTailCall:
+			continue
+		case code.OpJump:
+			if err := reach(ins, ins.operands[0], depth); err != nil {
+				return err
+			}
+			continue
+		}
+		if code.IsConditionalJump(ins.op) {
+			if err := reach(ins, ins.operands[len(ins.operands)-1], depth); err != nil {
+				return err
+			}
+		}
+
+		if err := reach(ins, ins.next, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newSharkError(unit *verifyUnit, offset int, code exception.SharkErrorCode, param ...interface{}) *exception.SharkError {
+	err := exception.NewSharkError(exception.SharkErrorTypeBytecode, code, param...)
+	err.SetHelpMsg("The bytecode is corrupted or was not produced by a compatible compiler")
+
+	if pos, ok := unit.sourceMap.PositionAt(offset); ok {
+		err.AddCause(exception.NewSharkErrorCause("compiled from here", pos))
+	}
+
+	return err
+}
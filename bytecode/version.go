@@ -1,16 +1,113 @@
 package bytecode
 
+import (
+	"fmt"
+	"shark/code"
+	"shark/object"
+)
+
 type Version byte
 
 const (
+	// Gob encoded bytecode. It does not keep the defaults, types or debug information of functions.
 	BcVersionOnos1 Version = iota
+	// Sectioned binary format, see doc.go.
+	BcVersionOnos2
+	// Same format as BcVersionOnos2, the instructions can also use OpTailCall, OpWide,
+	// OpLessThan, OpLessThanEqual and the superinstructions.
+	BcVersionOnos3
+	// Same format as BcVersionOnos3, the constants and types can also be chars.
+	BcVersionOnos4
+	// Same format as BcVersionOnos4, the instructions can also use OpConcat.
+	BcVersionOnos5
 )
 
+// The version used when writing new object files.
+const BcVersionLatest = BcVersionOnos5
+
+// The opcodes added after the first version, with the version that added them. The others can
+// be used by every version.
+var opcodeVersions = map[code.Opcode]Version{
+	// Added to onos2 without a new version, older onos2 readers do not have them
+	code.OpTailCall:                 BcVersionOnos3,
+	code.OpWide:                     BcVersionOnos3,
+	code.OpLessThan:                 BcVersionOnos3,
+	code.OpLessThanEqual:            BcVersionOnos3,
+	code.OpGetLocal0:                BcVersionOnos3,
+	code.OpGetLocal1:                BcVersionOnos3,
+	code.OpGetLocal2:                BcVersionOnos3,
+	code.OpGetLocal3:                BcVersionOnos3,
+	code.OpAddLocalConst:            BcVersionOnos3,
+	code.OpSubLocalConst:            BcVersionOnos3,
+	code.OpJumpIfLocalNotLess:       BcVersionOnos3,
+	code.OpJumpIfLocalNotGreater:    BcVersionOnos3,
+	code.OpJumpIfLocalNotEqualConst: BcVersionOnos3,
+	code.OpConcat:                   BcVersionOnos5,
+}
+
 func (v *Version) String() string {
 	switch *v {
 	case BcVersionOnos1:
 		return "onos1"
+	case BcVersionOnos2:
+		return "onos2"
+	case BcVersionOnos3:
+		return "onos3"
+	case BcVersionOnos4:
+		return "onos4"
+	case BcVersionOnos5:
+		return "onos5"
 	default:
 		return "unknown"
 	}
 }
+
+func (v Version) isKnown() bool {
+	return v <= BcVersionLatest
+}
+
+// Returns an error when the instructions of the bytecode use an opcode the version does not
+// have. Instructions that cannot be decoded are left to Verify.
+func (v Version) checkOpcodes(b *Bytecode) error {
+	check := func(name string, ins code.Instructions) error {
+		for offset := 0; offset < len(ins); {
+			in, err := code.ReadInstruction(ins[offset:])
+			if err != nil {
+				return nil
+			}
+			ops := []code.Opcode{in.Op}
+			if in.Wide {
+				ops = append(ops, code.OpWide)
+			}
+			for _, op := range ops {
+				if needed, ok := opcodeVersions[op]; ok && needed > v {
+					def, _ := code.Lookup(byte(op))
+					return fmt.Errorf("%s: offset %d: %s needs bytecode version %s, not %s", name, offset, def.Name, needed.String(), v.String())
+				}
+			}
+			offset += in.Size
+		}
+		return nil
+	}
+
+	if err := check("main", b.Instructions); err != nil {
+		return err
+	}
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			if err := check(fmt.Sprintf("function %d", i), fn.Instructions); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns an error when the version has no chars, the constants and types that are chars are
+// described by what.
+func (v Version) checkChars(what string) error {
+	if needed := BcVersionOnos4; v < needed {
+		return fmt.Errorf("%s needs bytecode version %s, not %s", what, needed.String(), v.String())
+	}
+	return nil
+}
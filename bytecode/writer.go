@@ -0,0 +1,346 @@
+package bytecode
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"shark/code"
+	"shark/object"
+	"shark/types"
+)
+
+type sectionID byte
+
+const (
+	sectionHeader sectionID = iota + 1
+	sectionCode
+	sectionFunctions
+	sectionConstants
+	sectionDebug
+	sectionSignature
+	sectionMetadata
+)
+
+// Flags of a function in the metadata section.
+const (
+	functionPure     = 1 << 0
+	functionMemoMask = 3 << 1
+)
+
+type constantTag byte
+
+const (
+	constantNull constantTag = iota
+	constantI64
+	constantBool
+	constantString
+	constantArray
+	constantTuple
+	constantFunction
+	constantChar
+)
+
+type typeTag byte
+
+const (
+	typeNone typeTag = iota
+	typeAny
+	typeI64
+	typeBool
+	typeString
+	typeNull
+	typeError
+	typeArray
+	typeHashMap
+	typeTuple
+	typeFunc
+	typeOptional
+	typeSpread
+	typeClosure
+	typeCollection
+	typeVariadic
+	typeAlias
+	typeChar
+)
+
+// EncodeOptions controls what is written to an object file besides the program itself.
+type EncodeOptions struct {
+	// Signs the object file with the Ed25519 key. Takes precedence over Checksum.
+	SigningKey ed25519.PrivateKey
+	// Leaves out the debug section.
+	StripDebug bool
+	// Appends a SHA-256 digest of the object file.
+	Checksum bool
+}
+
+type objWriter struct {
+	buf []byte
+	// The version of the object file, chars can only be written from BcVersionOnos4 on.
+	version Version
+}
+
+func (w *objWriter) byte(b byte) { w.buf = append(w.buf, b) }
+
+func (w *objWriter) uvarint(v int) { w.buf = binary.AppendUvarint(w.buf, uint64(v)) }
+
+func (w *objWriter) varint(v int64) { w.buf = binary.AppendVarint(w.buf, v) }
+
+func (w *objWriter) bytes(b []byte) {
+	w.uvarint(len(b))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *objWriter) string(s string) {
+	w.uvarint(len(s))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *objWriter) strings(s []string) {
+	w.uvarint(len(s))
+	for _, str := range s {
+		w.string(str)
+	}
+}
+
+func (w *objWriter) section(id sectionID, body []byte) {
+	w.byte(byte(id))
+	w.bytes(body)
+}
+
+func (w *objWriter) sourceMap(sm code.SourceMap) {
+	w.uvarint(len(sm))
+	for _, m := range sm {
+		w.uvarint(m.Offset)
+		w.varint(int64(m.Pos.Line))
+		w.varint(int64(m.Pos.LineTo))
+		w.varint(int64(m.Pos.ColFrom))
+		w.varint(int64(m.Pos.ColTo))
+	}
+}
+
+func (w *objWriter) typeList(list []types.ISharkType) error {
+	if list == nil {
+		w.uvarint(0)
+		return nil
+	}
+	w.uvarint(len(list) + 1)
+	for _, t := range list {
+		if err := w.sharkType(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *objWriter) sharkType(sharkType types.ISharkType) error {
+	switch t := sharkType.(type) {
+	case nil:
+		w.byte(byte(typeNone))
+	case types.TSharkAny:
+		w.byte(byte(typeAny))
+	case types.TSharkI64:
+		w.byte(byte(typeI64))
+	case types.TSharkBool:
+		w.byte(byte(typeBool))
+	case types.TSharkString:
+		w.byte(byte(typeString))
+	case types.TSharkChar:
+		if err := w.version.checkChars("the char type"); err != nil {
+			return err
+		}
+		w.byte(byte(typeChar))
+	case types.TSharkNull:
+		w.byte(byte(typeNull))
+	case types.TSharkError:
+		w.byte(byte(typeError))
+	case types.TSharkArray:
+		w.byte(byte(typeArray))
+		return w.sharkType(t.Collection)
+	case types.TSharkHashMap:
+		w.byte(byte(typeHashMap))
+		if err := w.sharkType(t.Indexes); err != nil {
+			return err
+		}
+		return w.sharkType(t.Collects)
+	case types.TSharkTuple:
+		w.byte(byte(typeTuple))
+		return w.typeList(t.Collection)
+	case types.TSharkFuncType:
+		w.byte(byte(typeFunc))
+		if err := w.typeList(t.ArgsList); err != nil {
+			return err
+		}
+		return w.sharkType(t.ReturnT)
+	case *types.TSharkFuncType:
+		return w.sharkType(*t)
+	case types.TSharkOptional:
+		w.byte(byte(typeOptional))
+		return w.sharkType(t.Type)
+	case types.TSharkSpread:
+		w.byte(byte(typeSpread))
+		return w.sharkType(t.Type)
+	case types.TSharkClosure:
+		w.byte(byte(typeClosure))
+		return w.sharkType(t.FuncType)
+	case types.TSharkCollection:
+		w.byte(byte(typeCollection))
+		return w.typeList(t.Collection)
+	case types.TSharkVariadic:
+		w.byte(byte(typeVariadic))
+		return w.sharkType(t.Enclosed)
+	case types.TSharkAlias:
+		w.byte(byte(typeAlias))
+		w.string(t.Name)
+		return w.sharkType(t.Type)
+	default:
+		return fmt.Errorf("cannot encode type %T", sharkType)
+	}
+	return nil
+}
+
+func (w *objWriter) constant(obj object.Object, functions map[*object.CompiledFunction]int) error {
+	switch obj := obj.(type) {
+	case *object.Null:
+		w.byte(byte(constantNull))
+	case *object.Int64:
+		w.byte(byte(constantI64))
+		w.varint(obj.Value)
+	case *object.Boolean:
+		w.byte(byte(constantBool))
+		if obj.Value {
+			w.byte(1)
+		} else {
+			w.byte(0)
+		}
+	case *object.String:
+		w.byte(byte(constantString))
+		w.string(obj.Value)
+	case *object.Char:
+		if err := w.version.checkChars(fmt.Sprintf("the char constant %q", obj.Value)); err != nil {
+			return err
+		}
+		w.byte(byte(constantChar))
+		w.uvarint(int(obj.Value))
+	case *object.Array:
+		w.byte(byte(constantArray))
+		return w.constants(obj.Elements, functions)
+	case *object.Tuple:
+		w.byte(byte(constantTuple))
+		return w.constants(obj.Elements, functions)
+	case *object.CompiledFunction:
+		w.byte(byte(constantFunction))
+		w.uvarint(functions[obj])
+	default:
+		return fmt.Errorf("cannot encode constant of type %T", obj)
+	}
+	return nil
+}
+
+func (w *objWriter) constants(objs []object.Object, functions map[*object.CompiledFunction]int) error {
+	w.uvarint(len(objs))
+	for _, obj := range objs {
+		if err := w.constant(obj, functions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Collects the compiled functions of the constant pool in the order they appear.
+func collectFunctions(objs []object.Object, functions []*object.CompiledFunction, indexes map[*object.CompiledFunction]int) []*object.CompiledFunction {
+	for _, obj := range objs {
+		switch obj := obj.(type) {
+		case *object.CompiledFunction:
+			if _, ok := indexes[obj]; !ok {
+				indexes[obj] = len(functions)
+				functions = append(functions, obj)
+			}
+		case *object.Array:
+			functions = collectFunctions(obj.Elements, functions, indexes)
+		case *object.Tuple:
+			functions = collectFunctions(obj.Elements, functions, indexes)
+		}
+	}
+	return functions
+}
+
+// Encodes the bytecode into the sections of a BcVersionOnos2 payload, or of a later version with
+// the same format.
+func encodeOnos2(b *Bytecode, version Version, options EncodeOptions) ([]byte, error) {
+	indexes := make(map[*object.CompiledFunction]int)
+	functions := collectFunctions(b.Constants, nil, indexes)
+
+	out := &objWriter{}
+
+	header := &objWriter{}
+	header.uvarint(len(functions))
+	header.uvarint(len(b.Constants))
+	out.section(sectionHeader, header.buf)
+
+	out.section(sectionCode, b.Instructions)
+
+	fns := &objWriter{version: version}
+	fns.uvarint(len(functions))
+	for _, fn := range functions {
+		fns.uvarint(fn.NumLocals)
+		fns.uvarint(fn.NumParameters)
+		fns.uvarint(fn.NumDefaults)
+		if err := fns.sharkType(fn.ObjType); err != nil {
+			return nil, err
+		}
+		fns.bytes(fn.Instructions)
+	}
+	out.section(sectionFunctions, fns.buf)
+
+	consts := &objWriter{version: version}
+	if err := consts.constants(b.Constants, indexes); err != nil {
+		return nil, err
+	}
+	out.section(sectionConstants, consts.buf)
+
+	metadata := &objWriter{}
+	metadata.uvarint(len(functions))
+	for _, fn := range functions {
+		var flags byte
+		if fn.Pure {
+			flags |= functionPure
+		}
+		flags |= byte(fn.Memo) << 1 & functionMemoMask
+		metadata.byte(flags)
+	}
+	out.section(sectionMetadata, metadata.buf)
+
+	if !options.StripDebug {
+		debug := &objWriter{}
+		debug.string(b.SourceName)
+		debug.sourceMap(b.SourceMap)
+		debug.strings(b.GlobalNames)
+		for _, fn := range functions {
+			debug.string(fn.Name)
+			debug.strings(fn.LocalNames)
+			debug.sourceMap(fn.SourceMap)
+		}
+		out.section(sectionDebug, debug.buf)
+	}
+
+	switch {
+	case options.SigningKey != nil:
+		if len(options.SigningKey) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid ed25519 private key size: %d", len(options.SigningKey))
+		}
+		signature := &objWriter{}
+		signature.byte(byte(SigEd25519))
+		signature.buf = append(signature.buf, options.SigningKey.Public().(ed25519.PublicKey)...)
+		signature.buf = append(signature.buf, ed25519.Sign(options.SigningKey, out.buf)...)
+		out.section(sectionSignature, signature.buf)
+	case options.Checksum:
+		digest := sha256.Sum256(out.buf)
+		signature := &objWriter{}
+		signature.byte(byte(SigSHA256))
+		signature.buf = append(signature.buf, digest[:]...)
+		out.section(sectionSignature, signature.buf)
+	}
+
+	return out.buf, nil
+}
@@ -0,0 +1,215 @@
+// Package cfg splits the instructions of the main program and of the compiled functions into
+// basic blocks, and writes them as an annotated listing or as Graphviz DOT graphs.
+package cfg
+
+import (
+	"fmt"
+	"shark/bytecode"
+	"shark/code"
+	"shark/object"
+	"sort"
+)
+
+// Graph is the control-flow graph of the main program or of a compiled function.
+type Graph struct {
+	Name string
+	// The index of the function in the constant pool, -1 for the main program.
+	Constant int
+	Fn       *object.CompiledFunction
+	Blocks   []*Block
+}
+
+// Block is a basic block, a run of instructions only entered at its first one and only left
+// after its last one.
+type Block struct {
+	Index        int
+	Instructions []Instruction
+	// The indexes of the blocks run after this one, the fall through first.
+	Succs []int
+	Preds []int
+	// Whether the block ends by jumping past the last instruction, out of the main program.
+	Exits bool
+}
+
+// Instruction is an instruction with the depth of the stack before it runs, -1 when it is
+// never reached.
+type Instruction struct {
+	Offset   int
+	Op       code.Opcode
+	Def      *code.Definition
+	Operands []int
+	// Whether it is prefixed by OpWide.
+	Wide  bool
+	Depth int
+}
+
+// Target returns the offset a jump jumps to, its last operand.
+func (in Instruction) Target() int {
+	return in.Operands[len(in.Operands)-1]
+}
+
+// Label returns the name of the block in listings and graphs.
+func (b *Block) Label() string {
+	return fmt.Sprintf("B%d", b.Index)
+}
+
+// Start returns the offset of the first instruction of the block.
+func (b *Block) Start() int {
+	return b.Instructions[0].Offset
+}
+
+// Last returns the instruction that ends the block.
+func (b *Block) Last() Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// Functions returns the graphs of the main program and of the compiled functions of the
+// constant pool, in the order of the pool.
+func Functions(bc *bytecode.Bytecode) ([]*Graph, error) {
+	main, err := Build("main", bc.Instructions)
+	if err != nil {
+		return nil, fmt.Errorf("main: %w", err)
+	}
+	main.Constant = -1
+	graphs := []*Graph{main}
+
+	for i, constant := range bc.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		g, err := Build(fn.DisplayName(), fn.Instructions)
+		if err != nil {
+			return nil, fmt.Errorf("function %d: %w", i, err)
+		}
+		g.Constant = i
+		g.Fn = fn
+		graphs = append(graphs, g)
+	}
+	return graphs, nil
+}
+
+// Build splits instructions into basic blocks. A block starts at the first instruction, at
+// each jump target and after each jump or return.
+func Build(name string, ins code.Instructions) (*Graph, error) {
+	var instructions []Instruction
+	for offset := 0; offset < len(ins); {
+		in, err := code.ReadInstruction(ins[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %w", offset, err)
+		}
+		def, _ := code.Lookup(byte(in.Op))
+		instructions = append(instructions, Instruction{
+			Offset:   offset,
+			Op:       in.Op,
+			Def:      def,
+			Operands: in.Operands,
+			Wide:     in.Wide,
+			Depth:    -1,
+		})
+		offset += in.Size
+	}
+
+	g := &Graph{Name: name}
+	if len(instructions) == 0 {
+		return g, nil
+	}
+
+	isInstruction := make(map[int]bool, len(instructions))
+	for _, in := range instructions {
+		isInstruction[in.Offset] = true
+	}
+	leaders := map[int]bool{0: true}
+	for i, in := range instructions {
+		if code.IsJump(in.Op) {
+			if !isInstruction[in.Target()] && in.Target() != len(ins) {
+				return nil, fmt.Errorf("offset %d: %s jumps to %d, which is not an instruction", in.Offset, in.Def.Name, in.Target())
+			}
+			leaders[in.Target()] = true
+		}
+		if (code.IsJump(in.Op) || endsFunction(in.Op)) && i+1 < len(instructions) {
+			leaders[instructions[i+1].Offset] = true
+		}
+	}
+
+	blockAt := make(map[int]int)
+	for _, in := range instructions {
+		if leaders[in.Offset] {
+			blockAt[in.Offset] = len(g.Blocks)
+			g.Blocks = append(g.Blocks, &Block{Index: len(g.Blocks)})
+		}
+		b := g.Blocks[len(g.Blocks)-1]
+		b.Instructions = append(b.Instructions, in)
+	}
+
+	link := func(from *Block, target int) {
+		to, ok := blockAt[target]
+		if !ok {
+			from.Exits = true
+			return
+		}
+		for _, succ := range from.Succs {
+			if succ == to {
+				return
+			}
+		}
+		from.Succs = append(from.Succs, to)
+		g.Blocks[to].Preds = append(g.Blocks[to].Preds, from.Index)
+	}
+	for i, b := range g.Blocks {
+		last := b.Last()
+		if endsFunction(last.Op) {
+			continue
+		}
+		if last.Op != code.OpJump {
+			if i+1 < len(g.Blocks) {
+				link(b, g.Blocks[i+1].Start())
+			} else {
+				b.Exits = true
+			}
+		}
+		if code.IsJump(last.Op) {
+			link(b, last.Target())
+		}
+	}
+	for _, b := range g.Blocks {
+		sort.Ints(b.Preds)
+	}
+
+	g.computeDepths()
+	return g, nil
+}
+
+// Follows the edges from the first block to find the depth of the stack before each
+// instruction. The compiler leaves the same depth on every path, when it is not the case the
+// depth of the first path is kept.
+func (g *Graph) computeDepths() {
+	visited := make([]bool, len(g.Blocks))
+	visited[0] = true
+	depths := map[int]int{0: 0}
+	worklist := []int{0}
+
+	for len(worklist) > 0 {
+		b := g.Blocks[worklist[0]]
+		worklist = worklist[1:]
+
+		depth := depths[b.Index]
+		for i := range b.Instructions {
+			in := &b.Instructions[i]
+			in.Depth = depth
+			pops, pushes := code.StackEffect(in.Op, in.Operands)
+			depth = max(depth-pops, 0) + pushes
+		}
+		for _, succ := range b.Succs {
+			if !visited[succ] {
+				visited[succ] = true
+				depths[succ] = depth
+				worklist = append(worklist, succ)
+			}
+		}
+	}
+}
+
+func endsFunction(op code.Opcode) bool {
+	return op == code.OpReturn || op == code.OpReturnValue || op == code.OpTailCall
+}
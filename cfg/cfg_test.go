@@ -0,0 +1,199 @@
+package cfg
+
+import (
+	"shark/bytecode"
+	"shark/code"
+	"shark/compiler"
+	"shark/lexer"
+	"shark/parser"
+	"strings"
+	"testing"
+)
+
+const input = `let classify = (n: i64): string => {
+	if (n > 10) {
+		"big"
+	} else {
+		"small"
+	}
+};
+let mut i = 0;
+while (i < 3) {
+	puts(classify(i));
+	i++;
+}`
+
+func TestBuild(t *testing.T) {
+	graphs, err := Functions(compile(t, input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graphs) != 2 {
+		t.Fatalf("expected the graphs of main and classify, got %d", len(graphs))
+	}
+
+	tests := []struct {
+		graph  *Graph
+		starts []int
+		succs  [][]int
+		preds  [][]int
+	}{
+		{
+			graph:  graphs[0],
+			starts: []int{0, 13, 23},
+			succs:  [][]int{{1}, {2}, {1}},
+			preds:  [][]int{nil, {0, 2}, {1}},
+		},
+		{
+			graph:  graphs[1],
+			starts: []int{0, 9, 15, 18},
+			succs:  [][]int{{1, 2}, {3}, {3}, nil},
+			preds:  [][]int{nil, {0}, {0}, {1, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		g := tt.graph
+		if len(g.Blocks) != len(tt.starts) {
+			t.Fatalf("%s: expected %d blocks, got %d", g.Name, len(tt.starts), len(g.Blocks))
+		}
+		for i, b := range g.Blocks {
+			if b.Start() != tt.starts[i] {
+				t.Errorf("%s: block %d: expected to start at %d, got %d", g.Name, i, tt.starts[i], b.Start())
+			}
+			if !equal(b.Succs, tt.succs[i]) {
+				t.Errorf("%s: block %d: expected successors %v, got %v", g.Name, i, tt.succs[i], b.Succs)
+			}
+			if !equal(b.Preds, tt.preds[i]) {
+				t.Errorf("%s: block %d: expected predecessors %v, got %v", g.Name, i, tt.preds[i], b.Preds)
+			}
+		}
+	}
+
+	// The loop condition jumps out of main
+	if !graphs[0].Blocks[1].Exits {
+		t.Errorf("expected the loop condition to exit main")
+	}
+
+	// Both branches of the condition leave the result on the stack
+	if depth := graphs[1].Blocks[3].Instructions[0].Depth; depth != 1 {
+		t.Errorf("expected a stack depth of 1 at the return, got %d", depth)
+	}
+}
+
+func TestStackDepth(t *testing.T) {
+	ins := concat(
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpAdd),
+		code.Make(code.OpJump, 12),
+		// Never reached
+		code.Make(code.OpNull),
+		code.Make(code.OpPop),
+		code.Make(code.OpPop),
+	)
+	g, err := Build("main", ins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var depths []int
+	for _, b := range g.Blocks {
+		for _, in := range b.Instructions {
+			depths = append(depths, in.Depth)
+		}
+	}
+	expected := []int{0, 1, 2, 1, -1, -1, 1}
+	if !equal(depths, expected) {
+		t.Errorf("expected depths %v, got %v", expected, depths)
+	}
+
+	if _, err := Build("main", code.Make(code.OpJump, 1)); err == nil {
+		t.Errorf("expected an error for a jump into an instruction")
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	var out strings.Builder
+	if err := WriteListing(&out, compile(t, input)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"@main:\n| B0:\n|     0000 [0] OpClosure 3 0           ; classify\n|     0004 [1] OpSetGlobal 0           ; classify\n",
+		"| B1:                                  ; from B0, B2\n",
+		"|     0020 [1] OpJumpNotTruthy 46      ; -> exit\n",
+		"|     0023 [0] OpGetBuiltin 1          ; puts\n",
+		"|     0043 [0] OpJump 13               ; -> B1\n",
+		"@function 0003 classify params=1 locals=1 pure:\n",
+		"|     0000 [0] OpGetLocal 0            ; n\n",
+		"|     0009 [0] OpConstant 1            ; \"big\"\n",
+		"| B3:                                  ; from B1, B2\n|     0018 [1] OpReturnValue\n",
+		"@constants:\n| 0000 i64: 10\n| 0001 string: \"big\"\n| 0002 string: \"small\"\n| 0003 FUNC classify\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the listing to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var out strings.Builder
+	if err := WriteDOT(&out, compile(t, input)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"digraph bytecode {\n",
+		"\tsubgraph cluster_main {\n\t\tlabel=\"main\";\n",
+		"\t\tmain_B1 -> main_B2 [label=\"true\"];\n\t\tmain_B1 -> main_exit [label=\"false\"];\n\t\tmain_B2 -> main_B1;\n",
+		"\t\tmain_exit [label=\"exit\" shape=oval];\n",
+		"\tsubgraph cluster_f3 {\n\t\tlabel=\"classify (constant 3)\";\n",
+		"\t\tf3_B1 [label=\"B1\\l0009 [0] OpConstant 1            ; \\\"big\\\"\\l0012 [1] OpJump 18               ; -> B3\\l\"];\n",
+		"\t\tf3_B0 -> f3_B1 [label=\"true\"];\n\t\tf3_B0 -> f3_B2 [label=\"false\"];\n\t\tf3_B1 -> f3_B3;\n\t\tf3_B2 -> f3_B3;\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the graph to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "f3_exit") {
+		t.Errorf("expected classify to only leave by returning")
+	}
+}
+
+func compile(t *testing.T, input string) *bytecode.Bytecode {
+	t.Helper()
+
+	l := lexer.New(&input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %+v", p.Errors())
+	}
+
+	comp := compiler.New()
+	if err, _ := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %+v", err)
+	}
+	return comp.Bytecode()
+}
+
+func concat(parts ...[]byte) code.Instructions {
+	var ins code.Instructions
+	for _, part := range parts {
+		ins = append(ins, part...)
+	}
+	return ins
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
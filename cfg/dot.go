@@ -0,0 +1,140 @@
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"shark/bytecode"
+	"shark/code"
+	"strings"
+)
+
+// WriteDOT writes the graphs of the main program and of the compiled functions as a Graphviz
+// DOT digraph, with a cluster for each of them. A node is a basic block with its annotated
+// instructions, the edges of a conditional jump are labelled with the outcome of the condition.
+func WriteDOT(w io.Writer, bc *bytecode.Bytecode) error {
+	graphs, err := Functions(bc)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph bytecode {\n")
+	fmt.Fprintf(bw, "\tnode [shape=box fontname=\"monospace\"];\n")
+
+	for _, g := range graphs {
+		prefix := "main"
+		title := "main"
+		if g.Constant >= 0 {
+			prefix = fmt.Sprintf("f%d", g.Constant)
+			title = fmt.Sprintf("%s (constant %d)", g.Name, g.Constant)
+		}
+
+		fmt.Fprintf(bw, "\n\tsubgraph cluster_%s {\n", prefix)
+		fmt.Fprintf(bw, "\t\tlabel=%s;\n", quote(title))
+
+		var lines []string
+		block := -1
+		for _, line := range g.lines(bc) {
+			// The lines of a block follow its label, which is not indented
+			if !strings.HasPrefix(line, indent) {
+				if block >= 0 {
+					writeNode(bw, prefix, g.Blocks[block], lines)
+				}
+				block++
+				lines = nil
+			}
+			lines = append(lines, strings.TrimPrefix(line, indent))
+		}
+		if block >= 0 {
+			writeNode(bw, prefix, g.Blocks[block], lines)
+		}
+
+		exit := false
+		for _, b := range g.Blocks {
+			for _, e := range g.edges(b) {
+				to := prefix + "_exit"
+				if e.to >= 0 {
+					to = prefix + "_" + g.Blocks[e.to].Label()
+				} else {
+					exit = true
+				}
+				attrs := ""
+				if e.label != "" {
+					attrs = fmt.Sprintf(" [label=%s]", quote(e.label))
+				}
+				fmt.Fprintf(bw, "\t\t%s_%s -> %s%s;\n", prefix, b.Label(), to, attrs)
+			}
+		}
+		if exit {
+			fmt.Fprintf(bw, "\t\t%s_exit [label=\"exit\" shape=oval];\n", prefix)
+		}
+		fmt.Fprintf(bw, "\t}\n")
+	}
+
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+type edge struct {
+	// The index of the block, -1 for the exit
+	to    int
+	label string
+}
+
+// Returns the edges leaving a block. The edges of a conditional jump are labelled with the
+// outcome of the condition, unless both go to the same block.
+func (g *Graph) edges(b *Block) []edge {
+	last := b.Last()
+	if endsFunction(last.Op) {
+		return nil
+	}
+
+	blockAt := func(offset int) int {
+		for _, other := range g.Blocks {
+			if other.Start() == offset {
+				return other.Index
+			}
+		}
+		return -1
+	}
+	next := -1
+	if b.Index+1 < len(g.Blocks) {
+		next = b.Index + 1
+	}
+
+	switch {
+	case last.Op == code.OpJump:
+		return []edge{{to: blockAt(last.Target())}}
+	case code.IsConditionalJump(last.Op):
+		target := blockAt(last.Target())
+		if target == next {
+			return []edge{{to: next}}
+		}
+		return []edge{{to: next, label: "true"}, {to: target, label: "false"}}
+	default:
+		return []edge{{to: next}}
+	}
+}
+
+// Writes the node of a block, titled with its label without the blocks it comes from, the
+// edges show them.
+func writeNode(w io.Writer, prefix string, b *Block, lines []string) {
+	var label strings.Builder
+	label.WriteString(b.Label() + `\l`)
+	for _, line := range lines[1:] {
+		// Left justified lines
+		label.WriteString(escape(line) + `\l`)
+	}
+	fmt.Fprintf(w, "\t\t%s_%s [label=\"%s\"];\n", prefix, b.Label(), label.String())
+}
+
+func quote(s string) string {
+	return `"` + escape(s) + `"`
+}
+
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\t", "    ")
+}
@@ -0,0 +1,171 @@
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"shark/bytecode"
+	"shark/code"
+	"shark/object"
+	"strings"
+)
+
+// The width the instructions are padded to before their annotation.
+const annotationColumn = 36
+
+// The indentation of the instructions under the label of their block.
+const indent = "    "
+
+// WriteListing writes the disassembly of the bytecode split into basic blocks. Each instruction
+// shows the depth of the stack before it, and is annotated with the constant, builtin, global,
+// local or block it refers to.
+func WriteListing(w io.Writer, bc *bytecode.Bytecode) error {
+	graphs, err := Functions(bc)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, g := range graphs {
+		if i == 0 {
+			fmt.Fprintf(bw, "@main:\n")
+		} else {
+			fmt.Fprintf(bw, "\n@function %04d %s params=%d locals=%d%s:\n", g.Constant, g.Name,
+				g.Fn.NumParameters, g.Fn.NumLocals, bytecode.FunctionFlags(g.Fn))
+		}
+		for _, line := range g.lines(bc) {
+			fmt.Fprintf(bw, "| %s\n", line)
+		}
+	}
+
+	fmt.Fprintf(bw, "\n@constants:\n")
+	for i, constant := range bc.Constants {
+		switch constant := constant.(type) {
+		case *object.CompiledFunction:
+			fmt.Fprintf(bw, "| %04d FUNC %s\n", i, constant.DisplayName())
+		default:
+			fmt.Fprintf(bw, "| %04d %s: %s\n", i, constant.Type().SharkTypeString(), value(constant))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Returns the lines of the listing of the graph, the block labels with the instructions of the
+// blocks.
+func (g *Graph) lines(bc *bytecode.Bytecode) []string {
+	var lines []string
+	for _, b := range g.Blocks {
+		label := b.Label() + ":"
+		if len(b.Preds) > 0 {
+			label = pad(label, annotationColumn) + " ; from " + g.labels(b.Preds)
+		}
+		lines = append(lines, label)
+
+		for _, in := range b.Instructions {
+			depth := "-"
+			if in.Depth >= 0 {
+				depth = fmt.Sprint(in.Depth)
+			}
+			text := fmt.Sprintf("%s%04d [%s] %s", indent, in.Offset, depth, formatInstruction(in))
+			if note := g.annotation(bc, in); note != "" {
+				text = pad(text, annotationColumn) + " ; " + note
+			}
+			lines = append(lines, text)
+		}
+	}
+	return lines
+}
+
+// Describes what an instruction refers to, empty when there is nothing to add to its operands.
+// A superinstruction refers to what the instructions it stands for refer to.
+func (g *Graph) annotation(bc *bytecode.Bytecode, in Instruction) string {
+	var notes []string
+	for _, part := range code.Expand(code.Instruction{Op: in.Op, Operands: in.Operands}) {
+		if note := g.annotate(bc, part); note != "" {
+			notes = append(notes, note)
+		}
+	}
+	return strings.Join(notes, ", ")
+}
+
+func (g *Graph) annotate(bc *bytecode.Bytecode, in code.Instruction) string {
+	operand := -1
+	if len(in.Operands) > 0 {
+		operand = in.Operands[0]
+	}
+
+	switch in.Op {
+	case code.OpConstant:
+		if operand < len(bc.Constants) {
+			return value(bc.Constants[operand])
+		}
+	case code.OpClosure:
+		if operand < len(bc.Constants) {
+			if fn, ok := bc.Constants[operand].(*object.CompiledFunction); ok {
+				return fn.DisplayName()
+			}
+		}
+	case code.OpGetBuiltin:
+		if operand < len(object.Builtins) {
+			return object.Builtins[operand].Name
+		}
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpIncrementGlobal, code.OpDecrementGlobal:
+		if operand < len(bc.GlobalNames) {
+			return bc.GlobalNames[operand]
+		}
+	case code.OpGetLocal, code.OpSetLocal, code.OpIncrementLocal, code.OpDecrementLocal, code.OpSetLocalDefault:
+		if g.Fn != nil && operand < len(g.Fn.LocalNames) {
+			return g.Fn.LocalNames[operand]
+		}
+	case code.OpJump, code.OpJumpNotTruthy:
+		for _, b := range g.Blocks {
+			if b.Start() == operand {
+				return "-> " + b.Label()
+			}
+		}
+		return "-> exit"
+	}
+	return ""
+}
+
+func (g *Graph) labels(indexes []int) string {
+	labels := make([]string, len(indexes))
+	for i, index := range indexes {
+		labels[i] = g.Blocks[index].Label()
+	}
+	return strings.Join(labels, ", ")
+}
+
+func formatInstruction(in Instruction) string {
+	text := in.Def.Name
+	if in.Wide {
+		text = "OpWide " + text
+	}
+	for _, operand := range in.Operands {
+		text += fmt.Sprintf(" %d", operand)
+	}
+	return text
+}
+
+// Writes a constant for the annotations, strings and chars are quoted.
+func value(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.String:
+		return fmt.Sprintf("%q", obj.Value)
+	case *object.Char:
+		return fmt.Sprintf("%q", obj.Value)
+	case *object.CompiledFunction:
+		return obj.DisplayName()
+	default:
+		return obj.Inspect()
+	}
+}
+
+// Pads s with spaces to width.
+func pad(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
@@ -19,6 +19,9 @@ func main() {
 	var compression string
 	var cnf string
 	var logLevel string
+	var signKey string
+	var stripDebug bool
+	var o0, o1, o2 bool
 	emitInstructionSet := false
 
 	flaggy.SetName("sharkc")
@@ -30,6 +33,11 @@ func main() {
 	flaggy.String(&outName, "o", "out", "The output file name")
 	flaggy.String(&compression, "z", "compression", "The compression algorithm to use (brotli, none)")
 	flaggy.Bool(&emitInstructionSet, "e", "emit", "Emit the instruction set")
+	flaggy.Bool(&stripDebug, "s", "strip", "Strip the debug information from the bytecode")
+	flaggy.Bool(&o0, "O0", "", "Do not optimize the bytecode (default)")
+	flaggy.Bool(&o1, "O1", "", "Fold constants and remove dead branches and unreachable code")
+	flaggy.Bool(&o2, "O2", "", "Also thread jumps, remove dead stores and use superinstructions")
+	flaggy.String(&signKey, "k", "sign", "Sign the bytecode with an Ed25519 private key (PEM encoded PKCS #8 file)")
 	flaggy.String(&cnf, "c", "config", "The configuration file")
 	flaggy.String(&logLevel, "l", "loglevel", "The log level (trace, debug, info, warn, error, fatal, panic)")
 
@@ -45,5 +53,5 @@ func main() {
 
 	serializer.RegisterTypes()
 
-	cmd.CompileSharkCodeFile(file, outName, compression, emitInstructionSet, argConfig)
+	cmd.CompileSharkCodeFile(file, outName, compression, signKey, emitInstructionSet, stripDebug, bin.OptimizationLevel(o1, o2), argConfig)
 }
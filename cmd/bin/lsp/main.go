@@ -15,6 +15,7 @@ var Codename string
 func main() {
 	var port int = 59027
 	var logLevel string
+	var stdio bool
 
 	flaggy.SetName("shark")
 	flaggy.SetDescription("The Shark programming language")
@@ -24,11 +25,12 @@ func main() {
 	flaggy.DefaultParser.AdditionalHelpPrepend = "Language server for the Shark programming language."
 
 	flaggy.Int(&port, "p", "port", "The port to listen on")
+	flaggy.Bool(&stdio, "", "stdio", "Communicate over stdin and stdout instead of a port")
 	flaggy.String(&logLevel, "l", "loglevel", "The log level (trace, debug, info, warn, error, fatal, panic)")
 
 	flaggy.Parse()
 
 	cmd.RegisterLogger(logLevel)
 
-	lsp.Start(port)
+	lsp.Start(port, stdio)
 }
@@ -0,0 +1,16 @@
+package bin
+
+import "shark/compiler"
+
+// Returns the optimization level selected by the -O1 and -O2 flags, the highest one wins if
+// both are given. Without either, like with -O0, the code is not optimized.
+func OptimizationLevel(o1, o2 bool) compiler.OptimizationLevel {
+	switch {
+	case o2:
+		return compiler.O2
+	case o1:
+		return compiler.O1
+	default:
+		return compiler.O0
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"shark/cmd/bin"
 	"shark/config"
 	"shark/serializer"
+	"time"
 
 	"github.com/integrii/flaggy"
 )
@@ -20,6 +21,17 @@ func main() {
 	var cnf string
 	var emitInstructionSet bool
 	var logLevel string
+	var signKey string
+	var stripDebug bool
+	var o0, o1, o2 bool
+	var write, check bool
+	var disassemble bool
+	var listing bool
+	var dotPath string
+	var timeout time.Duration
+	var junit string
+	var coveragePath string
+	var profilePath string
 
 	flaggy.SetName("shark")
 	flaggy.SetDescription("The Shark programming language")
@@ -35,6 +47,11 @@ func main() {
 	runCommand := flaggy.NewSubcommand("run")
 	runCommand.Description = "Interpret a SharkLang source code file"
 	runCommand.AddPositionalValue(&file, "file", 1, true, "The file to interpret")
+	runCommand.String(&coveragePath, "", "coverage", "Write the code coverage to this LCOV file, merged with the coverage already in it")
+	runCommand.String(&profilePath, "", "profile", "Profile the run and write the sampled stacks to this pprof file")
+	runCommand.Bool(&o0, "O0", "", "Do not optimize the bytecode (default)")
+	runCommand.Bool(&o1, "O1", "", "Fold constants and remove dead branches and unreachable code")
+	runCommand.Bool(&o2, "O2", "", "Also thread jumps, remove dead stores and use superinstructions")
 
 	compileCommand := flaggy.NewSubcommand("compile")
 	compileCommand.Description = "Compile a SharkLang source code file into bytecode"
@@ -42,6 +59,11 @@ func main() {
 	compileCommand.String(&outName, "o", "out", "The output file name")
 	compileCommand.String(&compression, "z", "compression", "The compression algorithm to use (brotli, none)")
 	compileCommand.Bool(&emitInstructionSet, "e", "emit", "Emit the instruction set")
+	compileCommand.Bool(&stripDebug, "s", "strip", "Strip the debug information from the bytecode")
+	compileCommand.Bool(&o0, "O0", "", "Do not optimize the bytecode (default)")
+	compileCommand.Bool(&o1, "O1", "", "Fold constants and remove dead branches and unreachable code")
+	compileCommand.Bool(&o2, "O2", "", "Also thread jumps, remove dead stores and use superinstructions")
+	compileCommand.String(&signKey, "k", "sign", "Sign the bytecode with an Ed25519 private key (PEM encoded PKCS #8 file)")
 
 	execCommand := flaggy.NewSubcommand("exec")
 	execCommand.Description = "Execute a SharkLang bytecode file"
@@ -50,11 +72,37 @@ func main() {
 	decompileCommand := flaggy.NewSubcommand("decompile")
 	decompileCommand.Description = "Decompiles a shark binary"
 	decompileCommand.AddPositionalValue(&file, "file", 1, true, "The bytecode file")
+	decompileCommand.String(&outName, "o", "out", "The output file name of the source (stdout by default)")
+	decompileCommand.Bool(&listing, "", "listing", "Print the annotated disassembly instead of the source")
+	decompileCommand.String(&dotPath, "", "dot", "Also write the control-flow graph of each function to this Graphviz DOT file")
+
+	asmCommand := flaggy.NewSubcommand("asm")
+	asmCommand.Description = "Assemble a Shark assembly file into bytecode, or disassemble a bytecode file"
+	asmCommand.AddPositionalValue(&file, "file", 1, true, "The assembly file, or the bytecode file with -d")
+	asmCommand.String(&outName, "o", "out", "The output file name (stdout when disassembling)")
+	asmCommand.Bool(&disassemble, "d", "disassemble", "Write the assembly of a bytecode file")
 
 	metaViewCommand := flaggy.NewSubcommand("meta")
 	metaViewCommand.Description = "View the metadata of a SharkLang bytecode file"
 	metaViewCommand.AddPositionalValue(&file, "file", 1, true, "The bytecode file")
 
+	fmtCommand := flaggy.NewSubcommand("fmt")
+	fmtCommand.Description = "Format a SharkLang source code file"
+	fmtCommand.AddPositionalValue(&file, "file", 1, true, "The file to format")
+	fmtCommand.Bool(&write, "w", "write", "Write the result to the file instead of stdout")
+	fmtCommand.Bool(&check, "", "check", "Exit with 1 if the file is not formatted")
+
+	lintCommand := flaggy.NewSubcommand("lint")
+	lintCommand.Description = "Report the likely mistakes in a SharkLang source code file"
+	lintCommand.AddPositionalValue(&file, "file", 1, true, "The file to lint")
+
+	timeout = 10 * time.Second
+	testCommand := flaggy.NewSubcommand("test")
+	testCommand.Description = "Run the tests of a SharkLang source code file, or of the '_test.shark' files in a directory"
+	testCommand.AddPositionalValue(&file, "path", 1, true, "The file or directory to test")
+	testCommand.Duration(&timeout, "t", "timeout", "The time a test can run before it fails (0 for no limit)")
+	testCommand.String(&junit, "", "junit", "Also write the results as a JUnit XML report to this file")
+
 	genConf := flaggy.NewSubcommand("genconf")
 	genConf.Description = "Generate a default configuration file to the current directory"
 
@@ -62,7 +110,11 @@ func main() {
 	flaggy.AttachSubcommand(compileCommand, 1)
 	flaggy.AttachSubcommand(execCommand, 1)
 	flaggy.AttachSubcommand(decompileCommand, 1)
+	flaggy.AttachSubcommand(asmCommand, 1)
 	flaggy.AttachSubcommand(metaViewCommand, 1)
+	flaggy.AttachSubcommand(fmtCommand, 1)
+	flaggy.AttachSubcommand(lintCommand, 1)
+	flaggy.AttachSubcommand(testCommand, 1)
 	flaggy.AttachSubcommand(genConf, 1)
 	flaggy.Parse()
 
@@ -78,13 +130,21 @@ func main() {
 	if execCommand.Used {
 		cmd.ExecuteSharkBinaryFile(file, argConfig)
 	} else if compileCommand.Used {
-		cmd.CompileSharkCodeFile(file, outName, compression, emitInstructionSet, argConfig)
+		cmd.CompileSharkCodeFile(file, outName, compression, signKey, emitInstructionSet, stripDebug, bin.OptimizationLevel(o1, o2), argConfig)
 	} else if runCommand.Used {
-		cmd.ExecuteSharkCodeFile(file, argConfig)
+		cmd.ExecuteSharkCodeFile(file, coveragePath, profilePath, bin.OptimizationLevel(o1, o2), argConfig)
 	} else if decompileCommand.Used {
-		cmd.DecompileSharkBinaryFile(file)
+		cmd.DecompileSharkBinaryFile(file, outName, dotPath, listing)
+	} else if asmCommand.Used {
+		cmd.AssembleSharkFile(file, outName, disassemble)
 	} else if metaViewCommand.Used {
 		cmd.ShowOjbMeta(file)
+	} else if fmtCommand.Used {
+		cmd.FormatSharkCodeFile(file, write, check)
+	} else if lintCommand.Used {
+		cmd.LintSharkCodeFile(file, argConfig)
+	} else if testCommand.Used {
+		cmd.TestSharkCode(file, timeout, junit, argConfig)
 	} else if genConf.Used {
 		cmd.GenerateDefaultConfig()
 	} else {
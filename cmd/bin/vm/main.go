@@ -3,6 +3,7 @@ package main
 import (
 	"shark/cmd"
 	"shark/cmd/bin"
+	"shark/compiler"
 	"shark/config"
 	"shark/serializer"
 
@@ -37,5 +38,5 @@ func main() {
 
 	serializer.RegisterTypes()
 
-	cmd.ExecuteSharkCodeFile(file, argConfig)
+	cmd.ExecuteSharkCodeFile(file, "", "", compiler.O0, argConfig)
 }
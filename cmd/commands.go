@@ -1,21 +1,37 @@
 package cmd
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"shark/asm"
 	"shark/bytecode"
+	"shark/cfg"
+	"shark/compiler"
 	"shark/config"
+	"shark/coverage"
+	"shark/decompile"
 	"shark/emitter"
 	"shark/exception"
+	"shark/format"
 	"shark/internal"
+	"shark/lint"
+	"shark/profile"
+	"shark/tester"
+	"shark/vm"
+	"time"
 
 	"github.com/phuslu/log"
 )
 
-func ExecuteSharkCodeFile(path string, argConfig *config.Config) {
+func ExecuteSharkCodeFile(path, coveragePath, profilePath string, optimizationLevel compiler.OptimizationLevel, argConfig *config.Config) {
 	log.Debug().Msg("Executing Shark code file")
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -29,10 +45,90 @@ func ExecuteSharkCodeFile(path string, argConfig *config.Config) {
 		exception.PrintExitMsgCtx(fmt.Sprintf("Could not read file '%s'", path), err.Error(), 1)
 	}
 	sharkEmitter := emitter.New(&absPath, os.Stdout, &argConfig.NidumVM)
+	sharkEmitter.SetOptimizationLevel(optimizationLevel)
+
+	var cov *vm.Coverage
+	if coveragePath != "" {
+		cov = vm.NewCoverage()
+		sharkEmitter.SetCoverage(cov)
+	}
+	var profiler *vm.Profiler
+	if profilePath != "" {
+		profiler = vm.NewProfiler(vm.DefaultSampleInterval)
+		sharkEmitter.SetProfiler(profiler)
+	}
+
 	sharkEmitter.Interpret(string(f))
+
+	if cov != nil {
+		writeCoverage(coveragePath, coverage.Collect(absPath, cov))
+	}
+	if profiler != nil {
+		writeProfile(profilePath, absPath, profiler)
+	}
+}
+
+// Writes the sampled stacks of a run as a pprof profile and prints the report of the profiler.
+func writeProfile(path, file string, profiler *vm.Profiler) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not create file '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not create file '%s'", path), err.Error(), 1)
+	}
+	err = profile.WritePprof(f, file, profiler)
+	f.Close()
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not write file '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not write file '%s'", path), err.Error(), 1)
+	}
+
+	fmt.Printf("\nprofile written to '%s'\n", path)
+	if err := profile.WriteReport(os.Stdout, profiler, 20); err != nil {
+		log.Error().Err(err).Msg("Could not print the profile report")
+	}
+}
+
+// Writes the coverage of a run as an LCOV tracefile and prints its summary. The coverage is
+// merged with the one already in the file, so the coverage of several runs adds up.
+func writeCoverage(path string, profile *coverage.Profile) {
+	if internal.IsFileExists(path) {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Error().Err(err).Msgf("Could not open file '%s'", path)
+			exception.PrintExitMsgCtx(fmt.Sprintf("Could not open file '%s'", path), err.Error(), 1)
+		}
+		previous, err := coverage.ReadLCOV(f)
+		f.Close()
+		if err != nil {
+			log.Error().Err(err).Msgf("Could not read the coverage in '%s'", path)
+			exception.PrintExitMsgCtx(fmt.Sprintf("Could not read the coverage in '%s'", path), err.Error(), 1)
+		}
+		previous.Merge(profile)
+		profile = previous
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not create file '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not create file '%s'", path), err.Error(), 1)
+	}
+	err = profile.WriteLCOV(f)
+	f.Close()
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not write file '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not write file '%s'", path), err.Error(), 1)
+	}
+
+	fmt.Printf("\ncoverage written to '%s'\n", path)
+	if err := profile.WriteSummary(os.Stdout); err != nil {
+		log.Error().Err(err).Msg("Could not print the coverage summary")
+	}
 }
 
-func DecompileSharkBinaryFile(path string) {
+// DecompileSharkBinaryFile prints the Shark source recovered from a bytecode file, or writes it
+// to outName when it is set. With listing, the annotated disassembly is printed instead. The
+// control-flow graphs of the functions are also written as a DOT file when dotPath is set.
+func DecompileSharkBinaryFile(path, outName, dotPath string, listing bool) {
 	log.Debug().Msg("Decompiling Shark binary file")
 	gobFile, err := internal.ReadFile(path)
 	if err != nil {
@@ -46,13 +142,98 @@ func DecompileSharkBinaryFile(path string) {
 		exception.PrintExitMsgCtx("Could not decompile bytecode", err.Error(), 1)
 	}
 
-	if _, err := io.WriteString(os.Stdout, bc.ToString()); err != nil {
-		log.Error().Err(err).Msg("Could not write bytecode to stdout")
+	if listing {
+		if err := cfg.WriteListing(os.Stdout, bc); err != nil {
+			log.Error().Err(err).Msg("Could not write bytecode to stdout")
+			return
+		}
+	} else {
+		src, err := decompile.Source(bc)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not decompile bytecode")
+			exception.PrintExitMsgCtx("Could not decompile bytecode", err.Error(), 1)
+		}
+		if outName == "" {
+			if _, err := io.WriteString(os.Stdout, src); err != nil {
+				log.Error().Err(err).Msg("Could not write source to stdout")
+			}
+		} else if err := os.WriteFile(outName, []byte(src), 0644); err != nil {
+			log.Error().Err(err).Msgf("Could not write file '%s'", outName)
+			exception.PrintExitMsgCtx(fmt.Sprintf("Could not write file '%s'", outName), err.Error(), 1)
+		}
+	}
+
+	if dotPath != "" {
+		f, err := os.Create(dotPath)
+		if err != nil {
+			log.Error().Err(err).Msgf("Could not create file '%s'", dotPath)
+			exception.PrintExitMsgCtx(fmt.Sprintf("Could not create file '%s'", dotPath), err.Error(), 1)
+		}
+		err = cfg.WriteDOT(f, bc)
+		f.Close()
+		if err != nil {
+			log.Error().Err(err).Msgf("Could not write file '%s'", dotPath)
+			exception.PrintExitMsgCtx(fmt.Sprintf("Could not write file '%s'", dotPath), err.Error(), 1)
+		}
+	}
+}
+
+// AssembleSharkFile assembles a Shark assembly file into an object file, or writes the assembly
+// of an object file when disassemble is set.
+func AssembleSharkFile(path, outName string, disassemble bool) {
+	log.Debug().Msg("Assembling Shark file")
+	f, err := internal.ReadFile(path)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not read file '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not read file '%s'", path), err.Error(), 1)
+	}
+
+	if disassemble {
+		bc, err := bytecode.FromBytes(f)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not decompile bytecode")
+			exception.PrintExitMsgCtx("Could not decompile bytecode", err.Error(), 1)
+		}
+		text, err := asm.Disassemble(bc)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not disassemble bytecode")
+			exception.PrintExitMsgCtx("Could not disassemble bytecode", err.Error(), 1)
+		}
+		if outName == "" {
+			if _, err := io.WriteString(os.Stdout, text); err != nil {
+				log.Error().Err(err).Msg("Could not write assembly to stdout")
+			}
+			return
+		}
+		if err := internal.WriteFile(outName, []byte(text)); err != nil {
+			log.Error().Err(err).Msg("Could not write assembly to file")
+			exception.PrintExitMsgCtx("Could not write assembly to file", err.Error(), 1)
+		}
 		return
 	}
+
+	bc, err := asm.Assemble(bytes.NewReader(f))
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not assemble file '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not assemble file '%s'", path), err.Error(), 1)
+	}
+	fileName := internal.GetFileName(path) + ".egg"
+	if outName != "" {
+		fileName = outName
+	}
+	log.Debug().Str("file", fileName).Msg("Writing bytecode to file")
+	obj, err := bc.ToObj(bytecode.BcTypeNormal, bytecode.BcVersionLatest)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not convert bytecode to bytes")
+		exception.PrintExitMsgCtx("Could not convert bytecode to bytes", err.Error(), 1)
+	}
+	if err := internal.WriteFile(fileName, obj); err != nil {
+		log.Error().Err(err).Msg("Could not write bytecode to file")
+		exception.PrintExitMsgCtx("Could not write bytecode to file", err.Error(), 1)
+	}
 }
 
-func CompileSharkCodeFile(path, outName, compression string, emitInstructionSet bool, argConfig *config.Config) {
+func CompileSharkCodeFile(path, outName, compression, signKeyPath string, emitInstructionSet, stripDebug bool, optimizationLevel compiler.OptimizationLevel, argConfig *config.Config) {
 	log.Debug().Msg("Compiling Shark code file")
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -66,6 +247,7 @@ func CompileSharkCodeFile(path, outName, compression string, emitInstructionSet
 		exception.PrintExitMsgCtx(fmt.Sprintf("Could not read file '%s'", path), err.Error(), 1)
 	}
 	sharkEmitter := emitter.New(&absPath, os.Stdout, &argConfig.NidumVM)
+	sharkEmitter.SetOptimizationLevel(optimizationLevel)
 	file := string(f)
 	if bc := sharkEmitter.Compile(&file); bc != nil {
 		fileName := internal.GetFileName(absPath) + ".egg"
@@ -81,8 +263,17 @@ func CompileSharkCodeFile(path, outName, compression string, emitInstructionSet
 		default:
 			bcType = bytecode.BcTypeNormal
 		}
+		bc.SourceName = path
+		options := bytecode.EncodeOptions{StripDebug: stripDebug}
+		if signKeyPath != "" {
+			options.SigningKey, err = readSigningKey(signKeyPath)
+			if err != nil {
+				log.Error().Err(err).Msgf("Could not read signing key '%s'", signKeyPath)
+				exception.PrintExitMsgCtx(fmt.Sprintf("Could not read signing key '%s'", signKeyPath), err.Error(), 1)
+			}
+		}
 		log.Debug().Str("file", fileName).Str("compression", bcType.String()).Msg("Writing bytecode to file")
-		bytes, err := bc.ToObj(bcType, bytecode.BcVersionOnos1)
+		bytes, err := bc.ToObjWithOptions(bcType, bytecode.BcVersionLatest, options)
 		if err != nil {
 			log.Error().Err(err).Msg("Could not convert bytecode to bytes")
 			exception.PrintExitMsgCtx("Could not convert bytecode to bytes", err.Error(), 1)
@@ -112,6 +303,10 @@ func ExecuteSharkBinaryFile(path string, argConfig *config.Config) {
 		log.Error().Err(err).Msg("Could not decompile bytecode")
 		exception.PrintExitMsgCtx("Could not decompile bytecode", err.Error(), 1)
 	}
+	if err := bytecode.Verify(bc, &argConfig.NidumVM); err != nil {
+		log.Error().Err(err).Msg("Could not verify bytecode")
+		exception.PrintExitMsgCtx("Could not verify bytecode", err.Error(), 1)
+	}
 	sharkEmitter := emitter.New(&absPath, os.Stdout, &argConfig.NidumVM)
 	sharkEmitter.Exec(bc)
 }
@@ -164,6 +359,53 @@ func ShowOjbMeta(path string) {
 	fmt.Printf("OBJ SIZE: \t%d bytes\n", len(objFile))
 	fmt.Printf("INSTRUCT SIZE: \t%d bytes\n", instructSize)
 	fmt.Printf("NUM CONSTS: \t%d\n", len(bytecode.Constants))
+
+	hasDebugInfo, err := objFile.HasDebugInfo()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not read debug information")
+		exception.PrintExitMsgCtx("Could not read debug information", err.Error(), 1)
+	}
+	fmt.Printf("DEBUG INFO: \t%t\n", hasDebugInfo)
+
+	signature, err := objFile.Signature()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not verify signature")
+		exception.PrintExitMsgCtx("Could not verify signature", err.Error(), 1)
+	}
+	switch {
+	case signature == nil:
+		fmt.Printf("SIGNATURE: \tnone\n")
+	case signature.PublicKey != nil:
+		fmt.Printf("SIGNATURE: \t%s (%s)\n", signature.Algorithm.String(), hex.EncodeToString(signature.PublicKey))
+	default:
+		fmt.Printf("SIGNATURE: \t%s\n", signature.Algorithm.String())
+	}
+}
+
+// Reads an Ed25519 private key from a PEM encoded PKCS #8 file, as generated by
+// 'openssl genpkey -algorithm ed25519'.
+func readSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := internal.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an ed25519 key, got %T", key)
+	}
+
+	return privateKey, nil
 }
 
 func GenerateDefaultConfig() {
@@ -191,3 +433,131 @@ func GenerateDefaultConfig() {
 		exception.PrintExitMsgCtx("Could not write to file", err.Error(), 1)
 	}
 }
+
+// FormatSharkCodeFile prints the file in its canonical layout. With write the file is rewritten
+// instead, with check nothing is printed and the exit code is 1 when the file is not formatted.
+func FormatSharkCodeFile(path string, write, check bool) {
+	log.Debug().Msg("Formatting Shark code file")
+	f, err := internal.ReadFile(path)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not read file '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not read file '%s'", path), err.Error(), 1)
+	}
+
+	src := string(f)
+	formatted, errs := format.Source(src)
+	if len(errs) != 0 {
+		for _, e := range errs {
+			e.SetInputName(path)
+			e.SetInputContent(&src)
+			fmt.Println(e.String())
+		}
+		os.Exit(1)
+	}
+
+	switch {
+	case check:
+		if formatted != src {
+			fmt.Printf("%s is not formatted\n", path)
+			os.Exit(1)
+		}
+	case write:
+		if formatted == src {
+			return
+		}
+		log.Debug().Str("file", path).Msg("Writing formatted code to file")
+		if err := internal.WriteFile(path, []byte(formatted)); err != nil {
+			log.Error().Err(err).Msg("Could not write to file")
+			exception.PrintExitMsgCtx("Could not write to file", err.Error(), 1)
+		}
+	default:
+		if _, err := io.WriteString(os.Stdout, formatted); err != nil {
+			log.Error().Err(err).Msg("Could not write formatted code to stdout")
+		}
+	}
+}
+
+// LintSharkCodeFile prints the diagnostics of the lint rules for the file. The exit code is 1
+// when a rule set to the error level finds something.
+func LintSharkCodeFile(path string, argConfig *config.Config) {
+	log.Debug().Msg("Linting Shark code file")
+	f, err := internal.ReadFile(path)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not read file '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not read file '%s'", path), err.Error(), 1)
+	}
+
+	src := string(f)
+	diagnostics, errs := lint.Source(src, argConfig.Lint)
+	if len(errs) != 0 {
+		for _, e := range errs {
+			e.SetInputName(path)
+			e.SetInputContent(&src)
+			fmt.Println(e.String())
+		}
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, d := range diagnostics {
+		fmt.Printf("%s[%s]: %s\n", d.Level, d.Rule, d.Message)
+		fmt.Printf("  --> %s:%d:%d\n", path, d.Pos.Line, d.Pos.ColFrom)
+		failed = failed || d.Level == config.LintError
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// TestSharkCode runs the tests of a file, or of the '_test.shark' files in a directory, and
+// exits with 1 if one of them fails. The results are also written as JUnit XML to junitPath
+// unless it is empty.
+func TestSharkCode(path string, timeout time.Duration, junitPath string, argConfig *config.Config) {
+	log.Debug().Msg("Testing Shark code")
+	files, err := tester.Discover(path)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not find the tests in '%s'", path)
+		exception.PrintExitMsgCtx(fmt.Sprintf("Could not find the tests in '%s'", path), err.Error(), 1)
+	}
+
+	var results []tester.Result
+	passed, failed := 0, 0
+	for _, file := range files {
+		fileResults, err := tester.File(file, timeout, &argConfig.NidumVM)
+		if err != nil {
+			log.Error().Err(err).Msgf("Could not read file '%s'", file)
+			exception.PrintExitMsgCtx(fmt.Sprintf("Could not read file '%s'", file), err.Error(), 1)
+		}
+		for _, r := range fileResults {
+			if r.Passed() {
+				passed++
+				fmt.Printf("PASS %s (%.3fs)\n", r.Name, r.Duration.Seconds())
+			} else {
+				failed++
+				fmt.Printf("FAIL %s (%.3fs)\n", r.Name, r.Duration.Seconds())
+				fmt.Println(r.Err.String())
+			}
+		}
+		results = append(results, fileResults...)
+	}
+
+	fmt.Printf("\n%d passed, %d failed\n", passed, failed)
+
+	if junitPath != "" {
+		f, err := os.Create(junitPath)
+		if err != nil {
+			log.Error().Err(err).Msgf("Could not create file '%s'", junitPath)
+			exception.PrintExitMsgCtx(fmt.Sprintf("Could not create file '%s'", junitPath), err.Error(), 1)
+		}
+		err = tester.WriteJUnit(f, results)
+		f.Close()
+		if err != nil {
+			log.Error().Err(err).Msgf("Could not write file '%s'", junitPath)
+			exception.PrintExitMsgCtx(fmt.Sprintf("Could not write file '%s'", junitPath), err.Error(), 1)
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
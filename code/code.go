@@ -3,6 +3,7 @@ package code
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 )
 
@@ -55,6 +56,23 @@ const (
 	OpIndexAssign
 	OpTuple
 	OpTupleDeconstruct
+	OpTailCall
+	// Prefixes an instruction whose operands are twice as wide as its definition gives them.
+	OpWide
+	OpLessThan
+	OpLessThanEqual
+	// Superinstructions, see superinstructions.go. The OpGetLocal0..3 opcodes follow each other.
+	OpGetLocal0
+	OpGetLocal1
+	OpGetLocal2
+	OpGetLocal3
+	OpAddLocalConst
+	OpSubLocalConst
+	OpJumpIfLocalNotLess
+	OpJumpIfLocalNotGreater
+	OpJumpIfLocalNotEqualConst
+	// Replaces the values on top of the stack with the string they make once converted to strings.
+	OpConcat
 )
 
 type Definition struct {
@@ -88,6 +106,7 @@ var definitions = map[Opcode]*Definition{
 	OpHash:             {"OpHash", []int{2}},
 	OpIndex:            {"OpIndex", []int{}},
 	OpCall:             {"OpCall", []int{1}},
+	OpTailCall:         {"OpTailCall", []int{1}},
 	OpReturnValue:      {"OpReturnValue", []int{}},
 	OpReturn:           {"OpReturn", []int{}},
 	OpGetLocal:         {"OpGetLocal", []int{1}},
@@ -107,6 +126,36 @@ var definitions = map[Opcode]*Definition{
 	OpRange:            {"OpRange", []int{}},
 	OpSpread:           {"OpSpread", []int{}},
 	OpIndexAssign:      {"OpIndexAssign", []int{}},
+	OpWide:             {"OpWide", []int{}},
+	OpLessThan:         {"OpLessThan", []int{}},
+	OpLessThanEqual:    {"OpLessThanEqual", []int{}},
+	OpGetLocal0:        {"OpGetLocal0", []int{}},
+	OpGetLocal1:        {"OpGetLocal1", []int{}},
+	OpGetLocal2:        {"OpGetLocal2", []int{}},
+	OpGetLocal3:        {"OpGetLocal3", []int{}},
+	OpAddLocalConst:    {"OpAddLocalConst", []int{1, 2}},
+	OpSubLocalConst:    {"OpSubLocalConst", []int{1, 2}},
+	// Jump to the offset of their last operand when the comparison is false
+	OpJumpIfLocalNotLess:       {"OpJumpIfLocalNotLess", []int{1, 1, 2}},
+	OpJumpIfLocalNotGreater:    {"OpJumpIfLocalNotGreater", []int{1, 1, 2}},
+	OpJumpIfLocalNotEqualConst: {"OpJumpIfLocalNotEqualConst", []int{1, 2, 2}},
+	OpConcat:                   {"OpConcat", []int{2}},
+}
+
+// The reasons an instruction cannot be read.
+var (
+	ErrUndefinedOpcode      = errors.New("undefined opcode")
+	ErrTruncatedInstruction = errors.New("truncated instruction")
+)
+
+// WideOperandWidths returns the widths of the operands of the instruction when it is prefixed
+// by OpWide.
+func (def *Definition) WideOperandWidths() []int {
+	widths := make([]int, len(def.OperandWidths))
+	for i, width := range def.OperandWidths {
+		widths[i] = 2 * width
+	}
+	return widths
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -117,16 +166,59 @@ func Lookup(op byte) (*Definition, error) {
 	return def, nil
 }
 
+// Make returns the instruction with its operands. It is prefixed by OpWide when an operand does
+// not fit in the width its definition gives it, and the operands that do not fit in the wide
+// width either are truncated, Encode reports them instead.
 func Make(op Opcode, operands ...int) []byte {
+	instruction, _ := Encode(op, operands...)
+	return instruction
+}
+
+// Encode returns the instruction with its operands like Make does, or an error when the opcode
+// is undefined or an operand does not fit in the wide width of the instruction.
+func Encode(op Opcode, operands ...int) ([]byte, error) {
 	def, ok := definitions[op]
+	if !ok || op == OpWide {
+		return []byte{}, fmt.Errorf("%w %d", ErrUndefinedOpcode, op)
+	}
+
+	wide := false
+	var err error
+	for i, operand := range operands {
+		if i >= len(def.OperandWidths) {
+			break
+		}
+		if !fits(operand, def.OperandWidths[i]) {
+			wide = true
+		}
+		if !fits(operand, 2*def.OperandWidths[i]) && err == nil {
+			err = fmt.Errorf("operand %d of %s does not fit in %d bytes", operand, def.Name, 2*def.OperandWidths[i])
+		}
+	}
+
+	if wide {
+		return append([]byte{byte(OpWide)}, makeInstruction(op, def.WideOperandWidths(), operands)...), err
+	}
+	return makeInstruction(op, def.OperandWidths, operands), err
+}
 
+// MakeWide returns the instruction prefixed by OpWide whatever the size of its operands.
+func MakeWide(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
 	if !ok {
 		return []byte{}
 	}
+	return append([]byte{byte(OpWide)}, makeInstruction(op, def.WideOperandWidths(), operands)...)
+}
 
+func fits(operand, width int) bool {
+	return operand >= 0 && operand < 1<<(8*width)
+}
+
+func makeInstruction(op Opcode, widths []int, operands []int) []byte {
 	instructionLength := 1
 
-	for _, width := range def.OperandWidths {
+	for _, width := range widths {
 		instructionLength += width
 	}
 
@@ -137,13 +229,18 @@ func Make(op Opcode, operands ...int) []byte {
 	offset := 1
 
 	for i, operand := range operands {
-		width := def.OperandWidths[i]
+		if i >= len(widths) {
+			break
+		}
+		width := widths[i]
 
 		switch width {
 		case 1:
 			instruction[offset] = byte(operand)
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(operand))
 		}
 
 		offset += width
@@ -152,27 +249,81 @@ func Make(op Opcode, operands ...int) []byte {
 	return instruction
 }
 
+// A decoded instruction.
+type Instruction struct {
+	Op       Opcode
+	Operands []int
+	// Whether it is prefixed by OpWide.
+	Wide bool
+	// The number of bytes it takes, its prefix included.
+	Size int
+}
+
+// ReadInstruction decodes the instruction at the start of ins. When the opcode is undefined,
+// or is an OpWide that does not prefix an instruction with operands, the error wraps
+// ErrUndefinedOpcode. When ins ends before the operands, the error wraps
+// ErrTruncatedInstruction. In both cases the returned instruction has its opcode set.
+func ReadInstruction(ins Instructions) (Instruction, error) {
+	in := Instruction{Op: Opcode(ins[0]), Size: 1}
+
+	if in.Op == OpWide {
+		if len(ins) < 2 {
+			return in, fmt.Errorf("%w: OpWide", ErrTruncatedInstruction)
+		}
+		in.Op = Opcode(ins[1])
+		in.Wide = true
+		in.Size++
+	}
+
+	def, ok := definitions[in.Op]
+	if !ok || (in.Wide && (in.Op == OpWide || len(def.OperandWidths) == 0)) {
+		return in, fmt.Errorf("%w %d", ErrUndefinedOpcode, in.Op)
+	}
+	widths := def.OperandWidths
+	if in.Wide {
+		widths = def.WideOperandWidths()
+	}
+
+	for _, width := range widths {
+		in.Size += width
+	}
+	if in.Size > len(ins) {
+		return in, fmt.Errorf("%w: %s", ErrTruncatedInstruction, def.Name)
+	}
+
+	start := 1
+	if in.Wide {
+		start = 2
+	}
+	in.Operands, _ = readOperands(widths, ins[start:])
+	return in, nil
+}
+
 func (ins Instructions) String() string {
 	var out bytes.Buffer
 
 	i := 0
 
 	for i < len(ins) {
-		def, err := Lookup(ins[i])
+		in, err := ReadInstruction(ins[i:])
 
 		if err != nil {
 			if _, err := fmt.Fprintf(&out, "ERROR: %s\n", err); err != nil {
 				return ""
 			}
-			continue
+			break
 		}
 
-		operands, read := ReadOperands(def, ins[i+1:])
-		if _, err := fmt.Fprintf(&out, "%04d %s\n", i, ins.formatInstruction(def, operands)); err != nil {
+		def, _ := Lookup(byte(in.Op))
+		prefix := ""
+		if in.Wide {
+			prefix = "OpWide "
+		}
+		if _, err := fmt.Fprintf(&out, "%04d %s%s\n", i, prefix, ins.formatInstruction(def, in.Operands)); err != nil {
 			return ""
 		}
 
-		i += 1 + read
+		i += in.Size
 	}
 
 	return out.String()
@@ -185,29 +336,66 @@ func (ins Instructions) formatInstruction(def *Definition, operands []int) strin
 		return fmt.Sprintf("ERROR: operand len %d does not match defined %d", len(operands), operandCount)
 	}
 
-	switch operandCount {
-	case 0:
-		return def.Name
-	case 1:
-		return fmt.Sprintf("%s %d", def.Name, operands[0])
-	case 2:
-		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	text := def.Name
+	for _, operand := range operands {
+		text += fmt.Sprintf(" %d", operand)
 	}
+	return text
+}
 
-	return fmt.Sprintf("ERROR: unhandled operandCount for %s", def.Name)
+// StackEffect returns the number of values an instruction pops from and pushes onto the stack.
+// A call pushes the value its function returns.
+func StackEffect(op Opcode, operands []int) (pops, pushes int) {
+	switch op {
+	case OpConstant, OpTrue, OpFalse, OpNull, OpGetGlobal, OpGetLocal,
+		OpGetBuiltin, OpGetFree, OpCurrentClosure,
+		OpGetLocal0, OpGetLocal1, OpGetLocal2, OpGetLocal3, OpAddLocalConst, OpSubLocalConst:
+		return 0, 1
+	case OpPop, OpJumpNotTruthy, OpSetGlobal, OpSetLocal, OpSetLocalDefault:
+		return 1, 0
+	case OpAdd, OpSub, OpMul, OpDiv, OpPower, OpEqual, OpNotEqual,
+		OpGreaterThan, OpGreaterThanEqual, OpLessThan, OpLessThanEqual, OpAnd, OpOr, OpIndex, OpRange:
+		return 2, 1
+	case OpMinus, OpBang, OpSpread:
+		return 1, 1
+	case OpIndexAssign:
+		return 3, 1
+	case OpArray, OpTuple, OpHash, OpConcat:
+		return operands[0], 1
+	case OpTupleDeconstruct:
+		return 1, operands[0]
+	case OpCall:
+		return operands[0] + 1, 1
+	case OpTailCall:
+		return operands[0] + 1, 0
+	case OpClosure:
+		return operands[1], 1
+	case OpReturnValue:
+		return 1, 0
+	default:
+		return 0, 0
+	}
 }
 
+// ReadOperands reads the operands of an instruction that is not prefixed by OpWide, and
+// returns them with the number of bytes they take.
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
-	operands := make([]int, len(def.OperandWidths))
+	return readOperands(def.OperandWidths, ins)
+}
+
+func readOperands(widths []int, ins Instructions) ([]int, int) {
+	operands := make([]int, len(widths))
 
 	offset := 0
 
-	for i, width := range def.OperandWidths {
+	for i, width := range widths {
 		switch width {
 		case 1:
 			operands[i] = int(ReadUint8(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		}
 
 		offset += width
@@ -216,6 +404,10 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
@@ -1,6 +1,10 @@
 package code
 
-import "testing"
+import (
+	"errors"
+	"shark/token"
+	"testing"
+)
 
 func TestMake(t *testing.T) {
 	t.Run("should get the correct bytecode instruction", func(t *testing.T) {
@@ -68,6 +72,81 @@ func TestMake(t *testing.T) {
 	})
 }
 
+func TestWideInstructions(t *testing.T) {
+	t.Run("should prefix the instructions whose operands do not fit with OpWide", func(t *testing.T) {
+		tests := []struct {
+			op       Opcode
+			operands []int
+			expected []byte
+		}{
+			{OpConstant, []int{65536}, []byte{byte(OpWide), byte(OpConstant), 0, 1, 0, 0}},
+			{OpJump, []int{70000}, []byte{byte(OpWide), byte(OpJump), 0, 1, 17, 112}},
+			{OpGetLocal, []int{256}, []byte{byte(OpWide), byte(OpGetLocal), 1, 0}},
+			{OpCall, []int{300}, []byte{byte(OpWide), byte(OpCall), 1, 44}},
+			{OpClosure, []int{1, 256}, []byte{byte(OpWide), byte(OpClosure), 0, 0, 0, 1, 1, 0}},
+		}
+
+		for _, tt := range tests {
+			instruction := Make(tt.op, tt.operands...)
+			if string(instruction) != string(tt.expected) {
+				t.Errorf("wrong instruction for %v. want=%v, got=%v", tt.operands, tt.expected, instruction)
+			}
+
+			in, err := ReadInstruction(instruction)
+			if err != nil {
+				t.Fatalf("could not read the instruction: %s", err)
+			}
+			if in.Op != tt.op || !in.Wide || in.Size != len(tt.expected) {
+				t.Errorf("wrong instruction read. got=%+v", in)
+			}
+			for i, want := range tt.operands {
+				if in.Operands[i] != want {
+					t.Errorf("wrong operand at position %d. want=%d, got=%d", i, want, in.Operands[i])
+				}
+			}
+		}
+	})
+	t.Run("should report the operands that do not fit even when wide", func(t *testing.T) {
+		tests := []struct {
+			op       Opcode
+			operands []int
+		}{
+			{OpGetLocal, []int{65536}},
+			{OpCall, []int{-1}},
+			{OpConstant, []int{1 << 32}},
+			{OpClosure, []int{0, 65536}},
+		}
+
+		for _, tt := range tests {
+			if _, err := Encode(tt.op, tt.operands...); err == nil {
+				t.Errorf("expected an error for %v", tt.operands)
+			}
+		}
+		if _, err := Encode(OpConstant, 65536); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+	t.Run("should reject invalid and truncated instructions", func(t *testing.T) {
+		tests := []struct {
+			ins      Instructions
+			expected error
+		}{
+			{Instructions{255}, ErrUndefinedOpcode},
+			{Instructions{byte(OpWide), byte(OpAdd)}, ErrUndefinedOpcode},
+			{Instructions{byte(OpWide), byte(OpWide), byte(OpConstant), 0, 0, 0, 0}, ErrUndefinedOpcode},
+			{Instructions{byte(OpWide)}, ErrTruncatedInstruction},
+			{Instructions{byte(OpConstant), 0}, ErrTruncatedInstruction},
+			{Instructions{byte(OpWide), byte(OpConstant), 0, 0}, ErrTruncatedInstruction},
+		}
+
+		for _, tt := range tests {
+			if _, err := ReadInstruction(tt.ins); !errors.Is(err, tt.expected) {
+				t.Errorf("wrong error for %v. want=%q, got=%v", tt.ins, tt.expected, err)
+			}
+		}
+	})
+}
+
 func TestInstructionString(t *testing.T) {
 	t.Run("should get the correct string representation of the instruction", func(t *testing.T) {
 		instructions := []Instructions{
@@ -112,6 +191,7 @@ func TestInstructionString(t *testing.T) {
 			Make(OpSpread),
 			Make(OpTuple, 65534),
 			Make(OpTupleDeconstruct, 65534),
+			Make(OpGetLocal, 256),
 		}
 
 		expected := `0000 OpAdd
@@ -155,6 +235,7 @@ func TestInstructionString(t *testing.T) {
 0068 OpSpread
 0069 OpTuple 65534
 0072 OpTupleDeconstruct 65534
+0075 OpWide OpGetLocal 256
 `
 
 		concatted := Instructions{}
@@ -216,3 +297,118 @@ func TestReadOperands(t *testing.T) {
 		}
 	})
 }
+
+func TestSourceMap(t *testing.T) {
+	t.Run("should map instruction offsets to source positions", func(t *testing.T) {
+		first := token.Position{Line: 1, LineTo: 1, ColFrom: 0, ColTo: 3}
+		second := token.Position{Line: 2, LineTo: 2, ColFrom: 4, ColTo: 5}
+
+		var sm SourceMap
+		sm = sm.Add(0, first)
+		sm = sm.Add(3, first)
+		sm = sm.Add(4, second)
+		sm = sm.Add(7, second)
+
+		if len(sm) != 2 {
+			t.Fatalf("consecutive instructions of the same position were not merged. got=%d mappings", len(sm))
+		}
+
+		tests := []struct {
+			offset   int
+			expected token.Position
+		}{
+			{0, first},
+			{3, first},
+			{4, second},
+			{100, second},
+		}
+
+		for _, tt := range tests {
+			pos, ok := sm.PositionAt(tt.offset)
+			if !ok || pos != tt.expected {
+				t.Errorf("wrong position at offset %d. want=%+v, got=%+v", tt.offset, tt.expected, pos)
+			}
+		}
+
+		sm = sm.Truncate(4)
+		if pos, _ := sm.PositionAt(4); pos != first {
+			t.Errorf("mapping was not truncated. got=%+v", pos)
+		}
+	})
+}
+
+func TestSuperinstructions(t *testing.T) {
+	t.Run("should fuse the longest sequence", func(t *testing.T) {
+		tests := []struct {
+			ops      []Opcode
+			expected Opcode
+			n        int
+			ok       bool
+		}{
+			{[]Opcode{OpGetLocal, OpGetLocal, OpLessThan, OpJumpNotTruthy}, OpJumpIfLocalNotLess, 4, true},
+			{[]Opcode{OpGetLocal, OpConstant, OpEqual, OpJumpNotTruthy}, OpJumpIfLocalNotEqualConst, 4, true},
+			{[]Opcode{OpGetLocal, OpConstant, OpAdd, OpPop}, OpAddLocalConst, 3, true},
+			{[]Opcode{OpGetLocal, OpConstant, OpEqual}, 0, 0, false},
+			{[]Opcode{OpGetLocal}, 0, 0, false},
+		}
+
+		for _, tt := range tests {
+			op, n, ok := Fuse(tt.ops)
+			if op != tt.expected || n != tt.n || ok != tt.ok {
+				t.Errorf("wrong superinstruction for %v. want=(%d, %d, %t), got=(%d, %d, %t)", tt.ops, tt.expected, tt.n, tt.ok, op, n, ok)
+			}
+		}
+	})
+
+	t.Run("should expand to the instructions it stands for", func(t *testing.T) {
+		tests := []struct {
+			in       Instruction
+			expected []Instruction
+		}{
+			{
+				Instruction{Op: OpJumpIfLocalNotLess, Operands: []int{1, 2, 12}},
+				[]Instruction{
+					{Op: OpGetLocal, Operands: []int{1}, Size: 2},
+					{Op: OpGetLocal, Operands: []int{2}, Size: 2},
+					{Op: OpLessThan, Operands: []int{}, Size: 1},
+					{Op: OpJumpNotTruthy, Operands: []int{12}, Size: 3},
+				},
+			},
+			{
+				Instruction{Op: OpSubLocalConst, Operands: []int{0, 3}},
+				[]Instruction{
+					{Op: OpGetLocal, Operands: []int{0}, Size: 2},
+					{Op: OpConstant, Operands: []int{3}, Size: 3},
+					{Op: OpSub, Operands: []int{}, Size: 1},
+				},
+			},
+			{
+				Instruction{Op: OpGetLocal2},
+				[]Instruction{{Op: OpGetLocal, Operands: []int{2}, Size: 2}},
+			},
+			{
+				Instruction{Op: OpPop, Size: 1},
+				[]Instruction{{Op: OpPop, Size: 1}},
+			},
+		}
+
+		for _, tt := range tests {
+			expanded := Expand(tt.in)
+			if len(expanded) != len(tt.expected) {
+				t.Fatalf("wrong number of instructions for opcode %d. want=%d, got=%d", tt.in.Op, len(tt.expected), len(expanded))
+			}
+			for i, want := range tt.expected {
+				got := expanded[i]
+				if got.Op != want.Op || got.Size != want.Size || len(got.Operands) != len(want.Operands) {
+					t.Errorf("wrong instruction %d for opcode %d. want=%+v, got=%+v", i, tt.in.Op, want, got)
+					continue
+				}
+				for j := range want.Operands {
+					if got.Operands[j] != want.Operands[j] {
+						t.Errorf("wrong operand %d of instruction %d. want=%d, got=%d", j, i, want.Operands[j], got.Operands[j])
+					}
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package code
+
+import (
+	"shark/token"
+	"sort"
+)
+
+// SourceMapping marks the instructions starting at Offset as compiled from the source code at Pos.
+type SourceMapping struct {
+	Pos    token.Position
+	Offset int
+}
+
+// SourceMap maps instruction offsets back to positions in the Shark source code.
+// The mappings are sorted by offset, and an instruction belongs to the last mapping at or before it.
+type SourceMap []SourceMapping
+
+// Add records that the instructions starting at offset were compiled from pos.
+// Consecutive instructions compiled from the same position share a single mapping.
+func (sm SourceMap) Add(offset int, pos token.Position) SourceMap {
+	if len(sm) > 0 {
+		last := sm[len(sm)-1]
+		if last.Pos == pos {
+			return sm
+		}
+		if last.Offset == offset {
+			sm[len(sm)-1].Pos = pos
+			return sm
+		}
+	}
+
+	return append(sm, SourceMapping{Offset: offset, Pos: pos})
+}
+
+// Truncate drops the mappings of the instructions at or after length.
+func (sm SourceMap) Truncate(length int) SourceMap {
+	for len(sm) > 0 && sm[len(sm)-1].Offset >= length {
+		sm = sm[:len(sm)-1]
+	}
+
+	return sm
+}
+
+// PositionAt returns the source position of the instruction at offset.
+func (sm SourceMap) PositionAt(offset int) (token.Position, bool) {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}, false
+	}
+
+	return sm[i-1].Pos, true
+}
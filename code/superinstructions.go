@@ -0,0 +1,98 @@
+package code
+
+// A superinstruction does the work of a sequence of instructions the compiler often emits in one
+// dispatch. Its operands are those of the instructions of the sequence, in order.
+type superinstruction struct {
+	op       Opcode
+	sequence []Opcode
+}
+
+// The superinstructions made of a sequence, the longest sequences first. OpGetLocal0..3 stand for
+// an OpGetLocal whose operand is their own.
+var superinstructions = []superinstruction{
+	{OpJumpIfLocalNotLess, []Opcode{OpGetLocal, OpGetLocal, OpLessThan, OpJumpNotTruthy}},
+	{OpJumpIfLocalNotGreater, []Opcode{OpGetLocal, OpGetLocal, OpGreaterThan, OpJumpNotTruthy}},
+	{OpJumpIfLocalNotEqualConst, []Opcode{OpGetLocal, OpConstant, OpEqual, OpJumpNotTruthy}},
+	{OpAddLocalConst, []Opcode{OpGetLocal, OpConstant, OpAdd}},
+	{OpSubLocalConst, []Opcode{OpGetLocal, OpConstant, OpSub}},
+}
+
+// MaxFusedInstructions is the number of instructions the longest superinstruction stands for.
+const MaxFusedInstructions = 4
+
+// The number of locals that have their own OpGetLocal superinstruction.
+const numGetLocalN = 4
+
+// IsJump reports whether the instruction jumps, the offset it jumps to is then its last operand.
+func IsJump(op Opcode) bool {
+	return op == OpJump || IsConditionalJump(op)
+}
+
+// IsConditionalJump reports whether the instruction only jumps when its condition is false, it
+// goes on with the next instruction otherwise.
+func IsConditionalJump(op Opcode) bool {
+	switch op {
+	case OpJumpNotTruthy, OpJumpIfLocalNotLess, OpJumpIfLocalNotGreater, OpJumpIfLocalNotEqualConst:
+		return true
+	default:
+		return false
+	}
+}
+
+// Fuse returns the superinstruction for the longest sequence the opcodes start with, and the
+// number of opcodes it stands for. It returns false when no sequence matches.
+func Fuse(ops []Opcode) (Opcode, int, bool) {
+	for _, super := range superinstructions {
+		if len(ops) < len(super.sequence) {
+			continue
+		}
+		matches := true
+		for i, op := range super.sequence {
+			if ops[i] != op {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return super.op, len(super.sequence), true
+		}
+	}
+	return 0, 0, false
+}
+
+// GetLocalN returns the superinstruction that loads the local, or false when the local has none.
+func GetLocalN(index int) (Opcode, bool) {
+	if index < 0 || index >= numGetLocalN {
+		return 0, false
+	}
+	return OpGetLocal0 + Opcode(index), true
+}
+
+// Expand returns the instructions a superinstruction stands for, it runs like them. Other
+// instructions are returned as they are. The instructions have the size they take without the
+// superinstruction, and are not wide.
+func Expand(in Instruction) []Instruction {
+	if in.Op >= OpGetLocal0 && in.Op <= OpGetLocal3 {
+		return []Instruction{newInstruction(OpGetLocal, int(in.Op-OpGetLocal0))}
+	}
+
+	for _, super := range superinstructions {
+		if super.op != in.Op {
+			continue
+		}
+		expanded := make([]Instruction, 0, len(super.sequence))
+		operands := in.Operands
+		for _, op := range super.sequence {
+			n := len(definitions[op].OperandWidths)
+			expanded = append(expanded, newInstruction(op, operands[:n]...))
+			operands = operands[n:]
+		}
+		return expanded
+	}
+
+	return []Instruction{in}
+}
+
+func newInstruction(op Opcode, operands ...int) Instruction {
+	return Instruction{Op: op, Operands: operands, Size: len(Make(op, operands...))}
+}
@@ -5,6 +5,7 @@ import (
 	"shark/ast"
 	"shark/bytecode"
 	"shark/code"
+	"shark/config"
 	"shark/exception"
 	"shark/object"
 	"shark/token"
@@ -15,10 +16,25 @@ import (
 type Compiler struct {
 	lastCompiledType types.ISharkType
 	symbolTable      *SymbolTable
+	typeTable        *TypeTable
 	upToPos          *token.Position
+	currentPos       token.Position
 	scopes           []CompilationScope
 	constants        []object.Object
-	scopeIndex       int
+	// Definitions of the function literals bound by a let statement, by the literal's position.
+	functionNames     map[*token.Position]*token.Position
+	references        []Reference
+	scopeIndex        int
+	optimizationLevel OptimizationLevel
+	// The first instruction whose operands do not fit in the bytecode, returned once the node
+	// being compiled is done.
+	encodeErr *exception.SharkError
+	// The indexes of the constants that can be reused, by their key, for the first
+	// indexedConstants constants.
+	constantIndexes  map[string]int
+	indexedConstants int
+	// The number of globals of the VM the bytecode runs on.
+	globalsSize int
 }
 
 type EmittedInstruction struct {
@@ -28,8 +44,13 @@ type EmittedInstruction struct {
 
 type CompilationScope struct {
 	instructions        code.Instructions
+	sourceMap           code.SourceMap
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	impure              bool
+	// The targets of the jumps too far to be patched in place, by the offset of the jump. The
+	// instructions are laid out again with wide jumps when the scope is optimized.
+	farJumps map[int]int
 }
 
 func New(upToPos ...token.Position) *Compiler {
@@ -58,19 +79,28 @@ func New(upToPos ...token.Position) *Compiler {
 		scopeIndex:       0,
 		constants:        []object.Object{},
 		symbolTable:      SymbolTable,
+		typeTable:        NewTypeTable(),
 		upToPos:          pos,
 		lastCompiledType: types.TSharkNull{},
+		globalsSize:      config.NewDefaultVmConf().GlobalsSize,
 	}
 }
 
-func NewWithState(symbolTable *SymbolTable, constants []object.Object, upToPos ...token.Position) *Compiler {
+func NewWithState(symbolTable *SymbolTable, typeTable *TypeTable, constants []object.Object, upToPos ...token.Position) *Compiler {
 	c := New(upToPos...)
 	c.symbolTable = symbolTable
+	c.typeTable = typeTable
 	c.constants = constants
 
 	return c
 }
 
+// Sets the number of globals of the VM the bytecode runs on, the programs defining more globals
+// are reported. It is the default of config.VmConf unless set.
+func (c *Compiler) SetGlobalsSize(size int) {
+	c.globalsSize = size
+}
+
 func (c *Compiler) currentInstructions() code.Instructions {
 	return c.scopes[c.scopeIndex].instructions
 }
@@ -83,14 +113,28 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 			return nil, true
 		}
 	}
+
+	previousPos := c.currentPos
+	if node != nil {
+		c.currentPos = node.TokenPos()
+	}
+	defer func() { c.currentPos = previousPos }()
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, statement := range node.Statements {
+			if test, ok := statement.(*ast.TestStatement); ok {
+				statement = testFunction(test)
+			}
 			if err, stopped := c.Compile(statement); err != nil || stopped {
 				return err, stopped
 			}
 		}
 	case *ast.ExpressionStatement:
+		// An empty statement, like the ';' after a block, has nothing to pop
+		if node.Expression == nil {
+			break
+		}
 		if err, stopped := c.Compile(node.Expression); err != nil || stopped {
 			return err, stopped
 		}
@@ -112,6 +156,7 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 				exception.NewSharkErrorCause("Variable not found for postfix expression", node.Token.Pos),
 			), false
 		}
+		c.addReference(ident.Token.Pos, symbol, false)
 		if !symbol.VariadicType && !symbol.Mutable {
 			return newSharkError(exception.SharkErrorImmutableValue, ident.Value,
 				"Add the 'mut' keyword before the variable name to make it mutable, or use the 'var' keyword to declare the variable",
@@ -134,31 +179,33 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 			}
 		}
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			if err, stopped := c.Compile(node.Right); err != nil || stopped {
-				return err, stopped
+		if c.optimizationLevel >= O1 {
+			if obj, ok := foldConstant(node); ok {
+				c.emitConstant(obj)
+				return nil, false
 			}
+		}
+		if node.Operator == "<" || node.Operator == "<=" {
 			if err, stopped := c.Compile(node.Left); err != nil || stopped {
 				return err, stopped
 			}
-			if _, ok := c.lastCompiledType.(types.TSharkI64); !ok {
+			if !isOrdered(c.lastCompiledType) && node.Operator == "<" {
 				return newSharkError(exception.SharkErrorTypeMismatch, c.lastCompiledType.SharkTypeString(),
-					"Use a number for comparison",
+					"Use a number or a char for comparison",
 					exception.NewSharkErrorCause(fmt.Sprintf("Cannot use type '%s' for left value comparison", c.lastCompiledType.SharkTypeString()), node.Token.Pos),
 				), false
 			}
-			c.emit(types.TSharkBool{}, code.OpGreaterThan)
-			return nil, false
-		} else if node.Operator == "<=" {
 			if err, stopped := c.Compile(node.Right); err != nil || stopped {
 				return err, stopped
 			}
-			if err, stopped := c.Compile(node.Left); err != nil || stopped {
-				return err, stopped
+			if node.Operator == "<" {
+				c.emit(types.TSharkBool{}, code.OpLessThan)
+			} else {
+				c.emit(types.TSharkBool{}, code.OpLessThanEqual)
 			}
-			c.emit(types.TSharkBool{}, code.OpGreaterThanEqual)
 			return nil, false
 		}
+		var leftType types.ISharkType
 		if node.Operator != "=" &&
 			node.Operator != "+=" &&
 			node.Operator != "-=" &&
@@ -167,6 +214,7 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 			if err, stopped := c.Compile(node.Left); err != nil || stopped {
 				return err, stopped
 			}
+			leftType = c.lastCompiledType
 			if err, stopped := c.Compile(node.Right); err != nil || stopped {
 				return err, stopped
 			}
@@ -175,7 +223,12 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 		case "..":
 			c.emit(types.TSharkArray{Collection: c.lastCompiledType}, code.OpRange)
 		case "+":
-			c.emit(c.lastCompiledType, code.OpAdd)
+			// Adding a char to a string, or a string to a char, gives a string
+			if _, ok := types.Underlying(leftType).(types.TSharkString); ok {
+				c.emit(leftType, code.OpAdd)
+			} else {
+				c.emit(c.lastCompiledType, code.OpAdd)
+			}
 		case "-":
 			c.emit(c.lastCompiledType, code.OpSub)
 		case "*":
@@ -203,6 +256,7 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 					exception.NewSharkErrorCause("Variable not found for reassignment", node.Token.Pos),
 				), false
 			}
+			c.addReference(identLeft.Token.Pos, symbolLeft, false)
 			if !symbolLeft.VariadicType && !symbolLeft.Mutable {
 				return newSharkError(exception.SharkErrorImmutableValue, identLeft.Value,
 					"Add the 'mut' keyword before the variable name to make it mutable, or use the 'var' keyword to declare the variable",
@@ -289,6 +343,12 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 			), false
 		}
 	case *ast.PrefixExpression:
+		if c.optimizationLevel >= O1 {
+			if obj, ok := foldConstant(node); ok {
+				c.emitConstant(obj)
+				return nil, false
+			}
+		}
 		switch node.Operator {
 		case "!":
 			if err, stopped := c.Compile(node.Right); err != nil || stopped {
@@ -314,6 +374,7 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 					exception.NewSharkErrorCause("Variable not found", node.Token.Pos),
 				), false
 			}
+			c.addReference(node.RightIdent.Token.Pos, symbol, false)
 			if !symbol.VariadicType && !symbol.Mutable {
 				return newSharkError(exception.SharkErrorImmutableValue, node.RightIdent.Value,
 					"Add the 'mut' keyword before the variable name to make it mutable, or use the 'var' keyword to declare the variable",
@@ -340,6 +401,7 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 					exception.NewSharkErrorCause("Variable not found", node.Token.Pos),
 				), false
 			}
+			c.addReference(node.RightIdent.Token.Pos, symbol, false)
 			if !symbol.VariadicType && !symbol.Mutable {
 				return newSharkError(exception.SharkErrorImmutableValue, node.RightIdent.Value,
 					"Add the 'mut' keyword before the variable name to make it mutable, or use the 'var' keyword to declare the variable",
@@ -420,14 +482,11 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 		}
 		jumpNotTruthyPos := c.emit(lastCompiledType, code.OpJumpNotTruthy, 9999)
 
+		// The body keeps its pops, a while statement leaves nothing on the stack
 		if err, stopped := c.Compile(node.Body); err != nil || stopped {
 			return err, stopped
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
-
 		c.emit(types.TSharkNull{}, code.OpJump, conditionPos)
 
 		afterBodyPos := len(c.currentInstructions())
@@ -453,22 +512,50 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 		statementType := c.lastCompiledType
 		// check if node type is the same as the given type
 		if node.Name.DefinedType != nil {
-			if !node.Name.DefinedType.Is(c.lastCompiledType) {
+			definedType, err := c.resolveType(node.Name.DefinedType, node.Name.Token.Pos)
+			if err != nil {
+				return err, false
+			}
+			if !definedType.Is(c.lastCompiledType) {
 				return newSharkError(exception.SharkErrorTypeMismatch, c.lastCompiledType.SharkTypeString(),
 					"Check the type of the value",
-					exception.NewSharkErrorCause(fmt.Sprintf("Cannot assign type '%s' to type '%s'", c.lastCompiledType.SharkTypeString(), node.Name.DefinedType.SharkTypeString()), node.Token.Pos),
+					exception.NewSharkErrorCause(fmt.Sprintf("Cannot assign type '%s' to type '%s'", c.lastCompiledType.SharkTypeString(), definedType.SharkTypeString()), node.Token.Pos),
 				), false
 			}
 
-			statementType = node.Name.DefinedType
+			statementType = definedType
 		}
 		symbol = c.symbolTable.Define(node.Name.Value, node.Name.Mutable, node.Name.IsVariadic, statementType, &node.Name.Token.Pos)
+		c.addReference(node.Name.Token.Pos, symbol, true)
+		c.addFunctionName(node)
+		// Calling an immutable binding of a pure function keeps the caller pure, '@memo' vouches for the function
+		if fn, ok := c.lastCompiledFunction(); ok && !symbol.Mutable && !symbol.VariadicType && (fn.Pure || fn.Memo == object.MemoAlways) {
+			symbol = c.symbolTable.MarkPure(symbol.Name)
+		}
 
 		if symbol.Scope == GlobalScope {
 			c.emit(symbol.ObjType, code.OpSetGlobal, symbol.Index)
 		} else {
 			c.emit(symbol.ObjType, code.OpSetLocal, symbol.Index)
 		}
+	case *ast.TypeAliasStatement:
+		if c.typeTable.IsDefinedLocally(node.Name.Value) {
+			return newSharkError(exception.SharkErrorDuplicateType, node.Name.Value,
+				"Use a different name for the type alias",
+				exception.NewSharkErrorCause("Type alias is already declared in this scope", node.Name.Token.Pos),
+			), false
+		}
+		aliasedType, err := c.resolveType(node.Value, node.Token.Pos)
+		if err != nil {
+			return err, false
+		}
+		c.typeTable.Define(node.Name.Value, aliasedType, &node.Name.Token.Pos)
+	case *ast.TestStatement:
+		// The tests of the program are compiled with its statements, a test anywhere else is nested
+		return newSharkError(exception.SharkErrorNestedTest, node.Name.Value,
+			"Move the test to the top level of the file",
+			exception.NewSharkErrorCause("Tests can only be declared at the top level", node.Token.Pos),
+		), false
 	case *ast.TupleDeconstruction:
 		// check if the right value is an identifier tuple
 		rightIdent, ok := node.Value.(*ast.Identifier)
@@ -482,13 +569,14 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 					exception.NewSharkErrorCause("Variable not found for tuple deconstruction", node.Token.Pos),
 				), false
 			}
+			c.addReference(rightIdent.Token.Pos, symbol, false)
 			if !symbol.ObjType.Is(types.TSharkTuple{}) {
 				return newSharkError(exception.SharkErrorTypeMismatch, symbol.ObjType.SharkTypeString(),
 					"Use a tuple for tuple deconstruction",
 					exception.NewSharkErrorCause(fmt.Sprintf("Cannot deconstruct type '%s'", symbol.ObjType.SharkTypeString()), node.Token.Pos),
 				), false
 			}
-			tupleType = symbol.ObjType.(types.TSharkTuple)
+			tupleType = types.Underlying(symbol.ObjType).(types.TSharkTuple)
 			c.loadSymbol(symbol)
 		} else {
 			if err, stopped := c.Compile(node.Value); err != nil || stopped {
@@ -500,7 +588,7 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 					exception.NewSharkErrorCause(fmt.Sprintf("Cannot deconstruct type '%s'", c.lastCompiledType.SharkTypeString()), node.Token.Pos),
 				), false
 			}
-			tupleType = c.lastCompiledType.(types.TSharkTuple)
+			tupleType = types.Underlying(c.lastCompiledType).(types.TSharkTuple)
 		}
 		c.emit(c.lastCompiledType, code.OpTupleDeconstruct, len(node.Names))
 		for i, name := range node.Names {
@@ -512,6 +600,7 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 				), false
 			}
 			symbol = c.symbolTable.Define(name.Value, name.Mutable, name.IsVariadic, tupleType.Collection[i], &name.Token.Pos)
+			c.addReference(name.Token.Pos, symbol, true)
 			if symbol.Scope == GlobalScope {
 				c.emit(c.lastCompiledType, code.OpSetGlobal, symbol.Index)
 			} else {
@@ -526,11 +615,34 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 				exception.NewSharkErrorCause(fmt.Sprintf("identifier '%s' is not defined", node.Value), node.Token.Pos),
 			), false
 		}
+		c.addReference(node.Token.Pos, symbol, false)
 		c.loadSymbol(symbol)
 		c.lastCompiledType = symbol.ObjType
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(types.TSharkString{}, code.OpConstant, c.addConstant(str))
+	case *ast.CharLiteral:
+		char := &object.Char{Value: node.Value}
+		c.emit(types.TSharkChar{}, code.OpConstant, c.addConstant(char))
+	case *ast.InterpolatedString:
+		if c.optimizationLevel >= O1 {
+			if obj, ok := foldConstant(node); ok {
+				c.emitConstant(obj)
+				return nil, false
+			}
+		}
+		// The values of any type are converted to strings by OpConcat, the empty text is left out
+		numParts := 0
+		for i, part := range node.Parts {
+			if text, ok := part.(*ast.StringLiteral); ok && i%2 == 0 && text.Value == "" {
+				continue
+			}
+			if err, stopped := c.Compile(part); err != nil || stopped {
+				return err, stopped
+			}
+			numParts++
+		}
+		c.emit(types.TSharkString{}, code.OpConcat, numParts)
 	case *ast.ArrayLiteral:
 		var elementType types.ISharkType
 		for _, element := range node.Elements {
@@ -633,6 +745,10 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 		}
 		c.emit(c.lastCompiledType, code.OpIndexAssign)
 	case *ast.FunctionLiteral:
+		memo, err := memoMode(node)
+		if err != nil {
+			return err, false
+		}
 		c.enterScope()
 		numDefaults := 0
 		isOptionalsActive := false
@@ -644,7 +760,10 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 				if err, stopped := c.Compile(*param.DefaultValue); err != nil || stopped {
 					return err, stopped
 				}
-				paramType := param.DefinedType
+				paramType, err := c.resolveType(param.DefinedType, param.Token.Pos)
+				if err != nil {
+					return err, false
+				}
 				if paramType == nil {
 					paramType = types.TSharkOptional{Type: c.lastCompiledType}
 				}
@@ -655,10 +774,14 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 					), false
 				}
 				symbol := c.symbolTable.Define(param.Value, param.Mutable, param.IsVariadic, paramType, &param.Token.Pos)
+				c.addReference(param.Token.Pos, symbol, true)
 				c.emit(paramType, code.OpSetLocalDefault, symbol.Index)
 				paramTypes = append(paramTypes, paramType)
 			} else {
-				paramType := param.DefinedType
+				paramType, err := c.resolveType(param.DefinedType, param.Token.Pos)
+				if err != nil {
+					return err, false
+				}
 				if paramType == nil {
 					paramType = types.TSharkAny{}
 				}
@@ -668,7 +791,8 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 						exception.NewSharkErrorCause("Optional parameters must be given a default value using '=`.", param.Token.Pos),
 					), false
 				}
-				c.symbolTable.Define(param.Value, param.Mutable, param.IsVariadic, paramType, &param.Token.Pos)
+				symbol := c.symbolTable.Define(param.Value, param.Mutable, param.IsVariadic, paramType, &param.Token.Pos)
+				c.addReference(param.Token.Pos, symbol, true)
 				paramTypes = append(paramTypes, paramType)
 			}
 			if isOptionalsActive && param.DefaultValue == nil {
@@ -680,7 +804,11 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 		}
 		var returnType types.ISharkType
 		if node.DefinedType != nil && node.DefinedType.Is(types.TSharkFuncType{}) && node.DefinedType.(*types.TSharkFuncType).ReturnT != nil {
-			returnType = node.DefinedType.(*types.TSharkFuncType).ReturnT
+			definedReturnType, err := c.resolveType(node.DefinedType.(*types.TSharkFuncType).ReturnT, node.Token.Pos)
+			if err != nil {
+				return err, false
+			}
+			returnType = definedReturnType
 		} else {
 			returnType = types.TSharkAny{}
 		}
@@ -701,7 +829,11 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 		}
 		freeSymbols := c.symbolTable.FreeSymbols
 		NumLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
+		localNames := c.symbolTable.DefinitionNames()
+		pure := !c.scopes[c.scopeIndex].impure
+		instructions, sourceMap := c.optimize(c.currentInstructions(), c.scopes[c.scopeIndex].sourceMap, c.scopes[c.scopeIndex].farJumps, true)
+		markTailCalls(instructions)
+		c.leaveScope()
 
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
@@ -713,6 +845,11 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 			NumParameters: len(node.Parameters),
 			NumDefaults:   numDefaults,
 			ObjType:       funcType,
+			Pure:          pure,
+			Memo:          memo,
+			Name:          node.Name,
+			LocalNames:    localNames,
+			SourceMap:     sourceMap,
 		}
 		c.emit(funcType, code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
 	case *ast.ReturnStatement:
@@ -728,10 +865,13 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 
 		c.emit(c.lastCompiledType, code.OpReturnValue)
 	case *ast.CallExpression:
+		if !c.isPureCallee(node.Function) {
+			c.markImpure()
+		}
 		if err, stopped := c.Compile(node.Function); err != nil || stopped {
 			return err, stopped
 		}
-		funcType := c.lastCompiledType
+		funcType := types.Underlying(c.lastCompiledType)
 		funcType, ok := funcType.(types.TSharkFuncType)
 		if !ok {
 			return newSharkError(exception.SharkErrorNotCallable, nil,
@@ -775,7 +915,26 @@ func (c *Compiler) Compile(node ast.Node) (*exception.SharkError, bool) {
 		c.emit(funcType.(types.TSharkFuncType).ReturnT, code.OpCall, len(node.Arguments))
 	}
 
-	return nil, false
+	return c.encodeErr, false
+}
+
+// Returns the statement a test is compiled to, a function made of its body that is created but
+// never called. Its body is checked like any other code, 'shark test' is what calls it.
+func testFunction(test *ast.TestStatement) ast.Statement {
+	return &ast.ExpressionStatement{
+		Token:      test.Token,
+		Expression: &ast.FunctionLiteral{Token: test.Token, Body: test.Body, Name: test.Name.Value},
+	}
+}
+
+// Reports whether values of the type can be compared with '<', numbers and chars.
+func isOrdered(sharkType types.ISharkType) bool {
+	switch types.Underlying(sharkType).(type) {
+	case types.TSharkI64, types.TSharkChar:
+		return true
+	default:
+		return false
+	}
 }
 
 func (c *Compiler) replaceLastPopWithReturn() {
@@ -787,9 +946,13 @@ func (c *Compiler) replaceLastPopWithReturn() {
 }
 
 func (c *Compiler) Bytecode() *bytecode.Bytecode {
+	instructions, sourceMap := c.optimize(c.currentInstructions(), c.scopes[c.scopeIndex].sourceMap, c.scopes[c.scopeIndex].farJumps, false)
+
 	return &bytecode.Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
+		SourceMap:    sourceMap,
+		GlobalNames:  c.symbolTable.DefinitionNames(),
 	}
 }
 
@@ -803,6 +966,7 @@ func (c *Compiler) enterScope() {
 	c.scopes = append(c.scopes, scope)
 	c.scopeIndex++
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+	c.typeTable = NewEnclosedTypeTable(c.typeTable)
 }
 
 func (c *Compiler) leaveScope() code.Instructions {
@@ -813,6 +977,10 @@ func (c *Compiler) leaveScope() code.Instructions {
 	currentSymbolTable.Outer = nil
 	c.symbolTable = c.symbolTable.Outer
 	c.symbolTable.Inner = &currentSymbolTable
+	currentTypeTable := *c.typeTable
+	currentTypeTable.Outer = nil
+	c.typeTable = c.typeTable.Outer
+	c.typeTable.Inner = &currentTypeTable
 
 	return instructions
 }
@@ -821,25 +989,127 @@ func (c *Compiler) GetSymbolTable() *SymbolTable {
 	return c.symbolTable
 }
 
+func (c *Compiler) GetTypeTable() *TypeTable {
+	return c.typeTable
+}
+
+// Replaces the type aliases used in a type annotation with their definitions from the type table.
+// Returns an error if an alias is not declared in the current or any outer scope.
+func (c *Compiler) resolveType(sharkType types.ISharkType, pos token.Position) (types.ISharkType, *exception.SharkError) {
+	var err *exception.SharkError
+
+	resolve := func(t types.ISharkType) types.ISharkType {
+		if err != nil || t == nil {
+			return t
+		}
+		var resolved types.ISharkType
+		resolved, err = c.resolveType(t, pos)
+		return resolved
+	}
+
+	switch t := sharkType.(type) {
+	case types.TSharkAlias:
+		if t.Type != nil {
+			return t, nil
+		}
+		symbol, ok := c.typeTable.Resolve(t.Name)
+		if !ok {
+			helpMsg := fmt.Sprintf("Declare the type with 'type %s = ...;' before using it", t.Name)
+			if keyword, ok := closestTypeKeyword(t.Name); ok {
+				helpMsg = fmt.Sprintf("Did you mean '%s'? Otherwise declare the type with 'type %s = ...;'", keyword, t.Name)
+			}
+			return nil, newSharkError(exception.SharkErrorTypeNotFound, t.Name, helpMsg,
+				exception.NewSharkErrorCause("this is not a valid type", pos),
+			)
+		}
+		return symbol.Type, nil
+	case types.TSharkArray:
+		t.Collection = resolve(t.Collection)
+		return t, err
+	case types.TSharkHashMap:
+		t.Indexes = resolve(t.Indexes)
+		t.Collects = resolve(t.Collects)
+		return t, err
+	case types.TSharkTuple:
+		if t.Collection != nil {
+			collection := make([]types.ISharkType, len(t.Collection))
+			for i, e := range t.Collection {
+				collection[i] = resolve(e)
+			}
+			t.Collection = collection
+		}
+		return t, err
+	case types.TSharkFuncType:
+		if t.ArgsList != nil {
+			args := make([]types.ISharkType, len(t.ArgsList))
+			for i, arg := range t.ArgsList {
+				args[i] = resolve(arg)
+			}
+			t.ArgsList = args
+		}
+		t.ReturnT = resolve(t.ReturnT)
+		return t, err
+	case types.TSharkOptional:
+		t.Type = resolve(t.Type)
+		return t, err
+	case types.TSharkSpread:
+		t.Type = resolve(t.Type)
+		return t, err
+	case types.TSharkClosure:
+		t.FuncType = resolve(t.FuncType)
+		return t, err
+	default:
+		return sharkType, nil
+	}
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	// TODO: Add detection for duplicate constants for functions and closures
-	if !obj.Type().Is(types.TSharkFuncType{}) && !obj.Type().Is(types.TSharkClosure{}) {
-		for i, constant := range c.constants {
-
-			if constant.Type().Is(obj.Type()) && constant.Inspect() == obj.Inspect() {
-				return i
+	if isReusable(obj) {
+		// The constants are indexed lazily, the ones given to NewWithState included
+		if c.constantIndexes == nil {
+			c.constantIndexes = make(map[string]int)
+		}
+		for ; c.indexedConstants < len(c.constants); c.indexedConstants++ {
+			constant := c.constants[c.indexedConstants]
+			if _, ok := c.constantIndexes[constantKey(constant)]; !ok && isReusable(constant) {
+				c.constantIndexes[constantKey(constant)] = c.indexedConstants
 			}
 		}
+		if i, ok := c.constantIndexes[constantKey(obj)]; ok {
+			return i
+		}
 	}
 	c.constants = append(c.constants, obj)
 
 	return len(c.constants) - 1
 }
 
+func isReusable(obj object.Object) bool {
+	return !obj.Type().Is(types.TSharkFuncType{}) && !obj.Type().Is(types.TSharkClosure{})
+}
+
+// Two constants of the same type and with the same value have the same key.
+func constantKey(obj object.Object) string {
+	return obj.Type().SharkTypeString() + " " + obj.Inspect()
+}
+
 func (c *Compiler) emit(sharkType types.ISharkType, op code.Opcode, operands ...int) int {
-	ins := code.Make(op, operands...)
+	ins, err := code.Encode(op, operands...)
+	if err != nil && c.encodeErr == nil {
+		c.encodeErr = operandTooLarge(op, err, c.currentPos)
+	}
+	// A wide operand holds more globals than the VM has
+	if isGlobalOp(op) && operands[0] >= c.globalsSize && c.encodeErr == nil {
+		err := fmt.Errorf("global %d does not fit in the %d globals of the VM", operands[0], c.globalsSize)
+		c.encodeErr = operandTooLarge(op, err, c.currentPos)
+	}
 	pos := c.addInstruction(ins)
 
+	if hasSideEffect(op) {
+		c.markImpure()
+	}
+
 	c.setLastInstruction(op, pos)
 	c.lastCompiledType = sharkType
 
@@ -857,6 +1127,7 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
 	c.scopes[c.scopeIndex].instructions = updatedInstructions
+	c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Add(posNewInstruction, c.currentPos)
 
 	return posNewInstruction
 }
@@ -875,6 +1146,7 @@ func (c *Compiler) removeLastPop() {
 	oldInstructions := c.currentInstructions()
 	newInstructions := oldInstructions[:last.position]
 	c.scopes[c.scopeIndex].instructions = newInstructions
+	c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Truncate(last.position)
 	c.scopes[c.scopeIndex].lastInstruction = previous
 }
 
@@ -889,12 +1161,57 @@ func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 func (c *Compiler) changeOperand(opPos, operand int) {
 	op := code.Opcode(c.currentInstructions()[opPos])
 	newInstruction := code.Make(op, operand)
+	// A wide instruction does not fit in the place of the one emitted
+	if newInstruction[0] == byte(code.OpWide) {
+		if c.scopes[c.scopeIndex].farJumps == nil {
+			c.scopes[c.scopeIndex].farJumps = make(map[int]int)
+		}
+		c.scopes[c.scopeIndex].farJumps[opPos] = operand
+		return
+	}
 	c.replaceInstruction(opPos, newInstruction)
 }
 
+func isGlobalOp(op code.Opcode) bool {
+	switch op {
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpIncrementGlobal, code.OpDecrementGlobal:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the error for an instruction whose operands do not fit even in its wide form.
+func operandTooLarge(op code.Opcode, err error, pos token.Position) *exception.SharkError {
+	var kind string
+	switch op {
+	case code.OpConstant:
+		kind = "constants"
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpIncrementGlobal, code.OpDecrementGlobal:
+		kind = "globals"
+	case code.OpGetLocal, code.OpSetLocal, code.OpIncrementLocal, code.OpDecrementLocal, code.OpSetLocalDefault:
+		kind = "locals"
+	case code.OpGetFree, code.OpClosure:
+		kind = "free variables"
+	case code.OpCall:
+		kind = "arguments"
+	case code.OpArray, code.OpHash, code.OpTuple, code.OpTupleDeconstruct, code.OpConcat:
+		kind = "elements"
+	default:
+		kind = "instructions"
+	}
+	return newSharkError(exception.SharkErrorOperandTooLarge, kind,
+		"Split the code into smaller functions",
+		exception.NewSharkErrorCause(err.Error(), pos),
+	)
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
+		if !isConstantGlobal(s) {
+			c.markImpure()
+		}
 		c.emit(s.ObjType, code.OpGetGlobal, s.Index)
 	case LocalScope:
 		c.emit(s.ObjType, code.OpGetLocal, s.Index)
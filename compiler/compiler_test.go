@@ -3,10 +3,15 @@ package compiler
 import (
 	"fmt"
 	"shark/ast"
+	"shark/bytecode"
 	"shark/code"
+	"shark/config"
+	"shark/exception"
 	"shark/lexer"
 	"shark/object"
 	"shark/parser"
+	"shark/token"
+	"strings"
 	"testing"
 )
 
@@ -152,11 +157,11 @@ func TestBooleanExpressions(t *testing.T) {
 			},
 			{
 				input:             "1 < 2",
-				expectedConstants: []interface{}{2, 1},
+				expectedConstants: []interface{}{1, 2},
 				expectedInstructions: []code.Instructions{
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpConstant, 1),
-					code.Make(code.OpGreaterThan),
+					code.Make(code.OpLessThan),
 					code.Make(code.OpPop),
 				},
 			},
@@ -172,11 +177,11 @@ func TestBooleanExpressions(t *testing.T) {
 			},
 			{
 				input:             "1 <= 2",
-				expectedConstants: []interface{}{2, 1},
+				expectedConstants: []interface{}{1, 2},
 				expectedInstructions: []code.Instructions{
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpConstant, 1),
-					code.Make(code.OpGreaterThanEqual),
+					code.Make(code.OpLessThanEqual),
 					code.Make(code.OpPop),
 				},
 			},
@@ -385,18 +390,20 @@ func TestWhileStatement(t *testing.T) {
 					// 0003
 					code.Make(code.OpSetGlobal, 0),
 					// 0006
-					code.Make(code.OpConstant, 1),
-					// 0009
 					code.Make(code.OpGetGlobal, 0),
+					// 0009
+					code.Make(code.OpConstant, 1),
 					// 0012
-					code.Make(code.OpGreaterThan),
+					code.Make(code.OpLessThan),
 					// 0013
-					code.Make(code.OpJumpNotTruthy, 25),
+					code.Make(code.OpJumpNotTruthy, 26),
 					// 0016
 					code.Make(code.OpGetGlobal, 0),
 					// 0019
 					code.Make(code.OpIncrementGlobal, 0),
 					// 0022
+					code.Make(code.OpPop),
+					// 0023
 					code.Make(code.OpJump, 6),
 				},
 			},
@@ -841,9 +848,82 @@ func TestStringExpressions(t *testing.T) {
 					code.Make(code.OpPop),
 				},
 			},
+			{
+				input:             `"a" == 'a'; 'a' < 'b'`,
+				expectedConstants: []interface{}{"a", 'a', 'b'},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpEqual),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpLessThan),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+		runCompilerTests(t, tests)
+	})
+
+	t.Run("should concatenate the parts of interpolated strings", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             `let name = "shark"; "Hello ${name}, ${1 + 2}!"`,
+				expectedConstants: []interface{}{"shark", "Hello ", ", ", 1, 2, "!"},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpConstant, 4),
+					code.Make(code.OpAdd),
+					code.Make(code.OpConstant, 5),
+					code.Make(code.OpConcat, 5),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             `"${true}${[1]}"`,
+				expectedConstants: []interface{}{1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpConcat, 2),
+					code.Make(code.OpPop),
+				},
+			},
 		}
 		runCompilerTests(t, tests)
 	})
+
+	t.Run("should type interpolated strings as strings", func(t *testing.T) {
+		input := "let n = 1; let s: string = \"${n}\" + `${n}`;"
+
+		program := parse(input)
+		compiler := New()
+		if err, _ := compiler.Compile(program); err != nil {
+			t.Errorf("compiler error for %s: %s", input, err.Error())
+		}
+	})
+
+	t.Run("should type strings added to chars as strings", func(t *testing.T) {
+		tests := []string{
+			`let s: string = "a" + 'b';`,
+			`let s: string = 'a' + "b";`,
+		}
+
+		for _, input := range tests {
+			program := parse(input)
+			compiler := New()
+			if err, _ := compiler.Compile(program); err != nil {
+				t.Errorf("compiler error for %s: %s", input, err.Error())
+			}
+		}
+	})
 }
 
 func TestArrayLiterals(t *testing.T) {
@@ -1161,6 +1241,52 @@ func TestFunction(t *testing.T) {
 	})
 }
 
+func TestTests(t *testing.T) {
+	t.Run("should compile tests to functions that are never called", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input: `test "adds" { assert(1 + 2 == 3); }`,
+				expectedConstants: []interface{}{
+					1,
+					2,
+					3,
+					[]code.Instructions{
+						code.Make(code.OpGetBuiltin, 8),
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpConstant, 1),
+						code.Make(code.OpAdd),
+						code.Make(code.OpConstant, 2),
+						code.Make(code.OpEqual),
+						code.Make(code.OpTailCall, 1),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 3, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+
+		runCompilerTests(t, tests)
+	})
+
+	t.Run("should reject tests that are not at the top level", func(t *testing.T) {
+		inputs := []string{
+			`let f = () => { test "nested" { 1 } };`,
+			`if (true) { test "nested" { 1 } }`,
+		}
+
+		for _, input := range inputs {
+			compiler := New()
+			err, _ := compiler.Compile(parse(input))
+			if err == nil || err.ErrCode != exception.SharkErrorNestedTest {
+				t.Errorf("expected a nested test error for %q, got %+v", input, err)
+			}
+		}
+	})
+}
+
 func TestFunctionWithoutReturnValue(t *testing.T) {
 	t.Run("should compile function literals without return value", func(t *testing.T) {
 		tests := []compilerTestCase{
@@ -1466,7 +1592,7 @@ func TestBuiltins(t *testing.T) {
 					[]code.Instructions{
 						code.Make(code.OpGetBuiltin, 2),
 						code.Make(code.OpArray, 0),
-						code.Make(code.OpCall, 1),
+						code.Make(code.OpTailCall, 1),
 						code.Make(code.OpReturnValue),
 					},
 				},
@@ -1625,7 +1751,7 @@ func TestRecursiveFunctions(t *testing.T) {
 						code.Make(code.OpGetLocal, 0),
 						code.Make(code.OpConstant, 0),
 						code.Make(code.OpSub),
-						code.Make(code.OpCall, 1),
+						code.Make(code.OpTailCall, 1),
 						code.Make(code.OpReturnValue),
 					},
 				},
@@ -1653,7 +1779,7 @@ func TestRecursiveFunctions(t *testing.T) {
 						code.Make(code.OpGetLocal, 0),
 						code.Make(code.OpConstant, 0),
 						code.Make(code.OpSub),
-						code.Make(code.OpCall, 1),
+						code.Make(code.OpTailCall, 1),
 						code.Make(code.OpReturnValue),
 					},
 					[]code.Instructions{
@@ -1661,7 +1787,7 @@ func TestRecursiveFunctions(t *testing.T) {
 						code.Make(code.OpSetLocal, 0),
 						code.Make(code.OpGetLocal, 0),
 						code.Make(code.OpConstant, 0),
-						code.Make(code.OpCall, 1),
+						code.Make(code.OpTailCall, 1),
 						code.Make(code.OpReturnValue),
 					},
 				},
@@ -1680,40 +1806,601 @@ func TestRecursiveFunctions(t *testing.T) {
 	})
 }
 
-func runCompilerTests(t *testing.T, tests []compilerTestCase) {
-	t.Helper()
-
-	for _, tt := range tests {
-		program := parse(tt.input)
+func TestTailCalls(t *testing.T) {
+	t.Run("should compile calls in tail position to tail calls", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input: "let f = (x) => { if (x) { f(1) } else { 2 } };",
+				expectedConstants: []interface{}{
+					1,
+					2,
+					[]code.Instructions{
+						// 0000
+						code.Make(code.OpGetLocal, 0),
+						// 0002
+						code.Make(code.OpJumpNotTruthy, 14),
+						// 0005
+						code.Make(code.OpCurrentClosure),
+						// 0006
+						code.Make(code.OpConstant, 0),
+						// 0009
+						code.Make(code.OpTailCall, 1),
+						// 0011
+						code.Make(code.OpJump, 17),
+						// 0014
+						code.Make(code.OpConstant, 1),
+						// 0017
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 2, 0),
+					code.Make(code.OpSetGlobal, 0),
+				},
+			},
+			{
+				input: "let f = (x) => { f(x) + 1 };",
+				expectedConstants: []interface{}{
+					1,
+					[]code.Instructions{
+						code.Make(code.OpCurrentClosure),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpCall, 1),
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpAdd),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetGlobal, 0),
+				},
+			},
+			{
+				input: "let f = (x) => { x }; f(1);",
+				expectedConstants: []interface{}{
+					[]code.Instructions{
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpReturnValue),
+					},
+					1,
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 0, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPop),
+				},
+			},
+		}
 
-		compiler := New()
+		runCompilerTests(t, tests)
+	})
+}
 
-		if err, _ := compiler.Compile(program); err != nil {
-			t.Fatalf("compiler error: %+v", err)
+func TestConstantFolding(t *testing.T) {
+	t.Run("should fold constant expressions at O1", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "1 + 2 * 3",
+				expectedConstants: []interface{}{7},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "-(2 ** 3) + 10 / 3",
+				expectedConstants: []interface{}{-5},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             `"sh" + "ark"`,
+				expectedConstants: []interface{}{"shark"},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             `1 < 2 && "a" != "b"`,
+				expectedConstants: []interface{}{},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "!(3 >= 4) == false",
+				expectedConstants: []interface{}{},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpFalse),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             `"${1 + 2} ${'a'} ${true}"`,
+				expectedConstants: []interface{}{"3 a true"},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "let a = 2; a * (3 + 4)",
+				expectedConstants: []interface{}{2, 7},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpMul),
+					code.Make(code.OpPop),
+				},
+			},
 		}
 
-		bytecode := compiler.Bytecode()
+		runOptimizedCompilerTests(t, O1, tests)
+	})
 
-		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
-			t.Fatalf("testInstructions failed: %s", err)
+	t.Run("should leave expressions failing at runtime unfolded", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "1 / 0",
+				expectedConstants: []interface{}{1, 0},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpDiv),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             `"a" == 1`,
+				expectedConstants: []interface{}{"a", 1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpEqual),
+					code.Make(code.OpPop),
+				},
+			},
 		}
 
-		if err := testConstants(t, tt.expectedConstants, bytecode.Constants); err != nil {
-			t.Fatalf("testConstants failed: %s", err)
+		runOptimizedCompilerTests(t, O1, tests)
+	})
+
+	t.Run("should not fold at O0", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "1 + 2",
+				expectedConstants: []interface{}{1, 2},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpPop),
+				},
+			},
 		}
-	}
-}
 
-func parse(input string) *ast.Program {
-	l := lexer.New(&input)
-	p := parser.New(l)
-	return p.ParseProgram()
+		runOptimizedCompilerTests(t, O0, tests)
+	})
 }
 
-func testInstructions(expected []code.Instructions, actual code.Instructions) error {
-	concatted := concatInstructions(expected)
-
-	if len(actual) != len(concatted) {
+func TestBranchElimination(t *testing.T) {
+	t.Run("should only compile the branch taken by a constant condition at O1", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "if (true) { 10 } else { 20 }; 3333;",
+				expectedConstants: []interface{}{10, 20, 3333},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "if (1 > 2) { 10 }; 3333;",
+				expectedConstants: []interface{}{10, 3333},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "while (false) { 10; }; 3333;",
+				expectedConstants: []interface{}{10, 3333},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "while (true) { 10; }; 3333;",
+				expectedConstants: []interface{}{10, 3333},
+				expectedInstructions: []code.Instructions{
+					// 0000
+					code.Make(code.OpConstant, 0),
+					// 0003
+					code.Make(code.OpPop),
+					// 0004
+					code.Make(code.OpJump, 0),
+				},
+			},
+			{
+				input: "let f = () => { if (true) { return 1; }; return 2; };",
+				expectedConstants: []interface{}{
+					1,
+					2,
+					[]code.Instructions{
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 2, 0),
+					code.Make(code.OpSetGlobal, 0),
+				},
+			},
+		}
+
+		runOptimizedCompilerTests(t, O1, tests)
+	})
+}
+
+func TestJumpThreading(t *testing.T) {
+	t.Run("should thread jumps landing on jumps at O2", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "let x = true; let y = true; if (x) { if (y) { 1 } else { 2 } } else { 3 };",
+				expectedConstants: []interface{}{1, 2, 3},
+				expectedInstructions: []code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpSetGlobal, 0),
+					// 0004
+					code.Make(code.OpTrue),
+					// 0005
+					code.Make(code.OpSetGlobal, 1),
+					// 0008
+					code.Make(code.OpGetGlobal, 0),
+					// 0011
+					code.Make(code.OpJumpNotTruthy, 32),
+					// 0014
+					code.Make(code.OpGetGlobal, 1),
+					// 0017
+					code.Make(code.OpJumpNotTruthy, 26),
+					// 0020
+					code.Make(code.OpConstant, 0),
+					// 0023
+					code.Make(code.OpJump, 35),
+					// 0026
+					code.Make(code.OpConstant, 1),
+					// 0029
+					code.Make(code.OpJump, 35),
+					// 0032
+					code.Make(code.OpConstant, 2),
+					// 0035
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input: "let f = (x) => { if (x) { 1 } else { 2 } };",
+				expectedConstants: []interface{}{
+					1,
+					2,
+					[]code.Instructions{
+						// 0000
+						code.Make(code.OpGetLocal0),
+						// 0001
+						code.Make(code.OpJumpNotTruthy, 8),
+						// 0004
+						code.Make(code.OpConstant, 0),
+						// 0007
+						code.Make(code.OpReturnValue),
+						// 0008
+						code.Make(code.OpConstant, 1),
+						// 0011
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 2, 0),
+					code.Make(code.OpSetGlobal, 0),
+				},
+			},
+		}
+
+		runOptimizedCompilerTests(t, O2, tests)
+	})
+}
+
+func TestDeadStoreRemoval(t *testing.T) {
+	t.Run("should remove stores to locals that are never read at O2", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input: "let f = () => { let mut a = 1; let b = 2; a = 3; return a; };",
+				expectedConstants: []interface{}{
+					1,
+					2,
+					3,
+					[]code.Instructions{
+						code.Make(code.OpConstant, 2),
+						code.Make(code.OpSetLocal, 0),
+						code.Make(code.OpGetLocal0),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 3, 0),
+					code.Make(code.OpSetGlobal, 0),
+				},
+			},
+			{
+				input: "let f = () => { let mut a = 1; while (a > 0) { a = a - 1; }; let b = a; return 0; };",
+				expectedConstants: []interface{}{
+					1,
+					0,
+					[]code.Instructions{
+						// 0000
+						code.Make(code.OpConstant, 0),
+						// 0003
+						code.Make(code.OpSetLocal, 0),
+						// 0005
+						code.Make(code.OpGetLocal0),
+						// 0006
+						code.Make(code.OpConstant, 1),
+						// 0009
+						code.Make(code.OpGreaterThan),
+						// 0010
+						code.Make(code.OpJumpNotTruthy, 22),
+						// 0013
+						code.Make(code.OpSubLocalConst, 0, 0),
+						// 0017
+						code.Make(code.OpSetLocal, 0),
+						// 0019
+						code.Make(code.OpJump, 5),
+						// 0022
+						code.Make(code.OpConstant, 1),
+						// 0025
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 2, 0),
+					code.Make(code.OpSetGlobal, 0),
+				},
+			},
+		}
+
+		runOptimizedCompilerTests(t, O2, tests)
+	})
+
+	t.Run("should keep the stores to globals", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "let mut a = 1; a = 2;",
+				expectedConstants: []interface{}{1, 2},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+
+		runOptimizedCompilerTests(t, O2, tests)
+	})
+
+	t.Run("should keep the last value the main program pops", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "let mut a = 1; a = 2; a; a = 3;",
+				expectedConstants: []interface{}{1, 2, 3},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+
+		runOptimizedCompilerTests(t, O2, tests)
+	})
+}
+
+func TestPurity(t *testing.T) {
+	t.Run("should infer which functions are pure", func(t *testing.T) {
+		tests := []struct {
+			input string
+			pure  bool
+			memo  object.MemoMode
+		}{
+			{input: `let f = (a: i64, b: i64) => { a * b + 1 };`, pure: true},
+			{input: `let f = (a: array<i64>) => { len(a) };`, pure: true},
+			{input: `let f = (n: i64): i64 => { if (n < 2) { return n; } f(n - 1) + f(n - 2) };`, pure: true},
+			{input: `let k = 10; let f = (n: i64) => { n + k };`, pure: true},
+			{input: `let g = (n: i64) => { n * 2 }; let f = (n: i64) => { g(n) + 1 };`, pure: true},
+			{input: `let f = (n: i64) => { let mut a = n; a++; a };`, pure: true},
+			{input: `let f = (n: i64) => { puts(n); n };`, pure: false},
+			{input: `let mut c = 0; let f = (n: i64) => { c = n; n };`, pure: false},
+			{input: `let mut c = 0; let f = (n: i64) => { c++; n };`, pure: false},
+			{input: `let mut c = 0; let f = (n: i64) => { n + c };`, pure: false},
+			{input: `let f = (g: func<(i64)->i64>) => { g(1) };`, pure: false},
+			{input: `let f = (n: i64) => { let mut b = [n]; b[0] = 1; n };`, pure: false},
+			{input: `let g = (n: i64) => { puts(n); n }; let f = (n: i64) => { g(n) };`, pure: false},
+			{input: `let f = @memo (n: i64) => { puts(n); n };`, pure: false, memo: object.MemoAlways},
+			{input: `let f = @nomemo (n: i64) => { n };`, pure: true, memo: object.MemoNever},
+		}
+
+		for _, tt := range tests {
+			compiler := New()
+			if err, _ := compiler.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error for %q: %+v", tt.input, err)
+			}
+
+			var fn *object.CompiledFunction
+			for _, constant := range compiler.Bytecode().Constants {
+				if f, ok := constant.(*object.CompiledFunction); ok && f.Name == "f" {
+					fn = f
+				}
+			}
+			if fn == nil {
+				t.Fatalf("no function 'f' compiled for %q", tt.input)
+			}
+
+			if fn.Pure != tt.pure {
+				t.Errorf("wrong purity for %q. want=%t, got=%t", tt.input, tt.pure, fn.Pure)
+			}
+			if fn.Memo != tt.memo {
+				t.Errorf("wrong memo mode for %q. want=%d, got=%d", tt.input, tt.memo, fn.Memo)
+			}
+		}
+	})
+
+	t.Run("should reject unknown and conflicting annotations", func(t *testing.T) {
+		inputs := []string{
+			`let f = @fast (n: i64) => { n };`,
+			`let f = @memo @nomemo (n: i64) => { n };`,
+		}
+
+		for _, input := range inputs {
+			compiler := New()
+			err, _ := compiler.Compile(parse(input))
+			if err == nil || err.ErrCode != exception.SharkErrorInvalidAnnotation {
+				t.Errorf("expected an invalid annotation error for %q, got %+v", input, err)
+			}
+		}
+	})
+}
+
+func TestReferences(t *testing.T) {
+	t.Run("should resolve every identifier to its binding", func(t *testing.T) {
+		input := `let mut x = 1;
+let f = (a: i64, x: i64): i64 => { let g = () => { f(a, x) }; a + x };
+x = f(x, 2);`
+
+		compiler := New()
+		if err, _ := compiler.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %+v", err)
+		}
+
+		type key struct{ line, col int }
+		bindings := make(map[key]*token.Position)
+		for _, ref := range compiler.References() {
+			bindings[key{ref.Pos.Line, ref.Pos.ColFrom}] = ref.Binding
+		}
+
+		// Each group lists the positions of the identifiers of one binding, its definition first
+		groups := [][]key{
+			{{1, 9}, {3, 1}, {3, 7}},
+			{{2, 5}, {2, 52}, {3, 5}},
+			{{2, 10}, {2, 54}, {2, 63}},
+			{{2, 18}, {2, 57}, {2, 67}},
+			{{2, 40}},
+		}
+
+		for _, group := range groups {
+			definition, ok := bindings[group[0]]
+			if !ok || definition == nil {
+				t.Fatalf("no binding for the definition at %v", group[0])
+			}
+			for _, k := range group[1:] {
+				if bindings[k] != definition {
+					t.Errorf("identifier at %v does not resolve to the definition at %v", k, group[0])
+				}
+			}
+		}
+
+		if len(bindings) != 13 {
+			t.Errorf("wrong number of references. want=13, got=%d", len(bindings))
+		}
+	})
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+
+		if err, _ := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %+v", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
+			t.Fatalf("testInstructions failed: %s", err)
+		}
+
+		if err := testConstants(t, tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("testConstants failed: %s", err)
+		}
+	}
+}
+
+// Compiles the tests at the given optimization level, the optimized bytecode has to pass the verifier.
+func runOptimizedCompilerTests(t *testing.T, level OptimizationLevel, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		compiler.SetOptimizationLevel(level)
+
+		if err, _ := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %+v", err)
+		}
+
+		bc := compiler.Bytecode()
+
+		if err := testInstructions(tt.expectedInstructions, bc.Instructions); err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		if err := testConstants(t, tt.expectedConstants, bc.Constants); err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+
+		conf := config.NewDefaultVmConf()
+		if err := bytecode.Verify(bc, &conf); err != nil {
+			t.Fatalf("bytecode error for %q: %s", tt.input, err.Error())
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(&input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
 		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q", concatted, actual)
 	}
 
@@ -1752,6 +2439,14 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err := testStringObject(constant, actual[i]); err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
+		case rune:
+			char, ok := actual[i].(*object.Char)
+			if !ok {
+				return fmt.Errorf("constant %d - object is not Char. got=%T (%+v)", i, actual[i], actual[i])
+			}
+			if char.Value != constant {
+				return fmt.Errorf("constant %d - object has wrong value. got=%q, want=%q", i, char.Value, constant)
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -1792,3 +2487,113 @@ func testIntegerObject(expected int64, actual object.Object) error {
 
 	return nil
 }
+
+func TestWideOperands(t *testing.T) {
+	t.Run("should prefix the operands past their width with OpWide", func(t *testing.T) {
+		var input strings.Builder
+		input.WriteString("let f = () => {\n")
+		for i := 0; i < 300; i++ {
+			fmt.Fprintf(&input, "\tlet v%d = %d;\n", i, i)
+		}
+		input.WriteString("\tv299\n};")
+
+		compiler := New()
+		if err, _ := compiler.Compile(parse(input.String())); err != nil {
+			t.Fatalf("compiler error: %+v", err)
+		}
+		bc := compiler.Bytecode()
+
+		fn := bc.Constants[len(bc.Constants)-1].(*object.CompiledFunction)
+		expected := concatInstructions([]code.Instructions{
+			code.Make(code.OpConstant, 299),
+			code.Make(code.OpSetLocal, 299),
+			code.Make(code.OpGetLocal, 299),
+			code.Make(code.OpReturnValue),
+		})
+		if !strings.HasSuffix(string(fn.Instructions), string(expected)) {
+			t.Errorf("wrong end of the function.\nwant=%q\ngot =%q", expected, fn.Instructions[len(fn.Instructions)-len(expected):])
+		}
+
+		conf := config.NewDefaultVmConf()
+		if err := bytecode.Verify(bc, &conf); err != nil {
+			t.Fatalf("bytecode error: %s", err.Error())
+		}
+	})
+	t.Run("should lay out the jumps past 64KiB again at every level", func(t *testing.T) {
+		var input strings.Builder
+		input.WriteString("let mut x = 0;\nif (x == 0) {\n")
+		for i := 0; i < 8000; i++ {
+			input.WriteString("\tx = x + 1;\n")
+		}
+		input.WriteString("} else {\n\tx = 2;\n}\nwhile (x > 0) { x = x - 1; }")
+
+		for _, level := range []OptimizationLevel{O0, O1, O2} {
+			compiler := New()
+			compiler.SetOptimizationLevel(level)
+			if err, _ := compiler.Compile(parse(input.String())); err != nil {
+				t.Fatalf("compiler error: %+v", err)
+			}
+			bc := compiler.Bytecode()
+
+			if len(bc.Instructions) <= 65536 {
+				t.Fatalf("O%d: expected more than 64KiB of instructions, got %d bytes", level, len(bc.Instructions))
+			}
+			jumps := 0
+			for offset := 0; offset < len(bc.Instructions); {
+				in, err := code.ReadInstruction(bc.Instructions[offset:])
+				if err != nil {
+					t.Fatalf("O%d: %s", level, err)
+				}
+				if in.Wide && (in.Op == code.OpJump || in.Op == code.OpJumpNotTruthy) {
+					jumps++
+				}
+				offset += in.Size
+			}
+			// The jumps of the if expression and of the loop are all past 64KiB
+			if jumps != 4 {
+				t.Errorf("O%d: expected 4 wide jumps, got %d", level, jumps)
+			}
+
+			conf := config.NewDefaultVmConf()
+			if err := bytecode.Verify(bc, &conf); err != nil {
+				t.Fatalf("O%d: bytecode error: %s", level, err.Error())
+			}
+		}
+	})
+	t.Run("should report the operands too large for the bytecode", func(t *testing.T) {
+		input := "puts(" + strings.Repeat("0, ", 65535) + "0);"
+
+		compiler := New()
+		err, _ := compiler.Compile(parse(input))
+		if err == nil || err.ErrCode != exception.SharkErrorOperandTooLarge {
+			t.Fatalf("expected an operand error, got %+v", err)
+		}
+		if err.ErrMsg != "too many arguments for the bytecode" {
+			t.Errorf("wrong error message. got=%q", err.ErrMsg)
+		}
+	})
+	t.Run("should report the globals past the ones of the VM", func(t *testing.T) {
+		var input strings.Builder
+		for i := 0; i <= config.NewDefaultVmConf().GlobalsSize; i++ {
+			fmt.Fprintf(&input, "let v%d = 0;\n", i)
+		}
+
+		compiler := New()
+		err, _ := compiler.Compile(parse(input.String()))
+		if err == nil || err.ErrCode != exception.SharkErrorOperandTooLarge {
+			t.Fatalf("expected an operand error, got %+v", err)
+		}
+		if err.ErrMsg != "too many globals for the bytecode" {
+			t.Errorf("wrong error message. got=%q", err.ErrMsg)
+		}
+
+		compiler = New()
+		compiler.SetGlobalsSize(2)
+		if err, _ := compiler.Compile(parse("let a = 1; let b = 2;")); err != nil {
+			t.Fatalf("compiler error: %+v", err)
+		}
+		if err, _ := compiler.Compile(parse("let c = 3;")); err == nil || err.ErrCode != exception.SharkErrorOperandTooLarge {
+			t.Fatalf("expected an operand error, got %+v", err)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"shark/ast"
+	"shark/code"
+	"shark/object"
+	"shark/types"
+	"strings"
+)
+
+// Evaluates an expression made only of literals the same way the VM would. Returns false if
+// the expression is not constant, or if evaluating it fails at runtime, so that the failure
+// still happens when the program runs.
+func foldConstant(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Int64{Value: node.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}, true
+	case *ast.CharLiteral:
+		return &object.Char{Value: node.Value}, true
+	case *ast.Boolean:
+		return &object.Boolean{Value: node.Value}, true
+	case *ast.PrefixExpression:
+		return foldPrefix(node)
+	case *ast.InfixExpression:
+		return foldInfix(node)
+	case *ast.InterpolatedString:
+		return foldInterpolation(node)
+	default:
+		return nil, false
+	}
+}
+
+func foldPrefix(node *ast.PrefixExpression) (object.Object, bool) {
+	if node.Operator != "!" && node.Operator != "-" {
+		return nil, false
+	}
+
+	right, ok := foldConstant(node.Right)
+	if !ok {
+		return nil, false
+	}
+
+	switch node.Operator {
+	case "!":
+		// Like OpBang, every value but false is truthy
+		if b, ok := right.(*object.Boolean); ok {
+			return &object.Boolean{Value: !b.Value}, true
+		}
+		return &object.Boolean{Value: false}, true
+	default:
+		if i, ok := right.(*object.Int64); ok {
+			return &object.Int64{Value: -i.Value}, true
+		}
+		return nil, false
+	}
+}
+
+func foldInfix(node *ast.InfixExpression) (object.Object, bool) {
+	left, ok := foldConstant(node.Left)
+	if !ok {
+		return nil, false
+	}
+	right, ok := foldConstant(node.Right)
+	if !ok {
+		return nil, false
+	}
+
+	switch l := left.(type) {
+	case *object.Int64:
+		r, ok := right.(*object.Int64)
+		if !ok {
+			return nil, false
+		}
+		return foldIntegerInfix(node.Operator, l.Value, r.Value)
+	case *object.String:
+		r, ok := right.(*object.String)
+		if !ok {
+			return nil, false
+		}
+		switch node.Operator {
+		case "+":
+			return &object.String{Value: l.Value + r.Value}, true
+		case "==":
+			return &object.Boolean{Value: l.Value == r.Value}, true
+		case "!=":
+			return &object.Boolean{Value: l.Value != r.Value}, true
+		}
+	case *object.Boolean:
+		r, ok := right.(*object.Boolean)
+		if !ok {
+			return nil, false
+		}
+		switch node.Operator {
+		case "==":
+			return &object.Boolean{Value: l.Value == r.Value}, true
+		case "!=":
+			return &object.Boolean{Value: l.Value != r.Value}, true
+		case "&&":
+			return &object.Boolean{Value: l.Value && r.Value}, true
+		case "||":
+			return &object.Boolean{Value: l.Value || r.Value}, true
+		}
+	}
+
+	return nil, false
+}
+
+// Like OpConcat, every part is written the way it is printed.
+func foldInterpolation(node *ast.InterpolatedString) (object.Object, bool) {
+	var out strings.Builder
+	for _, part := range node.Parts {
+		obj, ok := foldConstant(part)
+		if !ok {
+			return nil, false
+		}
+		out.WriteString(obj.Inspect())
+	}
+	return &object.String{Value: out.String()}, true
+}
+
+func foldIntegerInfix(operator string, left, right int64) (object.Object, bool) {
+	switch operator {
+	case "+":
+		return &object.Int64{Value: left + right}, true
+	case "-":
+		return &object.Int64{Value: left - right}, true
+	case "*":
+		return &object.Int64{Value: left * right}, true
+	case "/":
+		if right == 0 {
+			return nil, false
+		}
+		return &object.Int64{Value: left / right}, true
+	case "**":
+		return &object.Int64{Value: intPow(left, right)}, true
+	case "==":
+		return &object.Boolean{Value: left == right}, true
+	case "!=":
+		return &object.Boolean{Value: left != right}, true
+	case ">":
+		return &object.Boolean{Value: left > right}, true
+	case ">=":
+		return &object.Boolean{Value: left >= right}, true
+	case "<":
+		return &object.Boolean{Value: left < right}, true
+	case "<=":
+		return &object.Boolean{Value: left <= right}, true
+	default:
+		return nil, false
+	}
+}
+
+// Same as the VM's exponentiation, negative exponents give 1.
+func intPow(a, b int64) int64 {
+	result := int64(1)
+	for b > 0 {
+		if b&1 == 1 {
+			result *= a
+		}
+		a *= a
+		b >>= 1
+	}
+	return result
+}
+
+// Emits a folded constant with the type the unfolded expression would have had.
+func (c *Compiler) emitConstant(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		if obj.Value {
+			c.emit(types.TSharkBool{}, code.OpTrue)
+		} else {
+			c.emit(types.TSharkBool{}, code.OpFalse)
+		}
+	case *object.Int64:
+		c.emit(types.TSharkI64{}, code.OpConstant, c.addConstant(obj))
+	case *object.String:
+		c.emit(types.TSharkString{}, code.OpConstant, c.addConstant(obj))
+	}
+}
@@ -0,0 +1,466 @@
+package compiler
+
+import (
+	"shark/code"
+	"shark/token"
+)
+
+type OptimizationLevel int
+
+const (
+	// Emits the instructions as they are compiled.
+	O0 OptimizationLevel = iota
+	// Folds constant expressions, removes the branches that a constant condition never takes
+	// and the code that can never run.
+	O1
+	// Also threads jumps through other jumps, removes stores to locals that are never read
+	// again and values that are pushed only to be popped, and fuses common sequences of
+	// instructions into superinstructions.
+	O2
+)
+
+// Sets how much the compiler optimizes the instructions it emits, O0 by default.
+func (c *Compiler) SetOptimizationLevel(level OptimizationLevel) {
+	c.optimizationLevel = level
+}
+
+// A decoded instruction. Jumps refer to the index of the instruction they land on instead
+// of its offset, so instructions can be removed without patching every jump.
+type optInstruction struct {
+	operands []int
+	pos      token.Position
+	op       code.Opcode
+	// Index of the instruction a jump lands on, or the number of instructions for the end.
+	target  int
+	removed bool
+}
+
+type optimizer struct {
+	instructions []*optInstruction
+	// Locals are only removed from functions, globals outlive the main program.
+	isFunction bool
+}
+
+// Optimizes the instructions of the current scope at the given level, the source map is
+// moved along with the instructions. The instructions are laid out again whatever the level
+// when some jumps are too far to have been patched in place, farJumps gives their targets.
+func (c *Compiler) optimize(ins code.Instructions, sourceMap code.SourceMap, farJumps map[int]int, isFunction bool) (code.Instructions, code.SourceMap) {
+	if (c.optimizationLevel < O1 && len(farJumps) == 0) || len(ins) == 0 {
+		return ins, sourceMap
+	}
+
+	o := newOptimizer(ins, sourceMap, farJumps, isFunction)
+
+	for changed := c.optimizationLevel >= O1; changed; {
+		changed = o.removeConstantConditions()
+		changed = o.removeUnreachable() || changed
+		changed = o.removeJumpsToNext() || changed
+
+		if c.optimizationLevel >= O2 {
+			changed = o.threadJumps() || changed
+			changed = o.removeDeadStores() || changed
+			changed = o.removeDeadPushes() || changed
+		}
+	}
+
+	// The other passes only know the instructions the compiler emits
+	if c.optimizationLevel >= O2 {
+		o.fuseSuperinstructions()
+	}
+
+	return o.encode()
+}
+
+func newOptimizer(ins code.Instructions, sourceMap code.SourceMap, farJumps map[int]int, isFunction bool) *optimizer {
+	o := &optimizer{isFunction: isFunction}
+	indexOf := make(map[int]int)
+	var offsets []int
+
+	for offset := 0; offset < len(ins); {
+		in, err := code.ReadInstruction(ins[offset:])
+		if err != nil {
+			panic(err)
+		}
+		pos, _ := sourceMap.PositionAt(offset)
+
+		indexOf[offset] = len(o.instructions)
+		offsets = append(offsets, offset)
+		o.instructions = append(o.instructions, &optInstruction{op: in.Op, operands: in.Operands, pos: pos})
+		offset += in.Size
+	}
+	indexOf[len(ins)] = len(o.instructions)
+
+	for i, in := range o.instructions {
+		if code.IsJump(in.op) {
+			target, ok := farJumps[offsets[i]]
+			if !ok {
+				target = in.operands[len(in.operands)-1]
+			}
+			in.target = indexOf[target]
+		}
+	}
+
+	return o
+}
+
+// Returns the index of the first instruction from i on that was not removed. Control
+// reaching a removed instruction falls through to it.
+func (o *optimizer) resolve(i int) int {
+	for i < len(o.instructions) && o.instructions[i].removed {
+		i++
+	}
+	return i
+}
+
+// Returns the instructions that some jump lands on.
+func (o *optimizer) jumpTargets() map[int]bool {
+	targets := make(map[int]bool)
+	for _, in := range o.instructions {
+		if !in.removed && code.IsJump(in.op) {
+			targets[o.resolve(in.target)] = true
+		}
+	}
+	return targets
+}
+
+// Replaces 'OpTrue; OpJumpNotTruthy' with nothing, and 'OpFalse; OpJumpNotTruthy' with
+// an unconditional jump, removing the branch that is never taken from the control flow.
+func (o *optimizer) removeConstantConditions() bool {
+	changed := false
+	targets := o.jumpTargets()
+
+	for i, in := range o.instructions {
+		if in.removed {
+			continue
+		}
+
+		var truthy bool
+		switch in.op {
+		case code.OpTrue:
+			truthy = true
+		case code.OpFalse, code.OpNull:
+			truthy = false
+		default:
+			continue
+		}
+
+		j := o.resolve(i + 1)
+		if j == len(o.instructions) || o.instructions[j].op != code.OpJumpNotTruthy || targets[j] {
+			continue
+		}
+
+		in.removed = true
+		if truthy {
+			o.instructions[j].removed = true
+		} else {
+			o.instructions[j].op = code.OpJump
+		}
+		changed = true
+	}
+
+	return changed
+}
+
+// Removes the instructions that no path from the first instruction reaches.
+func (o *optimizer) removeUnreachable() bool {
+	reached := make([]bool, len(o.instructions))
+	worklist := []int{o.resolve(0)}
+
+	for len(worklist) > 0 {
+		i := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if i == len(o.instructions) || reached[i] {
+			continue
+		}
+		reached[i] = true
+
+		in := o.instructions[i]
+		switch in.op {
+		case code.OpReturn, code.OpReturnValue:
+		case code.OpJump:
+			worklist = append(worklist, o.resolve(in.target))
+		case code.OpJumpNotTruthy:
+			worklist = append(worklist, o.resolve(in.target), o.resolve(i+1))
+		default:
+			worklist = append(worklist, o.resolve(i+1))
+		}
+	}
+
+	changed := false
+	for i, in := range o.instructions {
+		if !in.removed && !reached[i] {
+			in.removed = true
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// Removes jumps to the instruction right after them. A conditional jump still has to pop
+// its condition.
+func (o *optimizer) removeJumpsToNext() bool {
+	changed := false
+
+	for i, in := range o.instructions {
+		if in.removed || !code.IsJump(in.op) || o.resolve(in.target) != o.resolve(i+1) {
+			continue
+		}
+		if in.op == code.OpJump {
+			in.removed = true
+		} else {
+			in.op = code.OpPop
+			in.operands = nil
+		}
+		changed = true
+	}
+
+	return changed
+}
+
+// Makes jumps that land on an unconditional jump go straight to its target, and replaces
+// unconditional jumps to a return with the return itself.
+func (o *optimizer) threadJumps() bool {
+	changed := false
+
+	for _, in := range o.instructions {
+		if in.removed || !code.IsJump(in.op) {
+			continue
+		}
+
+		target := o.resolve(in.target)
+		// A loop made only of jumps never ends, the number of hops is bounded to not follow it forever
+		for hops := 0; hops < len(o.instructions) && target < len(o.instructions); hops++ {
+			next := o.instructions[target]
+			if next.op != code.OpJump || o.resolve(next.target) == target {
+				break
+			}
+			target = o.resolve(next.target)
+		}
+		if target != o.resolve(in.target) {
+			in.target = target
+			changed = true
+		}
+
+		if in.op == code.OpJump && target < len(o.instructions) {
+			switch next := o.instructions[target]; next.op {
+			case code.OpReturn, code.OpReturnValue:
+				in.op = next.op
+				in.operands = nil
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// Replaces stores to a local with a pop when the value is never read: the local is never
+// read at all, or the function returns or stores to it again before reading it.
+func (o *optimizer) removeDeadStores() bool {
+	if !o.isFunction {
+		return false
+	}
+
+	read := make(map[int]bool)
+	for _, in := range o.instructions {
+		switch in.op {
+		case code.OpGetLocal, code.OpIncrementLocal, code.OpDecrementLocal, code.OpSetLocalDefault:
+			if !in.removed {
+				read[in.operands[0]] = true
+			}
+		}
+	}
+
+	changed := false
+	targets := o.jumpTargets()
+
+	for i, in := range o.instructions {
+		if in.removed || in.op != code.OpSetLocal {
+			continue
+		}
+		if read[in.operands[0]] && !o.isOverwritten(i, targets) {
+			continue
+		}
+		in.op = code.OpPop
+		in.operands = nil
+		changed = true
+	}
+
+	return changed
+}
+
+// Reports whether the local stored by the instruction at i is stored again, or the function
+// returns, before it is read. Only the instructions up to the next jump or jump target are
+// followed, past them the value is assumed to be read.
+func (o *optimizer) isOverwritten(i int, targets map[int]bool) bool {
+	local := o.instructions[i].operands[0]
+
+	for j := o.resolve(i + 1); j < len(o.instructions); j = o.resolve(j + 1) {
+		if targets[j] {
+			return false
+		}
+
+		in := o.instructions[j]
+		switch in.op {
+		case code.OpGetLocal, code.OpIncrementLocal, code.OpDecrementLocal, code.OpSetLocalDefault:
+			if in.operands[0] == local {
+				return false
+			}
+		case code.OpSetLocal:
+			if in.operands[0] == local {
+				return true
+			}
+		case code.OpReturn, code.OpReturnValue:
+			return true
+		case code.OpJump, code.OpJumpNotTruthy:
+			return false
+		}
+	}
+
+	return false
+}
+
+// Removes a value that is pushed without side effects and popped right away, like the
+// value of an assignment used as a statement. The last value the main program pops is the
+// value of the program, it is kept.
+func (o *optimizer) removeDeadPushes() bool {
+	changed := false
+	targets := o.jumpTargets()
+
+	for i, in := range o.instructions {
+		if in.removed {
+			continue
+		}
+		switch in.op {
+		case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpGetGlobal, code.OpGetLocal,
+			code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure:
+		default:
+			continue
+		}
+
+		j := o.resolve(i + 1)
+		if j == len(o.instructions) || o.instructions[j].op != code.OpPop || targets[j] {
+			continue
+		}
+		if !o.isFunction && o.resolve(j+1) == len(o.instructions) {
+			continue
+		}
+		in.removed = true
+		o.instructions[j].removed = true
+		changed = true
+	}
+
+	return changed
+}
+
+// Replaces the sequences of instructions that a superinstruction does the work of with it, and
+// the loads of the first locals with the instructions of their own. Only the first instruction
+// of a sequence can be a jump target, the others are only reached through it.
+func (o *optimizer) fuseSuperinstructions() {
+	targets := o.jumpTargets()
+
+	for i := o.resolve(0); i < len(o.instructions); i = o.resolve(i + 1) {
+		var sequence []int
+		var ops []code.Opcode
+		for j := i; j < len(o.instructions) && len(sequence) < code.MaxFusedInstructions; j = o.resolve(j + 1) {
+			if j != i && targets[j] {
+				break
+			}
+			sequence = append(sequence, j)
+			ops = append(ops, o.instructions[j].op)
+		}
+
+		op, n, ok := code.Fuse(ops)
+		if !ok {
+			continue
+		}
+		in := o.instructions[i]
+		var operands []int
+		for _, j := range sequence[:n] {
+			part := o.instructions[j]
+			operands = append(operands, part.operands...)
+			// Errors are reported where the operator is, not at the load of the local
+			if code.IsJump(part.op) {
+				in.target = part.target
+			} else {
+				in.pos = part.pos
+			}
+			if j != i {
+				part.removed = true
+			}
+		}
+		in.op = op
+		in.operands = operands
+	}
+
+	for _, in := range o.instructions {
+		if in.removed || in.op != code.OpGetLocal {
+			continue
+		}
+		if op, ok := code.GetLocalN(in.operands[0]); ok {
+			in.op = op
+			in.operands = nil
+		}
+	}
+}
+
+// Encodes the instructions left, with jumps pointing at their new offsets. A jump to an offset
+// past the width of its operand is wide, which moves the instructions after it, so the offsets
+// are computed again until no other jump has to be widened.
+func (o *optimizer) encode() (code.Instructions, code.SourceMap) {
+	offsets := make([]int, len(o.instructions)+1)
+	wide := make(map[int]bool)
+
+	for changed := true; changed; {
+		offset := 0
+		for i, in := range o.instructions {
+			offsets[i] = offset
+			operands := in.operands
+			if code.IsJump(in.op) {
+				// The width of a jump does not depend on where it jumped before
+				operands = withTarget(in.operands, 0)
+			}
+			switch {
+			case in.removed:
+			case wide[i]:
+				offset += len(code.MakeWide(in.op, operands...))
+			default:
+				offset += len(code.Make(in.op, operands...))
+			}
+		}
+		offsets[len(o.instructions)] = offset
+
+		changed = false
+		for i, in := range o.instructions {
+			if !in.removed && code.IsJump(in.op) && !wide[i] && code.Make(in.op, withTarget(in.operands, offsets[o.resolve(in.target)])...)[0] == byte(code.OpWide) {
+				wide[i] = true
+				changed = true
+			}
+		}
+	}
+
+	ins := make(code.Instructions, 0, offsets[len(o.instructions)])
+	var sourceMap code.SourceMap
+
+	for _, in := range o.instructions {
+		if in.removed {
+			continue
+		}
+		operands := in.operands
+		if code.IsJump(in.op) {
+			operands = withTarget(in.operands, offsets[o.resolve(in.target)])
+		}
+		sourceMap = sourceMap.Add(len(ins), in.pos)
+		ins = append(ins, code.Make(in.op, operands...)...)
+	}
+
+	return ins, sourceMap
+}
+
+// Returns the operands of a jump with the offset it jumps to replaced.
+func withTarget(operands []int, offset int) []int {
+	replaced := append([]int(nil), operands...)
+	replaced[len(replaced)-1] = offset
+	return replaced
+}
@@ -0,0 +1,108 @@
+package compiler
+
+import (
+	"shark/ast"
+	"shark/code"
+	"shark/exception"
+	"shark/object"
+	"shark/types"
+)
+
+// Records that the function being compiled has a side effect, or that its result depends on
+// more than its arguments and the values it closes over, so its calls cannot be memoized.
+func (c *Compiler) markImpure() {
+	c.scopes[c.scopeIndex].impure = true
+}
+
+// Reports whether an instruction changes state that outlives the call of the function it is in.
+func hasSideEffect(op code.Opcode) bool {
+	switch op {
+	case code.OpSetGlobal, code.OpIncrementGlobal, code.OpDecrementGlobal, code.OpIndexAssign:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reports whether a global always holds the same value once it is defined. Arrays and hashes
+// can be changed in place, so only immutable globals of immutable types are constant.
+func isConstantGlobal(s Symbol) bool {
+	if s.Mutable || s.VariadicType {
+		return false
+	}
+
+	switch types.Underlying(s.ObjType).(type) {
+	case types.TSharkI64, types.TSharkBool, types.TSharkString, types.TSharkChar, types.TSharkNull, types.TSharkFuncType, types.TSharkClosure:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reports whether calling the function an expression evaluates to keeps the caller pure: a
+// pure builtin, the function itself, or an immutable binding of a pure function literal.
+func (c *Compiler) isPureCallee(fn ast.Expression) bool {
+	ident, ok := fn.(*ast.Identifier)
+	if !ok {
+		return false
+	}
+
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		return false
+	}
+
+	switch symbol.Scope {
+	case BuiltinScope:
+		return object.Builtins[symbol.Index].Builtin.CanCache
+	case FunctionScope:
+		return true
+	default:
+		return symbol.Pure
+	}
+}
+
+// Returns the function literal compiled by the last instruction, if it is an OpClosure.
+func (c *Compiler) lastCompiledFunction() (*object.CompiledFunction, bool) {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	if !c.lastInstructionIs(code.OpClosure) {
+		return nil, false
+	}
+
+	in, err := code.ReadInstruction(c.currentInstructions()[last.position:])
+	if err != nil {
+		return nil, false
+	}
+	fn, ok := c.constants[in.Operands[0]].(*object.CompiledFunction)
+	return fn, ok
+}
+
+// Returns how the calls of a function literal are memoized from its '@memo' or '@nomemo' annotation.
+func memoMode(node *ast.FunctionLiteral) (object.MemoMode, *exception.SharkError) {
+	mode := object.MemoAuto
+
+	for _, annotation := range node.Annotations {
+		var annotationMode object.MemoMode
+		switch annotation.Name {
+		case "memo":
+			annotationMode = object.MemoAlways
+		case "nomemo":
+			annotationMode = object.MemoNever
+		default:
+			return mode, newSharkError(exception.SharkErrorInvalidAnnotation, annotation.Name,
+				"Use '@memo' to always memoize the calls of the function, or '@nomemo' to never memoize them",
+				exception.NewSharkErrorCause("unknown annotation", annotation.Token.Pos),
+			)
+		}
+
+		if mode != object.MemoAuto && mode != annotationMode {
+			return mode, newSharkError(exception.SharkErrorInvalidAnnotation, annotation.Name,
+				"Remove either '@memo' or '@nomemo'",
+				exception.NewSharkErrorCause("conflicts with a previous annotation", annotation.Token.Pos),
+			)
+		}
+		mode = annotationMode
+	}
+
+	return mode, nil
+}
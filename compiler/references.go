@@ -0,0 +1,50 @@
+package compiler
+
+import (
+	"shark/ast"
+	"shark/token"
+)
+
+// Reference is an identifier of the program resolved to the symbol it names.
+type Reference struct {
+	// Position of the definition the identifier resolves to, the same for every reference to
+	// a binding whatever the scope it is used from. Nil for builtins.
+	Binding *token.Position
+	Symbol  Symbol
+	// Position of the identifier.
+	Pos token.Position
+	// Set for the identifier that defines the binding.
+	Definition bool
+}
+
+// Records that the identifier at pos resolves to the symbol.
+func (c *Compiler) addReference(pos token.Position, symbol Symbol, definition bool) {
+	c.references = append(c.references, Reference{Binding: symbol.Pos, Symbol: symbol, Pos: pos, Definition: definition})
+}
+
+// Records that the name a function literal uses to call itself is the binding it is defined with.
+func (c *Compiler) addFunctionName(node *ast.LetStatement) {
+	fn, ok := node.Value.(*ast.FunctionLiteral)
+	if !ok || fn.Name != node.Name.Value {
+		return
+	}
+	if c.functionNames == nil {
+		c.functionNames = make(map[*token.Position]*token.Position)
+	}
+	c.functionNames[&fn.Token.Pos] = &node.Name.Token.Pos
+}
+
+// References returns the identifiers compiled so far, in the order they were compiled, each
+// resolved to the symbol it names. A function calling itself refers to the binding it is
+// defined with.
+func (c *Compiler) References() []Reference {
+	references := make([]Reference, len(c.references))
+	for i, ref := range c.references {
+		// Also through free variables, when a nested function calls the function
+		if binding, ok := c.functionNames[ref.Binding]; ok {
+			ref.Binding = binding
+		}
+		references[i] = ref
+	}
+	return references
+}
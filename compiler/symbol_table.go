@@ -25,6 +25,8 @@ type Symbol struct {
 	Index        int
 	Mutable      bool
 	VariadicType bool
+	// Set for immutable bindings of pure functions, calling them has no side effects.
+	Pure bool
 }
 
 type SymbolTable struct {
@@ -32,6 +34,7 @@ type SymbolTable struct {
 	Inner          *SymbolTable
 	store          map[string]Symbol
 	FreeSymbols    []Symbol
+	names          []string
 	numDefinitions int
 }
 
@@ -67,11 +70,36 @@ func (s *SymbolTable) Define(name string, mutable, variadicType bool, objType ty
 		Int("index", s.numDefinitions).Msg("Define new symbol")
 
 	s.store[name] = symbol
+	s.names = append(s.names, name)
 	s.numDefinitions++
 
 	return symbol
 }
 
+// DefinitionNames returns the names of the global or local symbols defined in this table,
+// indexed by their symbol index. Shadowed definitions keep their name.
+func (s *SymbolTable) DefinitionNames() []string {
+	return s.names
+}
+
+// MarkPure records that the symbol defined in this table holds a pure function and returns it.
+func (s *SymbolTable) MarkPure(name string) Symbol {
+	symbol := s.store[name]
+	symbol.Pure = true
+	s.store[name] = symbol
+
+	return symbol
+}
+
+// Symbols returns the symbols stored in this table, without the ones of the outer scopes.
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 
@@ -121,7 +149,7 @@ func (s *SymbolTable) DefineBuiltin(index int, name string, objType types.IShark
 func (s *SymbolTable) DefineFree(original Symbol, mutable, variadicType bool, objType types.ISharkType, pos *token.Position) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
 
-	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1, Mutable: mutable, Pos: pos, VariadicType: variadicType, ObjType: objType}
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1, Mutable: mutable, Pos: pos, VariadicType: variadicType, ObjType: objType, Pure: original.Pure}
 
 	s.store[original.Name] = symbol
 
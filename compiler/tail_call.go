@@ -0,0 +1,49 @@
+package compiler
+
+import "shark/code"
+
+// Replaces the calls in tail position of a function with OpTailCall, so the VM can run the
+// called function in the frame of the caller. A call is in tail position when its result is
+// returned right away, either by the next instruction or at the end of the jumps that follow
+// it, like a call ending a branch of an if expression.
+func markTailCalls(ins code.Instructions) {
+	for offset := 0; offset < len(ins); {
+		in, err := code.ReadInstruction(ins[offset:])
+		if err != nil {
+			panic(err)
+		}
+		next := offset + in.Size
+
+		if in.Op == code.OpCall && returnsAt(ins, next) {
+			// The opcode of a wide call follows its prefix
+			if in.Wide {
+				ins[offset+1] = byte(code.OpTailCall)
+			} else {
+				ins[offset] = byte(code.OpTailCall)
+			}
+		}
+		offset = next
+	}
+}
+
+// Reports whether control reaching offset returns the value on top of the stack without
+// running anything else.
+func returnsAt(ins code.Instructions, offset int) bool {
+	// The number of jumps followed is bounded, a loop made only of jumps never returns
+	for hops := 0; hops <= len(ins) && offset < len(ins); hops++ {
+		in, err := code.ReadInstruction(ins[offset:])
+		if err != nil {
+			return false
+		}
+		switch in.Op {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			offset = in.Operands[0]
+		default:
+			return false
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+package compiler
+
+import (
+	"shark/token"
+	"shark/types"
+
+	"github.com/phuslu/log"
+)
+
+type TypeSymbol struct {
+	Pos  *token.Position
+	Type types.TSharkAlias
+	Name string
+}
+
+// TypeTable stores the type aliases of a scope. It mirrors the SymbolTable,
+// so aliases declared in a function are not visible outside of it.
+type TypeTable struct {
+	Outer *TypeTable
+	Inner *TypeTable
+	store map[string]TypeSymbol
+}
+
+func NewTypeTable() *TypeTable {
+	s := make(map[string]TypeSymbol)
+
+	return &TypeTable{store: s}
+}
+
+func NewEnclosedTypeTable(outer *TypeTable) *TypeTable {
+	tt := NewTypeTable()
+	tt.Outer = outer
+
+	return tt
+}
+
+func (t *TypeTable) Define(name string, sharkType types.ISharkType, pos *token.Position) TypeSymbol {
+	symbol := TypeSymbol{Name: name, Pos: pos, Type: types.TSharkAlias{Name: name, Type: sharkType}}
+
+	log.Trace().
+		Str("name", name).
+		Str("type", sharkType.SharkTypeString()).
+		Msg("Define new type alias")
+
+	t.store[name] = symbol
+
+	return symbol
+}
+
+// Checks if the alias is defined in the current scope, without looking at the outer scopes.
+func (t *TypeTable) IsDefinedLocally(name string) bool {
+	_, ok := t.store[name]
+	return ok
+}
+
+// Aliases returns the type aliases declared in this scope, without the ones of the outer scopes.
+func (t *TypeTable) Aliases() []TypeSymbol {
+	aliases := make([]TypeSymbol, 0, len(t.store))
+	for _, symbol := range t.store {
+		aliases = append(aliases, symbol)
+	}
+	return aliases
+}
+
+func (t *TypeTable) Resolve(name string) (TypeSymbol, bool) {
+	symbol, ok := t.store[name]
+
+	if !ok && t.Outer != nil {
+		return t.Outer.Resolve(name)
+	}
+
+	return symbol, ok
+}
+
+func (t *TypeTable) FindType(name string) (TypeSymbol, bool) {
+	symbol, ok := t.store[name]
+
+	if ok {
+		return symbol, ok
+	}
+
+	if t.Inner != nil {
+		return t.Inner.FindType(name)
+	}
+
+	if t.Outer != nil {
+		return t.Outer.FindType(name)
+	}
+
+	return symbol, ok
+}
+
+// Returns the type keyword a name that is not a type is most likely a typo of, like 'i64'
+// for 'i46'. Names more than one edit away from every type keyword have none.
+func closestTypeKeyword(name string) (string, bool) {
+	closest, distance := "", 2
+	for _, keyword := range token.Keywords() {
+		if !token.IsTypeKeyword(keyword) {
+			continue
+		}
+		// Keywords come in no particular order, ties go to the first in alphabetical order
+		d := editDistance(name, keyword)
+		if d < distance || (d == distance && keyword < closest) {
+			closest, distance = keyword, d
+		}
+	}
+	return closest, closest != ""
+}
+
+// Returns the number of runes to insert, delete or replace, or of adjacent runes to swap, to
+// turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
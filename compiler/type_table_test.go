@@ -0,0 +1,158 @@
+package compiler
+
+import (
+	"shark/exception"
+	"shark/types"
+	"testing"
+)
+
+func TestDefineResolveTypeAlias(t *testing.T) {
+	t.Run("should define and resolve type aliases", func(t *testing.T) {
+		global := NewTypeTable()
+		global.Define("Numbers", types.TSharkArray{Collection: types.TSharkI64{}}, nil)
+
+		local := NewEnclosedTypeTable(global)
+		local.Define("Reducer", types.TSharkFuncType{ArgsList: []types.ISharkType{types.TSharkI64{}, types.TSharkI64{}}, ReturnT: types.TSharkI64{}}, nil)
+
+		expected := []struct {
+			name       string
+			typeString string
+		}{
+			{"Numbers", "array<i64>"},
+			{"Reducer", "func<(i64,i64)->i64>"},
+		}
+
+		for _, e := range expected {
+			result, ok := local.Resolve(e.name)
+			if !ok {
+				t.Errorf("type alias %s is not resolvable", e.name)
+
+				continue
+			}
+
+			if result.Name != e.name || result.Type.Name != e.name {
+				t.Errorf("expected alias name %s, got=%s", e.name, result.Name)
+			}
+
+			if result.Type.Type.SharkTypeString() != e.typeString {
+				t.Errorf("expected %s to resolve to %s, got=%s", e.name, e.typeString, result.Type.Type.SharkTypeString())
+			}
+		}
+
+		if _, ok := global.Resolve("Reducer"); ok {
+			t.Errorf("type alias Reducer should not be resolvable from the outer scope")
+		}
+	})
+
+	t.Run("should shadow type aliases of outer scopes", func(t *testing.T) {
+		global := NewTypeTable()
+		global.Define("T", types.TSharkI64{}, nil)
+
+		local := NewEnclosedTypeTable(global)
+		local.Define("T", types.TSharkString{}, nil)
+
+		if !local.IsDefinedLocally("T") {
+			t.Errorf("expected T to be defined locally")
+		}
+
+		result, ok := local.Resolve("T")
+		if !ok {
+			t.Fatalf("type alias T is not resolvable")
+		}
+
+		if !result.Type.Is(types.TSharkString{}) {
+			t.Errorf("expected T to resolve to string, got=%s", result.Type.Type.SharkTypeString())
+		}
+	})
+}
+
+func TestCompileTypeAlias(t *testing.T) {
+	t.Run("should compile type aliases in annotations", func(t *testing.T) {
+		input := `
+		type Reducer = func<(i64, i64)->i64>;
+		type Numbers = array<i64>;
+		let reduce = (arr: Numbers, initial: i64, f: Reducer): i64 => { f(initial, first(arr)) };
+		let add: Reducer = (a: i64, b: i64): i64 => { a + b };
+		reduce([1, 2], 0, add);
+		`
+
+		compiler := New()
+
+		if err, _ := compiler.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %+v", err)
+		}
+
+		symbol, ok := compiler.GetSymbolTable().Resolve("add")
+		if !ok {
+			t.Fatalf("symbol add is not resolvable")
+		}
+
+		if symbol.ObjType.SharkTypeString() != "Reducer" {
+			t.Errorf("expected type of add to be shown as Reducer, got=%s", symbol.ObjType.SharkTypeString())
+		}
+
+		symbol, ok = compiler.GetSymbolTable().Resolve("reduce")
+		if !ok {
+			t.Fatalf("symbol reduce is not resolvable")
+		}
+
+		if symbol.ObjType.SharkTypeString() != "func<(Numbers,i64,Reducer)->i64>" {
+			t.Errorf("expected alias names in function type, got=%s", symbol.ObjType.SharkTypeString())
+		}
+	})
+
+	t.Run("should report type alias errors", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`let x: Missing = 5;`, "type 'Missing' not found"},
+			{`type A = i64; type A = string;`, "type 'A' is already declared"},
+			{`type A = array<A>;`, "type 'A' not found"},
+			{`let f = () => { type Local = i64; 1 }; let x: Local = 1;`, "type 'Local' not found"},
+			{`type Reducer = func<(i64, i64)->i64>; let r: Reducer = 5;`, "type mismatch 'i64'"},
+		}
+
+		for _, tt := range tests {
+			compiler := New()
+
+			err, _ := compiler.Compile(parse(tt.input))
+			if err == nil {
+				t.Errorf("expected compiler error for %q", tt.input)
+
+				continue
+			}
+
+			if err.ErrMsg != tt.expected {
+				t.Errorf("expected error %q, got=%q", tt.expected, err.ErrMsg)
+			}
+		}
+	})
+
+	t.Run("should suggest the type keyword a missing type is a typo of", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`let x: i46 = 5;`, "Did you mean 'i64'? Otherwise declare the type with 'type i46 = ...;'"},
+			{`let s: strng = "a";`, "Did you mean 'string'? Otherwise declare the type with 'type strng = ...;'"},
+			{`let x: Missing = 5;`, "Declare the type with 'type Missing = ...;' before using it"},
+			{`let x: A = 5;`, "Declare the type with 'type A = ...;' before using it"},
+		}
+
+		for _, tt := range tests {
+			compiler := New()
+
+			err, _ := compiler.Compile(parse(tt.input))
+			if err == nil || err.ErrCode != exception.SharkErrorTypeNotFound {
+				t.Errorf("expected a type not found error for %q, got %+v", tt.input, err)
+
+				continue
+			}
+
+			if err.ErrHelpMsg == nil || *err.ErrHelpMsg != tt.expected {
+				t.Errorf("expected help %q for %q, got=%v", tt.expected, tt.input, err.ErrHelpMsg)
+			}
+		}
+	})
+}
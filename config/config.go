@@ -11,12 +11,14 @@ import (
 )
 
 type Config struct {
-	NidumVM VmConf `json:"nvm"`
+	NidumVM VmConf   `json:"nvm"`
+	Lint    LintConf `json:"lint"`
 }
 
 func NewDefaultConfig() Config {
 	return Config{
 		NidumVM: NewDefaultVmConf(),
+		Lint:    NewDefaultLintConf(),
 	}
 }
 
@@ -0,0 +1,33 @@
+package config
+
+// LintLevel is how a lint rule reports what it finds.
+type LintLevel string
+
+const (
+	LintOff     LintLevel = "off"
+	LintWarning LintLevel = "warning"
+	LintError   LintLevel = "error"
+)
+
+// LintConf holds the level of every lint rule, a rule left empty uses its default level.
+type LintConf struct {
+	UnusedBinding      LintLevel `json:"unusedBinding"`
+	UnusedParameter    LintLevel `json:"unusedParameter"`
+	ShadowedIdentifier LintLevel `json:"shadowedIdentifier"`
+	UnnecessaryMut     LintLevel `json:"unnecessaryMut"`
+	UnreachableCode    LintLevel `json:"unreachableCode"`
+	ConstantComparison LintLevel `json:"constantComparison"`
+	MismatchedEquality LintLevel `json:"mismatchedEquality"`
+}
+
+func NewDefaultLintConf() LintConf {
+	return LintConf{
+		UnusedBinding:      LintWarning,
+		UnusedParameter:    LintWarning,
+		ShadowedIdentifier: LintWarning,
+		UnnecessaryMut:     LintWarning,
+		UnreachableCode:    LintWarning,
+		ConstantComparison: LintWarning,
+		MismatchedEquality: LintWarning,
+	}
+}
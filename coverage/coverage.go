@@ -0,0 +1,214 @@
+// Package coverage turns the instruction counts of a VM into the lines, branches and functions
+// of the source code they were compiled from, reads and writes them as LCOV tracefiles, and
+// merges the coverage of several runs.
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"shark/code"
+	"shark/token"
+	"shark/vm"
+	"sort"
+)
+
+// Profile is the coverage of source files, by file name.
+type Profile struct {
+	Files map[string]*File
+}
+
+// File is the coverage of a source file.
+type File struct {
+	// How many times each line with code ran, by line number.
+	Lines     map[int]int
+	Branches  []Branch
+	Functions []Function
+}
+
+// Branch is an outcome of a condition. A condition has two branches: index 0 is when it is
+// truthy and index 1 when it is falsy.
+type Branch struct {
+	Line  int
+	Block int
+	Index int
+	Taken int
+	// Whether the condition was evaluated, LCOV writes the branches never reached as '-'.
+	Reached bool
+}
+
+// Function counts the calls of a function.
+type Function struct {
+	Name  string
+	Line  int
+	Calls int
+}
+
+func NewProfile() *Profile {
+	return &Profile{Files: make(map[string]*File)}
+}
+
+// Collect returns the coverage of a file from the instruction counts of the VMs that ran it.
+// Functions without a source map are left out, they cannot be mapped to the source.
+func Collect(file string, cov *vm.Coverage) *Profile {
+	f := &File{Lines: make(map[int]int)}
+
+	type jump struct {
+		pos    token.Position
+		branch vm.Branch
+		count  int
+	}
+	var jumps []jump
+
+	for _, fc := range cov.Functions() {
+		sm := fc.Fn.SourceMap
+		if len(sm) == 0 {
+			continue
+		}
+
+		ins := fc.Fn.Instructions
+		for offset := 0; offset < len(ins); {
+			in, err := code.ReadInstruction(ins[offset:])
+			if err != nil {
+				break
+			}
+			if pos, ok := sm.PositionAt(offset); ok {
+				// A line ran as many times as its instruction run the most
+				f.Lines[pos.Line] = max(f.Lines[pos.Line], fc.Counts[offset])
+				if b, ok := fc.Branches[offset]; ok {
+					jumps = append(jumps, jump{pos: pos, branch: b, count: fc.Counts[offset]})
+				}
+			}
+			offset += in.Size
+		}
+
+		if !fc.Main {
+			calls := 0
+			if len(fc.Counts) > 0 {
+				calls = fc.Counts[0]
+			}
+			f.Functions = append(f.Functions, Function{Name: fc.Fn.DisplayName(), Line: fc.Fn.FirstLine(), Calls: calls})
+		}
+	}
+
+	// The blocks are numbered in the order of the conditions in the source, so that the
+	// branches of different runs of the same file can be merged
+	sort.SliceStable(jumps, func(i, j int) bool {
+		a, b := jumps[i].pos, jumps[j].pos
+		return a.Line < b.Line || (a.Line == b.Line && a.ColFrom < b.ColFrom)
+	})
+	for block, j := range jumps {
+		reached := j.count > 0
+		f.Branches = append(f.Branches,
+			Branch{Line: j.pos.Line, Block: block, Index: 0, Taken: j.branch.Taken, Reached: reached},
+			Branch{Line: j.pos.Line, Block: block, Index: 1, Taken: j.branch.NotTaken, Reached: reached},
+		)
+	}
+	sort.SliceStable(f.Functions, func(i, j int) bool { return f.Functions[i].Line < f.Functions[j].Line })
+
+	p := NewProfile()
+	p.Files[file] = f
+	return p
+}
+
+// Merge adds the coverage of other to p, the counts of the same lines, branches and functions
+// are summed.
+func (p *Profile) Merge(other *Profile) {
+	for name, of := range other.Files {
+		f, ok := p.Files[name]
+		if !ok {
+			f = &File{Lines: make(map[int]int)}
+			p.Files[name] = f
+		}
+
+		for line, count := range of.Lines {
+			f.Lines[line] += count
+		}
+
+	branches:
+		for _, ob := range of.Branches {
+			for i, b := range f.Branches {
+				if b.Line == ob.Line && b.Block == ob.Block && b.Index == ob.Index {
+					f.Branches[i].Taken += ob.Taken
+					f.Branches[i].Reached = b.Reached || ob.Reached
+					continue branches
+				}
+			}
+			f.Branches = append(f.Branches, ob)
+		}
+
+	functions:
+		for _, ofn := range of.Functions {
+			for i, fn := range f.Functions {
+				if fn.Name == ofn.Name {
+					f.Functions[i].Calls += ofn.Calls
+					continue functions
+				}
+			}
+			f.Functions = append(f.Functions, ofn)
+		}
+	}
+}
+
+// WriteSummary writes the share of the lines, branches and functions covered in each file.
+func (p *Profile) WriteSummary(w io.Writer) error {
+	for _, name := range p.names() {
+		f := p.Files[name]
+		lines, linesHit := f.lineCounts()
+		branches, branchesHit := f.branchCounts()
+		functions, functionsHit := f.functionCounts()
+
+		_, err := fmt.Fprintf(w, "%s\n  lines:     %s\n  branches:  %s\n  functions: %s\n", name,
+			ratio(linesHit, lines), ratio(branchesHit, branches), ratio(functionsHit, functions))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ratio(hit, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%% (%d/%d)", float64(hit)*100/float64(total), hit, total)
+}
+
+// Returns the names of the files, sorted.
+func (p *Profile) names() []string {
+	names := make([]string, 0, len(p.Files))
+	for name := range p.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *File) lineCounts() (total, hit int) {
+	for _, count := range f.Lines {
+		total++
+		if count > 0 {
+			hit++
+		}
+	}
+	return total, hit
+}
+
+func (f *File) branchCounts() (total, hit int) {
+	for _, b := range f.Branches {
+		total++
+		if b.Taken > 0 {
+			hit++
+		}
+	}
+	return total, hit
+}
+
+func (f *File) functionCounts() (total, hit int) {
+	for _, fn := range f.Functions {
+		total++
+		if fn.Calls > 0 {
+			hit++
+		}
+	}
+	return total, hit
+}
@@ -0,0 +1,159 @@
+package coverage
+
+import (
+	"shark/compiler"
+	"shark/lexer"
+	"shark/parser"
+	"shark/vm"
+	"strings"
+	"testing"
+)
+
+const input = `let classify = (n: i64): string => {
+	if (n > 10) {
+		"big"
+	} else {
+		"small"
+	}
+};
+let unused = () => {
+	42
+};
+classify(1);
+classify(2);`
+
+func TestCollect(t *testing.T) {
+	profile := run(t, input)
+
+	f, ok := profile.Files["classify.shark"]
+	if !ok {
+		t.Fatalf("expected the coverage of classify.shark, got %+v", profile.Files)
+	}
+
+	expectedLines := map[int]int{1: 1, 2: 2, 3: 0, 5: 2, 8: 1, 9: 0, 11: 1, 12: 1}
+	if len(f.Lines) != len(expectedLines) {
+		t.Errorf("expected lines %v, got %v", expectedLines, f.Lines)
+	}
+	for line, count := range expectedLines {
+		if f.Lines[line] != count {
+			t.Errorf("line %d: expected %d runs, got %d", line, count, f.Lines[line])
+		}
+	}
+
+	expectedBranches := []Branch{
+		{Line: 2, Block: 0, Index: 0, Taken: 0, Reached: true},
+		{Line: 2, Block: 0, Index: 1, Taken: 2, Reached: true},
+	}
+	if len(f.Branches) != len(expectedBranches) {
+		t.Fatalf("expected branches %+v, got %+v", expectedBranches, f.Branches)
+	}
+	for i, b := range f.Branches {
+		if b != expectedBranches[i] {
+			t.Errorf("branch %d: expected %+v, got %+v", i, expectedBranches[i], b)
+		}
+	}
+
+	expectedFunctions := []Function{{Name: "classify", Line: 2, Calls: 2}, {Name: "unused", Line: 9, Calls: 0}}
+	if len(f.Functions) != len(expectedFunctions) {
+		t.Fatalf("expected functions %+v, got %+v", expectedFunctions, f.Functions)
+	}
+	for i, fn := range f.Functions {
+		if fn != expectedFunctions[i] {
+			t.Errorf("function %d: expected %+v, got %+v", i, expectedFunctions[i], fn)
+		}
+	}
+}
+
+func TestLCOV(t *testing.T) {
+	t.Run("should write a tracefile", func(t *testing.T) {
+		var out strings.Builder
+		if err := run(t, input).WriteLCOV(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range []string{
+			"SF:classify.shark\n",
+			"FN:2,classify\nFN:9,unused\nFNDA:2,classify\nFNDA:0,unused\nFNF:2\nFNH:1\n",
+			"BRDA:2,0,0,0\nBRDA:2,0,1,2\nBRF:2\nBRH:1\n",
+			"DA:1,1\nDA:2,2\nDA:3,0\n",
+			"LF:8\nLH:6\nend_of_record\n",
+		} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("expected the tracefile to contain %q, got:\n%s", expected, out.String())
+			}
+		}
+	})
+
+	t.Run("should read the tracefile it writes", func(t *testing.T) {
+		var first strings.Builder
+		if err := run(t, input).WriteLCOV(&first); err != nil {
+			t.Fatal(err)
+		}
+
+		profile, err := ReadLCOV(strings.NewReader(first.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var second strings.Builder
+		if err := profile.WriteLCOV(&second); err != nil {
+			t.Fatal(err)
+		}
+
+		if first.String() != second.String() {
+			t.Errorf("expected:\n%s\ngot:\n%s", first.String(), second.String())
+		}
+	})
+
+	t.Run("should reject invalid records", func(t *testing.T) {
+		if _, err := ReadLCOV(strings.NewReader("SF:a.shark\nDA:x,1\nend_of_record\n")); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+func TestMerge(t *testing.T) {
+	profile := run(t, input)
+	profile.Merge(run(t, input+"\nclassify(20);"))
+
+	f := profile.Files["classify.shark"]
+	if f.Lines[2] != 5 || f.Lines[3] != 1 {
+		t.Errorf("expected the line counts to add up, got %v", f.Lines)
+	}
+	if f.Branches[0].Taken != 1 || f.Branches[1].Taken != 4 {
+		t.Errorf("expected the branch counts to add up, got %+v", f.Branches)
+	}
+	if f.Functions[0].Calls != 5 || f.Functions[1].Calls != 0 {
+		t.Errorf("expected the calls to add up, got %+v", f.Functions)
+	}
+
+	var out strings.Builder
+	if err := profile.WriteSummary(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "classify.shark\n  lines:     88.9% (8/9)\n  branches:  100.0% (2/2)\n  functions: 50.0% (1/2)\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func run(t *testing.T, input string) *Profile {
+	t.Helper()
+
+	l := lexer.New(&input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	comp := compiler.New()
+	if err, _ := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %+v", err)
+	}
+
+	cov := vm.NewCoverage()
+	machine := vm.NewDefault(comp.Bytecode())
+	machine.SetCoverage(cov)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %+v", err)
+	}
+
+	return Collect("classify.shark", cov)
+}
@@ -0,0 +1,143 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteLCOV writes the profile as an LCOV tracefile, with a record for each file.
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, name := range p.names() {
+		f := p.Files[name]
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", name)
+
+		for _, fn := range f.Functions {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fn.Line, fn.Name)
+		}
+		for _, fn := range f.Functions {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", fn.Calls, fn.Name)
+		}
+		functions, functionsHit := f.functionCounts()
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", functions, functionsHit)
+
+		for _, b := range f.Branches {
+			taken := "-"
+			if b.Reached {
+				taken = strconv.Itoa(b.Taken)
+			}
+			fmt.Fprintf(bw, "BRDA:%d,%d,%d,%s\n", b.Line, b.Block, b.Index, taken)
+		}
+		branches, branchesHit := f.branchCounts()
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", branches, branchesHit)
+
+		lines := make([]int, 0, len(f.Lines))
+		for line := range f.Lines {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, f.Lines[line])
+		}
+		linesTotal, linesHit := f.lineCounts()
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", linesTotal, linesHit)
+	}
+
+	return bw.Flush()
+}
+
+// ReadLCOV reads a profile from an LCOV tracefile. The summary lines are left out, they are
+// computed again when the profile is written.
+func ReadLCOV(r io.Reader) (*Profile, error) {
+	p := NewProfile()
+	var name string
+	var f *File
+	// The functions by name, FN gives their line and FNDA their calls
+	var functions map[string]int
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		kind, value, _ := strings.Cut(line, ":")
+
+		if kind == "SF" {
+			name, f = value, &File{Lines: make(map[int]int)}
+			functions = make(map[string]int)
+			continue
+		}
+		if kind == "end_of_record" {
+			// A file can have several records, which are merged
+			if f != nil {
+				p.Merge(&Profile{Files: map[string]*File{name: f}})
+			}
+			f = nil
+			continue
+		}
+		if f == nil {
+			continue
+		}
+
+		var err error
+		switch kind {
+		case "DA":
+			var fields []int
+			if fields, err = numbers(value, 2); err == nil {
+				f.Lines[fields[0]] += fields[1]
+			}
+		case "BRDA":
+			parts := strings.Split(value, ",")
+			var fields []int
+			if len(parts) != 4 {
+				err = fmt.Errorf("expected 4 fields")
+			} else if fields, err = numbers(strings.Join(parts[:3], ","), 3); err == nil {
+				b := Branch{Line: fields[0], Block: fields[1], Index: fields[2]}
+				if parts[3] != "-" {
+					b.Reached = true
+					b.Taken, err = strconv.Atoi(parts[3])
+				}
+				f.Branches = append(f.Branches, b)
+			}
+		case "FN":
+			lineNumber, name, _ := strings.Cut(value, ",")
+			var fnLine int
+			if fnLine, err = strconv.Atoi(lineNumber); err == nil {
+				functions[name] = len(f.Functions)
+				f.Functions = append(f.Functions, Function{Name: name, Line: fnLine})
+			}
+		case "FNDA":
+			count, name, _ := strings.Cut(value, ",")
+			var calls int
+			if calls, err = strconv.Atoi(count); err == nil {
+				if i, ok := functions[name]; ok {
+					f.Functions[i].Calls += calls
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s record '%s': %w", n, kind, value, err)
+		}
+	}
+
+	return p, scanner.Err()
+}
+
+// Parses the first n comma separated numbers of s, LCOV records can have more fields.
+func numbers(s string, n int) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < n {
+		return nil, fmt.Errorf("expected %d fields", n)
+	}
+	result := make([]int, n)
+	for i := range result {
+		var err error
+		if result[i], err = strconv.Atoi(parts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
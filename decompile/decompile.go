@@ -0,0 +1,367 @@
+// Package decompile lifts the instructions of compiled bytecode back into a Shark syntax tree,
+// and prints it as source that compiles back to equivalent bytecode.
+//
+// The decompiler follows the patterns the compiler emits: if expressions and while loops are
+// recovered from their jumps, closures from OpClosure and the free variables loaded before it,
+// and tests from the functions they are compiled to. Variables are named after the debug
+// information when the bytecode has it, and after their slot otherwise. The bytecode does not
+// keep the types of variables, only the signatures of functions are recovered, so the variables
+// that are assigned are declared with 'var'.
+package decompile
+
+import (
+	"fmt"
+	"shark/ast"
+	"shark/bytecode"
+	"shark/cfg"
+	"shark/code"
+	"shark/format"
+	"shark/object"
+	"shark/token"
+	"shark/types"
+	"unicode"
+)
+
+// Source returns the Shark source of the bytecode.
+func Source(bc *bytecode.Bytecode) (string, error) {
+	program, err := Program(bc)
+	if err != nil {
+		return "", err
+	}
+	return format.Program(program), nil
+}
+
+// Program returns the syntax tree of the bytecode. The type aliases used by the signatures of
+// the functions are declared first.
+func Program(bc *bytecode.Bytecode) (*ast.Program, error) {
+	d := &decompiler{bc: bc, aliases: make(map[string]bool)}
+
+	main, err := d.newScope("main", bc.Instructions, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := main.body()
+	if err != nil {
+		return nil, err
+	}
+
+	program := &ast.Program{Statements: append(d.aliasStatements, statements...)}
+	layout(program.Statements, len(d.aliasStatements))
+	return program, nil
+}
+
+type decompiler struct {
+	bc      *bytecode.Bytecode
+	globals map[int]*variable
+	// The names of the type aliases declared so far.
+	aliases         map[string]bool
+	aliasStatements []ast.Statement
+}
+
+// A global, a local or a parameter.
+type variable struct {
+	name string
+	// The identifier the variable is declared with, nil until its declaration is lifted.
+	decl *ast.Identifier
+	// Whether it is declared by the deconstruction of a tuple, which cannot declare it with 'var'.
+	inTuple bool
+	mutated bool
+}
+
+func (v *variable) declare(ident *ast.Identifier, inTuple bool) {
+	v.decl = ident
+	v.inTuple = inTuple
+	if v.mutated {
+		v.mutate()
+	}
+}
+
+// Records that the variable is assigned after its declaration. The bytecode does not tell
+// whether the type of its values changes, so it is declared with 'var' to not be type checked.
+func (v *variable) mutate() {
+	v.mutated = true
+	if v.decl != nil {
+		v.decl.Mutable = v.inTuple
+		v.decl.IsVariadic = !v.inTuple
+	}
+}
+
+func (d *decompiler) global(index int) *variable {
+	if d.globals == nil {
+		d.globals = make(map[int]*variable)
+	}
+	if v, ok := d.globals[index]; ok {
+		return v
+	}
+
+	name := fmt.Sprintf("global%d", index)
+	if index < len(d.bc.GlobalNames) && isIdentifier(d.bc.GlobalNames[index]) {
+		name = d.bc.GlobalNames[index]
+	}
+	v := &variable{name: name}
+	d.globals[index] = v
+	return v
+}
+
+// The main program or a function being lifted.
+type scope struct {
+	d *decompiler
+	// Nil for the main program.
+	fn           *object.CompiledFunction
+	name         string
+	depth        int
+	instructions []cfg.Instruction
+	// The index of the instruction at each offset, the end of the instructions included.
+	indexAt map[int]int
+	// The index of the jump going back to each loop condition, by the index of the condition.
+	loops  map[int]int
+	locals map[int]*variable
+	free   []*variable
+	// The name the function calls itself by, empty when it does not have one.
+	self   string
+	params []*ast.Identifier
+}
+
+func (d *decompiler) newScope(name string, ins code.Instructions, fn *object.CompiledFunction, depth int) (*scope, error) {
+	g, err := cfg.Build(name, ins)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	s := &scope{
+		d:       d,
+		fn:      fn,
+		name:    name,
+		depth:   depth,
+		indexAt: make(map[int]int),
+		loops:   make(map[int]int),
+		locals:  make(map[int]*variable),
+	}
+	for _, b := range g.Blocks {
+		for _, in := range b.Instructions {
+			s.indexAt[in.Offset] = len(s.instructions)
+			// A superinstruction is lifted as the instructions it stands for, they share its offset
+			for _, part := range code.Expand(code.Instruction{Op: in.Op, Operands: in.Operands}) {
+				def, _ := code.Lookup(byte(part.Op))
+				s.instructions = append(s.instructions, cfg.Instruction{
+					Offset:   in.Offset,
+					Op:       part.Op,
+					Def:      def,
+					Operands: part.Operands,
+					Wide:     in.Wide,
+					Depth:    in.Depth,
+				})
+			}
+		}
+	}
+	s.indexAt[len(ins)] = len(s.instructions)
+
+	for i, in := range s.instructions {
+		if in.Op == code.OpJump {
+			if target := s.indexAt[in.Operands[0]]; target <= i {
+				s.loops[target] = i
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *scope) local(index int) (*variable, error) {
+	if s.fn == nil {
+		return nil, fmt.Errorf("the main program has no locals")
+	}
+	if v, ok := s.locals[index]; ok {
+		return v, nil
+	}
+
+	var name string
+	if index < len(s.fn.LocalNames) && isIdentifier(s.fn.LocalNames[index]) {
+		name = s.fn.LocalNames[index]
+	} else {
+		name = fmt.Sprintf("local%d", index)
+		if index < s.fn.NumParameters {
+			name = fmt.Sprintf("arg%d", index)
+		}
+		// The names of nested functions must not shadow the names of the functions around them
+		if s.depth > 1 {
+			name += fmt.Sprintf("_%d", s.depth)
+		}
+	}
+	v := &variable{name: name}
+	s.locals[index] = v
+	return v, nil
+}
+
+// Lifts the function at index of the constant pool. The free variables are the variables
+// loaded before its closure is created, and self is the name it calls itself by.
+func (d *decompiler) function(index int, free []*variable, self string, depth int) (*ast.FunctionLiteral, error) {
+	if index >= len(d.bc.Constants) {
+		return nil, fmt.Errorf("constant %d does not exist", index)
+	}
+	fn, ok := d.bc.Constants[index].(*object.CompiledFunction)
+	if !ok {
+		return nil, fmt.Errorf("constant %d is not a function", index)
+	}
+
+	s, err := d.newScope(fmt.Sprintf("function %d", index), fn.Instructions, fn, depth)
+	if err != nil {
+		return nil, err
+	}
+	s.free = free
+	s.self = self
+
+	funcType, _ := types.Underlying(fn.ObjType).(types.TSharkFuncType)
+	var argTypes []types.ISharkType
+	for i := 0; i < fn.NumParameters; i++ {
+		v, err := s.local(i)
+		if err != nil {
+			return nil, err
+		}
+		param := identifier(v.name)
+		// The type of an optional parameter is given by its default value
+		if i < len(funcType.ArgsList) && !isAny(funcType.ArgsList[i]) && i < fn.NumParameters-fn.NumDefaults {
+			param.DefinedType = d.typeOf(funcType.ArgsList[i])
+		}
+		v.declare(param, false)
+		s.params = append(s.params, param)
+		argTypes = append(argTypes, param.DefinedType)
+	}
+
+	statements, err := s.body()
+	if err != nil {
+		return nil, err
+	}
+
+	literal := &ast.FunctionLiteral{
+		Token:      token.Token{Type: token.LPAREN, Literal: "("},
+		Name:       self,
+		Parameters: s.params,
+		Body:       block(statements),
+	}
+	definedType := &types.TSharkFuncType{ArgsList: argTypes}
+	if funcType.ReturnT != nil && !isAny(funcType.ReturnT) {
+		definedType.ReturnT = d.typeOf(funcType.ReturnT)
+	}
+	literal.DefinedType = definedType
+
+	switch fn.Memo {
+	case object.MemoAlways:
+		literal.Annotations = []*ast.Annotation{{Token: token.Token{Type: token.AT, Literal: "@"}, Name: "memo"}}
+	case object.MemoNever:
+		literal.Annotations = []*ast.Annotation{{Token: token.Token{Type: token.AT, Literal: "@"}, Name: "nomemo"}}
+	}
+	return literal, nil
+}
+
+// Returns a type the way it is written in a signature. The aliases it uses are declared the
+// first time they are met, after the aliases they use themselves.
+func (d *decompiler) typeOf(t types.ISharkType) types.ISharkType {
+	switch t := t.(type) {
+	case types.TSharkAlias:
+		if t.Type != nil && !d.aliases[t.Name] {
+			d.aliases[t.Name] = true
+			value := d.typeOf(t.Type)
+			d.aliasStatements = append(d.aliasStatements, &ast.TypeAliasStatement{
+				Token: token.Token{Type: token.IDENT, Literal: "type"},
+				Name:  identifier(t.Name),
+				Value: value,
+			})
+		}
+		return types.TSharkAlias{Name: t.Name}
+	case types.TSharkArray:
+		t.Collection = d.typeOf(t.Collection)
+		return t
+	case types.TSharkHashMap:
+		t.Indexes = d.typeOf(t.Indexes)
+		t.Collects = d.typeOf(t.Collects)
+		return t
+	case types.TSharkTuple:
+		t.Collection = d.typeList(t.Collection)
+		return t
+	case types.TSharkFuncType:
+		t.ArgsList = d.typeList(t.ArgsList)
+		t.ReturnT = d.typeOf(t.ReturnT)
+		return t
+	case types.TSharkOptional:
+		t.Type = d.typeOf(t.Type)
+		return t
+	default:
+		return t
+	}
+}
+
+func (d *decompiler) typeList(list []types.ISharkType) []types.ISharkType {
+	if list == nil {
+		return nil
+	}
+	out := make([]types.ISharkType, len(list))
+	for i, t := range list {
+		out[i] = d.typeOf(t)
+	}
+	return out
+}
+
+func isAny(t types.ISharkType) bool {
+	_, ok := t.(types.TSharkAny)
+	return ok
+}
+
+// Gives the statements of the program lines, so the printer separates the declarations of
+// functions and the tests from the other statements with blank lines. The type aliases are
+// the first statements.
+func layout(statements []ast.Statement, aliases int) {
+	line := 1
+	for i, stmt := range statements {
+		separate := isDeclaration(stmt) || (i == aliases && aliases > 0)
+		if i > 0 && separate {
+			line++
+		}
+		setLine(stmt, line)
+		line++
+		if isDeclaration(stmt) {
+			line++
+		}
+	}
+}
+
+func isDeclaration(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		_, ok := stmt.Value.(*ast.FunctionLiteral)
+		return ok
+	case *ast.TestStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+func setLine(stmt ast.Statement, line int) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Token.Pos.Line = line
+	case *ast.TupleDeconstruction:
+		stmt.Token.Pos.Line = line
+	case *ast.ExpressionStatement:
+		stmt.Token.Pos.Line = line
+	case *ast.WhileStatement:
+		stmt.Token.Pos.Line = line
+	case *ast.TestStatement:
+		stmt.Token.Pos.Line = line
+	case *ast.TypeAliasStatement:
+		stmt.Token.Pos.Line = line
+	}
+}
+
+// Reports whether a name from the debug information can be written as an identifier.
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
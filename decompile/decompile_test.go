@@ -0,0 +1,302 @@
+package decompile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"shark/bytecode"
+	"shark/compiler"
+	"shark/lexer"
+	"shark/object"
+	"shark/parser"
+	"strings"
+	"testing"
+)
+
+// Programs covering the constructs the compiler emits.
+var programs = map[string]string{
+	"operators": `let a = 1 + 2 * 3 - 4 / 2;
+let b = !(a == 3) && a != 4 || a >= 2;
+let c = -a ** 2;
+let d = 2 < a;
+let e = a <= 3;
+let f = [1..3, ...["x", "y"]];
+let g = "shårk"[2] == 'å';
+let h = "${a} and ${"b"}${""}, ${b}!";
+let i = "${"c"}" + "x";`,
+	"collections": `let mut xs = [1, 2, 3];
+xs[0] = 10;
+let h = {"b": 2, "a": 1};
+let (x, mut y) = (1, 2);
+y += x;
+puts(xs[1], h["a"], (x, y));`,
+	"control flow": `let mut i = 0;
+let mut total = 0;
+while (i < 10) {
+	if (i == 3) {
+		total = total * 2;
+	} else {
+		let half = i / 2;
+		total += half;
+	}
+	i++;
+}
+let sign = if (total > 0) { "positive" } else { if (total == 0) { "zero" } else { "negative" } };
+while (true) {
+	--i;
+	if (i < 5) { exit(0); }
+}`,
+	"closures": `let counter = (): func<(i64)->i64> => {
+	let mut count = 0;
+	let increment = (by: i64): i64 => {
+		let next = count + by;
+		puts(next);
+		next
+	};
+	increment
+};
+let c = counter();
+c(2);
+let add = (a: i64, b = 1) => { a + b };
+add(2);
+let apply = (f: func<(i64)->i64>, x: i64): i64 => { f(x) };
+let twice = apply((n: i64): i64 => { n * 2 }, 21);
+let fib = @memo (n: i64): i64 => { if (n < 2) { return n; }; fib(n - 1) + fib(n - 2) };
+let skip = @nomemo () => { puts("side effect") };
+let outer = (a) => {
+	let inner = (b) => {
+		let innermost = (c) => { a + b + c };
+		innermost(1)
+	};
+	inner(2)
+};`,
+	"early returns": `let clamp = (n: i64): i64 => {
+	if (n < 0) { return 0; }
+	if (n > 9) { return 9; } else { puts(n); }
+	let m = n * 2;
+	if (m > 9) { return m; }
+	n
+};
+let sign = (n: i64): string => {
+	if (n < 0) { return "negative"; }
+	if (n == 0) { "zero" } else { "positive" }
+};`,
+	"tests": `type Pair = array<i64>;
+let swap = (p: Pair): Pair => {
+	let (a, b) = (p[0], p[1]);
+	[b, a]
+};
+test "swaps the elements" {
+	let p = swap([1, 2]);
+	assert_eq(p, [2, 1]);
+}`,
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := make(map[string]string)
+	for name, input := range programs {
+		inputs[name] = input
+	}
+	files, err := filepath.Glob("../examples/*.shark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs[filepath.Base(file)] = string(src)
+	}
+
+	// The source of optimized bytecode compiles back to it at the same level
+	levels := []compiler.OptimizationLevel{compiler.O0, compiler.O1, compiler.O2}
+	for name, input := range inputs {
+		for _, level := range levels {
+			t.Run(fmt.Sprintf("%s/O%d", name, level), func(t *testing.T) {
+				original, ok := compile(t, input, level)
+				if _, isProgram := programs[name]; !ok && isProgram {
+					t.Fatalf("the program does not compile")
+				} else if !ok {
+					// Examples of errors do not compile
+					return
+				}
+
+				for _, stripped := range []bool{false, true} {
+					bc := original
+					if stripped {
+						bc = strip(t, original)
+					}
+					src, err := Source(bc)
+					if err != nil {
+						t.Fatalf("could not decompile: %v", err)
+					}
+					recompiled, ok := compile(t, src, level)
+					if !ok {
+						t.Fatalf("the source does not compile:\n%s", src)
+					}
+					if err := equivalent(original, recompiled); err != "" {
+						t.Errorf("%s, source:\n%s", err, src)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		stripped bool
+		expected string
+	}{
+		{
+			name: "should recover names from the debug information",
+			input: `let fib = (n: i64): i64 => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let mut i = 0;
+while (i < 3) { puts(fib(i)); i++; }`,
+			expected: `let fib = (n: i64): i64 => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+
+var i = 0;
+while (i < 3) {
+	puts(fib(i));
+	i++;
+}
+`,
+		},
+		{
+			name: "should name variables after their slots without debug information",
+			input: `let add = (a, b = 2) => { let sum = a + b; sum };
+let x = add(1);`,
+			stripped: true,
+			expected: `let global0 = (arg0, arg1 = 2) => {
+	let local2 = arg0 + arg1;
+	local2
+};
+
+let global1 = global0(1);
+`,
+		},
+		{
+			name: "should write compound assignments and drop the values of branches without one",
+			input: `let mut a = 1;
+if (a > 0) { a = a + 1; let b = 2; }
+a -= 3;`,
+			expected: `var a = 1;
+if (a > 0) {
+	a += 1;
+	let b = 2;
+}
+a -= 3;
+`,
+		},
+		{
+			name: "should declare the type aliases of the signatures",
+			input: `type Id = i64;
+type Ids = array<Id>;
+let head = (ids: Ids): Id => { ids[0] };`,
+			expected: `type Id = i64;
+type Ids = array<Id>;
+
+let head = (ids: Ids): Id => { ids[0] };
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc, ok := compile(t, tt.input, compiler.O0)
+			if !ok {
+				t.Fatalf("the input does not compile")
+			}
+			if tt.stripped {
+				bc = strip(t, bc)
+			}
+			src, err := Source(bc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, src)
+			}
+		})
+	}
+}
+
+func TestUnsupportedBytecode(t *testing.T) {
+	bc, ok := compile(t, "let a = 1;", compiler.O0)
+	if !ok {
+		t.Fatal("the input does not compile")
+	}
+	// A jump in the middle of a statement is not code the compiler emits
+	bc.Instructions = append([]byte{byte(0x0e), 0, 3}, bc.Instructions...)
+
+	if _, err := Source(bc); err == nil {
+		t.Errorf("expected an error")
+	} else if !strings.Contains(err.Error(), "main: offset") {
+		t.Errorf("expected the error to give the offset, got %q", err)
+	}
+}
+
+func compile(t *testing.T, input string, level compiler.OptimizationLevel) (*bytecode.Bytecode, bool) {
+	t.Helper()
+
+	l := lexer.New(&input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, false
+	}
+
+	comp := compiler.New()
+	comp.SetOptimizationLevel(level)
+	if err, _ := comp.Compile(program); err != nil {
+		return nil, false
+	}
+	return comp.Bytecode(), true
+}
+
+// Returns the bytecode read back from an object file without debug information.
+func strip(t *testing.T, bc *bytecode.Bytecode) *bytecode.Bytecode {
+	t.Helper()
+
+	obj, err := bc.ToObjWithOptions(bytecode.BcTypeNormal, bytecode.BcVersionLatest, bytecode.EncodeOptions{StripDebug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripped, err := bytecode.FromBytes(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stripped
+}
+
+// Compares the instructions and the constants of two programs, and returns what differs.
+func equivalent(expected, actual *bytecode.Bytecode) string {
+	if !bytes.Equal(expected.Instructions, actual.Instructions) {
+		return "the instructions of the main program differ:\nexpected:\n" + expected.Instructions.String() + "got:\n" + actual.Instructions.String()
+	}
+	if len(expected.Constants) != len(actual.Constants) {
+		return "the number of constants differs"
+	}
+	for i, constant := range expected.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			if constant.Inspect() != actual.Constants[i].Inspect() {
+				return "constant " + constant.Inspect() + " differs"
+			}
+			continue
+		}
+		other, ok := actual.Constants[i].(*object.CompiledFunction)
+		if !ok || !bytes.Equal(fn.Instructions, other.Instructions) {
+			return "function " + fn.DisplayName() + " differs:\nexpected:\n" + fn.Instructions.String()
+		}
+		if fn.NumLocals != other.NumLocals || fn.NumParameters != other.NumParameters || fn.NumDefaults != other.NumDefaults ||
+			fn.Pure != other.Pure || fn.Memo != other.Memo || fn.ObjType.SharkTypeString() != other.ObjType.SharkTypeString() {
+			return "the signature of function " + fn.DisplayName() + " differs"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,698 @@
+package decompile
+
+import (
+	"fmt"
+	"math"
+	"shark/ast"
+	"shark/code"
+	"shark/object"
+	"shark/token"
+	"strconv"
+)
+
+// The operators of the instructions popping two values. Bytecode compiled before OpLessThan
+// existed has 'a < b' as 'b > a'.
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:              "+",
+	code.OpSub:              "-",
+	code.OpMul:              "*",
+	code.OpDiv:              "/",
+	code.OpPower:            "**",
+	code.OpEqual:            "==",
+	code.OpNotEqual:         "!=",
+	code.OpGreaterThan:      ">",
+	code.OpGreaterThanEqual: ">=",
+	code.OpLessThan:         "<",
+	code.OpLessThanEqual:    "<=",
+	code.OpAnd:              "&&",
+	code.OpOr:               "||",
+	code.OpRange:            "..",
+}
+
+var prefixOperators = map[code.Opcode]string{
+	code.OpMinus:  "-",
+	code.OpBang:   "!",
+	code.OpSpread: "...",
+}
+
+// The operators of the assignments 'x = x + y' is written with.
+var compoundOperators = map[string]string{
+	"+": "+=",
+	"-": "-=",
+	"*": "*=",
+	"/": "/=",
+}
+
+// Stands for the null the compiler pushes at the end of a branch of an if expression that has
+// no value. It is never written.
+var null = identifier("null")
+
+// The statements and the values of the stack lifted from a run of instructions.
+type region struct {
+	s          *scope
+	statements []ast.Statement
+	stack      []ast.Expression
+}
+
+// Lifts all the instructions of the scope.
+func (s *scope) body() ([]ast.Statement, error) {
+	statements, values, err := s.block(0, len(s.instructions))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 0 {
+		return nil, s.errorf(len(s.instructions), "%d values are left on the stack", len(values))
+	}
+	return statements, nil
+}
+
+// Lifts the instructions from index from up to index to into statements, and returns the
+// values they leave on the stack, like the value of a branch of an if expression.
+func (s *scope) block(from, to int) ([]ast.Statement, []ast.Expression, error) {
+	r := &region{s: s}
+	for i := from; i < to; {
+		next, err := r.lift(i, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		i = next
+	}
+	return r.statements, r.stack, nil
+}
+
+// Lifts a branch of an if expression. Its value, when it has one, is its last statement.
+func (s *scope) branch(from, to int) (*ast.BlockStatement, error) {
+	statements, values, err := s.block(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) > 1 {
+		return nil, s.errorf(to, "%d values are left on the stack by a branch", len(values))
+	}
+	if len(values) == 1 && values[0] != null {
+		statements = append(statements, &ast.ExpressionStatement{Expression: values[0]})
+	}
+	return block(statements), nil
+}
+
+// Lifts the instruction at index i, or the construct it starts, and returns the index of the
+// instruction after it.
+func (r *region) lift(i, to int) (int, error) {
+	s := r.s
+	in := s.instructions[i]
+
+	if end, ok := s.loops[i]; ok && end < to {
+		return r.while(i, end)
+	}
+
+	if op, ok := infixOperators[in.Op]; ok {
+		operands, err := r.pop(i, 2)
+		if err != nil {
+			return 0, err
+		}
+		r.push(infix(op, operands[0], operands[1]))
+		return i + 1, nil
+	}
+	if op, ok := prefixOperators[in.Op]; ok {
+		operands, err := r.pop(i, 1)
+		if err != nil {
+			return 0, err
+		}
+		r.push(prefix(op, operands[0]))
+		return i + 1, nil
+	}
+
+	switch in.Op {
+	case code.OpConstant:
+		value, err := s.constant(in.Operands[0])
+		if err != nil {
+			return 0, s.errorf(i, "%v", err)
+		}
+		r.push(value)
+	case code.OpTrue, code.OpFalse:
+		r.push(boolean(in.Op == code.OpTrue))
+	case code.OpNull:
+		r.push(null)
+	case code.OpGetGlobal, code.OpGetLocal:
+		v, err := s.variable(i)
+		if err != nil {
+			return 0, err
+		}
+		r.push(identifier(v.name))
+	case code.OpGetFree:
+		if in.Operands[0] >= len(s.free) {
+			return 0, s.errorf(i, "the function has %d free variables", len(s.free))
+		}
+		r.push(identifier(s.free[in.Operands[0]].name))
+	case code.OpGetBuiltin:
+		if in.Operands[0] >= len(object.Builtins) {
+			return 0, s.errorf(i, "builtin %d does not exist", in.Operands[0])
+		}
+		r.push(identifier(object.Builtins[in.Operands[0]].Name))
+	case code.OpCurrentClosure:
+		if s.self == "" {
+			return 0, s.errorf(i, "the function calls itself but has no name")
+		}
+		r.push(identifier(s.self))
+	case code.OpArray, code.OpTuple:
+		elements, err := r.pop(i, in.Operands[0])
+		if err != nil {
+			return 0, err
+		}
+		if in.Op == code.OpArray {
+			r.push(&ast.ArrayLiteral{Token: tok(token.LBRACKET, "["), Elements: elements})
+		} else {
+			r.push(&ast.TupleLiteral{Token: tok(token.LPAREN, "("), Elements: elements})
+		}
+	case code.OpConcat:
+		values, err := r.pop(i, in.Operands[0])
+		if err != nil {
+			return 0, err
+		}
+		r.push(interpolation(values))
+	case code.OpHash:
+		values, err := r.pop(i, in.Operands[0])
+		if err != nil {
+			return 0, err
+		}
+		pairs := make(map[ast.Expression]ast.Expression)
+		for j := 0; j+1 < len(values); j += 2 {
+			pairs[values[j]] = values[j+1]
+		}
+		r.push(&ast.HashLiteral{Token: tok(token.LBRACE, "{"), Pairs: pairs})
+	case code.OpIndex:
+		operands, err := r.pop(i, 2)
+		if err != nil {
+			return 0, err
+		}
+		r.push(&ast.IndexExpression{Token: tok(token.LBRACKET, "["), Left: operands[0], Index: operands[1]})
+	case code.OpIndexAssign:
+		// The value is compiled before the collection and the index
+		operands, err := r.pop(i, 3)
+		if err != nil {
+			return 0, err
+		}
+		if ident, ok := operands[1].(*ast.Identifier); ok {
+			s.mutateNamed(ident.Value)
+		}
+		r.push(&ast.IndexAssignExpression{Token: tok(token.LBRACKET, "["), Value: operands[0], Left: operands[1], Index: operands[2]})
+	case code.OpCall, code.OpTailCall:
+		operands, err := r.pop(i, in.Operands[0]+1)
+		if err != nil {
+			return 0, err
+		}
+		r.push(&ast.CallExpression{Token: tok(token.LPAREN, "("), Function: operands[0], Arguments: operands[1:]})
+	case code.OpClosure:
+		return r.closure(i, to)
+	case code.OpSetGlobal, code.OpSetLocal:
+		return r.store(i, to)
+	case code.OpIncrementGlobal, code.OpIncrementLocal, code.OpDecrementGlobal, code.OpDecrementLocal:
+		return r.step(i, to)
+	case code.OpTupleDeconstruct:
+		return r.deconstruct(i, to)
+	case code.OpSetLocalDefault:
+		operands, err := r.pop(i, 1)
+		if err != nil {
+			return 0, err
+		}
+		if in.Operands[0] >= len(s.params) {
+			return 0, s.errorf(i, "local %d is not a parameter", in.Operands[0])
+		}
+		s.params[in.Operands[0]].DefaultValue = &operands[0]
+	case code.OpJumpNotTruthy:
+		return r.ifExpression(i, to)
+	case code.OpPop:
+		operands, err := r.pop(i, 1)
+		if err != nil {
+			return 0, err
+		}
+		return i + 1, r.statement(i, &ast.ExpressionStatement{Expression: operands[0]})
+	case code.OpReturnValue:
+		if s.fn == nil {
+			return 0, s.errorf(i, "the main program cannot return")
+		}
+		operands, err := r.pop(i, 1)
+		if err != nil {
+			return 0, err
+		}
+		// The value of the last statement of a function is returned without 'return'
+		if i == len(s.instructions)-1 {
+			return i + 1, r.statement(i, &ast.ExpressionStatement{Expression: operands[0]})
+		}
+		return i + 1, r.statement(i, &ast.ReturnStatement{Token: tok(token.RETURN, "return"), ReturnValue: operands[0]})
+	case code.OpReturn:
+		if s.fn == nil || i != len(s.instructions)-1 {
+			return 0, s.errorf(i, "OpReturn can only end a function")
+		}
+	default:
+		return 0, s.errorf(i, "unexpected %s", in.Def.Name)
+	}
+
+	return i + 1, nil
+}
+
+// Lifts the while loop whose condition starts at index i, and whose body ends with the jump
+// back to it at index end.
+func (r *region) while(i, end int) (int, error) {
+	s := r.s
+	exit := end + 1
+
+	// The condition ends with the jump leaving the loop. An optimized 'while (true)' has none.
+	test := -1
+	for j := i; j < end; j++ {
+		if in := s.instructions[j]; in.Op == code.OpJumpNotTruthy && s.indexAt[in.Operands[0]] == exit {
+			test = j
+			break
+		}
+	}
+
+	loop := &ast.WhileStatement{Token: tok(token.WHILE, "while"), Condition: boolean(true)}
+	bodyFrom := i
+	if test >= 0 {
+		statements, values, err := s.block(i, test)
+		if err != nil {
+			return 0, err
+		}
+		if len(statements) != 0 || len(values) != 1 {
+			return 0, s.errorf(i, "the condition of the loop is not an expression")
+		}
+		loop.Condition = values[0]
+		bodyFrom = test + 1
+	}
+
+	body, values, err := s.block(bodyFrom, end)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) != 0 {
+		return 0, s.errorf(end, "%d values are left on the stack by the loop", len(values))
+	}
+	loop.Body = block(body)
+
+	return exit, r.statement(i, loop)
+}
+
+// Lifts the if expression whose condition is tested at index i. The consequence ends with a
+// jump over the alternative.
+func (r *region) ifExpression(i, to int) (int, error) {
+	s := r.s
+	operands, err := r.pop(i, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	elseAt := s.indexAt[s.instructions[i].Operands[0]]
+	if elseAt <= i+1 || elseAt > to {
+		return 0, s.errorf(i, "the jump is not the condition of an if expression or a while loop")
+	}
+	// The optimizer removes the jump after a consequence that returns, and turns a jump
+	// landing on a return into the return
+	if s.instructions[elseAt-1].Op == code.OpReturnValue {
+		return r.returningIf(i, elseAt, to, operands[0])
+	}
+	if s.instructions[elseAt-1].Op != code.OpJump {
+		return 0, s.errorf(i, "the jump is not the condition of an if expression or a while loop")
+	}
+	endAt := s.indexAt[s.instructions[elseAt-1].Operands[0]]
+	if endAt < elseAt || endAt > to {
+		return 0, s.errorf(elseAt-1, "the jump does not end an if expression")
+	}
+
+	consequence, err := s.branch(i+1, elseAt-1)
+	if err != nil {
+		return 0, err
+	}
+	alternative, err := s.branch(elseAt, endAt)
+	if err != nil {
+		return 0, err
+	}
+	if len(alternative.Statements) == 0 {
+		alternative = nil
+	}
+
+	r.push(&ast.IfExpression{Token: tok(token.IF, "if"), Condition: operands[0], Consequence: consequence, Alternative: alternative})
+	return endAt, nil
+}
+
+// Lifts the if expression whose condition is tested at index i and whose consequence returns,
+// so it has no jump over the alternative. The alternative of an if statement without one only
+// pushes null, which O2 removes. Otherwise the alternative runs up to the end of the function,
+// which returns the value of the if expression.
+func (r *region) returningIf(i, elseAt, to int, condition ast.Expression) (int, error) {
+	s := r.s
+	consequence, err := s.branch(i+1, elseAt)
+	if err != nil {
+		return 0, err
+	}
+	exp := &ast.IfExpression{Token: tok(token.IF, "if"), Condition: condition, Consequence: consequence}
+
+	last := len(s.instructions) - 1
+	switch {
+	case elseAt+1 < to && s.instructions[elseAt].Op == code.OpNull && s.instructions[elseAt+1].Op == code.OpPop:
+		r.push(exp)
+		return elseAt + 1, nil
+	case elseAt < last && to >= last && s.instructions[last].Op == code.OpReturnValue:
+		alternative, err := s.branch(elseAt, last)
+		if err != nil {
+			return 0, err
+		}
+		if len(alternative.Statements) != 0 {
+			exp.Alternative = alternative
+		}
+		r.push(exp)
+		return last, nil
+	}
+	return elseAt, r.statement(i, &ast.ExpressionStatement{Expression: exp})
+}
+
+// Lifts a store to a variable. The first store declares it, the others are assignments. The
+// value of an assignment is loaded again right after it when it is used.
+func (r *region) store(i, to int) (int, error) {
+	s := r.s
+	v, err := s.variable(i)
+	if err != nil {
+		return 0, err
+	}
+	operands, err := r.pop(i, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	if v.decl == nil {
+		name := identifier(v.name)
+		v.declare(name, false)
+		return i + 1, r.statement(i, &ast.LetStatement{Token: tok(token.LET, "let"), Name: name, Value: operands[0]})
+	}
+
+	v.mutate()
+	assignment := assign(v.name, operands[0])
+	if i+1 < to && s.loadsBack(i, i+1) {
+		r.push(assignment)
+		return i + 2, nil
+	}
+	return i + 1, r.statement(i, &ast.ExpressionStatement{Expression: assignment})
+}
+
+// Lifts an increment or a decrement. 'x++' loads the variable before changing it, '++x' after.
+func (r *region) step(i, to int) (int, error) {
+	s := r.s
+	v, err := s.variable(i)
+	if err != nil {
+		return 0, err
+	}
+	v.mutate()
+
+	op := "++"
+	if in := s.instructions[i]; in.Op == code.OpDecrementGlobal || in.Op == code.OpDecrementLocal {
+		op = "--"
+	}
+
+	if n := len(r.stack); n > 0 && i > 0 && s.loadsBack(i, i-1) {
+		r.stack = r.stack[:n-1]
+		r.push(&ast.PostfixExpression{Token: tok(token.Type(op), op), Operator: op, Left: identifier(v.name)})
+		return i + 1, nil
+	}
+	if i+1 < to && s.loadsBack(i, i+1) {
+		name := identifier(v.name)
+		r.push(&ast.PrefixExpression{Token: tok(token.Type(op), op), Operator: op, Right: name, RightIdent: name})
+		return i + 2, nil
+	}
+	return 0, s.errorf(i, "the variable is not loaded around %s", s.instructions[i].Def.Name)
+}
+
+// Lifts the declaration of the variables a tuple is deconstructed into, stored by the
+// instructions after the deconstruction.
+func (r *region) deconstruct(i, to int) (int, error) {
+	s := r.s
+	operands, err := r.pop(i, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	n := s.instructions[i].Operands[0]
+	if i+n >= to {
+		return 0, s.errorf(i, "the tuple is not stored in %d variables", n)
+	}
+	stmt := &ast.TupleDeconstruction{Token: tok(token.LET, "let"), Value: operands[0]}
+	for j := i + 1; j <= i+n; j++ {
+		if op := s.instructions[j].Op; op != code.OpSetGlobal && op != code.OpSetLocal {
+			return 0, s.errorf(j, "the tuple is not stored in %d variables", n)
+		}
+		v, err := s.variable(j)
+		if err != nil {
+			return 0, err
+		}
+		if v.decl != nil {
+			return 0, s.errorf(j, "%s is already declared", v.name)
+		}
+		name := identifier(v.name)
+		v.declare(name, true)
+		stmt.Names = append(stmt.Names, name)
+	}
+
+	return i + n + 1, r.statement(i, stmt)
+}
+
+// Lifts the creation of a closure. A function bound by a let statement calls itself by the
+// name of the variable, and a function created only to be popped at the top of the program is
+// a test.
+func (r *region) closure(i, to int) (int, error) {
+	s := r.s
+	in := s.instructions[i]
+	free, err := r.pop(i, in.Operands[1])
+	if err != nil {
+		return 0, err
+	}
+	variables := make([]*variable, len(free))
+	for j, value := range free {
+		ident, ok := value.(*ast.Identifier)
+		if !ok {
+			return 0, s.errorf(i, "free variable %d is not a variable", j)
+		}
+		variables[j] = s.named(ident.Value)
+	}
+
+	index := in.Operands[0]
+	fn, ok := s.d.bc.Constants[index].(*object.CompiledFunction)
+	if !ok {
+		return 0, s.errorf(i, "constant %d is not a function", index)
+	}
+
+	self := ""
+	if isIdentifier(fn.Name) {
+		self = fn.Name
+	}
+	if i+1 < to {
+		if next := s.instructions[i+1]; next.Op == code.OpSetGlobal || next.Op == code.OpSetLocal {
+			if v, err := s.variable(i + 1); err == nil && v.decl == nil {
+				self = v.name
+			}
+		}
+	}
+
+	literal, err := s.d.function(index, variables, self, s.depth+1)
+	if err != nil {
+		return 0, err
+	}
+
+	isTest := s.fn == nil && fn.Name != "" && fn.NumParameters == 0 && len(free) == 0 &&
+		i+1 < to && s.instructions[i+1].Op == code.OpPop
+	if isTest {
+		test := &ast.TestStatement{
+			Token: tok(token.IDENT, "test"),
+			Name:  &ast.StringLiteral{Token: tok(token.STRING, fn.Name), Value: fn.Name},
+			Body:  literal.Body,
+		}
+		return i + 2, r.statement(i, test)
+	}
+
+	r.push(literal)
+	return i + 1, nil
+}
+
+func (r *region) push(exp ast.Expression) {
+	r.stack = append(r.stack, exp)
+}
+
+// Pops the n values an instruction uses, in the order they were pushed.
+func (r *region) pop(i, n int) ([]ast.Expression, error) {
+	if len(r.stack) < n {
+		return nil, r.s.errorf(i, "%s needs %d values, the stack has %d", r.s.instructions[i].Def.Name, n, len(r.stack))
+	}
+	values := make([]ast.Expression, n)
+	copy(values, r.stack[len(r.stack)-n:])
+	r.stack = r.stack[:len(r.stack)-n]
+	return values, nil
+}
+
+// Adds a statement, which can only start once the values of the statements before it are
+// used.
+func (r *region) statement(i int, stmt ast.Statement) error {
+	if len(r.stack) != 0 {
+		return r.s.errorf(i, "%d values are left on the stack before a statement", len(r.stack))
+	}
+	r.statements = append(r.statements, stmt)
+	return nil
+}
+
+// Returns the variable the instruction at index i loads, stores or changes.
+func (s *scope) variable(i int) (*variable, error) {
+	in := s.instructions[i]
+	switch in.Op {
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpIncrementGlobal, code.OpDecrementGlobal:
+		return s.d.global(in.Operands[0]), nil
+	default:
+		v, err := s.local(in.Operands[0])
+		if err != nil {
+			return nil, s.errorf(i, "%v", err)
+		}
+		return v, nil
+	}
+}
+
+// Reports whether the instruction at index j loads the variable the instruction at index i
+// stores or changes.
+func (s *scope) loadsBack(i, j int) bool {
+	in, other := s.instructions[i], s.instructions[j]
+	switch in.Op {
+	case code.OpSetGlobal, code.OpIncrementGlobal, code.OpDecrementGlobal:
+		return other.Op == code.OpGetGlobal && other.Operands[0] == in.Operands[0]
+	default:
+		return other.Op == code.OpGetLocal && other.Operands[0] == in.Operands[0]
+	}
+}
+
+// Returns the variable of the scope with the name, a variable of its own, a free variable or a
+// global. The name the function calls itself by is not a variable, it cannot be changed.
+func (s *scope) named(name string) *variable {
+	for _, v := range s.locals {
+		if v.name == name {
+			return v
+		}
+	}
+	for _, v := range s.free {
+		if v.name == name {
+			return v
+		}
+	}
+	for _, v := range s.d.globals {
+		if v.name == name {
+			return v
+		}
+	}
+	return &variable{name: name}
+}
+
+// Records that the variable with the name is changed in place, like an array by an index
+// assignment, which needs it to be mutable.
+func (s *scope) mutateNamed(name string) {
+	s.named(name).mutate()
+}
+
+// Returns the interpolated string concatenating the values. A string constant is written as text
+// when it can be, so that the string compiles back to the same parts: the compiler leaves out the
+// empty text, and reads a string without interpolations as a single constant.
+func interpolation(values []ast.Expression) *ast.InterpolatedString {
+	str := &ast.InterpolatedString{Token: tok(token.STRING_HEAD, "")}
+	text := func(value string) {
+		str.Parts = append(str.Parts, &ast.StringLiteral{Token: tok(token.STRING, value), Value: value})
+	}
+	for _, value := range values {
+		if len(str.Parts)%2 == 0 {
+			if literal, ok := value.(*ast.StringLiteral); ok && literal.Value != "" && len(values) > 1 {
+				str.Parts = append(str.Parts, literal)
+				continue
+			}
+			text("")
+		}
+		str.Parts = append(str.Parts, value)
+	}
+	if len(str.Parts)%2 == 0 {
+		text("")
+	}
+	return str
+}
+
+// Returns the literal of a constant.
+func (s *scope) constant(index int) (ast.Expression, error) {
+	if index >= len(s.d.bc.Constants) {
+		return nil, fmt.Errorf("constant %d does not exist", index)
+	}
+
+	switch c := s.d.bc.Constants[index].(type) {
+	case *object.Int64:
+		switch {
+		case c.Value == math.MinInt64:
+			return infix("-", prefix("-", integer(math.MaxInt64)), integer(1)), nil
+		case c.Value < 0:
+			return prefix("-", integer(-c.Value)), nil
+		default:
+			return integer(c.Value), nil
+		}
+	case *object.String:
+		return &ast.StringLiteral{Token: tok(token.STRING, c.Value), Value: c.Value}, nil
+	case *object.Char:
+		return &ast.CharLiteral{Token: tok(token.CHAR, string(c.Value)), Value: c.Value}, nil
+	case *object.Boolean:
+		return boolean(c.Value), nil
+	default:
+		return nil, fmt.Errorf("constant %d is a %s, it cannot be written as a literal", index, c.Type().SharkTypeString())
+	}
+}
+
+func (s *scope) errorf(i int, format string, args ...any) error {
+	offset := 0
+	if i < len(s.instructions) {
+		offset = s.instructions[i].Offset
+	} else if s.fn != nil {
+		offset = len(s.fn.Instructions)
+	} else {
+		offset = len(s.d.bc.Instructions)
+	}
+	return fmt.Errorf("%s: offset %d: %s", s.name, offset, fmt.Sprintf(format, args...))
+}
+
+func tok(t token.Type, literal string) token.Token {
+	return token.Token{Type: t, Literal: literal}
+}
+
+func identifier(name string) *ast.Identifier {
+	return &ast.Identifier{Token: tok(token.IDENT, name), Value: name}
+}
+
+func integer(value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: tok(token.INT, strconv.FormatInt(value, 10)), Value: value}
+}
+
+func boolean(value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: tok(token.TRUE, "true"), Value: true}
+	}
+	return &ast.Boolean{Token: tok(token.FALSE, "false"), Value: false}
+}
+
+// The type of the token of an operator is the operator itself, the printer reads it to find
+// its precedence.
+func infix(op string, left, right ast.Expression) *ast.InfixExpression {
+	return &ast.InfixExpression{Token: tok(token.Type(op), op), Operator: op, Left: left, Right: right}
+}
+
+func prefix(op string, right ast.Expression) *ast.PrefixExpression {
+	return &ast.PrefixExpression{Token: tok(token.Type(op), op), Operator: op, Right: right}
+}
+
+// Returns the assignment of a value to a variable, 'x = x + y' is written 'x += y'.
+func assign(name string, value ast.Expression) *ast.InfixExpression {
+	if exp, ok := value.(*ast.InfixExpression); ok {
+		if left, ok := exp.Left.(*ast.Identifier); ok && left.Value == name {
+			if op, ok := compoundOperators[exp.Operator]; ok {
+				return infix(op, identifier(name), exp.Right)
+			}
+		}
+	}
+	return infix("=", identifier(name), value)
+}
+
+func block(statements []ast.Statement) *ast.BlockStatement {
+	return &ast.BlockStatement{Token: tok(token.LBRACE, "{"), Statements: statements}
+}
@@ -16,17 +16,25 @@ import (
 type Emitter struct {
 	output      io.Writer
 	symbolTable *compiler.SymbolTable
+	typeTable   *compiler.TypeTable
 	sourceName  *string
 	vmConf      *config.VmConf
 	constants   []object.Object
-	globals     []object.Object
+	globals     []vm.Value
+	// Applies to the code compiled to bytecode and to the code run right away.
+	optimizationLevel compiler.OptimizationLevel
+	// Counts the instructions run by the VMs when set.
+	coverage *vm.Coverage
+	// Profiles the VMs when set.
+	profiler *vm.Profiler
 }
 
 func New(sourceName *string, out io.Writer, vmConf *config.VmConf) *Emitter {
 	emitter := &Emitter{
 		constants:   []object.Object{},
-		globals:     make([]object.Object, vmConf.GlobalsSize),
+		globals:     make([]vm.Value, vmConf.GlobalsSize),
 		symbolTable: compiler.NewSymbolTable(),
+		typeTable:   compiler.NewTypeTable(),
 		output:      out,
 		sourceName:  sourceName,
 		vmConf:      vmConf,
@@ -38,10 +46,28 @@ func New(sourceName *string, out io.Writer, vmConf *config.VmConf) *Emitter {
 	return emitter
 }
 
+func (i *Emitter) SetOptimizationLevel(level compiler.OptimizationLevel) {
+	i.optimizationLevel = level
+}
+
+// SetCoverage makes the code run by the emitter count the instructions it runs in c.
+func (i *Emitter) SetCoverage(c *vm.Coverage) {
+	i.coverage = c
+}
+
+// SetProfiler makes the code run by the emitter record its calls and instructions in p.
+func (i *Emitter) SetProfiler(p *vm.Profiler) {
+	i.profiler = p
+}
+
 func (i *Emitter) GetSymbolTable() compiler.SymbolTable {
 	return *i.symbolTable
 }
 
+func (i *Emitter) GetTypeTable() compiler.TypeTable {
+	return *i.typeTable
+}
+
 func (i *Emitter) Compile(sharkCode *string, upToPos ...token.Position) *bytecode.Bytecode {
 	l := lexer.New(sharkCode)
 	p := parser.New(l)
@@ -52,13 +78,16 @@ func (i *Emitter) Compile(sharkCode *string, upToPos ...token.Position) *bytecod
 		return nil
 	}
 
-	comp := compiler.NewWithState(i.symbolTable, i.constants, upToPos...)
+	comp := compiler.NewWithState(i.symbolTable, i.typeTable, i.constants, upToPos...)
+	comp.SetOptimizationLevel(i.optimizationLevel)
+	comp.SetGlobalsSize(i.vmConf.GlobalsSize)
 	if err, _ := comp.Compile(program); err != nil {
 		i.printCompilerError(err, i.sourceName, sharkCode)
 		return nil
 	}
 
 	i.symbolTable = comp.GetSymbolTable()
+	i.typeTable = comp.GetTypeTable()
 
 	return comp.Bytecode()
 }
@@ -66,6 +95,13 @@ func (i *Emitter) Compile(sharkCode *string, upToPos ...token.Position) *bytecod
 func (i *Emitter) Exec(bytecode *bytecode.Bytecode) {
 	i.constants = bytecode.Constants
 	machine := vm.NewWithGlobalsStore(bytecode, i.globals, i.vmConf)
+	if i.coverage != nil {
+		machine.SetCoverage(i.coverage)
+	}
+	if i.profiler != nil {
+		machine.SetProfiler(i.profiler)
+		defer i.profiler.Stop()
+	}
 
 	if err := machine.Run(); err != nil {
 		i.printCompilerError(err, i.sourceName, nil)
@@ -93,7 +129,9 @@ func (i *Emitter) Interpret(in string) {
 		return
 	}
 
-	comp := compiler.NewWithState(i.symbolTable, i.constants)
+	comp := compiler.NewWithState(i.symbolTable, i.typeTable, i.constants)
+	comp.SetOptimizationLevel(i.optimizationLevel)
+	comp.SetGlobalsSize(i.vmConf.GlobalsSize)
 	err, _ := comp.Compile(program)
 	if err != nil {
 		i.printCompilerError(err, i.sourceName, &in)
@@ -102,6 +140,13 @@ func (i *Emitter) Interpret(in string) {
 	code := comp.Bytecode()
 	i.constants = code.Constants
 	machine := vm.NewWithGlobalsStore(code, i.globals, i.vmConf)
+	if i.coverage != nil {
+		machine.SetCoverage(i.coverage)
+	}
+	if i.profiler != nil {
+		machine.SetProfiler(i.profiler)
+		defer i.profiler.Stop()
+	}
 
 	if err := machine.Run(); err != nil {
 		i.printCompilerError(err, i.sourceName, nil)
@@ -0,0 +1,45 @@
+package emitter
+
+import (
+	"bytes"
+	"shark/code"
+	"shark/compiler"
+	"shark/config"
+	"shark/vm"
+	"testing"
+)
+
+func TestInterpret(t *testing.T) {
+	t.Run("should run the code optimized at the level set", func(t *testing.T) {
+		// Folding the constants leaves no addition to run
+		input := `let a = 1 + 2; a;`
+		tests := []struct {
+			level compiler.OptimizationLevel
+			adds  int
+		}{
+			{compiler.O0, 1},
+			{compiler.O1, 0},
+			{compiler.O2, 0},
+		}
+
+		for _, tt := range tests {
+			conf := config.NewDefaultVmConf()
+			conf.GlobalsSize = 64
+			name := "test.shark"
+			var out bytes.Buffer
+
+			e := New(&name, &out, &conf)
+			e.SetOptimizationLevel(tt.level)
+			profiler := vm.NewProfiler(vm.DefaultSampleInterval)
+			e.SetProfiler(profiler)
+			e.Interpret(input)
+
+			if out.Len() != 0 {
+				t.Fatalf("unexpected output at O%d: %s", tt.level, out.String())
+			}
+			if adds := profiler.Opcodes()[code.OpAdd]; adds != tt.adds {
+				t.Errorf("expected %d additions at O%d, got %d", tt.adds, tt.level, adds)
+			}
+		}
+	})
+}
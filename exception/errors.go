@@ -78,6 +78,8 @@ func (e *SharkError) String() string {
 		errType = "compiler"
 	case SharkErrorTypeRuntime:
 		errType = "runtime"
+	case SharkErrorTypeBytecode:
+		errType = "bytecode"
 	}
 
 	str.WriteString(fmt.Sprintf("%s_error[%04d]: %s\n", errType, e.ErrCode, e.ErrMsg))
@@ -131,7 +133,9 @@ func (e *SharkError) String() string {
 	}
 
 	if e.ErrHelpMsg != nil {
-		str.WriteString(fmt.Sprintf("%shelp: %s\n", emptySpace, *e.ErrHelpMsg))
+		// The lines after the first one are aligned with it
+		helpMsg := strings.ReplaceAll(*e.ErrHelpMsg, "\n", "\n"+emptySpace+strings.Repeat(" ", len("help: ")))
+		str.WriteString(fmt.Sprintf("%shelp: %s\n", emptySpace, helpMsg))
 	}
 
 	return str.String()
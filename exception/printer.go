@@ -3,6 +3,7 @@ package exception
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 func PrintExitMsgCtx(msg, ctx string, exitCode int) {
@@ -10,3 +11,16 @@ func PrintExitMsgCtx(msg, ctx string, exitCode int) {
 	fmt.Printf("   --> %s\n", ctx)
 	os.Exit(exitCode)
 }
+
+// Diff returns the expected and the actual value on lines of their own, with a marker under the
+// first character of the actual value that differs. It is meant as the help message of an error.
+func Diff(expected, actual string) string {
+	exp, act := []rune(expected), []rune(actual)
+	i := 0
+	for i < len(exp) && i < len(act) && exp[i] == act[i] {
+		i++
+	}
+
+	const expectedLabel, actualLabel = "expected: ", "  actual: "
+	return expectedLabel + expected + "\n" + actualLabel + actual + "\n" + strings.Repeat(" ", len(actualLabel)+i) + "^"
+}
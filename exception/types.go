@@ -83,6 +83,42 @@ const (
 	SharkErrorTypeNotFound
 
 	SharkErrorTypeSyntax
+
+	SharkErrorDuplicateType
+
+	SharkErrorInvalidOpcode
+
+	SharkErrorTruncatedInstruction
+
+	SharkErrorOperandOutOfRange
+
+	SharkErrorInvalidJumpTarget
+
+	SharkErrorStackUnderflow
+
+	SharkErrorStackDepthMismatch
+
+	SharkErrorMissingReturn
+
+	SharkErrorInvalidFunction
+
+	SharkErrorInvalidAnnotation
+
+	SharkErrorNestedTest
+
+	SharkErrorAssertionFailed
+
+	SharkErrorVMInterrupted
+
+	SharkErrorOperandTooLarge
+
+	SharkErrorInvalidEscape
+
+	SharkErrorUnterminatedChar
+
+	SharkErrorInvalidChar
+
+	SharkErrorUnsetVariable
 )
 
 const (
@@ -94,6 +130,8 @@ const (
 	SharkErrorTypeCompiler
 	// SharkErrorTypeRuntime is the error type for runtime errors.
 	SharkErrorTypeRuntime
+	// SharkErrorTypeBytecode is the error type for bytecode verification errors.
+	SharkErrorTypeBytecode
 )
 
 var errMessages = []struct {
@@ -137,4 +175,22 @@ var errMessages = []struct {
 	{SharkErrorNotCallable, "not callable"},
 	{SharkErrorTypeNotFound, "type '%v' not found"},
 	{SharkErrorTypeSyntax, "syntax error: %v"},
+	{SharkErrorDuplicateType, "type '%v' is already declared"},
+	{SharkErrorInvalidOpcode, "invalid opcode %v at %v"},
+	{SharkErrorTruncatedInstruction, "truncated instruction '%v' at %v"},
+	{SharkErrorOperandOutOfRange, "%v index %v of '%v' is out of range at %v"},
+	{SharkErrorInvalidJumpTarget, "jump target %v of '%v' is not an instruction at %v"},
+	{SharkErrorStackUnderflow, "'%v' pops %v values from a stack of %v at %v"},
+	{SharkErrorStackDepthMismatch, "stack depth is %v on one path and %v on another at %v"},
+	{SharkErrorMissingReturn, "function reaches the end of its instructions without returning at %v"},
+	{SharkErrorInvalidFunction, "invalid function at %v: %v"},
+	{SharkErrorInvalidAnnotation, "invalid annotation '@%v'"},
+	{SharkErrorNestedTest, "test \"%v\" is not at the top level"},
+	{SharkErrorAssertionFailed, "assertion failed: %v"},
+	{SharkErrorVMInterrupted, "execution was interrupted"},
+	{SharkErrorOperandTooLarge, "too many %v for the bytecode"},
+	{SharkErrorInvalidEscape, "invalid escape sequence '%v'"},
+	{SharkErrorUnterminatedChar, "char is not terminated"},
+	{SharkErrorInvalidChar, "a char holds exactly one character, got '%v'"},
+	{SharkErrorUnsetVariable, "variable is read before it is set"},
 }
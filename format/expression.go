@@ -0,0 +1,277 @@
+package format
+
+import (
+	"shark/ast"
+	"shark/parser"
+	"shark/token"
+	"shark/types"
+	"sort"
+	"strings"
+)
+
+// Prints an expression starting at the column col. Parentheses are only written where the
+// expression would be parsed differently without them.
+func (p *printer) expression(exp ast.Expression, indent, col int) string {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp.Value
+	case *ast.IntegerLiteral:
+		return p.source(exp.Token)
+	case *ast.Boolean:
+		if exp.Value {
+			return "true"
+		}
+		return "false"
+	case *ast.StringLiteral:
+		if exp.Token.Type == token.RAW_STRING {
+			return "`" + exp.Value + "`"
+		}
+		return quote(exp.Value)
+	case *ast.InterpolatedString:
+		out := `"`
+		for i, part := range exp.Parts {
+			if text, ok := part.(*ast.StringLiteral); ok && i%2 == 0 {
+				out += escape(text.Value)
+			} else {
+				out += "${" + p.expression(part, indent, advance(col, out)+2) + "}"
+			}
+		}
+		return out + `"`
+	case *ast.CharLiteral:
+		return quoteChar(exp.Value)
+	case *ast.PrefixExpression:
+		operand := p.expression(exp.Right, indent, col+len(exp.Operator))
+		switch right := exp.Right.(type) {
+		case *ast.InfixExpression:
+			operand = "(" + p.expression(right, indent, col+len(exp.Operator)+1) + ")"
+		case *ast.PrefixExpression:
+			// '- -a' would be read as '--a'
+			if strings.HasPrefix(right.Operator, exp.Operator[len(exp.Operator)-1:]) {
+				operand = "(" + operand + ")"
+			}
+		}
+		return exp.Operator + operand
+	case *ast.PostfixExpression:
+		return p.expression(exp.Left, indent, col) + exp.Operator
+	case *ast.InfixExpression:
+		return p.infix(exp, indent, col)
+	case *ast.IfExpression:
+		head := "if ("
+		head += p.expression(exp.Condition, indent, col+width(head)) + ") "
+		out := head + p.block(exp.Consequence, indent, advance(col, head), true)
+		if exp.Alternative != nil {
+			out += " else "
+			out += p.block(exp.Alternative, indent, advance(col, out), true)
+		}
+		return out
+	case *ast.FunctionLiteral:
+		return p.function(exp, indent, col)
+	case *ast.CallExpression:
+		callee := p.operand(exp.Function, indent, col)
+		return callee + p.list("(", ")", exp.Token.Pos, exp.Arguments, indent, advance(col, callee))
+	case *ast.ArrayLiteral:
+		return p.list("[", "]", exp.Token.Pos, exp.Elements, indent, col)
+	case *ast.TupleLiteral:
+		return p.list("(", ")", exp.Token.Pos, exp.Elements, indent, col)
+	case *ast.HashLiteral:
+		return p.hash(exp, indent, col)
+	case *ast.IndexExpression:
+		left := p.operand(exp.Left, indent, col)
+		return left + "[" + p.expression(exp.Index, indent, advance(col, left)+1) + "]"
+	case *ast.IndexAssignExpression:
+		out := p.operand(exp.Left, indent, col)
+		out += "[" + p.expression(exp.Index, indent, advance(col, out)+1) + "] = "
+		return out + p.expression(exp.Value, indent, advance(col, out))
+	case nil:
+		return ""
+	default:
+		return exp.String()
+	}
+}
+
+// Prints the callee of a call or the collection of an index expression, in parentheses unless
+// it binds tighter than both.
+func (p *printer) operand(exp ast.Expression, indent, col int) string {
+	switch exp.(type) {
+	case *ast.InfixExpression, *ast.PrefixExpression, *ast.FunctionLiteral, *ast.IfExpression:
+		return "(" + p.expression(exp, indent, col+1) + ")"
+	default:
+		return p.expression(exp, indent, col)
+	}
+}
+
+func isAssign(t token.Type) bool {
+	switch t {
+	case token.ASSIGN, token.PLUS_EQ, token.MIN_EQ, token.MUL_EQ, token.DIV_EQ:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *printer) infix(exp *ast.InfixExpression, indent, col int) string {
+	prec := parser.Precedence(exp.Token.Type)
+
+	// Operators are left associative, but the assignments are right associative
+	left := p.expression(exp.Left, indent, col)
+	if l, ok := exp.Left.(*ast.InfixExpression); ok {
+		lp := parser.Precedence(l.Token.Type)
+		if lp < prec || (lp == prec && isAssign(exp.Token.Type)) {
+			left = "(" + p.expression(exp.Left, indent, col+1) + ")"
+		}
+	}
+
+	op := " " + exp.Operator + " "
+	if exp.Token.Type == token.RANGE {
+		op = exp.Operator
+	}
+	out := left + op
+
+	rightCol := advance(col, out)
+	right := p.expression(exp.Right, indent, rightCol)
+	if r, ok := exp.Right.(*ast.InfixExpression); ok {
+		rp := parser.Precedence(r.Token.Type)
+		if rp < prec || (rp == prec && !isAssign(r.Token.Type)) {
+			right = "(" + p.expression(exp.Right, indent, rightCol+1) + ")"
+		}
+	}
+
+	return out + right
+}
+
+func (p *printer) function(fn *ast.FunctionLiteral, indent, col int) string {
+	var out strings.Builder
+	for _, annotation := range fn.Annotations {
+		out.WriteString(annotation.String() + " ")
+	}
+
+	params := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		if param.IsVariadic {
+			params[i] = "var "
+		} else if param.Mutable {
+			params[i] = "mut "
+		}
+		params[i] += param.Value
+		if param.DefinedType != nil {
+			params[i] += ": " + typeString(param.DefinedType)
+		}
+		if param.DefaultValue != nil {
+			params[i] += " = " + p.expression(*param.DefaultValue, indent, col)
+		}
+	}
+	out.WriteString("(" + strings.Join(params, ", ") + ")")
+
+	if t, ok := fn.DefinedType.(*types.TSharkFuncType); ok && t.ReturnT != nil {
+		out.WriteString(": " + typeString(t.ReturnT))
+	}
+	out.WriteString(" => ")
+
+	head := out.String()
+	return head + p.block(fn.Body, indent, advance(col, head), true)
+}
+
+// Prints a comma separated list of expressions between brackets. The list stays on one line
+// when the source has it on one line and it fits, its last item can still span several lines
+// like a function literal passed to a call. Otherwise every item is on its own line.
+func (p *printer) list(open, close string, openPos token.Position, items []ast.Expression, indent, col int) string {
+	if len(items) == 0 {
+		return open + close
+	}
+
+	print := func(i, indent, col int) string { return p.expression(items[i], indent, col) }
+	return p.wrap(open, close, openPos, len(items), print, indent, col)
+}
+
+func (p *printer) hash(hash *ast.HashLiteral, indent, col int) string {
+	if len(hash.Pairs) == 0 {
+		return "{}"
+	}
+
+	keys := make([]ast.Expression, 0, len(hash.Pairs))
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	// Keys without a position, in a tree built without source, are in the order of their text
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].TokenPos(), keys[j].TokenPos()
+		if a == b {
+			return keys[i].String() < keys[j].String()
+		}
+		return a.Before(b)
+	})
+
+	print := func(i, indent, col int) string {
+		key := p.expression(keys[i], indent, col) + ": "
+		return key + p.expression(hash.Pairs[keys[i]], indent, advance(col, key))
+	}
+	return p.wrap("{", "}", hash.Token.Pos, len(keys), print, indent, col)
+}
+
+func (p *printer) wrap(open, close string, openPos token.Position, n int, print func(i, indent, col int) string, indent, col int) string {
+	next, ok := p.tokens.after(openPos)
+	brokenInSource := ok && next.Pos.Line > openPos.Line
+
+	if !brokenInSource {
+		mark := p.next
+		var out strings.Builder
+		out.WriteString(open)
+		fits := true
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			item := print(i, indent, advance(col, out.String()))
+			// Only the last item can span several lines
+			if strings.Contains(item, "\n") && i != n-1 {
+				fits = false
+			}
+			out.WriteString(item)
+		}
+		out.WriteString(close)
+		if flat := out.String(); fits && col+width(flat) <= maxWidth {
+			return flat
+		}
+		p.next = mark
+	}
+
+	var out strings.Builder
+	out.WriteString(open + "\n")
+	for i := 0; i < n; i++ {
+		out.WriteString(tabs(indent+1) + print(i, indent+1, (indent+1)*tabWidth))
+		if i != n-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString(tabs(indent) + close)
+	return out.String()
+}
+
+// Returns the text of a token the way it is written in the source, like the underscores and
+// the base of numbers.
+func (p *printer) source(tok token.Token) string {
+	pos := tok.Pos
+	if pos.Line < 1 || pos.Line > len(p.lines) || (pos.LineTo != 0 && pos.LineTo != pos.Line) {
+		return tok.Literal
+	}
+	line := p.lines[pos.Line-1]
+	if pos.ColFrom < 1 || pos.ColTo-1 > len(line) || pos.ColFrom >= pos.ColTo {
+		return tok.Literal
+	}
+	return string(line[pos.ColFrom-1 : pos.ColTo-1])
+}
+
+// Escapes the characters the lexer reads escaped in a string between double quotes, '${' would
+// start an interpolation.
+var escape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace
+
+// Quotes a string, escaping the characters the lexer reads escaped.
+func quote(s string) string {
+	return `"` + escape(s) + `"`
+}
+
+// Quotes a char, like quote quotes a string.
+func quoteChar(c rune) string {
+	return `'` + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(string(c)) + `'`
+}
@@ -0,0 +1,124 @@
+// Package format prints Shark source code in its canonical layout: statements on their own
+// lines, blocks indented with tabs, single spaces around binary operators and after commas, and
+// lists wrapped one item per line when they do not fit. Comments are kept where they are.
+package format
+
+import (
+	"shark/ast"
+	"shark/exception"
+	"shark/lexer"
+	"shark/parser"
+	"shark/token"
+	"strings"
+)
+
+const (
+	// Width the printer keeps the lines under when it can.
+	maxWidth = 100
+	// Width of an indentation tab when measuring lines.
+	tabWidth = 4
+)
+
+// Source returns the source code in its canonical layout. The source must parse, otherwise the
+// parser errors are returned and nothing is formatted.
+func Source(src string) (string, []exception.SharkError) {
+	l := lexer.New(&src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return "", errs
+	}
+
+	return newPrinter(src, l.Comments()).program(program), nil
+}
+
+// Program prints a syntax tree that was not parsed from source, like the one recovered by the
+// decompiler. Without source the blocks and lists are kept on one line when they fit, and a
+// blank line is written between statements whose lines are more than one apart.
+func Program(program *ast.Program) string {
+	return newPrinter("", nil).program(program)
+}
+
+// The tokens of the source, to find the positions the tree does not keep, like where blocks
+// and statements end.
+type tokenIndex struct {
+	*token.Index
+}
+
+func newTokenIndex(src string) *tokenIndex {
+	return &tokenIndex{lexer.Index(src)}
+}
+
+// Returns the token before the one starting at pos.
+func (idx *tokenIndex) before(pos token.Position) (token.Token, bool) {
+	i, ok := idx.IndexOf(pos)
+	if !ok || i == 0 {
+		return token.Token{}, false
+	}
+	return idx.Tokens[i-1], true
+}
+
+// Returns the token after the one starting at pos.
+func (idx *tokenIndex) after(pos token.Position) (token.Token, bool) {
+	i, ok := idx.IndexOf(pos)
+	if !ok || i+1 >= len(idx.Tokens) {
+		return token.Token{}, false
+	}
+	return idx.Tokens[i+1], true
+}
+
+// Returns the position of the brace closing the block opened at pos.
+func (idx *tokenIndex) blockEnd(pos token.Position) token.Position {
+	start, ok := idx.IndexOf(pos)
+	if !ok {
+		return pos
+	}
+
+	depth := 0
+	for i := start; i < len(idx.Tokens); i++ {
+		switch idx.Tokens[i].Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return idx.Tokens[i].Pos
+			}
+		case token.EOF:
+			return idx.Tokens[i].Pos
+		}
+	}
+	return pos
+}
+
+func (idx *tokenIndex) eof() token.Position {
+	return idx.Tokens[len(idx.Tokens)-1].Pos
+}
+
+// Returns the width of the last line of s, once printed from the column col.
+func advance(col int, s string) int {
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return width(s[i+1:])
+	}
+	return col + width(s)
+}
+
+// Returns the width of the first line of s.
+func width(s string) int {
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[:i]
+	}
+	w := 0
+	for _, r := range s {
+		if r == '\t' {
+			w += tabWidth
+		} else {
+			w++
+		}
+	}
+	return w
+}
+
+func tabs(indent int) string {
+	return strings.Repeat("\t", indent)
+}
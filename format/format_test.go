@@ -0,0 +1,122 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "should space operators and commas",
+			input:    "let a=[1,2,3];let b={\"x\":a[0]+1};puts(a,b);",
+			expected: "let a = [1, 2, 3];\nlet b = {\"x\": a[0] + 1};\nputs(a, b);\n",
+		},
+		{
+			name:     "should indent blocks with tabs",
+			input:    "let f = (a: i64, mut b = 2): i64 => {\n  while (b > 0) {\n      b--;\n  }\n  if (a > b) { a } else { b }\n};",
+			expected: "let f = (a: i64, mut b = 2): i64 => {\n\twhile (b > 0) {\n\t\tb--;\n\t}\n\tif (a > b) { a } else { b }\n};\n",
+		},
+		{
+			name:     "should keep a single blank line between statements",
+			input:    "let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			expected: "let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			name:     "should keep only the parentheses changing the meaning",
+			input:    "let a = ((1 + 2)) * (3 * 4) - (5 - 6) - -(-7);",
+			expected: "let a = (1 + 2) * (3 * 4) - (5 - 6) - -(-7);\n",
+		},
+		{
+			name:     "should keep literals the way they are written",
+			input:    "let a = 0xF00D; let b = 0b1010; let c = \"tab\\tquote\\\"\"; let d = '\\''; let e = 'é';",
+			expected: "let a = 0xF00D;\nlet b = 0b1010;\nlet c = \"tab\\tquote\\\"\";\nlet d = '\\'';\nlet e = 'é';\n",
+		},
+		{
+			name:     "should print interpolated and raw strings",
+			input:    "let s = \"a ${1+f(x,y)} \\${b} ${ {\"k\":\"${c}\"}[\"k\"] }\"; let r = `raw\\n\n${x}`;",
+			expected: "let s = \"a ${1 + f(x, y)} \\${b} ${{\"k\": \"${c}\"}[\"k\"]}\";\nlet r = `raw\\n\n${x}`;\n",
+		},
+		{
+			name:     "should preserve the comments",
+			input:    "// header\nlet a = 1; // trailing\n/* block\n   comment */\nlet f = () => {\n// inside\n1\n};",
+			expected: "// header\nlet a = 1; // trailing\n/* block\n   comment */\nlet f = () => {\n\t// inside\n\t1\n};\n",
+		},
+		{
+			name:     "should wrap the lists that do not fit",
+			input:    "puts(aVeryLongFunctionName(anotherVeryLongArgumentName, yetAnotherVeryLongArgumentName, andOneMoreArgument));",
+			expected: "puts(aVeryLongFunctionName(\n\tanotherVeryLongArgumentName,\n\tyetAnotherVeryLongArgumentName,\n\tandOneMoreArgument\n));\n",
+		},
+		{
+			name:     "should keep the lists broken in the source",
+			input:    "let h = {\n\"x\": 1, \"y\": 2,\n};",
+			expected: "let h = {\n\t\"x\": 1,\n\t\"y\": 2\n};\n",
+		},
+		{
+			name:     "should print the other statements",
+			input:    "type Pairs = hashmap<i64,string>; let (x, mut y) = (1, \"a\"); let sq = @memo (n: i64) => { n * n }; return x;",
+			expected: "type Pairs = hashmap<i64, string>;\nlet (x, mut y) = (1, \"a\");\nlet sq = @memo (n: i64) => { n * n };\nreturn x;\n",
+		},
+		{
+			name:     "should print the tests",
+			input:    "test \"adds\"{assert_eq(1+2,3);}",
+			expected: "test \"adds\" { assert_eq(1 + 2, 3); }\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errs := Source(tt.input)
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if out != tt.expected {
+				t.Errorf("expected:\n%q\ngot:\n%q", tt.expected, out)
+			}
+		})
+	}
+
+	t.Run("should not format code that does not parse", func(t *testing.T) {
+		out, errs := Source("let = 5;")
+		if len(errs) == 0 {
+			t.Fatalf("expected parser errors")
+		}
+		if out != "" {
+			t.Errorf("expected no output, got %q", out)
+		}
+	})
+}
+
+func TestSourceIsIdempotent(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.shark")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, errs := Source(string(src))
+		if len(errs) != 0 {
+			// Examples of errors are not formatted
+			continue
+		}
+
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			second, errs := Source(first)
+			if len(errs) != 0 {
+				t.Fatalf("formatted code does not parse: %v\n%s", errs, first)
+			}
+			if second != first {
+				t.Errorf("formatting twice changed the code:\n%s\nto:\n%s", first, second)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package format
+
+import (
+	"shark/ast"
+	"shark/token"
+	"shark/types"
+	"strings"
+)
+
+type printer struct {
+	tokens *tokenIndex
+	// Lines of the source, to print literals the way they are written.
+	lines    [][]rune
+	comments []token.Token
+	// Index of the first comment not printed yet. Comments are printed in the order they appear.
+	next int
+}
+
+func newPrinter(src string, comments []token.Token) *printer {
+	p := &printer{tokens: newTokenIndex(src), comments: comments}
+	for _, line := range strings.Split(src, "\n") {
+		p.lines = append(p.lines, []rune(line))
+	}
+	return p
+}
+
+func (p *printer) program(program *ast.Program) string {
+	out := p.statements(program.Statements, token.Position{}, p.tokens.eof(), 0, false)
+	if strings.TrimSpace(out) == "" {
+		return ""
+	}
+	return out
+}
+
+// Prints the statements of a block between the positions of its braces, one per line with the
+// comments around them. A blank line between statements in the source is kept, several become
+// one. The last expression of a block whose value is used has no semicolon.
+func (p *printer) statements(stmts []ast.Statement, open, end token.Position, indent int, value bool) string {
+	var out strings.Builder
+	prevLine := open.Line
+	first := true
+
+	// Writes the comments before pos, each on its own line
+	leading := func(pos token.Position) {
+		for p.next < len(p.comments) && p.comments[p.next].Pos.Before(pos) {
+			c := p.comments[p.next]
+			if !first && c.Pos.Line > prevLine+1 {
+				out.WriteString("\n")
+			}
+			out.WriteString(tabs(indent) + c.Literal + "\n")
+			prevLine = max(c.Pos.LineTo, c.Pos.Line)
+			first = false
+			p.next++
+		}
+	}
+
+	for i, stmt := range stmts {
+		start := stmt.TokenPos()
+		next := end
+		if i+1 < len(stmts) {
+			next = stmts[i+1].TokenPos()
+		}
+
+		leading(start)
+		if !first && start.Line > prevLine+1 {
+			out.WriteString("\n")
+		}
+		first = false
+
+		out.WriteString(tabs(indent) + p.statement(stmt, indent, value && i == len(stmts)-1))
+
+		// The statement ends with the token before the next one
+		endLine := start.Line
+		if last, ok := p.tokens.before(next); ok && !last.Pos.Before(start) {
+			endLine = max(last.Pos.LineTo, last.Pos.Line)
+		}
+		if p.next < len(p.comments) {
+			if c := p.comments[p.next]; c.Pos.Line == endLine && c.Pos.Before(next) && !strings.Contains(c.Literal, "\n") {
+				out.WriteString(" " + c.Literal)
+				p.next++
+			}
+		}
+		out.WriteString("\n")
+		prevLine = endLine
+	}
+	leading(end)
+
+	return out.String()
+}
+
+func (p *printer) statement(stmt ast.Statement, indent int, blockValue bool) string {
+	col := indent * tabWidth
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		head := "let "
+		if stmt.Name.IsVariadic {
+			head = "var "
+		} else if stmt.Name.Mutable {
+			head += "mut "
+		}
+		head += stmt.Name.Value
+		if stmt.Name.DefinedType != nil {
+			head += ": " + typeString(stmt.Name.DefinedType)
+		}
+		head += " = "
+		return head + p.expression(stmt.Value, indent, col+width(head)) + ";"
+	case *ast.TupleDeconstruction:
+		names := make([]string, len(stmt.Names))
+		for i, name := range stmt.Names {
+			names[i] = name.Value
+			if name.Mutable {
+				names[i] = "mut " + name.Value
+			}
+		}
+		head := "let (" + strings.Join(names, ", ") + ") = "
+		if stmt.Token.Type == token.VAR {
+			head = "var (" + strings.Join(names, ", ") + ") = "
+		}
+		return head + p.expression(stmt.Value, indent, col+width(head)) + ";"
+	case *ast.TypeAliasStatement:
+		return "type " + stmt.Name.Value + " = " + typeString(stmt.Value) + ";"
+	case *ast.ReturnStatement:
+		return "return " + p.expression(stmt.ReturnValue, indent, col+len("return ")) + ";"
+	case *ast.TestStatement:
+		head := "test " + quote(stmt.Name.Value) + " "
+		return head + p.block(stmt.Body, indent, advance(col, head), false)
+	case *ast.WhileStatement:
+		head := "while ("
+		head += p.expression(stmt.Condition, indent, col+width(head)) + ") "
+		return head + p.block(stmt.Body, indent, advance(col, head), false)
+	case *ast.ExpressionStatement:
+		out := p.expression(stmt.Expression, indent, col)
+		if _, ok := stmt.Expression.(*ast.IfExpression); ok || blockValue {
+			return out
+		}
+		return out + ";"
+	default:
+		return stmt.String()
+	}
+}
+
+// Prints a block, on one line when the source has it on one line and it fits, like the
+// '{ x * 2 }' of a short function literal.
+func (p *printer) block(block *ast.BlockStatement, indent, col int, value bool) string {
+	end := p.tokens.blockEnd(block.Token.Pos)
+
+	hasComments := p.next < len(p.comments) && p.comments[p.next].Pos.Before(end)
+	if block.Token.Pos.Line == end.Line && !hasComments {
+		switch len(block.Statements) {
+		case 0:
+			return "{}"
+		case 1:
+			mark := p.next
+			inner := p.statement(block.Statements[0], indent, value)
+			if out := "{ " + inner + " }"; !strings.Contains(out, "\n") && col+width(out) <= maxWidth {
+				return out
+			}
+			p.next = mark
+		}
+	}
+
+	return "{\n" + p.statements(block.Statements, block.Token.Pos, end, indent+1, value) + tabs(indent) + "}"
+}
+
+// Prints a type the way it is written in annotations.
+func typeString(t types.ISharkType) string {
+	switch t := t.(type) {
+	case types.TSharkArray:
+		return "array<" + typeString(t.Collection) + ">"
+	case types.TSharkHashMap:
+		return "hashmap<" + typeString(t.Indexes) + ", " + typeString(t.Collects) + ">"
+	case types.TSharkTuple:
+		return "tuple<" + typeList(t.Collection) + ">"
+	case types.TSharkFuncType:
+		if t.ReturnT == nil {
+			return t.SharkTypeString()
+		}
+		return "func<(" + typeList(t.ArgsList) + ")->" + typeString(t.ReturnT) + ">"
+	case types.TSharkOptional:
+		return typeString(t.Type) + "?"
+	case nil:
+		return ""
+	default:
+		return t.SharkTypeString()
+	}
+}
+
+func typeList(list []types.ISharkType) string {
+	names := make([]string, len(list))
+	for i, t := range list {
+		names[i] = typeString(t)
+	}
+	return strings.Join(names, ", ")
+}
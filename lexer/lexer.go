@@ -3,14 +3,17 @@ package lexer
 import (
 	"shark/exception"
 	"shark/token"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Lexer is a struct that is used to tokenize the input string.
 type Lexer struct {
 	characters   []rune
 	errors       []exception.SharkError
+	comments     []token.Token
 	position     int
 	readPosition int
 	curLine      int
@@ -18,6 +21,9 @@ type Lexer struct {
 	curCol       int
 	prevCol      int
 	ch           rune
+	// The number of braces opened in each interpolation being read, the innermost last. The
+	// brace closing an interpolation is the one read when none is open.
+	interpolations []int
 }
 
 // Creates a new Lexer struct and initializes it with the input string.
@@ -50,6 +56,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 	if l.ch == '/' && l.peekChar() == '*' {
 		l.skipMultiLineComment()
+		return l.NextToken()
 	}
 	switch l.ch {
 	case '=':
@@ -71,7 +78,16 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = l.newToken(token.RPAREN, string(l.ch))
 	case '"':
-		tok = l.newToken(token.STRING, l.readString())
+		text, interpolated := l.readString()
+		if interpolated {
+			tok = l.newToken(token.STRING_HEAD, text)
+		} else {
+			tok = l.newToken(token.STRING, text)
+		}
+	case '`':
+		tok = l.newToken(token.RAW_STRING, l.readRawString())
+	case '\'':
+		tok = l.newToken(token.CHAR, l.readCharLiteral())
 	case ',':
 		tok = l.newToken(token.COMMA, string(l.ch))
 	case '+':
@@ -87,8 +103,26 @@ func (l *Lexer) NextToken() token.Token {
 			tok = l.newToken(token.PLUS, string(l.ch))
 		}
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = l.newToken(token.LBRACE, string(l.ch))
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1] == 0 {
+			// The interpolation is closed, the string goes on after the brace
+			l.interpolations = l.interpolations[:n-1]
+			text, interpolated := l.readString()
+			if interpolated {
+				tok = l.newToken(token.STRING_MIDDLE, text)
+			} else {
+				tok = l.newToken(token.STRING_TAIL, text)
+			}
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1]--
+		}
 		tok = l.newToken(token.RBRACE, string(l.ch))
 	case '[':
 		tok = l.newToken(token.LBRACKET, string(l.ch))
@@ -182,6 +216,8 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	case ':':
 		tok = l.newToken(token.COLON, string(l.ch))
+	case '@':
+		tok = l.newToken(token.AT, string(l.ch))
 	case 0:
 		tok = l.newToken(token.EOF, "")
 	default:
@@ -255,10 +291,13 @@ func (l *Lexer) readIdentifier() string {
 	return id
 }
 
-// Reads a string between two double quotes and returns it.
-func (l *Lexer) readString() string {
+// Reads a string between two double quotes and returns it. The string is read up to its closing
+// double quote or up to its next interpolation, which is reported. The interpolation is then
+// read as tokens up to its closing brace, and the string is read on from there.
+func (l *Lexer) readString() (string, bool) {
 	out := ""
 	multilineMode := false
+	interpolated := false
 	for {
 		l.readChar()
 		if isNewLine(l.ch) {
@@ -275,36 +314,136 @@ func (l *Lexer) readString() string {
 		if l.ch == '"' {
 			break
 		}
-		if l.ch == '\\' {
+		if l.ch == '$' && l.peekChar() == '{' {
 			l.readChar()
-			if l.ch == 'n' {
-				l.ch = '\n'
-			}
-			if l.ch == 'r' {
-				l.ch = '\r'
-			}
-			if l.ch == 't' {
-				l.ch = '\t'
-			}
-			if l.ch == '"' {
-				l.ch = '"'
-			}
-			if l.ch == '\\' {
-				l.ch = '\\'
-			}
+			l.interpolations = append(l.interpolations, 0)
+			interpolated = true
+			break
+		}
+		if l.ch == '\\' {
+			out = out + string(l.readEscape())
+			continue
 		}
 		out = out + string(l.ch)
 	}
 	if multilineMode {
 		l.errors = append(l.errors, newSharkError(exception.SharkErrorUnterminatedString, nil,
-			"Use a \\n instead to create multiline strings in double quoted strings",
+			"Use a \\n instead to create multiline strings in double quoted strings, or a raw string between backticks",
 			exception.NewSharkErrorCause("String is started here", token.Position{Line: l.prevLine, ColFrom: l.prevCol, LineTo: l.prevLine, ColTo: l.prevCol + 1}),
 			exception.NewSharkErrorCause("String ends here", token.Position{Line: l.curLine, ColFrom: l.curCol - 1, LineTo: l.curLine, ColTo: l.curCol}),
 		))
 	}
+	return out, interpolated
+}
+
+// Reads a string between two backticks and returns it. A raw string is read as it is written, it
+// has no escape sequences nor interpolations and can span lines.
+func (l *Lexer) readRawString() string {
+	out := ""
+	for {
+		l.readChar()
+		if l.ch == 0 {
+			l.errors = append(l.errors, newSharkError(exception.SharkErrorUnterminatedString, nil,
+				"Add a closing backtick to the end of the string",
+				exception.NewSharkErrorCause("There is no closing backtick before the end of the file", token.Position{Line: l.prevLine, ColFrom: l.prevCol, LineTo: l.curLine, ColTo: l.curCol}),
+			))
+			break
+		}
+		if l.ch == '`' {
+			break
+		}
+		if isNewLine(l.ch) {
+			l.registerNewlinePosition()
+		}
+		out = out + string(l.ch)
+	}
+	return out
+}
+
+// Reads a char between two single quotes and returns it. The char is written like in a string,
+// so it can be an escape sequence.
+func (l *Lexer) readCharLiteral() string {
+	out := ""
+	for {
+		// A char does not span lines, the newline is left for skipWhitespace
+		if next := l.peekChar(); next == 0 || isNewLine(next) {
+			l.errors = append(l.errors, newSharkError(exception.SharkErrorUnterminatedChar, nil,
+				"Add a closing single quote after the character",
+				exception.NewSharkErrorCause("There is no closing single quote before the end of the line", token.Position{Line: l.prevLine, ColFrom: l.prevCol, LineTo: l.curLine, ColTo: l.curCol}),
+			))
+			return out
+		}
+		l.readChar()
+		if l.ch == '\'' {
+			break
+		}
+		if l.ch == '\\' {
+			out = out + string(l.readEscape())
+		} else {
+			out = out + string(l.ch)
+		}
+	}
+	if utf8.RuneCountInString(out) != 1 {
+		l.errors = append(l.errors, newSharkError(exception.SharkErrorInvalidChar, out,
+			"Use a string between double quotes for several characters",
+			exception.NewSharkErrorCause("This char does not hold exactly one character", token.Position{Line: l.prevLine, ColFrom: l.prevCol, LineTo: l.curLine, ColTo: l.curCol}),
+		))
+	}
 	return out
 }
 
+// Reads the escape sequence starting at the current backslash and returns the character it
+// stands for. An unknown sequence stands for the escaped character itself.
+func (l *Lexer) readEscape() rune {
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'u':
+		return l.readUnicodeEscape()
+	default:
+		return l.ch
+	}
+}
+
+// Reads the rest of a '\u{...}' escape sequence, the code point of the character is written
+// with 1 to 6 hexadecimal digits.
+func (l *Lexer) readUnicodeEscape() rune {
+	pos := token.Position{Line: l.curLine, ColFrom: l.curCol - 2, LineTo: l.curLine}
+	sequence := "\\u"
+	digits := ""
+	terminated := false
+	if l.peekChar() == '{' {
+		l.readChar()
+		sequence += "{"
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+			digits += string(l.ch)
+		}
+		sequence += digits
+		if l.peekChar() == '}' {
+			l.readChar()
+			sequence += "}"
+			terminated = true
+		}
+	}
+
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if !terminated || err != nil || len(digits) > 6 || !utf8.ValidRune(rune(value)) {
+		pos.ColTo = l.curCol
+		l.errors = append(l.errors, newSharkError(exception.SharkErrorInvalidEscape, sequence,
+			"Write the code point of the character in hexadecimal, like '\\u{1F988}'",
+			exception.NewSharkErrorCause("This is not a valid unicode escape sequence", pos),
+		))
+		return utf8.RuneError
+	}
+	return rune(value)
+}
+
 // Advances the lexer's position until it encounters a non-digit character.
 // This function will increment the current line number if it encounters a isNewLine character.
 func (l *Lexer) skipWhitespace() {
@@ -349,19 +488,27 @@ func (l *Lexer) peekChar() rune {
 // Skips a single line comment. This is a comment that starts with // and ends with a isNewLine.
 // This function will increment the current line number.
 func (l *Lexer) skipSingleLineComment() {
+	pos := token.Position{Line: l.curLine, ColFrom: l.curCol - 1}
+	text := ""
 	for l.ch != '\n' && l.ch != 0 {
+		text += string(l.ch)
 		l.readChar()
 	}
+	pos.LineTo, pos.ColTo = l.curLine, l.curCol-1
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: strings.TrimRight(text, "\r"), Pos: pos})
 	l.skipWhitespace()
 }
 
 // Skips a multiline comment. This is a comment that starts with /* and ends with */.
 // This function will increment the current line number.
 func (l *Lexer) skipMultiLineComment() {
+	pos := token.Position{Line: l.curLine, ColFrom: l.curCol - 1}
+	text := ""
 	foundEndOfComment := false
 	for !foundEndOfComment {
 		if l.ch == 0 {
 			foundEndOfComment = true
+			break
 		}
 		if isNewLine(l.ch) {
 			l.registerPosition()
@@ -369,13 +516,36 @@ func (l *Lexer) skipMultiLineComment() {
 		}
 		if l.ch == '*' && l.peekChar() == '/' {
 			foundEndOfComment = true
+			text += string(l.ch)
 			l.readChar()
 		}
+		text += string(l.ch)
 		l.readChar()
 	}
+	pos.LineTo, pos.ColTo = l.curLine, l.curCol-1
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: text, Pos: pos})
 	l.skipWhitespace()
 }
 
+// Comments returns the comments skipped so far, in the order they appear in the input. The
+// parser never sees them, they are kept as trivia for the tools that rewrite the source.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// Index lexes the whole input, up to and including the EOF token, and indexes its tokens.
+func Index(input string) *token.Index {
+	l := New(&input)
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return token.NewIndex(tokens)
+		}
+	}
+}
+
 // Registers a newline position. This function will increment the current line number
 // and reset the current column number.
 func (l *Lexer) registerNewlinePosition() {
@@ -414,6 +584,11 @@ func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// Checks if a given character is a hexadecimal digit, 0-9 and a-f in any case.
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
+
 func newSharkError(code exception.SharkErrorCode, param interface{}, helpMsg string, cause ...exception.SharkErrorCause) exception.SharkError {
 	var err exception.SharkError
 
@@ -7,7 +7,7 @@ import (
 
 func TestNextToken(t *testing.T) {
 	t.Run("should tokenize individual tokens", func(t *testing.T) {
-		input := `=+(){},;`
+		input := `=+(){},;@`
 		tests := []struct {
 			expectedType    token.Type
 			expectedLiteral string
@@ -20,6 +20,7 @@ func TestNextToken(t *testing.T) {
 			{token.RBRACE, "}"},
 			{token.COMMA, ","},
 			{token.SEMICOLON, ";"},
+			{token.AT, "@"},
 			{token.EOF, ""},
 		}
 		l := New(&input)
@@ -345,6 +346,33 @@ func TestComments(t *testing.T) {
 			}
 		}
 	})
+	t.Run("should keep the comments as trivia", func(t *testing.T) {
+		input := "let a = 1; // one\n/* two\nlines */ /* three */// four\n2;"
+
+		expected := []token.Token{
+			{Type: token.COMMENT, Literal: "// one", Pos: token.Position{Line: 1, LineTo: 1, ColFrom: 12, ColTo: 18}},
+			{Type: token.COMMENT, Literal: "/* two\nlines */", Pos: token.Position{Line: 2, LineTo: 3, ColFrom: 1, ColTo: 9}},
+			{Type: token.COMMENT, Literal: "/* three */", Pos: token.Position{Line: 3, LineTo: 3, ColFrom: 10, ColTo: 21}},
+			{Type: token.COMMENT, Literal: "// four", Pos: token.Position{Line: 3, LineTo: 3, ColFrom: 21, ColTo: 28}},
+		}
+
+		l := New(&input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			if tok.Type == token.COMMENT || tok.Type == token.SLASH {
+				t.Fatalf("comment returned as a token. got=%+v", tok)
+			}
+		}
+
+		comments := l.Comments()
+		if len(comments) != len(expected) {
+			t.Fatalf("wrong number of comments. want=%d, got=%d (%+v)", len(expected), len(comments), comments)
+		}
+		for i, c := range comments {
+			if c != expected[i] {
+				t.Errorf("wrong comment %d. want=%+v, got=%+v", i, expected[i], c)
+			}
+		}
+	})
 }
 
 func TestTokenDebugLocators(t *testing.T) {
@@ -651,3 +679,163 @@ func TestDigits(t *testing.T) {
 		}
 	})
 }
+
+func TestChars(t *testing.T) {
+	t.Run("should parse chars and unicode escapes", func(t *testing.T) {
+		input := `let c: char = 'é'; '\n' '\'' '\u{1F988}' "sh\u{e9}rk"`
+
+		tests := []struct {
+			expectedType    token.Type
+			expectedLiteral string
+		}{
+			{token.LET, "let"},
+			{token.IDENT, "c"},
+			{token.COLON, ":"},
+			{token.T_CHAR, "char"},
+			{token.ASSIGN, "="},
+			{token.CHAR, "é"},
+			{token.SEMICOLON, ";"},
+			{token.CHAR, "\n"},
+			{token.CHAR, "'"},
+			{token.CHAR, "🦈"},
+			{token.STRING, "shérk"},
+			{token.EOF, ""},
+		}
+		l := New(&input)
+		for i, tt := range tests {
+			tok := l.NextToken()
+			if tok.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+			}
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - Literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+			}
+		}
+		if errs := l.PopErrors(); len(errs) != 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+	})
+
+	t.Run("should report invalid chars and escapes", func(t *testing.T) {
+		tests := []string{
+			`''`,
+			`'ab'`,
+			`'a`,
+			"'a\n'",
+			`"\u{}"`,
+			`"\u{110000}"`,
+			`"\u{D800}"`,
+			`"\u1F988"`,
+			`'\u{1F988'`,
+		}
+
+		for _, input := range tests {
+			l := New(&input)
+			for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			}
+			if len(l.PopErrors()) == 0 {
+				t.Errorf("no error for %s", input)
+			}
+		}
+	})
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	t.Run("should split strings around their interpolations", func(t *testing.T) {
+		input := `"Hello ${name}, ${ {"a": "${x}"}["a"] }!" "\${no}" "${a}${b}"`
+
+		tests := []struct {
+			expectedType    token.Type
+			expectedLiteral string
+		}{
+			{token.STRING_HEAD, "Hello "},
+			{token.IDENT, "name"},
+			{token.STRING_MIDDLE, ", "},
+			{token.LBRACE, "{"},
+			{token.STRING, "a"},
+			{token.COLON, ":"},
+			{token.STRING_HEAD, ""},
+			{token.IDENT, "x"},
+			{token.STRING_TAIL, ""},
+			{token.RBRACE, "}"},
+			{token.LBRACKET, "["},
+			{token.STRING, "a"},
+			{token.RBRACKET, "]"},
+			{token.STRING_TAIL, "!"},
+			{token.STRING, "${no}"},
+			{token.STRING_HEAD, ""},
+			{token.IDENT, "a"},
+			{token.STRING_MIDDLE, ""},
+			{token.IDENT, "b"},
+			{token.STRING_TAIL, ""},
+			{token.EOF, ""},
+		}
+		l := New(&input)
+		for i, tt := range tests {
+			tok := l.NextToken()
+			if tok.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+			}
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - Literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+			}
+		}
+		if errs := l.PopErrors(); len(errs) != 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+	})
+
+	t.Run("should read raw strings as they are written", func(t *testing.T) {
+		input := "`a\\n\"${b}\"\nc` 1"
+
+		l := New(&input)
+		tok := l.NextToken()
+		if tok.Type != token.RAW_STRING || tok.Literal != "a\\n\"${b}\"\nc" {
+			t.Fatalf("expected the raw string, got %q %q", tok.Type, tok.Literal)
+		}
+		if tok.Pos.Line != 1 || tok.Pos.LineTo != 2 {
+			t.Fatalf("expected the raw string on lines 1 to 2, got %d to %d", tok.Pos.Line, tok.Pos.LineTo)
+		}
+		if tok = l.NextToken(); tok.Type != token.INT || tok.Pos.Line != 2 {
+			t.Fatalf("expected a number on line 2, got %q on line %d", tok.Type, tok.Pos.Line)
+		}
+		if errs := l.PopErrors(); len(errs) != 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+	})
+
+	t.Run("should report unterminated strings", func(t *testing.T) {
+		for _, input := range []string{"`abc", `"a ${b} c`, "\"a\nb\""} {
+			l := New(&input)
+			for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			}
+			if len(l.PopErrors()) == 0 {
+				t.Errorf("no error for %q", input)
+			}
+		}
+	})
+}
+
+func TestIndex(t *testing.T) {
+	t.Run("should find the tokens by where they start", func(t *testing.T) {
+		idx := Index("let a = 1;\nlet bc = a;")
+		if len(idx.Tokens) != 11 || idx.Tokens[10].Type != token.EOF {
+			t.Fatalf("expected 11 tokens ending with EOF, got %v", idx.Tokens)
+		}
+		i, ok := idx.IndexOf(token.Position{Line: 2, ColFrom: 5})
+		if !ok || idx.Tokens[i].Literal != "bc" {
+			t.Fatalf("expected the index of bc, got %d %t", i, ok)
+		}
+		if _, ok := idx.IndexOf(token.Position{Line: 2, ColFrom: 6}); ok {
+			t.Fatalf("expected no token starting inside bc")
+		}
+	})
+
+	t.Run("should order positions as they are in the source", func(t *testing.T) {
+		a := token.Position{Line: 1, ColFrom: 9}
+		b := token.Position{Line: 2, ColFrom: 1}
+		if !a.Before(b) || b.Before(a) || a.Before(a) {
+			t.Fatalf("expected %v before %v", a, b)
+		}
+	})
+}
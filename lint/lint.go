@@ -0,0 +1,193 @@
+// Package lint finds the code that compiles but is likely a mistake, like bindings never used
+// or code after a return. Every rule has a level set in the 'lint' section of the configuration,
+// and some findings come with a fix that rewrites the code.
+package lint
+
+import (
+	"shark/ast"
+	"shark/compiler"
+	"shark/config"
+	"shark/exception"
+	"shark/lexer"
+	"shark/parser"
+	"shark/token"
+	"sort"
+)
+
+type Rule string
+
+const (
+	UnusedBinding      Rule = "unused-binding"
+	UnusedParameter    Rule = "unused-parameter"
+	ShadowedIdentifier Rule = "shadowed-identifier"
+	UnnecessaryMut     Rule = "unnecessary-mut"
+	UnreachableCode    Rule = "unreachable-code"
+	ConstantComparison Rule = "constant-comparison"
+	MismatchedEquality Rule = "mismatched-equality"
+)
+
+// Diagnostic is a finding of a rule in the source.
+type Diagnostic struct {
+	Rule    Rule
+	Level   config.LintLevel
+	Message string
+	Pos     token.Position
+	// The code the diagnostic is about can be removed without changing what the program does.
+	Unnecessary bool
+	Fix         *Fix
+}
+
+// Fix is a rewrite of the source making a diagnostic go away.
+type Fix struct {
+	Title string
+	Edits []Edit
+}
+
+// Edit replaces the text from the start to the end of a position.
+type Edit struct {
+	Pos     token.Position
+	NewText string
+}
+
+// Source returns the diagnostics of the rules not turned off in the configuration, sorted by
+// position. The source must compile, otherwise the errors are returned and nothing is linted.
+func Source(src string, conf config.LintConf) ([]Diagnostic, []exception.SharkError) {
+	l := lexer.New(&src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, errs
+	}
+
+	c := compiler.New()
+	if err, _ := c.Compile(program); err != nil {
+		return nil, []exception.SharkError{*err}
+	}
+
+	ln := newLinter(src, conf, c.References())
+	ln.bindings(program)
+	ln.shadowing(program)
+	ln.unreachable(program)
+	ln.comparisons(program)
+
+	sort.SliceStable(ln.diagnostics, func(i, j int) bool {
+		return ln.diagnostics[i].Pos.Before(ln.diagnostics[j].Pos)
+	})
+	return ln.diagnostics, nil
+}
+
+type linter struct {
+	*token.Index
+	conf config.LintConf
+	// Identifiers resolved by the compiler, by their line and column.
+	references  map[[2]int]compiler.Reference
+	ordered     []compiler.Reference
+	diagnostics []Diagnostic
+}
+
+func newLinter(src string, conf config.LintConf, references []compiler.Reference) *linter {
+	ln := &linter{
+		Index:      lexer.Index(src),
+		conf:       conf,
+		references: make(map[[2]int]compiler.Reference),
+		ordered:    references,
+	}
+
+	for _, ref := range references {
+		ln.references[key(ref.Pos)] = ref
+	}
+
+	return ln
+}
+
+// Returns the level of a rule, the default level when the configuration leaves it empty.
+func (ln *linter) level(rule Rule) config.LintLevel {
+	conf, def := ln.conf, config.NewDefaultLintConf()
+
+	var level, defLevel config.LintLevel
+	switch rule {
+	case UnusedBinding:
+		level, defLevel = conf.UnusedBinding, def.UnusedBinding
+	case UnusedParameter:
+		level, defLevel = conf.UnusedParameter, def.UnusedParameter
+	case ShadowedIdentifier:
+		level, defLevel = conf.ShadowedIdentifier, def.ShadowedIdentifier
+	case UnnecessaryMut:
+		level, defLevel = conf.UnnecessaryMut, def.UnnecessaryMut
+	case UnreachableCode:
+		level, defLevel = conf.UnreachableCode, def.UnreachableCode
+	case ConstantComparison:
+		level, defLevel = conf.ConstantComparison, def.ConstantComparison
+	case MismatchedEquality:
+		level, defLevel = conf.MismatchedEquality, def.MismatchedEquality
+	}
+
+	if level == "" {
+		return defLevel
+	}
+	return level
+}
+
+func (ln *linter) enabled(rule Rule) bool {
+	return ln.level(rule) != config.LintOff
+}
+
+func (ln *linter) report(d Diagnostic) {
+	if d.Level = ln.level(d.Rule); d.Level != config.LintOff {
+		ln.diagnostics = append(ln.diagnostics, d)
+	}
+}
+
+// Returns the last token in the block opened at open, or the last token of the source when
+// open is nil.
+func (ln *linter) lastToken(open *token.Position) token.Token {
+	end := len(ln.Tokens) - 1
+	if open != nil {
+		if i, ok := ln.IndexOf(*open); ok {
+			depth := 0
+			for end = i; end < len(ln.Tokens)-1; end++ {
+				if ln.Tokens[end].Type == token.LBRACE {
+					depth++
+				} else if ln.Tokens[end].Type == token.RBRACE {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+		}
+	}
+	if end == 0 {
+		return ln.Tokens[0]
+	}
+	return ln.Tokens[end-1]
+}
+
+func key(pos token.Position) [2]int {
+	return [2]int{pos.Line, pos.ColFrom}
+}
+
+// Returns the position from the start of from to the end of to.
+func span(from, to token.Position) token.Position {
+	return token.Position{Line: from.Line, ColFrom: from.ColFrom, LineTo: max(to.LineTo, to.Line), ColTo: to.ColTo}
+}
+
+// Returns the position from the start of from to the start of to.
+func upTo(from, to token.Position) token.Position {
+	return token.Position{Line: from.Line, ColFrom: from.ColFrom, LineTo: to.Line, ColTo: to.ColFrom}
+}
+
+// Returns the position from the end of from to the end of to.
+func after(from, to token.Position) token.Position {
+	return token.Position{Line: max(from.LineTo, from.Line), ColFrom: from.ColTo, LineTo: max(to.LineTo, to.Line), ColTo: to.ColTo}
+}
+
+// Walks the statement lists of the program and its blocks.
+func inspectStatements(program *ast.Program, f func(stmts []ast.Statement, open *token.Position)) {
+	f(program.Statements, nil)
+	ast.Inspect(program, func(n ast.Node) bool {
+		if block, ok := n.(*ast.BlockStatement); ok {
+			f(block.Statements, &block.Token.Pos)
+		}
+		return true
+	})
+}
@@ -0,0 +1,191 @@
+package lint
+
+import (
+	"shark/config"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		rule     Rule
+		messages []string
+	}{
+		{
+			name:     "should report the bindings never read",
+			input:    "let a = 1; let mut b = 2; b = 3; let (c, d) = (1, 2); puts(c);",
+			rule:     UnusedBinding,
+			messages: []string{"'a' is declared but never used", "'b' is declared but never used", "'d' is declared but never used"},
+		},
+		{
+			name:     "should report the parameters never read",
+			input:    "let f = (a, b) => { a }; puts(f(1, 2));",
+			rule:     UnusedParameter,
+			messages: []string{"parameter 'b' is never used"},
+		},
+		{
+			name:     "should report the parameters shadowing a binding or a builtin",
+			input:    "let a = 1; let f = (a, len) => { a + len }; puts(f(a, 2));",
+			rule:     ShadowedIdentifier,
+			messages: []string{"parameter 'a' shadows the binding declared at line 1", "parameter 'len' shadows the builtin function"},
+		},
+		{
+			name:     "should report the mutable bindings never reassigned",
+			input:    "let mut a = 1; let mut b = 2; b++; let mut c = 3; c += 1; puts(a, b, c);",
+			rule:     UnnecessaryMut,
+			messages: []string{"'a' is declared mutable but never reassigned"},
+		},
+		{
+			name:     "should report the code after a return",
+			input:    "let f = () => {\n\treturn 1;\n\tputs(2);\n};\nputs(f());",
+			rule:     UnreachableCode,
+			messages: []string{"unreachable code after 'return'"},
+		},
+		{
+			name:     "should report the comparisons of constants",
+			input:    "let a = 1; puts(1 == 2, -1 < 2, \"a\" != \"b\", a == a, a == 1, 'a' < 'b');",
+			rule:     ConstantComparison,
+			messages: []string{"comparison is always false", "comparison is always true", "comparison is always true", "comparison is always true", "comparison is always true"},
+		},
+		{
+			name:     "should report the equality of values of different types",
+			input:    "let a = 1; let s = \"1\"; let f = (): bool => { true }; puts(a == s, f() != 1, a == 2);",
+			rule:     MismatchedEquality,
+			messages: []string{"comparing 'i64' with 'string', '==' is always false", "comparing 'bool' with 'i64', '!=' is always true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics, errs := Source(tt.input, config.LintConf{})
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+
+			var messages []string
+			for _, d := range diagnostics {
+				if d.Rule == tt.rule {
+					messages = append(messages, d.Message)
+				}
+			}
+			if strings.Join(messages, "\n") != strings.Join(tt.messages, "\n") {
+				t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(tt.messages, "\n"), strings.Join(messages, "\n"))
+			}
+		})
+	}
+}
+
+func TestLevels(t *testing.T) {
+	input := "let a = 1; let f = (b) => { 1 }; puts(f(1));"
+
+	t.Run("should use the default level of the rules left empty", func(t *testing.T) {
+		diagnostics, _ := Source(input, config.LintConf{})
+		if len(diagnostics) != 2 {
+			t.Fatalf("expected 2 diagnostics, got %+v", diagnostics)
+		}
+		for _, d := range diagnostics {
+			if d.Level != config.LintWarning {
+				t.Errorf("expected level %q, got %q", config.LintWarning, d.Level)
+			}
+		}
+	})
+
+	t.Run("should use the configured levels", func(t *testing.T) {
+		conf := config.LintConf{UnusedBinding: config.LintError, UnusedParameter: config.LintOff}
+		diagnostics, _ := Source(input, conf)
+		if len(diagnostics) != 1 {
+			t.Fatalf("expected 1 diagnostic, got %+v", diagnostics)
+		}
+		if diagnostics[0].Rule != UnusedBinding || diagnostics[0].Level != config.LintError {
+			t.Errorf("expected an error of %q, got %+v", UnusedBinding, diagnostics[0])
+		}
+	})
+
+	t.Run("should not lint code that does not compile", func(t *testing.T) {
+		diagnostics, errs := Source("let a = 1; puts(b);", config.LintConf{})
+		if len(errs) != 1 || diagnostics != nil {
+			t.Errorf("expected the compiler error only, got %+v and %v", diagnostics, errs)
+		}
+	})
+}
+
+func TestFixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "should remove an unused binding",
+			input:    "let a = 1;\nputs(2);",
+			expected: "puts(2);",
+		},
+		{
+			name:     "should keep the value of an unused binding with effects",
+			input:    "let a = puts(1);",
+			expected: "puts(1);",
+		},
+		{
+			name:     "should remove 'mut'",
+			input:    "let mut a = 1; puts(a);",
+			expected: "let a = 1; puts(a);",
+		},
+		{
+			name:     "should remove the unreachable code",
+			input:    "let f = () => {\n\treturn 1;\n\tputs(2);\n\tputs(3);\n};\nputs(f());",
+			expected: "let f = () => {\n\treturn 1;\n};\nputs(f());",
+		},
+		{
+			name:     "should replace a comparison of constants with its result",
+			input:    "puts(1 + 1, -1 < 2);",
+			expected: "puts(1 + 1, true);",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics, errs := Source(tt.input, config.LintConf{})
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+
+			out := tt.input
+			for _, d := range diagnostics {
+				if d.Fix == nil {
+					continue
+				}
+				for _, edit := range d.Fix.Edits {
+					out = apply(out, edit)
+				}
+				break
+			}
+			if out != tt.expected {
+				t.Errorf("expected:\n%q\ngot:\n%q", tt.expected, out)
+			}
+		})
+	}
+
+	t.Run("should not fix a comparison in parentheses of its own", func(t *testing.T) {
+		diagnostics, _ := Source("puts((5) == 5);", config.LintConf{})
+		if len(diagnostics) != 1 || diagnostics[0].Fix != nil {
+			t.Errorf("expected a diagnostic without a fix, got %+v", diagnostics)
+		}
+	})
+}
+
+// Applies an edit to the source, positions are counted in runes from 1.
+func apply(src string, edit Edit) string {
+	offset := func(line, col int) int {
+		lines := strings.SplitAfter(src, "\n")
+		n := 0
+		for _, l := range lines[:line-1] {
+			n += len(l)
+		}
+		return n + len(string([]rune(lines[line-1])[:col-1]))
+	}
+	pos := edit.Pos
+	lineTo := max(pos.LineTo, pos.Line)
+	return src[:offset(pos.Line, pos.ColFrom)] + edit.NewText + src[offset(lineTo, pos.ColTo):]
+}
@@ -0,0 +1,525 @@
+package lint
+
+import (
+	"fmt"
+	"shark/ast"
+	"shark/object"
+	"shark/token"
+	"shark/types"
+)
+
+// A name the program defines: a let binding, a name of a tuple deconstruction or a parameter.
+type binding struct {
+	ident *ast.Identifier
+	// The statement defining the name, nil for parameters.
+	let       *ast.LetStatement
+	parameter bool
+	read      bool
+	written   bool
+}
+
+// Reports the bindings never read, and the mutable ones never reassigned.
+func (ln *linter) bindings(program *ast.Program) {
+	bindings := make(map[*token.Position]*binding)
+	var order []*binding
+	define := func(b *binding) {
+		bindings[&b.ident.Token.Pos] = b
+		order = append(order, b)
+	}
+
+	// The identifiers assigned to, a plain '=' does not read the value
+	assigned := make(map[[2]int]bool)
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			define(&binding{ident: n.Name, let: n})
+		case *ast.TupleDeconstruction:
+			for _, name := range n.Names {
+				define(&binding{ident: name})
+			}
+		case *ast.FunctionLiteral:
+			for _, param := range n.Parameters {
+				define(&binding{ident: param, parameter: true})
+			}
+		case *ast.InfixExpression:
+			if ident, ok := n.Left.(*ast.Identifier); ok && isAssign(n.Token.Type) {
+				assigned[key(ident.Token.Pos)] = n.Token.Type == token.ASSIGN
+			}
+		case *ast.PostfixExpression:
+			if ident, ok := n.Left.(*ast.Identifier); ok {
+				assigned[key(ident.Token.Pos)] = false
+			}
+		case *ast.PrefixExpression:
+			if n.RightIdent != nil {
+				assigned[key(n.RightIdent.Token.Pos)] = false
+			}
+		}
+		return true
+	})
+
+	for _, ref := range ln.ordered {
+		b, ok := bindings[ref.Binding]
+		if !ok || ref.Definition {
+			continue
+		}
+		plain, isAssigned := assigned[key(ref.Pos)]
+		b.written = b.written || isAssigned
+		b.read = b.read || !plain
+	}
+
+	for _, b := range order {
+		name := b.ident.Value
+		switch {
+		case !b.read && b.parameter:
+			ln.report(Diagnostic{
+				Rule:        UnusedParameter,
+				Message:     fmt.Sprintf("parameter '%s' is never used", name),
+				Pos:         b.ident.Token.Pos,
+				Unnecessary: true,
+			})
+		case !b.read:
+			ln.report(Diagnostic{
+				Rule:        UnusedBinding,
+				Message:     fmt.Sprintf("'%s' is declared but never used", name),
+				Pos:         b.ident.Token.Pos,
+				Unnecessary: true,
+				Fix:         ln.removeBinding(b.let),
+			})
+		case b.ident.Mutable && !b.written:
+			ln.report(Diagnostic{
+				Rule:    UnnecessaryMut,
+				Message: fmt.Sprintf("'%s' is declared mutable but never reassigned", name),
+				Pos:     b.ident.Token.Pos,
+				Fix:     ln.removeMut(b.ident),
+			})
+		}
+	}
+}
+
+// Removes a let statement, only the binding when the value does more than computing a value.
+func (ln *linter) removeBinding(let *ast.LetStatement) *Fix {
+	if let == nil {
+		return nil
+	}
+	start, ok := ln.IndexOf(let.Token.Pos)
+	if !ok {
+		return nil
+	}
+
+	if hasEffects(let.Value) {
+		// The value starts after the first '=', types have none
+		assign := start
+		for assign < len(ln.Tokens)-1 && ln.Tokens[assign].Type != token.ASSIGN {
+			assign++
+		}
+		if ln.Tokens[assign].Type != token.ASSIGN {
+			return nil
+		}
+		return &Fix{
+			Title: fmt.Sprintf("Remove the binding '%s'", let.Name.Value),
+			Edits: []Edit{{Pos: upTo(ln.Tokens[start].Pos, ln.Tokens[assign+1].Pos)}},
+		}
+	}
+
+	// The statement ends with its semicolon, the text up to the next token goes with it
+	end := start
+	for end < len(ln.Tokens)-1 && ln.Tokens[end].Type != token.SEMICOLON {
+		end++
+	}
+	if ln.Tokens[end].Type != token.SEMICOLON {
+		return nil
+	}
+	pos := upTo(let.Token.Pos, ln.Tokens[end+1].Pos)
+	if ln.Tokens[end+1].Type == token.EOF {
+		pos = span(let.Token.Pos, ln.Tokens[end].Pos)
+	}
+	return &Fix{
+		Title: fmt.Sprintf("Remove the unused binding '%s'", let.Name.Value),
+		Edits: []Edit{{Pos: pos}},
+	}
+}
+
+// Removes the 'mut' keyword before a name.
+func (ln *linter) removeMut(ident *ast.Identifier) *Fix {
+	i, ok := ln.IndexOf(ident.Token.Pos)
+	if !ok || i == 0 || ln.Tokens[i-1].Type != token.MUTABLE {
+		return nil
+	}
+	return &Fix{
+		Title: "Remove 'mut'",
+		Edits: []Edit{{Pos: upTo(ln.Tokens[i-1].Pos, ident.Token.Pos)}},
+	}
+}
+
+// Reports whether evaluating the expression can change the state of the program: calls and
+// assignments.
+func hasEffects(exp ast.Expression) bool {
+	effects := false
+	ast.Inspect(exp, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			// The body only runs when the function is called
+			return false
+		case *ast.CallExpression, *ast.IndexAssignExpression, *ast.PostfixExpression:
+			effects = true
+		case *ast.InfixExpression:
+			effects = effects || isAssign(n.Token.Type)
+		case *ast.PrefixExpression:
+			effects = effects || n.RightIdent != nil
+		}
+		return !effects
+	})
+	return effects
+}
+
+func isAssign(t token.Type) bool {
+	switch t {
+	case token.ASSIGN, token.PLUS_EQ, token.MIN_EQ, token.MUL_EQ, token.DIV_EQ:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reports the parameters named like a binding of an enclosing scope or a builtin, which are
+// hidden in the function.
+func (ln *linter) shadowing(program *ast.Program) {
+	if !ln.enabled(ShadowedIdentifier) {
+		return
+	}
+
+	builtins := make(map[string]*token.Position)
+	for _, builtin := range object.Builtins {
+		builtins[builtin.Name] = nil
+	}
+	scopes := []map[string]*token.Position{builtins, {}}
+	define := func(ident *ast.Identifier) {
+		scopes[len(scopes)-1][ident.Value] = &ident.Token.Pos
+	}
+	resolve := func(name string) (*token.Position, bool) {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if pos, ok := scopes[i][name]; ok {
+				return pos, true
+			}
+		}
+		return nil, false
+	}
+
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			// A function can call itself by its name
+			if _, ok := n.Value.(*ast.FunctionLiteral); ok {
+				define(n.Name)
+			}
+			ast.Inspect(n.Value, visit)
+			define(n.Name)
+			return false
+		case *ast.TupleDeconstruction:
+			ast.Inspect(n.Value, visit)
+			for _, name := range n.Names {
+				define(name)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			scopes = append(scopes, map[string]*token.Position{})
+			for _, param := range n.Parameters {
+				if param.DefaultValue != nil {
+					ast.Inspect(*param.DefaultValue, visit)
+				}
+				if pos, ok := resolve(param.Value); ok {
+					message := fmt.Sprintf("parameter '%s' shadows the builtin function", param.Value)
+					if pos != nil {
+						message = fmt.Sprintf("parameter '%s' shadows the binding declared at line %d", param.Value, pos.Line)
+					}
+					ln.report(Diagnostic{Rule: ShadowedIdentifier, Message: message, Pos: param.Token.Pos})
+				}
+				define(param)
+			}
+			ast.Inspect(n.Body, visit)
+			scopes = scopes[:len(scopes)-1]
+			return false
+		}
+		return true
+	}
+	ast.Inspect(program, visit)
+}
+
+// Reports the statements after a return, which never run.
+func (ln *linter) unreachable(program *ast.Program) {
+	if !ln.enabled(UnreachableCode) {
+		return
+	}
+
+	inspectStatements(program, func(stmts []ast.Statement, open *token.Position) {
+		for i, stmt := range stmts[:max(len(stmts)-1, 0)] {
+			if _, ok := stmt.(*ast.ReturnStatement); !ok {
+				continue
+			}
+
+			first, ok := ln.IndexOf(stmts[i+1].TokenPos())
+			if !ok || first == 0 {
+				return
+			}
+			last := ln.lastToken(open).Pos
+			ln.report(Diagnostic{
+				Rule:        UnreachableCode,
+				Message:     "unreachable code after 'return'",
+				Pos:         span(ln.Tokens[first].Pos, last),
+				Unnecessary: true,
+				Fix: &Fix{
+					Title: "Remove the unreachable code",
+					Edits: []Edit{{Pos: after(ln.Tokens[first-1].Pos, last)}},
+				},
+			})
+			return
+		}
+	})
+}
+
+// Reports the comparisons whose result is known before the program runs, and the equality of
+// values of different types.
+func (ln *linter) comparisons(program *ast.Program) {
+	ast.Inspect(program, func(n ast.Node) bool {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok || !isComparison(infix.Token.Type) {
+			return true
+		}
+
+		if result, ok := compareConstants(infix); ok {
+			ln.report(Diagnostic{
+				Rule:    ConstantComparison,
+				Message: fmt.Sprintf("comparison is always %t", result),
+				Pos:     infix.Token.Pos,
+				Fix:     ln.replaceComparison(infix, result),
+			})
+			return true
+		}
+
+		if infix.Token.Type != token.EQ && infix.Token.Type != token.NOT_EQ {
+			return true
+		}
+		left, right := ln.typeOf(infix.Left), ln.typeOf(infix.Right)
+		if left == nil || right == nil || left.Is(right) || right.Is(left) {
+			return true
+		}
+		ln.report(Diagnostic{
+			Rule: MismatchedEquality,
+			Message: fmt.Sprintf("comparing '%s' with '%s', '%s' is always %t",
+				left.SharkTypeString(), right.SharkTypeString(), infix.Operator, infix.Token.Type == token.NOT_EQ),
+			Pos: infix.Token.Pos,
+		})
+		return true
+	})
+}
+
+func isComparison(t token.Type) bool {
+	switch t {
+	case token.EQ, token.NOT_EQ, token.LT, token.LTE, token.GT, token.GTE:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the result of a comparison of literals, or of a name with itself.
+func compareConstants(infix *ast.InfixExpression) (bool, bool) {
+	if l, ok := infix.Left.(*ast.Identifier); ok {
+		r, ok := infix.Right.(*ast.Identifier)
+		if !ok || l.Value != r.Value {
+			return false, false
+		}
+		switch infix.Token.Type {
+		case token.EQ, token.LTE, token.GTE:
+			return true, true
+		default:
+			return false, true
+		}
+	}
+
+	left, ok := constant(infix.Left)
+	if !ok {
+		return false, false
+	}
+	right, ok := constant(infix.Right)
+	if !ok {
+		return false, false
+	}
+
+	switch l := left.(type) {
+	case int64:
+		r, ok := right.(int64)
+		if !ok {
+			return false, false
+		}
+		return compareOrdered(infix.Token.Type, l, r)
+	case rune:
+		r, ok := right.(rune)
+		if !ok {
+			return false, false
+		}
+		return compareOrdered(infix.Token.Type, l, r)
+	case string, bool:
+		if fmt.Sprintf("%T", left) != fmt.Sprintf("%T", right) {
+			return false, false
+		}
+		switch infix.Token.Type {
+		case token.EQ:
+			return left == right, true
+		case token.NOT_EQ:
+			return left != right, true
+		}
+	}
+	return false, false
+}
+
+// Compares two numbers or two chars with the operator of a comparison.
+func compareOrdered[T int64 | rune](operator token.Type, l, r T) (bool, bool) {
+	switch operator {
+	case token.EQ:
+		return l == r, true
+	case token.NOT_EQ:
+		return l != r, true
+	case token.LT:
+		return l < r, true
+	case token.LTE:
+		return l <= r, true
+	case token.GT:
+		return l > r, true
+	case token.GTE:
+		return l >= r, true
+	}
+	return false, false
+}
+
+// Returns the value of a literal, negated or not.
+func constant(exp ast.Expression) (any, bool) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return exp.Value, true
+	case *ast.StringLiteral:
+		return exp.Value, true
+	case *ast.CharLiteral:
+		return exp.Value, true
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.PrefixExpression:
+		value, ok := constant(exp.Right)
+		if !ok {
+			return nil, false
+		}
+		switch v := value.(type) {
+		case int64:
+			if exp.Operator == "-" {
+				return -v, true
+			}
+		case bool:
+			if exp.Operator == "!" {
+				return !v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Replaces a comparison with its result. The comparison must not be in parentheses of its own.
+func (ln *linter) replaceComparison(infix *ast.InfixExpression, result bool) *Fix {
+	from, ok := ln.IndexOf(infix.Left.TokenPos())
+	if !ok {
+		return nil
+	}
+	to, ok := ln.IndexOf(ln.endOf(infix.Right))
+	if !ok {
+		return nil
+	}
+
+	// '(5) == 5' starts in parentheses it does not close
+	depth := 0
+	for _, tok := range ln.Tokens[from : to+1] {
+		switch tok.Type {
+		case token.LPAREN:
+			depth++
+		case token.RPAREN:
+			if depth--; depth < 0 {
+				return nil
+			}
+		}
+	}
+	if depth != 0 {
+		return nil
+	}
+
+	return &Fix{
+		Title: fmt.Sprintf("Replace with '%t'", result),
+		Edits: []Edit{{Pos: span(ln.Tokens[from].Pos, ln.Tokens[to].Pos), NewText: fmt.Sprintf("%t", result)}},
+	}
+}
+
+// Returns the position of the last token of a literal, negated or not, or of a name.
+func (ln *linter) endOf(exp ast.Expression) token.Position {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		return ln.endOf(exp.Right)
+	default:
+		return exp.TokenPos()
+	}
+}
+
+// Returns the type of an operand when it is known without running the program: literals, names
+// and calls of functions with a return type.
+func (ln *linter) typeOf(exp ast.Expression) types.ISharkType {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return types.TSharkI64{}
+	case *ast.StringLiteral, *ast.InterpolatedString:
+		return types.TSharkString{}
+	case *ast.CharLiteral:
+		return types.TSharkChar{}
+	case *ast.Boolean:
+		return types.TSharkBool{}
+	case *ast.Identifier:
+		ref, ok := ln.references[key(exp.Token.Pos)]
+		if !ok || ref.Symbol.VariadicType {
+			return nil
+		}
+		return known(ref.Symbol.ObjType)
+	case *ast.CallExpression:
+		callee, ok := exp.Function.(*ast.Identifier)
+		if !ok {
+			return nil
+		}
+		ref, ok := ln.references[key(callee.Token.Pos)]
+		if !ok {
+			return nil
+		}
+		if fn, ok := funcType(ref.Symbol.ObjType); ok {
+			return known(fn.ReturnT)
+		}
+	}
+	return nil
+}
+
+// Returns the type unless the values can be of several types.
+func known(t types.ISharkType) types.ISharkType {
+	switch types.Underlying(t).(type) {
+	case nil, types.TSharkAny, types.TSharkOptional, types.TSharkVariadic:
+		return nil
+	default:
+		return t
+	}
+}
+
+func funcType(t types.ISharkType) (types.TSharkFuncType, bool) {
+	switch t := types.Underlying(t).(type) {
+	case types.TSharkFuncType:
+		return t, true
+	case types.TSharkClosure:
+		if t.FuncType == nil {
+			return types.TSharkFuncType{}, false
+		}
+		return funcType(t.FuncType)
+	default:
+		return types.TSharkFuncType{}, false
+	}
+}
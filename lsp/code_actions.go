@@ -0,0 +1,66 @@
+package lsp
+
+import (
+	"shark/lint"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Returns the quick fixes of the lint findings in the range. Every action is linked to the
+// diagnostic it fixes, the one the editor sent or a new one.
+func quickFixes(uri protocol.DocumentUri, content string, r protocol.Range, sent []protocol.Diagnostic) []protocol.CodeAction {
+	actions := []protocol.CodeAction{}
+
+	findings, _ := lint.Source(content, lintConfig(uri))
+	for _, d := range findings {
+		if d.Fix == nil {
+			continue
+		}
+		diagnostic := newLintDiagnostic(content, d)
+		if !overlaps(diagnostic.Range, r) {
+			continue
+		}
+		for _, s := range sent {
+			if s.Range == diagnostic.Range && s.Code != nil && s.Code.Value == diagnostic.Code.Value {
+				diagnostic = s
+				break
+			}
+		}
+
+		edits := make([]protocol.TextEdit, len(d.Fix.Edits))
+		for i, edit := range d.Fix.Edits {
+			edits[i] = protocol.TextEdit{Range: newRange(content, edit.Pos), NewText: edit.NewText}
+		}
+
+		kind := protocol.CodeActionKindQuickFix
+		preferred := true
+		actions = append(actions, protocol.CodeAction{
+			Title:       d.Fix.Title,
+			Kind:        &kind,
+			Diagnostics: []protocol.Diagnostic{diagnostic},
+			IsPreferred: &preferred,
+			Edit:        &protocol.WorkspaceEdit{Changes: map[protocol.DocumentUri][]protocol.TextEdit{uri: edits}},
+		})
+	}
+
+	return actions
+}
+
+// Reports whether the ranges share a position, their ends included.
+func overlaps(a, b protocol.Range) bool {
+	return !isBefore(a.End, b.Start) && !isBefore(b.End, a.Start)
+}
+
+func isBefore(a, b protocol.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+func codeAction(context *glsp.Context, params *protocol.CodeActionParams) (any, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return quickFixes(params.TextDocument.URI, content, params.Range, params.Context.Diagnostics), nil
+}
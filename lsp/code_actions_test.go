@@ -0,0 +1,49 @@
+package lsp
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestQuickFixes(t *testing.T) {
+	uri := protocol.DocumentUri("file:///tmp/main.shark")
+	input := "let mut a = 1;\nputs(a);"
+
+	diagnostics := diagnose(uri, input)
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", diagnostics)
+	}
+	if *diagnostics[0].Severity != protocol.DiagnosticSeverityWarning || diagnostics[0].Code.Value != "unnecessary-mut" {
+		t.Fatalf("expected a warning of 'unnecessary-mut', got %+v", diagnostics[0])
+	}
+
+	t.Run("should fix the diagnostics in the range", func(t *testing.T) {
+		actions := quickFixes(uri, input, diagnostics[0].Range, diagnostics)
+		if len(actions) != 1 {
+			t.Fatalf("expected 1 action, got %+v", actions)
+		}
+
+		action := actions[0]
+		if action.Title != "Remove 'mut'" || *action.Kind != protocol.CodeActionKindQuickFix {
+			t.Errorf("wrong action %+v", action)
+		}
+		if len(action.Diagnostics) != 1 || action.Diagnostics[0].Message != diagnostics[0].Message {
+			t.Errorf("action not linked to its diagnostic, got %+v", action.Diagnostics)
+		}
+		expected := []protocol.TextEdit{{
+			Range: protocol.Range{Start: protocol.Position{Character: 4}, End: protocol.Position{Character: 8}},
+		}}
+		edits := action.Edit.Changes[uri]
+		if len(edits) != 1 || edits[0] != expected[0] {
+			t.Errorf("expected edits %+v, got %+v", expected, edits)
+		}
+	})
+
+	t.Run("should not fix the diagnostics out of the range", func(t *testing.T) {
+		r := protocol.Range{Start: protocol.Position{Line: 1}, End: protocol.Position{Line: 1, Character: 3}}
+		if actions := quickFixes(uri, input, r, nil); len(actions) != 0 {
+			t.Errorf("expected no actions, got %+v", actions)
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"shark/ast"
+	"shark/compiler"
+	"shark/lexer"
+	"shark/parser"
+	"shark/token"
+	"shark/types"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+var (
+	// Types that take type parameters between angle brackets.
+	genericTypes = map[string]bool{"array": true, "tuple": true, "hashmap": true, "func": true}
+	// The right side of a type alias, 'type Name = '.
+	typeAliasValue = regexp.MustCompile(`^\s*type\s+\w+\s*=\s*$`)
+)
+
+func completion(context *glsp.Context, params *protocol.CompletionParams) (any, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return complete(content, params.Position), nil
+}
+
+// Returns the completion items for the cursor at the given position of the content.
+func complete(content string, position protocol.Position) []protocol.CompletionItem {
+	cursor := position.IndexIn(content)
+	start := wordStart(content, cursor)
+
+	lineStart := strings.LastIndex(content[:start], "\n") + 1
+	symbols, aliases, params := symbolsAt(content, start, cursor, int(position.Line)+1)
+
+	if isTypePosition(content[lineStart:start]) {
+		return typeCompletions(aliases)
+	}
+
+	items := keywordCompletions()
+	items = append(items, symbolCompletions(symbols, params)...)
+
+	return items
+}
+
+// Returns the offset where the identifier ending at the cursor starts.
+func wordStart(content string, cursor int) int {
+	runes := []rune(content[:cursor])
+	i := len(runes)
+	for i > 0 && isIdentRune(runes[i-1]) {
+		i--
+	}
+	return len(string(runes[:i]))
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Reports whether the text before the identifier being typed expects a type: after the colon
+// of a type annotation, the arrow of a function type, inside the angle brackets of a generic
+// type, or on the right side of a type alias.
+func isTypePosition(before string) bool {
+	trimmed := strings.TrimRightFunc(before, unicode.IsSpace)
+	if strings.HasSuffix(trimmed, ":") || strings.HasSuffix(trimmed, "->") || typeAliasValue.MatchString(before) {
+		return true
+	}
+
+	// Finds the innermost angle bracket that is not closed, ignoring the ones of arrows
+	depth := 0
+	for i := len(trimmed) - 1; i >= 0; i-- {
+		switch trimmed[i] {
+		case '>':
+			if i == 0 || trimmed[i-1] != '-' {
+				depth++
+			}
+		case '<':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			j := i
+			for j > 0 && isIdentRune(rune(trimmed[j-1])) {
+				j--
+			}
+			return genericTypes[trimmed[j:i]]
+		case ';', '{', '}', '=':
+			return false
+		}
+	}
+
+	return false
+}
+
+// Compiles the content up to the cursor and returns the symbols and type aliases in scope
+// there, from the innermost scope out, and the parameter names of the functions bound to a
+// name. The identifier being typed is usually incomplete code, so it is removed first, and
+// if the content still does not parse the whole line is left out.
+func symbolsAt(content string, start, cursor, line int) ([][]compiler.Symbol, [][]compiler.TypeSymbol, map[string][]string) {
+	lineStart := strings.LastIndex(content[:start], "\n") + 1
+	lineEnd := len(content)
+	if i := strings.Index(content[cursor:], "\n"); i >= 0 {
+		lineEnd = cursor + i
+	}
+
+	// A '0' on the line after the stop line makes the compiler stop in the scope of the cursor
+	attempts := []struct {
+		content  string
+		stopLine int
+	}{
+		{content: content[:start] + "\n0;\n" + content[cursor:], stopLine: line},
+		{content: content[:lineStart] + "0;" + content[lineEnd:], stopLine: line - 1},
+	}
+
+	for _, attempt := range attempts {
+		l := lexer.New(&attempt.content)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			continue
+		}
+
+		c := compiler.New(token.Position{Line: attempt.stopLine})
+		// Errors before the cursor leave the symbols defined up to them
+		_, _ = c.Compile(program)
+
+		return scopeSymbols(c.GetSymbolTable()), scopeAliases(c.GetTypeTable()), functionParameters(program)
+	}
+
+	return scopeSymbols(compiler.New().GetSymbolTable()), nil, nil
+}
+
+func scopeSymbols(st *compiler.SymbolTable) [][]compiler.Symbol {
+	var scopes [][]compiler.Symbol
+	for ; st != nil; st = st.Outer {
+		scopes = append(scopes, st.Symbols())
+	}
+	return scopes
+}
+
+func scopeAliases(tt *compiler.TypeTable) [][]compiler.TypeSymbol {
+	var scopes [][]compiler.TypeSymbol
+	for ; tt != nil; tt = tt.Outer {
+		scopes = append(scopes, tt.Aliases())
+	}
+	return scopes
+}
+
+// Returns the parameter names of the function literals bound to a name.
+func functionParameters(node ast.Node) map[string][]string {
+	params := make(map[string][]string)
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if fn, ok := n.(*ast.FunctionLiteral); ok && fn.Name != "" {
+			names := make([]string, len(fn.Parameters))
+			for i, p := range fn.Parameters {
+				names[i] = p.Value
+			}
+			params[fn.Name] = names
+		}
+		return true
+	})
+
+	return params
+}
+
+func keywordCompletions() []protocol.CompletionItem {
+	kind := protocol.CompletionItemKindKeyword
+
+	var items []protocol.CompletionItem
+	for _, keyword := range token.Keywords() {
+		if token.IsTypeKeyword(keyword) {
+			continue
+		}
+		items = append(items, protocol.CompletionItem{Label: keyword, Kind: &kind})
+	}
+	sortItems(items)
+
+	return items
+}
+
+func typeCompletions(aliases [][]compiler.TypeSymbol) []protocol.CompletionItem {
+	keywordKind := protocol.CompletionItemKindKeyword
+	aliasKind := protocol.CompletionItemKindClass
+
+	var items []protocol.CompletionItem
+	for _, keyword := range token.Keywords() {
+		if token.IsTypeKeyword(keyword) {
+			items = append(items, protocol.CompletionItem{Label: keyword, Kind: &keywordKind})
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, scope := range aliases {
+		for _, alias := range scope {
+			if seen[alias.Name] {
+				continue
+			}
+			seen[alias.Name] = true
+			detail := "type " + alias.Name + " = " + alias.Type.Type.SharkTypeString()
+			items = append(items, protocol.CompletionItem{Label: alias.Name, Kind: &aliasKind, Detail: &detail})
+		}
+	}
+	sortItems(items)
+
+	return items
+}
+
+// Returns a completion item for every symbol in scope, the symbols of inner scopes shadow the
+// ones of outer scopes. The locals of enclosing functions are free variables at the cursor.
+func symbolCompletions(scopes [][]compiler.Symbol, params map[string][]string) []protocol.CompletionItem {
+	var items []protocol.CompletionItem
+	seen := make(map[string]bool)
+
+	for depth, scope := range scopes {
+		for _, symbol := range scope {
+			if seen[symbol.Name] {
+				continue
+			}
+			seen[symbol.Name] = true
+
+			scope := symbol.Scope
+			if depth > 0 && scope == compiler.LocalScope {
+				scope = compiler.FreeScope
+			}
+			items = append(items, symbolCompletion(symbol, scope, params[symbol.Name]))
+		}
+	}
+	sortItems(items)
+
+	return items
+}
+
+func symbolCompletion(symbol compiler.Symbol, scope compiler.SymbolScope, paramNames []string) protocol.CompletionItem {
+	kind := protocol.CompletionItemKindVariable
+	detail := strings.ToLower(string(scope))
+	if symbol.ObjType != nil {
+		detail += " " + symbol.ObjType.SharkTypeString()
+	}
+
+	item := protocol.CompletionItem{Label: symbol.Name, Kind: &kind, Detail: &detail}
+
+	fn, ok := funcType(symbol.ObjType)
+	if !ok {
+		return item
+	}
+
+	kind = protocol.CompletionItemKindFunction
+	format := protocol.InsertTextFormatSnippet
+
+	var args []string
+	for i, arg := range fn.ArgsList {
+		placeholder := arg.SharkTypeString()
+		if i < len(paramNames) {
+			placeholder = paramNames[i]
+		}
+		args = append(args, fmt.Sprintf("${%d:%s}", i+1, escapeSnippet(placeholder)))
+	}
+	insertText := symbol.Name + "(" + strings.Join(args, ", ") + ")$0"
+
+	item.InsertText = &insertText
+	item.InsertTextFormat = &format
+
+	return item
+}
+
+// Returns the function type of a function or closure type.
+func funcType(t types.ISharkType) (types.TSharkFuncType, bool) {
+	switch t := types.Underlying(t).(type) {
+	case types.TSharkFuncType:
+		return t, true
+	case types.TSharkClosure:
+		return funcType(t.FuncType)
+	default:
+		return types.TSharkFuncType{}, false
+	}
+}
+
+// Escapes the characters with a meaning in snippets.
+func escapeSnippet(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`).Replace(text)
+}
+
+func sortItems(items []protocol.CompletionItem) {
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+}
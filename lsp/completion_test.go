@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func findItem(items []protocol.CompletionItem, label string) (protocol.CompletionItem, bool) {
+	for _, item := range items {
+		if item.Label == label {
+			return item, true
+		}
+	}
+	return protocol.CompletionItem{}, false
+}
+
+func TestCompletion(t *testing.T) {
+	t.Run("should complete the identifiers in scope at the cursor", func(t *testing.T) {
+		input := `let g = 1;
+let add = (a: i64, b: i64): i64 => {
+	let s = a;
+	let inner = () => {
+		s
+	};
+	a + b
+};
+let after = 2;`
+
+		items := complete(input, protocol.Position{Line: 4, Character: 3})
+
+		tests := []struct {
+			label  string
+			detail string
+		}{
+			{label: "s", detail: "free i64"},
+			{label: "a", detail: "free i64"},
+			{label: "g", detail: "global i64"},
+			{label: "len", detail: "builtin func<(collection<...any>)->i64>"},
+		}
+
+		for _, tt := range tests {
+			item, ok := findItem(items, tt.label)
+			if !ok {
+				t.Errorf("no completion for %q", tt.label)
+				continue
+			}
+			if *item.Detail != tt.detail {
+				t.Errorf("wrong detail for %q. want=%q, got=%q", tt.label, tt.detail, *item.Detail)
+			}
+		}
+
+		if _, ok := findItem(items, "after"); ok {
+			t.Errorf("'after' is defined after the cursor but was completed")
+		}
+		if item, ok := findItem(items, "let"); !ok || *item.Kind != protocol.CompletionItemKindKeyword {
+			t.Errorf("keyword 'let' was not completed")
+		}
+		if _, ok := findItem(items, "i64"); ok {
+			t.Errorf("type 'i64' was completed outside of a type annotation")
+		}
+	})
+
+	t.Run("should complete the locals of the function at the cursor", func(t *testing.T) {
+		input := "let add = (a: i64, b: i64): i64 => {\n\ta + \n};"
+
+		items := complete(input, protocol.Position{Line: 1, Character: 5})
+
+		for _, label := range []string{"a", "b"} {
+			item, ok := findItem(items, label)
+			if !ok {
+				t.Fatalf("no completion for %q", label)
+			}
+			if *item.Detail != "local i64" {
+				t.Errorf("wrong detail for %q. got=%q", label, *item.Detail)
+			}
+		}
+	})
+
+	t.Run("should insert argument placeholders for functions", func(t *testing.T) {
+		input := "let add = (first: i64, second: i64): i64 => { first + second };\nad"
+
+		items := complete(input, protocol.Position{Line: 1, Character: 2})
+
+		tests := []struct {
+			label      string
+			insertText string
+		}{
+			{label: "add", insertText: "add(${1:first}, ${2:second})$0"},
+			{label: "push", insertText: "push(${1:array<T>}, ${2:T})$0"},
+		}
+
+		for _, tt := range tests {
+			item, ok := findItem(items, tt.label)
+			if !ok {
+				t.Fatalf("no completion for %q", tt.label)
+			}
+			if item.InsertText == nil || *item.InsertText != tt.insertText {
+				t.Errorf("wrong insert text for %q. want=%q, got=%v", tt.label, tt.insertText, item.InsertText)
+			}
+			if item.InsertTextFormat == nil || *item.InsertTextFormat != protocol.InsertTextFormatSnippet {
+				t.Errorf("insert text of %q is not a snippet", tt.label)
+			}
+		}
+	})
+
+	t.Run("should complete type names in type annotations", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			position protocol.Position
+		}{
+			{input: "type Names = array<string>;\nlet n: Na", position: protocol.Position{Line: 1, Character: 9}},
+			{input: "type Names = array<string>;\nlet f = (n: array<", position: protocol.Position{Line: 1, Character: 18}},
+			{input: "type Names = array<string>;\nlet f = (): func<(i64)->", position: protocol.Position{Line: 1, Character: 24}},
+			{input: "type Names = array<string>;\ntype Other = ", position: protocol.Position{Line: 1, Character: 13}},
+		}
+
+		for _, tt := range tests {
+			items := complete(tt.input, tt.position)
+
+			if _, ok := findItem(items, "i64"); !ok {
+				t.Errorf("type 'i64' was not completed in %q", tt.input)
+			}
+			if item, ok := findItem(items, "Names"); !ok || *item.Detail != "type Names = array<string>" {
+				t.Errorf("alias 'Names' was not completed in %q", tt.input)
+			}
+			if _, ok := findItem(items, "len"); ok {
+				t.Errorf("identifier 'len' was completed in the type annotation of %q", tt.input)
+			}
+		}
+	})
+
+	t.Run("should not take comparisons for type parameters", func(t *testing.T) {
+		items := complete("let a = 1;\nif (a < ", protocol.Position{Line: 1, Character: 8})
+
+		if _, ok := findItem(items, "a"); !ok {
+			t.Errorf("identifier 'a' was not completed after a comparison")
+		}
+	})
+}
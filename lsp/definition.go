@@ -1,12 +1,10 @@
 package lsp
 
 import (
-	"fmt"
-	"os"
+	"io"
 	"shark/compiler"
 	"shark/config"
 	"shark/emitter"
-	"shark/internal"
 	"shark/lexer"
 	"shark/token"
 
@@ -15,23 +13,17 @@ import (
 )
 
 func definition(context *glsp.Context, params *protocol.DefinitionParams) (any, error) {
-	path, err := internal.GetFilePathFromURI(params.TextDocument.URI)
+	path, content, err := documents.read(params.TextDocument.URI)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
-	bytes, err := internal.ReadFile(*path)
-	if err != nil {
-		return nil, err
-	}
-	content := string(bytes)
 
 	argConfig, err := config.LocateConfig(nil, path)
 	if err != nil {
 		return nil, err
 	}
 
-	sharkEmitter := emitter.New(path, os.Stdout, &argConfig.NidumVM)
+	sharkEmitter := emitter.New(path, io.Discard, &argConfig.NidumVM)
 
 	l := lexer.New(&content)
 
@@ -54,20 +46,14 @@ func definition(context *glsp.Context, params *protocol.DefinitionParams) (any,
 	sym, ok := st.FindIdent(identName)
 
 	if ok && sym.Scope != compiler.BuiltinScope {
-		return &protocol.Location{
-			URI: params.TextDocument.URI,
-			Range: protocol.Range{
-				Start: protocol.Position{
-					Line:      uint32(sym.Pos.Line - 1),
-					Character: uint32(sym.Pos.ColFrom - 1),
-				},
-				End: protocol.Position{
-					Line:      uint32(sym.Pos.Line - 1),
-					Character: uint32(sym.Pos.ColTo - 1),
-				},
-			},
-		}, nil
-	} else {
-		return nil, nil
+		return newLocation(params.TextDocument.URI, content, sym.Pos), nil
 	}
+
+	tt := sharkEmitter.GetTypeTable()
+
+	if typeSym, ok := tt.FindType(identName); ok {
+		return newLocation(params.TextDocument.URI, content, typeSym.Pos), nil
+	}
+
+	return nil, nil
 }
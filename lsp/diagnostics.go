@@ -0,0 +1,142 @@
+package lsp
+
+import (
+	"shark/compiler"
+	"shark/config"
+	"shark/exception"
+	"shark/internal"
+	"shark/lexer"
+	"shark/lint"
+	"shark/parser"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Lexes, parses and compiles the content, returning the errors found. The compiler stops at
+// its first error, and only runs when the content parses.
+func analyze(content string) []*exception.SharkError {
+	l := lexer.New(&content)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if errors := p.Errors(); len(errors) != 0 {
+		result := make([]*exception.SharkError, len(errors))
+		for i := range errors {
+			result[i] = &errors[i]
+		}
+		return result
+	}
+
+	if err, _ := compiler.New().Compile(program); err != nil {
+		return []*exception.SharkError{err}
+	}
+
+	return nil
+}
+
+// Converts an error to a diagnostic placed at its first cause. The help message is added to
+// the message, and every cause is reported as related information.
+func newDiagnostic(uri protocol.DocumentUri, content string, err *exception.SharkError) protocol.Diagnostic {
+	severity := protocol.DiagnosticSeverityError
+	source := lsName
+
+	diagnostic := protocol.Diagnostic{
+		Severity: &severity,
+		Code:     &protocol.IntegerOrString{Value: protocol.Integer(err.ErrCode)},
+		Source:   &source,
+		Message:  err.ErrMsg,
+	}
+
+	if err.ErrHelpMsg != nil {
+		diagnostic.Message += "\nhelp: " + *err.ErrHelpMsg
+	}
+
+	if len(err.ErrCause) > 0 {
+		diagnostic.Range = newRange(content, err.ErrCause[0].Pos)
+	}
+
+	for _, cause := range err.ErrCause {
+		if cause.CauseMsg == "" {
+			continue
+		}
+		diagnostic.RelatedInformation = append(diagnostic.RelatedInformation, protocol.DiagnosticRelatedInformation{
+			Location: *newLocation(uri, content, &cause.Pos),
+			Message:  cause.CauseMsg,
+		})
+	}
+
+	return diagnostic
+}
+
+// Converts a finding of the linter to a diagnostic, its rule is the code.
+func newLintDiagnostic(content string, d lint.Diagnostic) protocol.Diagnostic {
+	severity := protocol.DiagnosticSeverityWarning
+	if d.Level == config.LintError {
+		severity = protocol.DiagnosticSeverityError
+	}
+	source := lsName
+
+	diagnostic := protocol.Diagnostic{
+		Range:    newRange(content, d.Pos),
+		Severity: &severity,
+		Code:     &protocol.IntegerOrString{Value: string(d.Rule)},
+		Source:   &source,
+		Message:  d.Message,
+	}
+	// Editors fade the code out
+	if d.Unnecessary {
+		diagnostic.Tags = []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary}
+	}
+
+	return diagnostic
+}
+
+// Returns the lint configuration of the file, from the configuration file next to it.
+func lintConfig(uri protocol.DocumentUri) config.LintConf {
+	path, err := internal.GetFilePathFromURI(uri)
+	if err != nil {
+		return config.NewDefaultLintConf()
+	}
+	conf, err := config.LocateConfig(nil, path)
+	if err != nil {
+		return config.NewDefaultLintConf()
+	}
+	return conf.Lint
+}
+
+// Returns the errors of the content, or the findings of the linter when it compiles.
+func diagnose(uri protocol.DocumentUri, content string) []protocol.Diagnostic {
+	// An empty list clears the diagnostics published before
+	diagnostics := []protocol.Diagnostic{}
+	errs := analyze(content)
+	for _, err := range errs {
+		diagnostics = append(diagnostics, newDiagnostic(uri, content, err))
+	}
+	if len(errs) != 0 {
+		return diagnostics
+	}
+
+	findings, _ := lint.Source(content, lintConfig(uri))
+	for _, d := range findings {
+		diagnostics = append(diagnostics, newLintDiagnostic(content, d))
+	}
+	return diagnostics
+}
+
+// Analyzes the document as it is in the store and publishes its diagnostics.
+func publishDiagnostics(context *glsp.Context, uri protocol.DocumentUri, version protocol.Integer) error {
+	_, content, err := documents.read(uri)
+	if err != nil {
+		return err
+	}
+
+	v := protocol.UInteger(version)
+	context.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+		URI:         uri,
+		Version:     &v,
+		Diagnostics: diagnose(uri, content),
+	})
+
+	return nil
+}
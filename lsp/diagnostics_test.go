@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"shark/exception"
+	"strings"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestDiagnostics(t *testing.T) {
+	uri := protocol.DocumentUri("file:///tmp/main.shark")
+
+	t.Run("should report parser and compiler errors at their causes", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			code     exception.SharkErrorCode
+			expected protocol.Range
+		}{
+			{
+				input:    "let a = ;",
+				code:     exception.SharkErrorExpectedExpression,
+				expected: protocol.Range{Start: protocol.Position{Line: 0, Character: 8}, End: protocol.Position{Line: 0, Character: 9}},
+			},
+			{
+				input:    "let a = 1;\nputs(b);",
+				code:     exception.SharkErrorIdentifierNotFound,
+				expected: protocol.Range{Start: protocol.Position{Line: 1, Character: 5}, End: protocol.Position{Line: 1, Character: 6}},
+			},
+			{
+				// Characters are counted in UTF-16 code units, the emoji takes two
+				input:    "let s = \"🦈\"; s + c;",
+				code:     exception.SharkErrorIdentifierNotFound,
+				expected: protocol.Range{Start: protocol.Position{Line: 0, Character: 18}, End: protocol.Position{Line: 0, Character: 19}},
+			},
+		}
+
+		for _, tt := range tests {
+			diagnostics := diagnose(uri, tt.input)
+			if len(diagnostics) != 1 {
+				t.Fatalf("expected 1 diagnostic for %q, got %d", tt.input, len(diagnostics))
+			}
+
+			d := diagnostics[0]
+			if d.Range != tt.expected {
+				t.Errorf("wrong range for %q. want=%+v, got=%+v", tt.input, tt.expected, d.Range)
+			}
+			if d.Code.Value != protocol.Integer(tt.code) {
+				t.Errorf("wrong code for %q. want=%d, got=%v", tt.input, tt.code, d.Code.Value)
+			}
+			if *d.Severity != protocol.DiagnosticSeverityError {
+				t.Errorf("wrong severity for %q. got=%d", tt.input, *d.Severity)
+			}
+			if !strings.Contains(d.Message, "\nhelp: ") {
+				t.Errorf("help message missing for %q. got=%q", tt.input, d.Message)
+			}
+			if len(d.RelatedInformation) == 0 || d.RelatedInformation[0].Location.URI != uri {
+				t.Errorf("causes missing from the related information for %q. got=%+v", tt.input, d.RelatedInformation)
+			}
+		}
+	})
+
+	t.Run("should report every cause of an error", func(t *testing.T) {
+		input := "let s = \"abc\nlet b = 1;"
+
+		diagnostics := diagnose(uri, input)
+		if len(diagnostics) == 0 {
+			t.Fatalf("expected diagnostics for %q", input)
+		}
+		if len(diagnostics[0].RelatedInformation) != len(analyze(input)[0].ErrCause) {
+			t.Errorf("wrong number of related information. got=%+v", diagnostics[0].RelatedInformation)
+		}
+	})
+
+	t.Run("should publish an empty list when there are no errors", func(t *testing.T) {
+		diagnostics := diagnose(uri, "let a = 1; puts(a);")
+		if diagnostics == nil || len(diagnostics) != 0 {
+			t.Errorf("expected an empty list of diagnostics, got %+v", diagnostics)
+		}
+	})
+}
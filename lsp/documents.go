@@ -0,0 +1,118 @@
+package lsp
+
+import (
+	"fmt"
+	"shark/internal"
+	"sync"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// A document opened in the editor, its content includes the edits that are not saved yet.
+type document struct {
+	content string
+	version protocol.Integer
+}
+
+// Holds the documents opened in the editor. Handlers are run concurrently, so every access
+// goes through the lock.
+type documentStore struct {
+	documents map[protocol.DocumentUri]*document
+	mu        sync.RWMutex
+}
+
+func newDocumentStore() *documentStore {
+	return &documentStore{documents: make(map[protocol.DocumentUri]*document)}
+}
+
+var documents = newDocumentStore()
+
+func (s *documentStore) open(uri protocol.DocumentUri, version protocol.Integer, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.documents[uri] = &document{content: content, version: version}
+}
+
+// Applies the changes in order, each one either replaces the whole content or the text in its range.
+func (s *documentStore) change(uri protocol.DocumentUri, version protocol.Integer, changes []any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[uri]
+	if !ok {
+		return fmt.Errorf("document '%s' is not open", uri)
+	}
+
+	for _, change := range changes {
+		switch change := change.(type) {
+		case protocol.TextDocumentContentChangeEventWhole:
+			doc.content = change.Text
+		case protocol.TextDocumentContentChangeEvent:
+			start, end := change.Range.IndexesIn(doc.content)
+			if start > end {
+				return fmt.Errorf("invalid range %v in document '%s'", *change.Range, uri)
+			}
+			doc.content = doc.content[:start] + change.Text + doc.content[end:]
+		default:
+			return fmt.Errorf("unknown change %T in document '%s'", change, uri)
+		}
+	}
+	doc.version = version
+
+	return nil
+}
+
+func (s *documentStore) close(uri protocol.DocumentUri) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.documents, uri)
+}
+
+// Returns the path of the document and its content. Documents that are not open in the
+// editor are read from the disk.
+func (s *documentStore) read(uri protocol.DocumentUri) (*string, string, error) {
+	path, err := internal.GetFilePathFromURI(uri)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	doc, ok := s.documents[uri]
+	s.mu.RUnlock()
+	if ok {
+		return path, doc.content, nil
+	}
+
+	bytes, err := internal.ReadFile(*path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return path, string(bytes), nil
+}
+
+func didOpen(context *glsp.Context, params *protocol.DidOpenTextDocumentParams) error {
+	documents.open(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+	return publishDiagnostics(context, params.TextDocument.URI, params.TextDocument.Version)
+}
+
+func didChange(context *glsp.Context, params *protocol.DidChangeTextDocumentParams) error {
+	if err := documents.change(params.TextDocument.URI, params.TextDocument.Version, params.ContentChanges); err != nil {
+		return err
+	}
+	return publishDiagnostics(context, params.TextDocument.URI, params.TextDocument.Version)
+}
+
+func didClose(context *glsp.Context, params *protocol.DidCloseTextDocumentParams) error {
+	documents.close(params.TextDocument.URI)
+
+	// The diagnostics of a closed document are cleared
+	context.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+		URI:         params.TextDocument.URI,
+		Diagnostics: []protocol.Diagnostic{},
+	})
+	return nil
+}
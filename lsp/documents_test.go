@@ -0,0 +1,113 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func changeRange(startLine, startChar, endLine, endChar uint32) *protocol.Range {
+	return &protocol.Range{
+		Start: protocol.Position{Line: startLine, Character: startChar},
+		End:   protocol.Position{Line: endLine, Character: endChar},
+	}
+}
+
+func TestDocumentStore(t *testing.T) {
+	uri := protocol.DocumentUri("file:///tmp/main.shark")
+
+	t.Run("should apply full and incremental changes in order", func(t *testing.T) {
+		tests := []struct {
+			changes  []any
+			expected string
+		}{
+			{
+				changes:  []any{protocol.TextDocumentContentChangeEventWhole{Text: "let b = 2;\n"}},
+				expected: "let b = 2;\n",
+			},
+			{
+				changes: []any{
+					protocol.TextDocumentContentChangeEvent{Range: changeRange(0, 4, 0, 5), Text: "value"},
+				},
+				expected: "let value = 1;\nputs(a);\n",
+			},
+			{
+				changes: []any{
+					protocol.TextDocumentContentChangeEvent{Range: changeRange(1, 5, 1, 6), Text: "a + 1"},
+					protocol.TextDocumentContentChangeEvent{Range: changeRange(0, 14, 1, 0), Text: " "},
+				},
+				expected: "let a = 1; puts(a + 1);\n",
+			},
+			{
+				changes: []any{
+					protocol.TextDocumentContentChangeEvent{Range: changeRange(2, 0, 2, 0), Text: "a;\n"},
+				},
+				expected: "let a = 1;\nputs(a);\na;\n",
+			},
+			{
+				// Characters are counted in UTF-16 code units, the emoji takes two
+				changes: []any{
+					protocol.TextDocumentContentChangeEventWhole{Text: "\"🦈é\";"},
+					protocol.TextDocumentContentChangeEvent{Range: changeRange(0, 3, 0, 4), Text: "e"},
+				},
+				expected: "\"🦈e\";",
+			},
+		}
+
+		for _, tt := range tests {
+			store := newDocumentStore()
+			store.open(uri, 1, "let a = 1;\nputs(a);\n")
+
+			if err := store.change(uri, 2, tt.changes); err != nil {
+				t.Fatalf("could not apply changes: %s", err)
+			}
+
+			_, content, err := store.read(uri)
+			if err != nil {
+				t.Fatalf("could not read document: %s", err)
+			}
+			if content != tt.expected {
+				t.Errorf("wrong content. want=%q, got=%q", tt.expected, content)
+			}
+			if store.documents[uri].version != 2 {
+				t.Errorf("wrong version. want=2, got=%d", store.documents[uri].version)
+			}
+		}
+	})
+
+	t.Run("should not change documents that are not open", func(t *testing.T) {
+		store := newDocumentStore()
+
+		changes := []any{protocol.TextDocumentContentChangeEventWhole{Text: "1;"}}
+		if err := store.change(uri, 1, changes); err == nil {
+			t.Fatalf("expected an error for a document that is not open")
+		}
+	})
+
+	t.Run("should read documents from the disk once they are closed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "main.shark")
+		if err := os.WriteFile(path, []byte("saved;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fileUri := protocol.DocumentUri("file://" + path)
+
+		store := newDocumentStore()
+		store.open(fileUri, 1, "unsaved;")
+
+		if _, content, _ := store.read(fileUri); content != "unsaved;" {
+			t.Errorf("open document not read from the store. got=%q", content)
+		}
+
+		store.close(fileUri)
+
+		readPath, content, err := store.read(fileUri)
+		if err != nil {
+			t.Fatalf("could not read document: %s", err)
+		}
+		if content != "saved;" || *readPath != path {
+			t.Errorf("closed document not read from the disk. got=%q at %q", content, *readPath)
+		}
+	})
+}
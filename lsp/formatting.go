@@ -0,0 +1,145 @@
+package lsp
+
+import (
+	"shark/format"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Above this many line pairs the documents are not diffed, the edit replaces every line that
+// changed between the first and the last one.
+const maxDiffSize = 1 << 20
+
+// A run of lines of the old content replaced with lines of the new one.
+type hunk struct {
+	oldFrom, oldTo int
+	newFrom, newTo int
+}
+
+// Returns the edits turning the content into its formatted layout. Only the lines that change are
+// edited, the cursor and the folded regions of the editor stay where they are. The content is
+// not formatted when it does not parse.
+func formattingEdits(content string) []protocol.TextEdit {
+	formatted, errs := format.Source(content)
+	if len(errs) != 0 || formatted == content {
+		return []protocol.TextEdit{}
+	}
+
+	oldLines, newLines := textLines(content), textLines(formatted)
+	edits := []protocol.TextEdit{}
+	for _, h := range diff(oldLines, newLines) {
+		edits = append(edits, protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: protocol.UInteger(h.oldFrom)},
+				End:   lineEnd(oldLines, h.oldTo),
+			},
+			NewText: strings.Join(newLines[h.newFrom:h.newTo], ""),
+		})
+	}
+	return edits
+}
+
+// Returns the lines of the content with their line breaks.
+func textLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Returns the position after the line before the nth one.
+func lineEnd(lines []string, n int) protocol.Position {
+	if n < len(lines) || n == 0 || strings.HasSuffix(lines[n-1], "\n") {
+		return protocol.Position{Line: protocol.UInteger(n)}
+	}
+	// The last line has no line break
+	return protocol.Position{Line: protocol.UInteger(n - 1), Character: protocol.UInteger(utf16Len(lines[n-1]))}
+}
+
+// Returns the runs of lines that differ between from and to, from the longest common
+// subsequence of their lines.
+func diff(from, to []string) []hunk {
+	// The lines the same at the start and the end are not part of the subsequence table
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+	a, b := from[prefix:len(from)-suffix], to[prefix:len(to)-suffix]
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	if len(a)*len(b) > maxDiffSize {
+		return []hunk{{prefix, prefix + len(a), prefix, prefix + len(b)}}
+	}
+
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var hunks []hunk
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			i++
+			j++
+			continue
+		}
+		h := hunk{oldFrom: prefix + i, newFrom: prefix + j}
+		for i < len(a) || j < len(b) {
+			if i < len(a) && j < len(b) && a[i] == b[j] {
+				break
+			}
+			if j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]) {
+				i++
+			} else {
+				j++
+			}
+		}
+		h.oldTo, h.newTo = prefix+i, prefix+j
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+func formatting(context *glsp.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return formattingEdits(content), nil
+}
+
+// The whole document is formatted, only the edits of the lines in the range are kept.
+func rangeFormatting(context *glsp.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	edits := []protocol.TextEdit{}
+	for _, edit := range formattingEdits(content) {
+		if edit.Range.Start.Line <= params.Range.End.Line && edit.Range.End.Line >= params.Range.Start.Line {
+			edits = append(edits, edit)
+		}
+	}
+	return edits, nil
+}
@@ -0,0 +1,62 @@
+package lsp
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestFormattingEdits(t *testing.T) {
+	t.Run("should only edit the lines that change", func(t *testing.T) {
+		input := "let a = 1;\nlet b=2;\nlet c = 3;\nlet d=4"
+
+		edits := formattingEdits(input)
+
+		expected := []protocol.TextEdit{
+			{
+				Range:   protocol.Range{Start: protocol.Position{Line: 1}, End: protocol.Position{Line: 2}},
+				NewText: "let b = 2;\n",
+			},
+			{
+				Range:   protocol.Range{Start: protocol.Position{Line: 3}, End: protocol.Position{Line: 3, Character: 7}},
+				NewText: "let d = 4;\n",
+			},
+		}
+		if len(edits) != len(expected) {
+			t.Fatalf("expected %d edits, got %d: %v", len(expected), len(edits), edits)
+		}
+		for i, edit := range edits {
+			if edit != expected[i] {
+				t.Errorf("edit %d: expected %v, got %v", i, expected[i], edit)
+			}
+		}
+	})
+
+	t.Run("should not edit formatted code", func(t *testing.T) {
+		if edits := formattingEdits("let a = 1;\n"); len(edits) != 0 {
+			t.Errorf("expected no edits, got %v", edits)
+		}
+	})
+
+	t.Run("should not edit code that does not parse", func(t *testing.T) {
+		if edits := formattingEdits("let a=;"); len(edits) != 0 {
+			t.Errorf("expected no edits, got %v", edits)
+		}
+	})
+}
+
+func TestDiff(t *testing.T) {
+	from := []string{"a", "b", "c", "d", "e"}
+	to := []string{"a", "x", "c", "e", "f"}
+
+	expected := []hunk{{1, 2, 1, 2}, {3, 4, 3, 3}, {5, 5, 4, 5}}
+	hunks := diff(from, to)
+	if len(hunks) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, hunks)
+	}
+	for i, h := range hunks {
+		if h != expected[i] {
+			t.Errorf("hunk %d: expected %v, got %v", i, expected[i], h)
+		}
+	}
+}
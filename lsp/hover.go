@@ -1,12 +1,10 @@
 package lsp
 
 import (
-	"fmt"
-	"os"
+	"io"
 	"shark/compiler"
 	"shark/config"
 	"shark/emitter"
-	"shark/internal"
 	"shark/lexer"
 	"shark/token"
 
@@ -15,23 +13,17 @@ import (
 )
 
 func hover(context *glsp.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
-	path, err := internal.GetFilePathFromURI(params.TextDocument.URI)
+	path, content, err := documents.read(params.TextDocument.URI)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
-	bytes, err := internal.ReadFile(*path)
-	if err != nil {
-		return nil, err
-	}
-	content := string(bytes)
 
 	argConfig, err := config.LocateConfig(nil, path)
 	if err != nil {
 		return nil, err
 	}
 
-	sharkEmitter := emitter.New(path, os.Stdout, &argConfig.NidumVM)
+	sharkEmitter := emitter.New(path, io.Discard, &argConfig.NidumVM)
 
 	l := lexer.New(&content)
 
@@ -54,7 +46,18 @@ func hover(context *glsp.Context, params *protocol.HoverParams) (*protocol.Hover
 	sym, ok := st.FindIdent(identName)
 
 	if !ok {
-		return nil, nil
+		tt := sharkEmitter.GetTypeTable()
+		typeSym, ok := tt.FindType(identName)
+		if !ok {
+			return nil, nil
+		}
+
+		return &protocol.Hover{
+			Contents: &protocol.MarkupContent{
+				Kind:  protocol.MarkupKindMarkdown,
+				Value: "**Shark Type (_alias_)**\n```shark\ntype " + typeSym.Name + " = " + typeSym.Type.Type.SharkTypeString() + "\n```",
+			},
+		}, nil
 	}
 
 	var value string
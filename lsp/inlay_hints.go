@@ -0,0 +1,181 @@
+package lsp
+
+import (
+	"shark/ast"
+	"shark/compiler"
+	"shark/lexer"
+	"shark/parser"
+	"shark/token"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Inlay hints are part of the protocol since 3.17, the types are not in protocol_3_16.
+const methodTextDocumentInlayHint = "textDocument/inlayHint"
+
+type inlayHintParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	Range        protocol.Range                  `json:"range"`
+}
+
+type inlayHintKind protocol.UInteger
+
+const (
+	inlayHintKindType      inlayHintKind = 1
+	inlayHintKindParameter inlayHintKind = 2
+)
+
+type inlayHint struct {
+	Label        string            `json:"label"`
+	Position     protocol.Position `json:"position"`
+	Kind         inlayHintKind     `json:"kind"`
+	PaddingRight bool              `json:"paddingRight,omitempty"`
+}
+
+// Returns the inlay hints of the content: the types the compiler inferred after the names of the
+// bindings without a type annotation, and the names of the parameters before the arguments of
+// the calls to functions bound to a name. The content is hinted up to the first compile error.
+func inlayHintsOf(content string) []inlayHint {
+	l := lexer.New(&content)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return []inlayHint{}
+	}
+
+	c := compiler.New()
+	_, _ = c.Compile(program)
+
+	references := make(map[[2]int]compiler.Reference)
+	for _, ref := range c.References() {
+		references[[2]int{ref.Pos.Line, ref.Pos.ColFrom}] = ref
+	}
+
+	// The binding of every let statement defining a function
+	functions := make(map[*token.Position]*ast.FunctionLiteral)
+	ast.Inspect(program, func(n ast.Node) bool {
+		if let, ok := n.(*ast.LetStatement); ok {
+			if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+				functions[&let.Name.Token.Pos] = fn
+			}
+		}
+		return true
+	})
+
+	lines := strings.Split(content, "\n")
+	tokens := newTokenIndex(content)
+	hints := []inlayHint{}
+
+	typeHint := func(name *ast.Identifier) {
+		ref, ok := references[[2]int{name.Token.Pos.Line, name.Token.Pos.ColFrom}]
+		if !ok || !ref.Definition || ref.Symbol.ObjType == nil {
+			return
+		}
+		hints = append(hints, inlayHint{
+			Label:    ": " + ref.Symbol.ObjType.SharkTypeString(),
+			Position: newPosition(lines, name.Token.Pos.Line, name.Token.Pos.ColTo),
+			Kind:     inlayHintKindType,
+		})
+	}
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			// Function literals spell out their type
+			if _, ok := n.Value.(*ast.FunctionLiteral); !ok && n.Name.DefinedType == nil {
+				typeHint(n.Name)
+			}
+		case *ast.TupleDeconstruction:
+			for _, name := range n.Names {
+				typeHint(name)
+			}
+		case *ast.CallExpression:
+			callee, ok := n.Function.(*ast.Identifier)
+			if !ok {
+				break
+			}
+			ref, ok := references[[2]int{callee.Token.Pos.Line, callee.Token.Pos.ColFrom}]
+			if !ok {
+				break
+			}
+			fn, ok := functions[ref.Binding]
+			if !ok {
+				break
+			}
+			for i, start := range tokens.argumentStarts(n.Token.Pos) {
+				if i >= len(fn.Parameters) || i >= len(n.Arguments) {
+					break
+				}
+				// The argument already says what it is
+				if arg, ok := n.Arguments[i].(*ast.Identifier); ok && arg.Value == fn.Parameters[i].Value {
+					continue
+				}
+				hints = append(hints, inlayHint{
+					Label:        fn.Parameters[i].Value + ":",
+					Position:     newPosition(lines, start.Line, start.ColFrom),
+					Kind:         inlayHintKindParameter,
+					PaddingRight: true,
+				})
+			}
+		}
+		return true
+	})
+
+	return hints
+}
+
+// Returns the positions of the first tokens of the arguments of the call whose argument list
+// opens at pos.
+func (idx *tokenIndex) argumentStarts(pos token.Position) []token.Position {
+	start, ok := idx.IndexOf(pos)
+	if !ok {
+		return nil
+	}
+
+	var starts []token.Position
+	depth := 0
+	for i := start; i < len(idx.Tokens)-1; i++ {
+		switch idx.Tokens[i].Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+			if depth == 1 && idx.Tokens[i+1].Type != token.RPAREN {
+				starts = append(starts, idx.Tokens[i+1].Pos)
+			}
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+			if depth == 0 {
+				return starts
+			}
+		case token.COMMA:
+			if depth == 1 {
+				starts = append(starts, idx.Tokens[i+1].Pos)
+			}
+		}
+	}
+	return starts
+}
+
+// Reports whether the position is in the range, the end of the range excluded.
+func inRange(position protocol.Position, r protocol.Range) bool {
+	after := position.Line > r.Start.Line || (position.Line == r.Start.Line && position.Character >= r.Start.Character)
+	before := position.Line < r.End.Line || (position.Line == r.End.Line && position.Character < r.End.Character)
+	return after && before
+}
+
+func inlayHints(context *glsp.Context, params *inlayHintParams) ([]inlayHint, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	hints := []inlayHint{}
+	for _, hint := range inlayHintsOf(content) {
+		if inRange(hint.Position, params.Range) {
+			hints = append(hints, hint)
+		}
+	}
+
+	return hints, nil
+}
@@ -0,0 +1,34 @@
+package lsp
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestInlayHints(t *testing.T) {
+	input := `let add = (a: i64, b: i64): i64 => { a + b };
+let b = 1;
+let total: i64 = add(b + 1, b);
+let (name, size) = ("é", add(2, 3));`
+
+	expected := []inlayHint{
+		{Label: ": i64", Position: protocol.Position{Line: 1, Character: 5}, Kind: inlayHintKindType},
+		{Label: "a:", Position: protocol.Position{Line: 2, Character: 21}, Kind: inlayHintKindParameter, PaddingRight: true},
+		{Label: ": string", Position: protocol.Position{Line: 3, Character: 9}, Kind: inlayHintKindType},
+		{Label: ": i64", Position: protocol.Position{Line: 3, Character: 15}, Kind: inlayHintKindType},
+		{Label: "a:", Position: protocol.Position{Line: 3, Character: 29}, Kind: inlayHintKindParameter, PaddingRight: true},
+		{Label: "b:", Position: protocol.Position{Line: 3, Character: 32}, Kind: inlayHintKindParameter, PaddingRight: true},
+	}
+
+	hints := inlayHintsOf(input)
+
+	if len(hints) != len(expected) {
+		t.Fatalf("wrong number of hints. want=%d, got=%d (%+v)", len(expected), len(hints), hints)
+	}
+	for i, hint := range hints {
+		if hint != expected[i] {
+			t.Errorf("wrong hint %d. want=%+v, got=%+v", i, expected[i], hint)
+		}
+	}
+}
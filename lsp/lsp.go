@@ -1,6 +1,7 @@
 package lsp
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/phuslu/log"
@@ -15,28 +16,87 @@ var (
 	version = "0.0.1"
 )
 
-func Start(port int) {
+// Starts the language server, on stdin and stdout if stdio is set, otherwise on the given port.
+// The standard output is the protocol stream in stdio mode, logs go to the standard error.
+func Start(port int, stdio bool) {
+	handler = protocol.Handler{
+		Initialize:                     initialize,
+		Initialized:                    initialized,
+		Shutdown:                       shutdown,
+		SetTrace:                       setTrace,
+		TextDocumentDidOpen:            didOpen,
+		TextDocumentDidChange:          didChange,
+		TextDocumentDidClose:           didClose,
+		TextDocumentCompletion:         completion,
+		TextDocumentHover:              hover,
+		TextDocumentSignatureHelp:      signatureHelp,
+		TextDocumentDefinition:         definition,
+		TextDocumentReferences:         references,
+		TextDocumentPrepareRename:      prepareRename,
+		TextDocumentRename:             rename,
+		TextDocumentDocumentSymbol:     documentSymbol,
+		TextDocumentSemanticTokensFull: semanticTokensFull,
+		TextDocumentFormatting:         formatting,
+		TextDocumentCodeAction:         codeAction,
+		TextDocumentRangeFormatting:    rangeFormatting,
+	}
+
+	server := server.NewServer(sharkHandler{&handler}, lsName, true)
+
+	if stdio {
+		log.Debug().Msg("Starting Shark language server on stdio")
+		if err := server.RunStdio(); err != nil {
+			log.Error().Err(err).Msg("Shark language server stopped")
+		}
+		return
+	}
+
 	log.Debug().Int("port", port).Msg("Starting Shark language server")
+	if err := server.RunTCP(fmt.Sprintf("localhost:%d", port)); err != nil {
+		log.Error().Err(err).Msg("Shark language server stopped")
+	}
+}
 
-	handler = protocol.Handler{
-		Initialize:             initialize,
-		Initialized:            initialized,
-		Shutdown:               shutdown,
-		SetTrace:               setTrace,
-		TextDocumentHover:      hover,
-		TextDocumentDefinition: definition,
+// Handles the methods of the protocol that protocol.Handler does not know about, and passes the
+// others on to it.
+type sharkHandler struct {
+	*protocol.Handler
+}
+
+func (h sharkHandler) Handle(context *glsp.Context) (r any, validMethod bool, validParams bool, err error) {
+	if context.Method != methodTextDocumentInlayHint || !h.IsInitialized() {
+		return h.Handler.Handle(context)
 	}
 
-	server := server.NewServer(&handler, lsName, true)
+	var params inlayHintParams
+	if err = json.Unmarshal(context.Params, &params); err != nil {
+		return nil, true, false, err
+	}
+	r, err = inlayHints(context, &params)
+	return r, true, true, err
+}
+
+// The capabilities of protocol.ServerCapabilities and the ones of later versions of the protocol.
+type serverCapabilities struct {
+	protocol.ServerCapabilities
+	InlayHintProvider bool `json:"inlayHintProvider,omitempty"`
+}
 
-	server.RunTCP(fmt.Sprintf("localhost:%d", port))
+type initializeResult struct {
+	ServerInfo   *protocol.InitializeResultServerInfo `json:"serverInfo,omitempty"`
+	Capabilities serverCapabilities                   `json:"capabilities"`
 }
 
 func initialize(context *glsp.Context, params *protocol.InitializeParams) (any, error) {
 	capabilities := handler.CreateServerCapabilities()
+	// Renames are checked with textDocument/prepareRename first
+	capabilities.RenameProvider = protocol.RenameOptions{PrepareProvider: &protocol.True}
+	capabilities.SemanticTokensProvider = protocol.SemanticTokensOptions{Legend: semanticTokensLegend, Full: true}
+	capabilities.SignatureHelpProvider = &protocol.SignatureHelpOptions{TriggerCharacters: []string{"(", ","}}
+	capabilities.CodeActionProvider = protocol.CodeActionOptions{CodeActionKinds: []protocol.CodeActionKind{protocol.CodeActionKindQuickFix}}
 
-	return protocol.InitializeResult{
-		Capabilities: capabilities,
+	return initializeResult{
+		Capabilities: serverCapabilities{ServerCapabilities: capabilities, InlayHintProvider: true},
 		ServerInfo: &protocol.InitializeResultServerInfo{
 			Name:    lsName,
 			Version: &version,
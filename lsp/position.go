@@ -0,0 +1,55 @@
+package lsp
+
+import (
+	"shark/token"
+	"strings"
+	"unicode/utf16"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Converts a position of the lexer, with lines and columns counted in runes from 1, to a
+// position of the protocol, counted from 0 with characters in UTF-16 code units.
+func newPosition(lines []string, line, col int) protocol.Position {
+	if line < 1 {
+		return protocol.Position{}
+	}
+	if line > len(lines) {
+		return protocol.Position{Line: uint32(line - 1)}
+	}
+
+	character := 0
+	for i, r := range []rune(lines[line-1]) {
+		if i >= col-1 {
+			break
+		}
+		character += len(utf16.Encode([]rune{r}))
+	}
+
+	return protocol.Position{Line: uint32(line - 1), Character: uint32(character)}
+}
+
+func newRange(content string, pos token.Position) protocol.Range {
+	return rangeIn(strings.Split(content, "\n"), pos)
+}
+
+// Converts a position of the lexer to a range of the protocol against the lines of the content,
+// for the callers converting many positions of the same content to split it only once.
+func rangeIn(lines []string, pos token.Position) protocol.Range {
+	lineTo := pos.LineTo
+	if lineTo < pos.Line {
+		lineTo = pos.Line
+	}
+
+	return protocol.Range{
+		Start: newPosition(lines, pos.Line, pos.ColFrom),
+		End:   newPosition(lines, lineTo, pos.ColTo),
+	}
+}
+
+func newLocation(uri protocol.DocumentUri, content string, pos *token.Position) *protocol.Location {
+	return &protocol.Location{
+		URI:   uri,
+		Range: newRange(content, *pos),
+	}
+}
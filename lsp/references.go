@@ -0,0 +1,174 @@
+package lsp
+
+import (
+	"fmt"
+	"shark/compiler"
+	"shark/lexer"
+	"shark/parser"
+	"shark/token"
+	"sort"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// The identifiers of a document resolved to their bindings.
+type referenceIndex struct {
+	// The lines of the content, to convert the positions of the references.
+	lines      []string
+	references []compiler.Reference
+	// Set when the whole content compiled, otherwise the identifiers after the error are missing.
+	complete bool
+}
+
+// Compiles the whole content and indexes its identifiers. When the content does not compile,
+// only the identifiers before the error are indexed.
+func newReferenceIndex(content string) *referenceIndex {
+	l := lexer.New(&content)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &referenceIndex{lines: strings.Split(content, "\n")}
+	}
+
+	c := compiler.New()
+	err, _ := c.Compile(program)
+
+	return &referenceIndex{lines: strings.Split(content, "\n"), references: c.References(), complete: err == nil}
+}
+
+// Returns the reference whose identifier contains the position.
+func (idx *referenceIndex) at(position protocol.Position) (compiler.Reference, bool) {
+	for _, ref := range idx.references {
+		r := rangeIn(idx.lines, ref.Pos)
+		if r.Start.Line != position.Line {
+			continue
+		}
+		if r.Start.Character <= position.Character && position.Character <= r.End.Character {
+			return ref, true
+		}
+	}
+	return compiler.Reference{}, false
+}
+
+// Reports whether two references resolve to the same binding. Builtins have no definition,
+// they are the same binding when they have the same name.
+func sameBinding(a, b compiler.Reference) bool {
+	if a.Binding == nil || b.Binding == nil {
+		return a.Binding == nil && b.Binding == nil && a.Symbol.Name == b.Symbol.Name
+	}
+	return a.Binding == b.Binding
+}
+
+// Returns the references to the binding of ref in the order they appear in the content, the
+// definition included if asked for.
+func (idx *referenceIndex) referencesTo(ref compiler.Reference, includeDefinition bool) []compiler.Reference {
+	var result []compiler.Reference
+	for _, other := range idx.references {
+		if !sameBinding(ref, other) || (other.Definition && !includeDefinition) {
+			continue
+		}
+		result = append(result, other)
+	}
+	// A let statement defines its name after compiling its value
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Pos.Line != result[j].Pos.Line {
+			return result[i].Pos.Line < result[j].Pos.Line
+		}
+		return result[i].Pos.ColFrom < result[j].Pos.ColFrom
+	})
+	return result
+}
+
+// Checks that every reference to the binding of ref can be renamed to newName without
+// changing what the program means.
+func (idx *referenceIndex) checkRename(ref compiler.Reference, newName string) error {
+	if ref.Binding == nil {
+		return fmt.Errorf("cannot rename the builtin '%s'", ref.Symbol.Name)
+	}
+	if !idx.complete {
+		return fmt.Errorf("cannot rename '%s' while the document has errors", ref.Symbol.Name)
+	}
+
+	l := lexer.New(&newName)
+	if tok := l.NextToken(); tok.Type != token.IDENT || tok.Literal != newName || l.NextToken().Type != token.EOF {
+		return fmt.Errorf("'%s' is not a valid identifier", newName)
+	}
+
+	// Names can only be shadowed by parameters, a name that is already used could end up
+	// referring to another binding
+	for _, other := range idx.references {
+		if other.Symbol.Name == newName && !sameBinding(ref, other) {
+			return fmt.Errorf("'%s' is already defined", newName)
+		}
+	}
+	if _, ok := compiler.New().GetSymbolTable().Resolve(newName); ok {
+		return fmt.Errorf("'%s' is a builtin", newName)
+	}
+
+	return nil
+}
+
+func references(context *glsp.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newReferenceIndex(content)
+	ref, ok := idx.at(params.Position)
+	if !ok {
+		return nil, nil
+	}
+
+	locations := []protocol.Location{}
+	for _, other := range idx.referencesTo(ref, params.Context.IncludeDeclaration) {
+		locations = append(locations, protocol.Location{URI: params.TextDocument.URI, Range: rangeIn(idx.lines, other.Pos)})
+	}
+
+	return locations, nil
+}
+
+func prepareRename(context *glsp.Context, params *protocol.PrepareRenameParams) (any, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newReferenceIndex(content)
+	ref, ok := idx.at(params.Position)
+	if !ok {
+		return nil, nil
+	}
+	if ref.Binding == nil {
+		return nil, fmt.Errorf("cannot rename the builtin '%s'", ref.Symbol.Name)
+	}
+
+	return protocol.RangeWithPlaceholder{Range: rangeIn(idx.lines, ref.Pos), Placeholder: ref.Symbol.Name}, nil
+}
+
+func rename(context *glsp.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newReferenceIndex(content)
+	ref, ok := idx.at(params.Position)
+	if !ok {
+		return nil, nil
+	}
+	if err := idx.checkRename(ref, params.NewName); err != nil {
+		return nil, err
+	}
+
+	var edits []protocol.TextEdit
+	for _, other := range idx.referencesTo(ref, true) {
+		edits = append(edits, protocol.TextEdit{Range: rangeIn(idx.lines, other.Pos), NewText: params.NewName})
+	}
+
+	return &protocol.WorkspaceEdit{
+		Changes: map[protocol.DocumentUri][]protocol.TextEdit{params.TextDocument.URI: edits},
+	}, nil
+}
@@ -0,0 +1,126 @@
+package lsp
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Applies edits that do not overlap, from the last one to the first.
+func applyEdits(content string, edits []protocol.TextEdit) string {
+	for i := len(edits) - 1; i >= 0; i-- {
+		start, end := edits[i].Range.IndexesIn(content)
+		content = content[:start] + edits[i].NewText + content[end:]
+	}
+	return content
+}
+
+func TestReferences(t *testing.T) {
+	input := `let mut total = 0;
+let add = (x: i64, total: i64): i64 => {
+	let inner = () => { add(x, total) };
+	x + total
+};
+total = add(total, 1);
+puts(total);`
+
+	t.Run("should find the references of the binding at the cursor", func(t *testing.T) {
+		tests := []struct {
+			position          protocol.Position
+			includeDefinition bool
+			expected          []protocol.Position
+		}{
+			{
+				position:          protocol.Position{Line: 5, Character: 2},
+				includeDefinition: true,
+				expected:          []protocol.Position{{Line: 0, Character: 8}, {Line: 5, Character: 0}, {Line: 5, Character: 12}, {Line: 6, Character: 5}},
+			},
+			{
+				position:          protocol.Position{Line: 3, Character: 6},
+				includeDefinition: false,
+				expected:          []protocol.Position{{Line: 2, Character: 28}, {Line: 3, Character: 5}},
+			},
+			{
+				position:          protocol.Position{Line: 2, Character: 21},
+				includeDefinition: true,
+				expected:          []protocol.Position{{Line: 1, Character: 4}, {Line: 2, Character: 21}, {Line: 5, Character: 8}},
+			},
+		}
+
+		for _, tt := range tests {
+			idx := newReferenceIndex(input)
+			ref, ok := idx.at(tt.position)
+			if !ok {
+				t.Fatalf("no identifier at %+v", tt.position)
+			}
+
+			refs := idx.referencesTo(ref, tt.includeDefinition)
+			if len(refs) != len(tt.expected) {
+				t.Fatalf("wrong number of references for %+v. want=%d, got=%d", tt.position, len(tt.expected), len(refs))
+			}
+			for i, r := range refs {
+				if start := newRange(input, r.Pos).Start; start != tt.expected[i] {
+					t.Errorf("wrong reference %d for %+v. want=%+v, got=%+v", i, tt.position, tt.expected[i], start)
+				}
+			}
+		}
+	})
+
+	t.Run("should rename every reference of the binding and nothing else", func(t *testing.T) {
+		idx := newReferenceIndex(input)
+		ref, ok := idx.at(protocol.Position{Line: 1, Character: 20})
+		if !ok {
+			t.Fatalf("no identifier at the 'total' parameter")
+		}
+		if err := idx.checkRename(ref, "amount"); err != nil {
+			t.Fatalf("rename rejected: %s", err)
+		}
+
+		var edits []protocol.TextEdit
+		for _, r := range idx.referencesTo(ref, true) {
+			edits = append(edits, protocol.TextEdit{Range: newRange(input, r.Pos), NewText: "amount"})
+		}
+
+		expected := `let mut total = 0;
+let add = (x: i64, amount: i64): i64 => {
+	let inner = () => { add(x, amount) };
+	x + amount
+};
+total = add(total, 1);
+puts(total);`
+
+		if got := applyEdits(input, edits); got != expected {
+			t.Errorf("wrong content after the rename.\nwant=%q\ngot=%q", expected, got)
+		}
+	})
+
+	t.Run("should reject renames that change the program", func(t *testing.T) {
+		tests := []struct {
+			position protocol.Position
+			newName  string
+		}{
+			{position: protocol.Position{Line: 3, Character: 1}, newName: "total"},
+			{position: protocol.Position{Line: 3, Character: 1}, newName: "len"},
+			{position: protocol.Position{Line: 3, Character: 1}, newName: "let"},
+			{position: protocol.Position{Line: 3, Character: 1}, newName: "a b"},
+			{position: protocol.Position{Line: 6, Character: 1}, newName: "print"},
+		}
+
+		for _, tt := range tests {
+			idx := newReferenceIndex(input)
+			ref, ok := idx.at(tt.position)
+			if !ok {
+				t.Fatalf("no identifier at %+v", tt.position)
+			}
+			if err := idx.checkRename(ref, tt.newName); err == nil {
+				t.Errorf("rename of %q to %q was not rejected", ref.Symbol.Name, tt.newName)
+			}
+		}
+
+		idx := newReferenceIndex(input + "\nputs(missing);")
+		ref, _ := idx.at(protocol.Position{Line: 0, Character: 9})
+		if err := idx.checkRename(ref, "sum"); err == nil {
+			t.Errorf("rename was not rejected in a document that does not compile")
+		}
+	})
+}
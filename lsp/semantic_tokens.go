@@ -0,0 +1,256 @@
+package lsp
+
+import (
+	"shark/ast"
+	"shark/compiler"
+	"shark/lexer"
+	"shark/parser"
+	"shark/token"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Types of the semantic tokens, in the order of the legend.
+const (
+	semanticKeyword protocol.UInteger = iota
+	semanticType
+	semanticFunction
+	semanticParameter
+	semanticVariable
+	semanticNumber
+	semanticString
+	semanticOperator
+)
+
+// Modifiers of the semantic tokens, bits in the order of the legend.
+const (
+	modifierDeclaration protocol.UInteger = 1 << iota
+	modifierReadonly
+	modifierMutable
+	modifierDefaultLibrary
+)
+
+var semanticTokensLegend = protocol.SemanticTokensLegend{
+	TokenTypes: []string{
+		string(protocol.SemanticTokenTypeKeyword),
+		string(protocol.SemanticTokenTypeType),
+		string(protocol.SemanticTokenTypeFunction),
+		string(protocol.SemanticTokenTypeParameter),
+		string(protocol.SemanticTokenTypeVariable),
+		string(protocol.SemanticTokenTypeNumber),
+		string(protocol.SemanticTokenTypeString),
+		string(protocol.SemanticTokenTypeOperator),
+	},
+	TokenModifiers: []string{
+		string(protocol.SemanticTokenModifierDeclaration),
+		string(protocol.SemanticTokenModifierReadonly),
+		// Not a standard modifier, for the bindings declared with 'mut' or 'var'
+		"mutable",
+		string(protocol.SemanticTokenModifierDefaultLibrary),
+	},
+}
+
+// Classifies the tokens that are not identifiers.
+var semanticTokenTypes = map[token.Type]protocol.UInteger{
+	token.LET:         semanticKeyword,
+	token.VAR:         semanticKeyword,
+	token.MUTABLE:     semanticKeyword,
+	token.IF:          semanticKeyword,
+	token.ELSE:        semanticKeyword,
+	token.RETURN:      semanticKeyword,
+	token.WHILE:       semanticKeyword,
+	token.TRUE:        semanticKeyword,
+	token.AT:          semanticKeyword,
+	token.FALSE:       semanticKeyword,
+	token.T_I64:       semanticType,
+	token.T_BOOL:      semanticType,
+	token.T_ANY:       semanticType,
+	token.T_CHAR:      semanticType,
+	token.T_ARRAY:     semanticType,
+	token.T_TUPLE:     semanticType,
+	token.T_HASHMAP:   semanticType,
+	token.T_FUNCTION:  semanticType,
+	token.INT:         semanticNumber,
+	token.STRING:      semanticString,
+	token.CHAR:        semanticString,
+	token.ASSIGN:      semanticOperator,
+	token.PLUS:        semanticOperator,
+	token.MINUS:       semanticOperator,
+	token.BANG:        semanticOperator,
+	token.ASTERISK:    semanticOperator,
+	token.POW:         semanticOperator,
+	token.SLASH:       semanticOperator,
+	token.LT:          semanticOperator,
+	token.LTE:         semanticOperator,
+	token.GT:          semanticOperator,
+	token.GTE:         semanticOperator,
+	token.AND:         semanticOperator,
+	token.OR:          semanticOperator,
+	token.EQ:          semanticOperator,
+	token.NOT_EQ:      semanticOperator,
+	token.MINUS_MINUS: semanticOperator,
+	token.PLUS_PLUS:   semanticOperator,
+	token.MIN_EQ:      semanticOperator,
+	token.PLUS_EQ:     semanticOperator,
+	token.DIV_EQ:      semanticOperator,
+	token.MUL_EQ:      semanticOperator,
+	token.RANGE:       semanticOperator,
+	token.SPREAD:      semanticOperator,
+
+	// The raw strings spanning several lines are left out when the tokens are encoded
+	token.RAW_STRING:    semanticString,
+	token.STRING_HEAD:   semanticString,
+	token.STRING_MIDDLE: semanticString,
+	token.STRING_TAIL:   semanticString,
+}
+
+type semanticToken struct {
+	pos       token.Position
+	tokenType protocol.UInteger
+	modifiers protocol.UInteger
+}
+
+// Classifies the tokens of the content. Identifiers are classified with the symbols the
+// compiler resolved them to, the identifiers after a compile error only by their syntax.
+func semanticTokens(content string) []semanticToken {
+	l := lexer.New(&content)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	references := make(map[[2]int]compiler.Reference)
+	parameters := make(map[*token.Position]bool)
+	aliases := make(map[string]bool)
+	keywords := make(map[[2]int]bool)
+	aliasNames := make(map[[2]int]bool)
+
+	if len(p.Errors()) == 0 {
+		c := compiler.New()
+		c.Compile(program)
+		for _, ref := range c.References() {
+			references[[2]int{ref.Pos.Line, ref.Pos.ColFrom}] = ref
+		}
+	}
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			for _, param := range n.Parameters {
+				parameters[&param.Token.Pos] = true
+			}
+		case *ast.TypeAliasStatement:
+			aliases[n.Name.Value] = true
+			keywords[[2]int{n.Token.Pos.Line, n.Token.Pos.ColFrom}] = true
+			aliasNames[[2]int{n.Name.Token.Pos.Line, n.Name.Token.Pos.ColFrom}] = true
+		case *ast.TestStatement:
+			keywords[[2]int{n.Token.Pos.Line, n.Token.Pos.ColFrom}] = true
+		}
+		return true
+	})
+
+	var result []semanticToken
+	var prev token.Token
+	l = lexer.New(&content)
+	for tok := l.NextToken(); tok.Type != token.EOF; prev, tok = tok, l.NextToken() {
+		// The 'string' keyword has the type of string literals, the literals are quoted
+		if tok.Type == token.T_STRING && tok.Literal == "string" && tok.Pos.ColTo-tok.Pos.ColFrom == len(tok.Literal) {
+			result = append(result, semanticToken{pos: tok.Pos, tokenType: semanticType})
+			continue
+		}
+		if tok.Type != token.IDENT {
+			if tokenType, ok := semanticTokenTypes[tok.Type]; ok {
+				result = append(result, semanticToken{pos: tok.Pos, tokenType: tokenType})
+			}
+			continue
+		}
+
+		key := [2]int{tok.Pos.Line, tok.Pos.ColFrom}
+		// The names of annotations, 'type' in type aliases and 'test' are keywords
+		if keywords[key] || prev.Type == token.AT {
+			result = append(result, semanticToken{pos: tok.Pos, tokenType: semanticKeyword})
+			continue
+		}
+		if aliasNames[key] {
+			result = append(result, semanticToken{pos: tok.Pos, tokenType: semanticType, modifiers: modifierDeclaration})
+			continue
+		}
+
+		ref, ok := references[key]
+		if !ok {
+			tokenType := semanticVariable
+			if aliases[tok.Literal] {
+				tokenType = semanticType
+			}
+			result = append(result, semanticToken{pos: tok.Pos, tokenType: tokenType})
+			continue
+		}
+
+		result = append(result, referenceToken(ref, parameters))
+	}
+
+	return result
+}
+
+func referenceToken(ref compiler.Reference, parameters map[*token.Position]bool) semanticToken {
+	if ref.Binding == nil {
+		return semanticToken{pos: ref.Pos, tokenType: semanticFunction, modifiers: modifierDefaultLibrary}
+	}
+
+	st := semanticToken{pos: ref.Pos, tokenType: semanticVariable}
+	if parameters[ref.Binding] {
+		st.tokenType = semanticParameter
+	} else if _, ok := funcType(ref.Symbol.ObjType); ok {
+		st.tokenType = semanticFunction
+	}
+
+	if ref.Definition {
+		st.modifiers |= modifierDeclaration
+	}
+	if ref.Symbol.Mutable || ref.Symbol.VariadicType {
+		st.modifiers |= modifierMutable
+	} else {
+		st.modifiers |= modifierReadonly
+	}
+
+	return st
+}
+
+// Encodes the tokens as the protocol expects them: five integers per token, the line and the
+// start relative to the previous token, the length, the type and the modifiers. Tokens spanning
+// several lines are left out, not every client supports them.
+func encodeSemanticTokens(content string, tokens []semanticToken) []protocol.UInteger {
+	lines := strings.Split(content, "\n")
+
+	data := []protocol.UInteger{}
+	var prevLine, prevStart protocol.UInteger
+	for _, st := range tokens {
+		if st.pos.LineTo > st.pos.Line {
+			continue
+		}
+
+		start := newPosition(lines, st.pos.Line, st.pos.ColFrom)
+		end := newPosition(lines, st.pos.Line, st.pos.ColTo)
+		if end.Character <= start.Character {
+			continue
+		}
+
+		deltaStart := start.Character
+		if start.Line == prevLine {
+			deltaStart -= prevStart
+		}
+		data = append(data, start.Line-prevLine, deltaStart, end.Character-start.Character, st.tokenType, st.modifiers)
+		prevLine, prevStart = start.Line, start.Character
+	}
+
+	return data
+}
+
+func semanticTokensFull(context *glsp.Context, params *protocol.SemanticTokensParams) (*protocol.SemanticTokens, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.SemanticTokens{Data: encodeSemanticTokens(content, semanticTokens(content))}, nil
+}
@@ -0,0 +1,101 @@
+package lsp
+
+import (
+	"fmt"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestSemanticTokens(t *testing.T) {
+	t.Run("should classify identifiers with the symbols they resolve to", func(t *testing.T) {
+		input := `type Id = i64;
+let mut n: Id = 1;
+let f = (x: i64) => { x + n };
+puts(f("é" == "string"));`
+
+		tests := []struct {
+			literal   string
+			line      int
+			col       int
+			tokenType protocol.UInteger
+			modifiers protocol.UInteger
+		}{
+			{literal: "type", line: 1, col: 1, tokenType: semanticKeyword},
+			{literal: "Id", line: 1, col: 6, tokenType: semanticType, modifiers: modifierDeclaration},
+			{literal: "i64", line: 1, col: 11, tokenType: semanticType},
+			{literal: "n", line: 2, col: 9, tokenType: semanticVariable, modifiers: modifierDeclaration | modifierMutable},
+			{literal: "Id", line: 2, col: 12, tokenType: semanticType},
+			{literal: "f", line: 3, col: 5, tokenType: semanticFunction, modifiers: modifierDeclaration | modifierReadonly},
+			{literal: "x", line: 3, col: 10, tokenType: semanticParameter, modifiers: modifierDeclaration | modifierReadonly},
+			{literal: "x", line: 3, col: 23, tokenType: semanticParameter, modifiers: modifierReadonly},
+			{literal: "n", line: 3, col: 27, tokenType: semanticVariable, modifiers: modifierMutable},
+			{literal: "puts", line: 4, col: 1, tokenType: semanticFunction, modifiers: modifierDefaultLibrary},
+			{literal: "f", line: 4, col: 6, tokenType: semanticFunction, modifiers: modifierReadonly},
+			{literal: `"string"`, line: 4, col: 15, tokenType: semanticString},
+		}
+
+		tokens := semanticTokens(input)
+
+		for _, tt := range tests {
+			found := false
+			for _, st := range tokens {
+				if st.pos.Line != tt.line || st.pos.ColFrom != tt.col {
+					continue
+				}
+				found = true
+				if st.tokenType != tt.tokenType || st.modifiers != tt.modifiers {
+					t.Errorf("wrong classification of %s at %d:%d. want=%d/%b, got=%d/%b",
+						tt.literal, tt.line, tt.col, tt.tokenType, tt.modifiers, st.tokenType, st.modifiers)
+				}
+			}
+			if !found {
+				t.Errorf("no token for %s at %d:%d", tt.literal, tt.line, tt.col)
+			}
+		}
+	})
+
+	t.Run("should classify the identifiers interpolated in strings", func(t *testing.T) {
+		input := `let mut n = 1;
+puts("n is ${n}");`
+
+		var types []protocol.UInteger
+		for _, st := range semanticTokens(input) {
+			if st.pos.Line == 2 {
+				types = append(types, st.tokenType)
+			}
+		}
+
+		expected := []protocol.UInteger{semanticFunction, semanticString, semanticVariable, semanticString}
+		if fmt.Sprint(types) != fmt.Sprint(expected) {
+			t.Errorf("wrong classification of the second line. want=%v, got=%v", expected, types)
+		}
+	})
+
+	t.Run("should encode the tokens relative to each other in UTF-16", func(t *testing.T) {
+		input := "let s = \"😀\"; s;\nlet\nt = 1;"
+
+		expected := []protocol.UInteger{
+			0, 0, 3, semanticKeyword, 0,
+			0, 4, 1, semanticVariable, modifierDeclaration | modifierReadonly,
+			0, 2, 1, semanticOperator, 0,
+			0, 2, 4, semanticString, 0,
+			0, 6, 1, semanticVariable, modifierReadonly,
+			1, 0, 3, semanticKeyword, 0,
+			1, 0, 1, semanticVariable, modifierDeclaration | modifierReadonly,
+			0, 2, 1, semanticOperator, 0,
+			0, 2, 1, semanticNumber, 0,
+		}
+
+		data := encodeSemanticTokens(input, semanticTokens(input))
+
+		if len(data) != len(expected) {
+			t.Fatalf("wrong number of integers. want=%d, got=%d (%v)", len(expected), len(data), data)
+		}
+		for i := range expected {
+			if data[i] != expected[i] {
+				t.Errorf("wrong integer %d of token %d. want=%d, got=%d", i%5, i/5, expected[i], data[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package lsp
+
+import (
+	"shark/lexer"
+	"shark/token"
+	"shark/types"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// An open call before the cursor: the name of the function called and the argument the cursor
+// is in.
+type callSite struct {
+	name     string
+	pos      token.Position
+	argument int
+}
+
+// Finds the innermost call whose argument list is not closed before the cursor. Only calls of
+// a name are found, like 'add(1, '.
+func callAt(before string) (callSite, bool) {
+	var tokens []token.Token
+	l := lexer.New(&before)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+	}
+
+	depth, argument := 0, 0
+	for i := len(tokens) - 1; i >= 0; i-- {
+		switch tokens[i].Type {
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth++
+		case token.LBRACE:
+			// The cursor is in a block, calls around it are not continued in it
+			if depth == 0 {
+				return callSite{}, false
+			}
+			depth--
+		case token.LBRACKET:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			// The commas so far are the ones of an array literal
+			argument = 0
+		case token.COMMA:
+			if depth == 0 {
+				argument++
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				return callSite{}, false
+			}
+		case token.LPAREN:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if i == 0 || tokens[i-1].Type != token.IDENT {
+				// The commas so far are the ones of a tuple or the parameters of a function literal
+				argument = 0
+				continue
+			}
+			return callSite{name: tokens[i-1].Literal, pos: tokens[i-1].Pos, argument: argument}, true
+		}
+	}
+
+	return callSite{}, false
+}
+
+// Returns the signature of the function called around the cursor, with the argument the cursor
+// is in as the active parameter.
+func signatureAt(content string, position protocol.Position) *protocol.SignatureHelp {
+	cursor := position.IndexIn(content)
+	call, ok := callAt(content[:cursor])
+	if !ok {
+		return nil
+	}
+
+	// The rest of the content is cut, it is usually more unfinished calls and blocks
+	lines := strings.Split(content, "\n")
+	start := newPosition(lines, call.pos.Line, call.pos.ColFrom).IndexIn(content)
+	prefix := content[:start] + "\n" + closeBlocks(content[:start])
+	scopes, _, params := symbolsAt(prefix, start, start, call.pos.Line)
+
+	for _, scope := range scopes {
+		for _, symbol := range scope {
+			if symbol.Name != call.name {
+				continue
+			}
+			fn, ok := funcType(symbol.ObjType)
+			if !ok {
+				return nil
+			}
+
+			signature := newSignature(call.name, fn, params[call.name])
+
+			active := call.argument
+			// Every argument after a spread is part of it
+			if n := len(fn.ArgsList); n > 0 && active >= n && isSpread(fn.ArgsList[n-1]) {
+				active = n - 1
+			}
+			activeParameter := protocol.UInteger(active)
+			signature.ActiveParameter = &activeParameter
+
+			var activeSignature protocol.UInteger
+			return &protocol.SignatureHelp{
+				Signatures:      []protocol.SignatureInformation{signature},
+				ActiveSignature: &activeSignature,
+				ActiveParameter: &activeParameter,
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the braces closing the blocks left open in the content.
+func closeBlocks(content string) string {
+	depth := 0
+	l := lexer.New(&content)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth = max(depth-1, 0)
+		}
+	}
+	return strings.Repeat("}", depth)
+}
+
+// Returns the signature of a function, like 'add(a: i64, b: i64?): i64'. Parameters are
+// labelled with their offsets in the signature, the types of builtins are not unique. Builtins
+// have no parameter names, only their types are shown.
+func newSignature(name string, fn types.TSharkFuncType, names []string) protocol.SignatureInformation {
+	var label strings.Builder
+	label.WriteString(name + "(")
+
+	parameters := make([]protocol.ParameterInformation, 0, len(fn.ArgsList))
+	for i, arg := range fn.ArgsList {
+		if i > 0 {
+			label.WriteString(", ")
+		}
+		from := utf16Len(label.String())
+		if i < len(names) {
+			label.WriteString(names[i] + ": ")
+		}
+		label.WriteString(arg.SharkTypeString())
+		parameters = append(parameters, protocol.ParameterInformation{
+			Label: []protocol.UInteger{protocol.UInteger(from), protocol.UInteger(utf16Len(label.String()))},
+		})
+	}
+
+	label.WriteString(")")
+	if fn.ReturnT != nil {
+		label.WriteString(": " + fn.ReturnT.SharkTypeString())
+	}
+
+	return protocol.SignatureInformation{Label: label.String(), Parameters: parameters}
+}
+
+func isSpread(t types.ISharkType) bool {
+	_, ok := t.(types.TSharkSpread)
+	return ok
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func signatureHelp(context *glsp.Context, params *protocol.SignatureHelpParams) (*protocol.SignatureHelp, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return signatureAt(content, params.Position), nil
+}
@@ -0,0 +1,56 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestSignatureHelp(t *testing.T) {
+	definition := "let add = (a: i64, b = 2): i64 => { a + b };\n"
+
+	tests := []struct {
+		input           string
+		label           string
+		parameter       string
+		activeParameter protocol.UInteger
+	}{
+		{input: "add(", label: "add(a: i64, b: i64?): i64", activeParameter: 0, parameter: "a: i64"},
+		{input: "add(1, (2 + 3), ", label: "add(a: i64, b: i64?): i64", activeParameter: 2},
+		{input: "add(1, (2 ", label: "add(a: i64, b: i64?): i64", activeParameter: 1, parameter: "b: i64?"},
+		{input: "puts(\"a\", \"b\", ", label: "puts(...any): null", activeParameter: 0, parameter: "...any"},
+		{input: "add(len([1, 2]), ", label: "add(a: i64, b: i64?): i64", activeParameter: 1, parameter: "b: i64?"},
+		{input: "add(len([1, ", label: "len(collection<...any>): i64", activeParameter: 0, parameter: "collection<...any>"},
+		{input: "let f = () => {\n\tlet g = (n: i64) => { n };\n\tg(", label: "g(n: i64): any", activeParameter: 0, parameter: "n: i64"},
+	}
+
+	for _, tt := range tests {
+		input := definition + tt.input
+		lines := strings.Split(input, "\n")
+		end := protocol.Position{Line: uint32(len(lines) - 1), Character: uint32(len(lines[len(lines)-1]))}
+		help := signatureAt(input, end)
+		if help == nil {
+			t.Fatalf("no signature for %q", tt.input)
+		}
+
+		signature := help.Signatures[0]
+		if signature.Label != tt.label {
+			t.Errorf("wrong signature for %q. want=%q, got=%q", tt.input, tt.label, signature.Label)
+		}
+		if *help.ActiveParameter != tt.activeParameter {
+			t.Errorf("wrong active parameter for %q. want=%d, got=%d", tt.input, tt.activeParameter, *help.ActiveParameter)
+		}
+		if tt.parameter == "" {
+			continue
+		}
+		offsets := signature.Parameters[tt.activeParameter].Label.([]protocol.UInteger)
+		if got := signature.Label[offsets[0]:offsets[1]]; got != tt.parameter {
+			t.Errorf("wrong parameter label for %q. want=%q, got=%q", tt.input, tt.parameter, got)
+		}
+	}
+
+	if help := signatureAt(definition, protocol.Position{Line: 0, Character: 20}); help != nil {
+		t.Errorf("signature outside of a call. got=%+v", help.Signatures)
+	}
+}
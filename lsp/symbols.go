@@ -0,0 +1,235 @@
+package lsp
+
+import (
+	"fmt"
+	"shark/ast"
+	"shark/lexer"
+	"shark/parser"
+	"shark/token"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// The tokens of a document, to find where the nodes of the tree end. Nodes only know the
+// position of their first token.
+type tokenIndex struct {
+	*token.Index
+}
+
+func newTokenIndex(content string) *tokenIndex {
+	return &tokenIndex{lexer.Index(content)}
+}
+
+// Returns the position of the last token of the statement starting at pos: the semicolon ending
+// it, or the token before the next statement or the end of the enclosing block.
+func (idx *tokenIndex) statementEnd(pos token.Position) token.Position {
+	start, ok := idx.IndexOf(pos)
+	if !ok {
+		return pos
+	}
+
+	depth := 0
+	for i := start; i < len(idx.Tokens); i++ {
+		tok := idx.Tokens[i]
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+			if depth < 0 {
+				return idx.Tokens[i-1].Pos
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				return tok.Pos
+			}
+		case token.LET, token.VAR:
+			if depth == 0 && i != start {
+				return idx.Tokens[i-1].Pos
+			}
+		case token.EOF:
+			return idx.Tokens[max(i-1, start)].Pos
+		}
+	}
+	return pos
+}
+
+// Returns the position of the brace closing the block starting at pos.
+func (idx *tokenIndex) blockEnd(pos token.Position) token.Position {
+	start, ok := idx.IndexOf(pos)
+	if !ok {
+		return pos
+	}
+
+	depth := 0
+	for i := start; i < len(idx.Tokens); i++ {
+		switch idx.Tokens[i].Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return idx.Tokens[i].Pos
+			}
+		case token.EOF:
+			return idx.Tokens[max(i-1, start)].Pos
+		}
+	}
+	return pos
+}
+
+// Returns the position of the parenthesis opening the parameters of a function literal, the
+// literal starts at its first parameter.
+func (idx *tokenIndex) functionStart(fn *ast.FunctionLiteral) token.Position {
+	i, ok := idx.IndexOf(fn.Token.Pos)
+	if !ok || fn.Token.Type == token.LPAREN || i == 0 || idx.Tokens[i-1].Type != token.LPAREN {
+		return fn.Token.Pos
+	}
+	return idx.Tokens[i-1].Pos
+}
+
+// Returns the position spanning from the start of from to the end of to.
+func span(from, to token.Position) token.Position {
+	lineTo := to.LineTo
+	if lineTo < to.Line {
+		lineTo = to.Line
+	}
+	return token.Position{Line: from.Line, LineTo: lineTo, ColFrom: from.ColFrom, ColTo: to.ColTo}
+}
+
+// Returns the outline of the content: its let and var bindings and the function literals they
+// are defined with, nested as they are in the source. The content is outlined up to the first
+// parse error.
+func outline(content string) []protocol.DocumentSymbol {
+	l := lexer.New(&content)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	o := &outliner{lines: strings.Split(content, "\n"), tokens: newTokenIndex(content)}
+	return o.symbolsIn(program)
+}
+
+type outliner struct {
+	tokens *tokenIndex
+	// The lines of the content, to convert the positions of the symbols.
+	lines []string
+}
+
+// Returns the symbols defined in node, without descending into the symbols it finds.
+func (o *outliner) symbolsIn(node ast.Node) []protocol.DocumentSymbol {
+	symbols := []protocol.DocumentSymbol{}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			symbols = append(symbols, o.letSymbol(n))
+			return false
+		case *ast.TupleDeconstruction:
+			r := rangeIn(o.lines, span(n.Token.Pos, o.tokens.statementEnd(n.Token.Pos)))
+			for _, name := range n.Names {
+				symbols = append(symbols, protocol.DocumentSymbol{
+					Name:           name.Value,
+					Kind:           bindingKind(name, n.Value),
+					Range:          r,
+					SelectionRange: rangeIn(o.lines, name.Token.Pos),
+				})
+			}
+			symbols = append(symbols, o.symbolsIn(n.Value)...)
+			return false
+		case *ast.FunctionLiteral:
+			symbols = append(symbols, o.functionSymbol(n))
+			return false
+		case *ast.TestStatement:
+			detail := "test"
+			symbols = append(symbols, protocol.DocumentSymbol{
+				Name:           n.Name.Value,
+				Detail:         &detail,
+				Kind:           protocol.SymbolKindFunction,
+				Range:          rangeIn(o.lines, span(n.Token.Pos, o.tokens.blockEnd(n.Body.Token.Pos))),
+				SelectionRange: rangeIn(o.lines, n.Name.Token.Pos),
+				Children:       o.symbolsIn(n.Body),
+			})
+			return false
+		}
+		return true
+	})
+
+	return symbols
+}
+
+func (o *outliner) letSymbol(node *ast.LetStatement) protocol.DocumentSymbol {
+	symbol := protocol.DocumentSymbol{
+		Name:           node.Name.Value,
+		Kind:           bindingKind(node.Name, node.Value),
+		Range:          rangeIn(o.lines, span(node.Token.Pos, o.tokens.statementEnd(node.Token.Pos))),
+		SelectionRange: rangeIn(o.lines, node.Name.Token.Pos),
+	}
+
+	if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+		detail := functionDetail(fn)
+		symbol.Detail = &detail
+		symbol.Children = o.symbolsIn(fn.Body)
+	} else {
+		if node.Name.DefinedType != nil {
+			detail := node.Name.DefinedType.SharkTypeString()
+			symbol.Detail = &detail
+		}
+		symbol.Children = o.symbolsIn(node.Value)
+	}
+
+	return symbol
+}
+
+func (o *outliner) functionSymbol(fn *ast.FunctionLiteral) protocol.DocumentSymbol {
+	detail := functionDetail(fn)
+	start := o.tokens.functionStart(fn)
+	pos := start
+	if fn.Body != nil {
+		pos = span(pos, o.tokens.blockEnd(fn.Body.Token.Pos))
+	}
+
+	return protocol.DocumentSymbol{
+		Name:           "<function>",
+		Detail:         &detail,
+		Kind:           protocol.SymbolKindFunction,
+		Range:          rangeIn(o.lines, pos),
+		SelectionRange: rangeIn(o.lines, start),
+		Children:       o.symbolsIn(fn.Body),
+	}
+}
+
+// Returns the kind of a binding: functions, variables when it can be reassigned, constants
+// otherwise.
+func bindingKind(name *ast.Identifier, value ast.Expression) protocol.SymbolKind {
+	if _, ok := value.(*ast.FunctionLiteral); ok && !name.Mutable && !name.IsVariadic {
+		return protocol.SymbolKindFunction
+	}
+	if name.Mutable || name.IsVariadic {
+		return protocol.SymbolKindVariable
+	}
+	return protocol.SymbolKindConstant
+}
+
+// Returns the parameter list of a function, like "(a: i64, b)".
+func functionDetail(fn *ast.FunctionLiteral) string {
+	params := make([]string, 0, len(fn.Parameters))
+	for _, param := range fn.Parameters {
+		if param.DefinedType != nil {
+			params = append(params, fmt.Sprintf("%s: %s", param.Value, param.DefinedType.SharkTypeString()))
+		} else {
+			params = append(params, param.Value)
+		}
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+func documentSymbol(context *glsp.Context, params *protocol.DocumentSymbolParams) (any, error) {
+	_, content, err := documents.read(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return outline(content), nil
+}
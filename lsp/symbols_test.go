@@ -0,0 +1,74 @@
+package lsp
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestOutline(t *testing.T) {
+	input := `let limit = 10;
+let mut count = 0;
+let add = (a: i64, b: i64): i64 => {
+	let sum = a + b;
+	let apply = (f: func<(i64)->i64>) => { f(sum) };
+	apply((x) => { x * 2 })
+};
+var (first, second) = (1, "two");`
+
+	symbols := outline(input)
+
+	type expected struct {
+		name     string
+		kind     protocol.SymbolKind
+		rng      protocol.Range
+		children []string
+	}
+	tests := []expected{
+		{name: "limit", kind: protocol.SymbolKindConstant, rng: protocol.Range{End: protocol.Position{Character: 15}}},
+		{name: "count", kind: protocol.SymbolKindVariable, rng: protocol.Range{Start: protocol.Position{Line: 1}, End: protocol.Position{Line: 1, Character: 18}}},
+		{
+			name:     "add",
+			kind:     protocol.SymbolKindFunction,
+			rng:      protocol.Range{Start: protocol.Position{Line: 2}, End: protocol.Position{Line: 6, Character: 2}},
+			children: []string{"sum", "apply", "<function>"},
+		},
+		{name: "first", kind: protocol.SymbolKindVariable, rng: protocol.Range{Start: protocol.Position{Line: 7}, End: protocol.Position{Line: 7, Character: 33}}},
+		{name: "second", kind: protocol.SymbolKindVariable, rng: protocol.Range{Start: protocol.Position{Line: 7}, End: protocol.Position{Line: 7, Character: 33}}},
+	}
+
+	if len(symbols) != len(tests) {
+		t.Fatalf("wrong number of symbols. want=%d, got=%d (%+v)", len(tests), len(symbols), symbols)
+	}
+	for i, tt := range tests {
+		s := symbols[i]
+		if s.Name != tt.name || s.Kind != tt.kind {
+			t.Errorf("wrong symbol %d. want=%s (%d), got=%s (%d)", i, tt.name, tt.kind, s.Name, s.Kind)
+		}
+		if s.Range != tt.rng {
+			t.Errorf("wrong range for %q. want=%+v, got=%+v", tt.name, tt.rng, s.Range)
+		}
+		if len(s.Children) != len(tt.children) {
+			t.Fatalf("wrong number of children for %q. want=%d, got=%d", tt.name, len(tt.children), len(s.Children))
+		}
+		for j, child := range s.Children {
+			if child.Name != tt.children[j] {
+				t.Errorf("wrong child %d of %q. want=%s, got=%s", j, tt.name, tt.children[j], child.Name)
+			}
+		}
+	}
+
+	add := symbols[2]
+	if *add.Detail != "(a: i64, b: i64)" {
+		t.Errorf("wrong detail for 'add'. got=%q", *add.Detail)
+	}
+	if add.SelectionRange != (protocol.Range{Start: protocol.Position{Line: 2, Character: 4}, End: protocol.Position{Line: 2, Character: 7}}) {
+		t.Errorf("wrong selection range for 'add'. got=%+v", add.SelectionRange)
+	}
+	if apply := add.Children[1]; apply.Range.End != (protocol.Position{Line: 4, Character: 49}) || apply.Kind != protocol.SymbolKindFunction {
+		t.Errorf("wrong symbol for 'apply'. got=%+v", apply)
+	}
+	if anonymous := add.Children[2]; anonymous.Range != (protocol.Range{Start: protocol.Position{Line: 5, Character: 7}, End: protocol.Position{Line: 5, Character: 23}}) {
+		t.Errorf("wrong range for the anonymous function. got=%+v", anonymous.Range)
+	}
+}
@@ -0,0 +1,131 @@
+package object
+
+import (
+	"fmt"
+	"shark/types"
+	"strconv"
+)
+
+// AssertionError is returned by the assertion builtins when an assertion does not hold. Unlike
+// an Error, which is a value the program can use, it stops the program.
+type AssertionError struct {
+	Message string
+	// The values compared by 'assert_eq', empty for the other assertions.
+	Expected string
+	Actual   string
+}
+
+func (ae *AssertionError) Inspect() string { return "ASSERTION FAILED: " + ae.Message }
+
+func (ae *AssertionError) Type() types.ISharkType { return types.TSharkError{} }
+
+func Assert(args ...Object) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	condition, ok := args[0].(*Boolean)
+	if !ok {
+		return newError("argument to `assert` must be bool, got %s", args[0].Type().SharkTypeString())
+	}
+	if condition.Value {
+		return nil
+	}
+
+	message := "condition is false"
+	if len(args) == 2 {
+		if s, ok := args[1].(*String); ok {
+			message = s.Value
+		}
+	}
+	return &AssertionError{Message: message}
+}
+
+func AssertEq(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	actual, expected := args[0], args[1]
+	if Equal(actual, expected) {
+		return nil
+	}
+
+	actualType, expectedType := actual.Type().SharkTypeString(), expected.Type().SharkTypeString()
+	if actualType != expectedType {
+		return &AssertionError{
+			Message:  fmt.Sprintf("values have different types '%s' and '%s'", actualType, expectedType),
+			Expected: display(expected) + ": " + expectedType,
+			Actual:   display(actual) + ": " + actualType,
+		}
+	}
+	return &AssertionError{Message: "values are not equal", Expected: display(expected), Actual: display(actual)}
+}
+
+// AssertThrows calls a function, which builtins cannot do. The VM runs 'assert_throws' itself
+// and this is never called by a program.
+func AssertThrows(args ...Object) Object {
+	return newError("`assert_throws` can only be called by the VM")
+}
+
+// Equal reports whether two values are the same. Collections are equal when their elements
+// are, functions only when they are the same function.
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Int64:
+		b, ok := b.(*Int64)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Error:
+		b, ok := b.(*Error)
+		return ok && a.Message == b.Message
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && equalElements(a.Elements, b.Elements)
+	case *Tuple:
+		b, ok := b.(*Tuple)
+		return ok && equalElements(a.Elements, b.Elements)
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !Equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func equalElements(a, b []Object) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns how a value is shown in an assertion, strings are quoted to tell them from numbers.
+func display(o Object) string {
+	if s, ok := o.(*String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return o.Inspect()
+}
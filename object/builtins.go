@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"shark/types"
+	"unicode/utf8"
 )
 
 type Builtin struct {
+	// Whether the builtin is pure, its results are memoized and calling it keeps a function pure.
 	CanCache bool
 	Fn       BuiltinFunction
 	FuncType types.ISharkType
@@ -25,7 +27,7 @@ var Builtins = []struct {
 	{"exit",
 		&Builtin{
 			Fn:       Exit,
-			CanCache: true,
+			CanCache: false,
 			FuncType: types.TSharkFuncType{ArgsList: []types.ISharkType{types.TSharkI64{}}, ReturnT: types.TSharkNull{}},
 		},
 	},
@@ -78,6 +80,51 @@ var Builtins = []struct {
 			FuncType: types.TSharkFuncType{ArgsList: []types.ISharkType{types.TSharkAny{}}, ReturnT: types.TSharkString{}},
 		},
 	},
+	{"assert",
+		&Builtin{
+			Fn:       Assert,
+			CanCache: false,
+			FuncType: types.TSharkFuncType{ArgsList: []types.ISharkType{types.TSharkBool{}, types.TSharkOptional{Type: types.TSharkString{}}}, ReturnT: types.TSharkNull{}},
+		},
+	},
+	{"assert_eq",
+		&Builtin{
+			Fn:       AssertEq,
+			CanCache: false,
+			FuncType: types.TSharkFuncType{ArgsList: []types.ISharkType{types.TSharkAny{}, types.TSharkAny{}}, ReturnT: types.TSharkNull{}},
+		},
+	},
+	{"assert_throws",
+		&Builtin{
+			Fn:       AssertThrows,
+			CanCache: false,
+			FuncType: types.TSharkFuncType{ArgsList: []types.ISharkType{types.TSharkFuncType{ArgsList: []types.ISharkType{}, ReturnT: types.TSharkAny{}}}, ReturnT: types.TSharkNull{}},
+		},
+	},
+	{"bytes",
+		&Builtin{
+			Fn:       Bytes,
+			CanCache: true,
+			FuncType: types.TSharkFuncType{ArgsList: []types.ISharkType{types.TSharkString{}}, ReturnT: types.TSharkArray{Collection: types.TSharkI64{}}},
+		},
+	},
+	{"byte_len",
+		&Builtin{
+			Fn:       ByteLen,
+			CanCache: true,
+			FuncType: types.TSharkFuncType{ArgsList: []types.ISharkType{types.TSharkString{}}, ReturnT: types.TSharkI64{}},
+		},
+	},
+}
+
+// GetBuiltinByName returns the builtin function with the given name, or nil if there is none.
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
 }
 
 func ObjType(args ...Object) Object {
@@ -96,14 +143,14 @@ func Len(args ...Object) Object {
 
 	switch arg := args[0].(type) {
 	case *String:
-		return &Int64{Value: int64(len(arg.Value))}
+		return NewInt64(int64(arg.Length()))
 	case *Array:
-		return &Int64{Value: int64(len(arg.Elements))}
+		return NewInt64(int64(len(arg.Elements)))
 	// FIXME: Make new type collection to support hash maps for length
 	// case *Hash:
 	// 	return &Int64{Value: int64(len(arg.Pairs))}
 	case *Tuple:
-		return &Int64{Value: int64(len(arg.Elements))}
+		return NewInt64(int64(len(arg.Elements)))
 	default:
 		return newError("argument to `len` not supported, got %s", args[0].Type().SharkTypeString())
 	}
@@ -116,8 +163,8 @@ func First(args ...Object) Object {
 
 	switch arg := args[0].(type) {
 	case *String:
-		if len(arg.Value) > 0 {
-			return &String{Value: string(arg.Value[0])}
+		if char, ok := arg.CharAt(0); ok {
+			return char
 		}
 		return nil
 	case *Array:
@@ -152,9 +199,9 @@ func Last(args ...Object) Object {
 
 	switch arg := args[0].(type) {
 	case *String:
-		length := len(arg.Value)
-		if length > 0 {
-			return &String{Value: string(arg.Value[length-1])}
+		if len(arg.Value) > 0 {
+			r, _ := utf8.DecodeLastRuneInString(arg.Value)
+			return NewChar(r)
 		}
 		return nil
 	case *Array:
@@ -205,6 +252,38 @@ func Push(args ...Object) Object {
 	return &Array{Elements: newElements}
 }
 
+// Bytes returns the UTF-8 bytes of a string, len and indexing count chars instead.
+func Bytes(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `bytes` must be string, got %s", args[0].Type().SharkTypeString())
+	}
+
+	elements := make([]Object, len(str.Value))
+	for i := 0; i < len(str.Value); i++ {
+		elements[i] = NewInt64(int64(str.Value[i]))
+	}
+	return &Array{Elements: elements}
+}
+
+// ByteLen returns the number of bytes of a string in UTF-8.
+func ByteLen(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `byte_len` must be string, got %s", args[0].Type().SharkTypeString())
+	}
+
+	return NewInt64(int64(len(str.Value)))
+}
+
 func Exit(args ...Object) Object {
 	if len(args) != 1 {
 		os.Exit(0)
@@ -0,0 +1,54 @@
+package object
+
+import (
+	"bytes"
+	"encoding/gob"
+	"shark/types"
+	"unicode/utf8"
+)
+
+// A single Unicode code point.
+type Char struct {
+	Value rune
+}
+
+// The ASCII chars are allocated once and shared, like the small integers.
+var asciiChars = func() []Char {
+	chars := make([]Char, utf8.RuneSelf)
+	for i := range chars {
+		chars[i].Value = rune(i)
+	}
+	return chars
+}()
+
+// NewChar returns a char with the value, ASCII ones come from a cache instead of being allocated.
+func NewChar(value rune) *Char {
+	if value >= 0 && value < utf8.RuneSelf {
+		return &asciiChars[value]
+	}
+	return &Char{Value: value}
+}
+
+func (c *Char) Inspect() string { return string(c.Value) }
+
+func (c *Char) HashKey() HashKey {
+	return HashKey{Type: c.Type(), Value: uint64(c.Value)}
+}
+
+func (c *Char) Type() types.ISharkType { return types.TSharkChar{} }
+
+func (c *Char) GobEncode() ([]byte, error) {
+	w := new(bytes.Buffer)
+	encoder := gob.NewEncoder(w)
+	err := encoder.Encode(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+func (c *Char) GobDecode(buf []byte) error {
+	r := bytes.NewBuffer(buf)
+	decoder := gob.NewDecoder(r)
+	return decoder.Decode(&c.Value)
+}
@@ -3,20 +3,68 @@ package object
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"shark/code"
 	"shark/types"
 )
 
+// MemoMode is how the calls of a function are memoized, set with the '@memo' and '@nomemo' annotations.
+type MemoMode byte
+
+const (
+	// Calls are memoized if the function is pure.
+	MemoAuto MemoMode = iota
+	// Calls are always memoized, the function is trusted to be pure.
+	MemoAlways
+	// Calls are never memoized.
+	MemoNever
+)
+
 type CompiledFunction struct {
 	ObjType       types.ISharkType
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
 	NumDefaults   int
+
+	// Whether the compiler proved that the function has no side effects and that its result
+	// only depends on its arguments and the values it closes over.
+	Pure bool
+	Memo MemoMode
+
+	// Debug information, empty when it was stripped from the bytecode.
+	Name       string
+	LocalNames []string
+	SourceMap  code.SourceMap
 }
 
 func (cf *CompiledFunction) Inspect() string { return "CompiledFunction" }
 
+// FirstLine returns the first source line the function was compiled from, 0 without a source map.
+func (cf *CompiledFunction) FirstLine() int {
+	first := 0
+	for _, m := range cf.SourceMap {
+		if first == 0 || m.Pos.Line < first {
+			first = m.Pos.Line
+		}
+	}
+	return first
+}
+
+// DisplayName returns the name of the function, anonymous functions are named after their
+// first line.
+func (cf *CompiledFunction) DisplayName() string {
+	if cf.Name != "" {
+		return cf.Name
+	}
+	return fmt.Sprintf("<function>:%d", cf.FirstLine())
+}
+
+// Memoizable reports whether the VM may cache the results of calls to the function.
+func (cf *CompiledFunction) Memoizable() bool {
+	return cf.Memo == MemoAlways || (cf.Memo == MemoAuto && cf.Pure)
+}
+
 func (cf *CompiledFunction) GobEncode() ([]byte, error) {
 	w := new(bytes.Buffer)
 	encoder := gob.NewEncoder(w)
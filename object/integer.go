@@ -11,6 +11,30 @@ type Int64 struct {
 	Value int64
 }
 
+// The integers in [smallIntMin, smallIntMax] are allocated once and shared, they cover most
+// loop counters, indexes and lengths.
+const (
+	smallIntMin = -128
+	smallIntMax = 1023
+)
+
+var smallInts = func() []Int64 {
+	ints := make([]Int64, smallIntMax-smallIntMin+1)
+	for i := range ints {
+		ints[i].Value = int64(i + smallIntMin)
+	}
+	return ints
+}()
+
+// NewInt64 returns an integer with the value, small ones come from a cache instead of being
+// allocated. Integers are immutable, so a cached one can be shared by any number of values.
+func NewInt64(value int64) *Int64 {
+	if value >= smallIntMin && value <= smallIntMax {
+		return &smallInts[value-smallIntMin]
+	}
+	return &Int64{Value: value}
+}
+
 func (i *Int64) Inspect() string { return fmt.Sprintf("%d", i.Value) }
 
 func (i *Int64) HashKey() HashKey {
@@ -26,6 +26,32 @@ func TestStringHashKey(t *testing.T) {
 	})
 }
 
+func TestNewInt64(t *testing.T) {
+	t.Run("should share the small integers", func(t *testing.T) {
+		for _, value := range []int64{smallIntMin, -1, 0, 1, 42, smallIntMax} {
+			a, b := NewInt64(value), NewInt64(value)
+			if a != b {
+				t.Errorf("integer %d is allocated twice", value)
+			}
+			if a.Value != value {
+				t.Errorf("wrong value. got=%d, want=%d", a.Value, value)
+			}
+		}
+	})
+
+	t.Run("should allocate the integers outside the cache", func(t *testing.T) {
+		for _, value := range []int64{smallIntMin - 1, smallIntMax + 1, 1 << 40} {
+			a, b := NewInt64(value), NewInt64(value)
+			if a == b {
+				t.Errorf("integer %d is shared", value)
+			}
+			if a.Value != value || b.Value != value {
+				t.Errorf("wrong value. got=%d and %d, want=%d", a.Value, b.Value, value)
+			}
+		}
+	})
+}
+
 func TestObjects(t *testing.T) {
 	t.Run("should return the correct array object", func(t *testing.T) {
 		arrayObj := &Array{Elements: []Object{&Int64{Value: 1}, &Int64{Value: 2}, &Int64{Value: 3}}} // [1, 2, 3]
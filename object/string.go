@@ -5,6 +5,7 @@ import (
 	"encoding/gob"
 	"hash/fnv"
 	"shark/types"
+	"unicode/utf8"
 )
 
 type String struct {
@@ -24,6 +25,34 @@ func (s *String) HashKey() HashKey {
 
 func (s *String) Type() types.ISharkType { return types.TSharkString{} }
 
+// Length returns the number of chars of the string, not its number of bytes.
+func (s *String) Length() int { return utf8.RuneCountInString(s.Value) }
+
+// CharAt returns the char at the index, counted in chars. It returns false when the index is
+// out of range.
+func (s *String) CharAt(index int64) (*Char, bool) {
+	if index < 0 || index >= int64(len(s.Value)) {
+		return nil, false
+	}
+	i := int64(0)
+	for _, r := range s.Value {
+		if i == index {
+			return NewChar(r), true
+		}
+		i++
+	}
+	return nil, false
+}
+
+// Chars returns the chars of the string, in order.
+func (s *String) Chars() []Object {
+	chars := make([]Object, 0, len(s.Value))
+	for _, r := range s.Value {
+		chars = append(chars, NewChar(r))
+	}
+	return chars
+}
+
 func (s *String) GobEncode() ([]byte, error) {
 	w := new(bytes.Buffer)
 	encoder := gob.NewEncoder(w)
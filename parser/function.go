@@ -2,6 +2,7 @@ package parser
 
 import (
 	"shark/ast"
+	"shark/exception"
 	"shark/token"
 	"shark/types"
 )
@@ -39,6 +40,37 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+// Parses the annotations before a function literal, like '@memo (n) => { ... }'.
+func (p *Parser) parseAnnotatedFunction() ast.Expression {
+	var annotations []*ast.Annotation
+
+	for p.curTokenIs(token.AT) {
+		tok := p.curToken
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		annotations = append(annotations, &ast.Annotation{Token: tok, Name: p.curToken.Literal})
+		p.nextToken()
+	}
+
+	exp := p.parseExpression(PREFIX)
+	if exp == nil {
+		return nil
+	}
+
+	lit, ok := exp.(*ast.FunctionLiteral)
+	if !ok {
+		p.errors = append(p.errors, newSharkError(exception.SharkErrorInvalidAnnotation, annotations[0].Name,
+			"Annotations can only be written before a function literal",
+			exception.NewSharkErrorCause("not a function literal", exp.TokenPos()),
+		))
+		return nil
+	}
+	lit.Annotations = append(annotations, lit.Annotations...)
+
+	return lit
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	var identifiers []*ast.Identifier
 
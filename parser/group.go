@@ -9,14 +9,14 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	curToken := p.curToken
 	p.nextToken()
 
-	if (p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COMMA)) ||
+	if (p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COMMA) && p.parametersAhead()) ||
 		p.curTokenIs(token.MUTABLE) ||
 		(p.curTokenIs(token.RPAREN) && p.peekTokenIs(token.ARROW)) ||
 		(p.curTokenIs(token.RPAREN) && p.peekTokenIs(token.COLON)) ||
 		(p.curTokenIs(token.IDENT) && p.peekTokenIs(token.ASSIGN)) ||
 		(p.curTokenIs(token.VAR) && p.peekTokenIs(token.IDENT)) ||
 		(p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON)) ||
-		(p.curTokenIs(token.IDENT) && p.peekTokenIs(token.RPAREN)) {
+		(p.curTokenIs(token.IDENT) && p.peekTokenIs(token.RPAREN) && p.parametersAhead()) {
 		return p.parseFunctionLiteral()
 	}
 
@@ -36,3 +36,25 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 	return exp
 }
+
+// Reports whether the parenthesis the current token is in is followed by an arrow or by a return
+// type, so the identifiers in it are the parameters of a function and not a tuple or a grouped
+// expression. The tokens are read from a copy of the lexer.
+func (p *Parser) parametersAhead() bool {
+	l := *p.l
+	depth := 1
+	for tok := p.peekToken; tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN:
+			depth++
+		case token.RPAREN:
+			depth--
+		}
+		if depth == 0 {
+			next := l.NextToken()
+			return next.Type == token.ARROW || next.Type == token.COLON
+		}
+	}
+	// An unclosed parenthesis is reported by the function literal
+	return true
+}
@@ -116,6 +116,9 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.RAW_STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_HEAD, p.parseInterpolatedString)
+	p.registerPrefix(token.CHAR, p.parseCharLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
@@ -124,6 +127,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.PLUS_PLUS, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS_MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.SPREAD, p.parsePrefixExpression)
+	p.registerPrefix(token.AT, p.parseAnnotatedFunction)
 
 	return p
 }
@@ -202,6 +206,8 @@ func (p *Parser) peekError(t token.Type) {
 		suggestionMsg = "Try adding a closing brace."
 	case token.RBRACKET:
 		suggestionMsg = "Try adding a closing bracket."
+	case token.STRING_TAIL:
+		suggestionMsg = "Try closing the interpolation with a brace and the string with a double quote."
 	case token.EOF:
 		suggestionMsg = "Try terminated the statement."
 	}
@@ -229,6 +235,14 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// Precedence returns the precedence of an infix operator, LOWEST for the other tokens.
+func Precedence(tokenType token.Type) int {
+	if p, ok := precedence[tokenType]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 // Checks the precedence of the next token. It returns the precedence of the next token.
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedence[p.peekToken.Type]; ok {
@@ -3,8 +3,10 @@ package parser
 import (
 	"fmt"
 	"shark/ast"
+	"shark/exception"
 	"shark/lexer"
 	"shark/types"
+	"strings"
 	"testing"
 )
 
@@ -836,6 +838,53 @@ func TestFunctionLiteralWithName(t *testing.T) {
 	})
 }
 
+func TestFunctionAnnotations(t *testing.T) {
+	t.Run("should parse annotations before function literals", func(t *testing.T) {
+		input := `let sq = @memo @pure (n: i64) => { n * n };`
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+		}
+		function, ok := stmt.Value.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+		}
+
+		if len(function.Annotations) != 2 {
+			t.Fatalf("function.Annotations has not 2 annotations. got=%d", len(function.Annotations))
+		}
+		if function.Annotations[0].Name != "memo" || function.Annotations[1].Name != "pure" {
+			t.Errorf("annotations wrong. got=%q, %q", function.Annotations[0].Name, function.Annotations[1].Name)
+		}
+		if function.Name != "sq" {
+			t.Errorf("function literal name wrong. want 'sq', got=%q", function.Name)
+		}
+		if !strings.HasPrefix(function.String(), "@memo @pure ") {
+			t.Errorf("function.String() does not start with the annotations. got=%q", function.String())
+		}
+	})
+
+	t.Run("should report annotations that are not before a function literal", func(t *testing.T) {
+		input := `let a = @memo 5;`
+
+		l := lexer.New(&input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0].ErrCode != exception.SharkErrorInvalidAnnotation {
+			t.Fatalf("expected an invalid annotation error, got %+v", errors)
+		}
+	})
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	t.Run("should parse function parameters", func(t *testing.T) {
 		tests := []struct {
@@ -1076,6 +1125,123 @@ func TestTypeParsing(t *testing.T) {
 	})
 }
 
+func TestTypeAliasParsing(t *testing.T) {
+	t.Run("should parse type alias statement", func(t *testing.T) {
+		input := `type Reducer = func<(i64, i64)->i64>;`
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.TypeAliasStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.TypeAliasStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Name.Value != "Reducer" {
+			t.Errorf("stmt.Name.Value is not 'Reducer'. got=%s", stmt.Name.Value)
+		}
+
+		if stmt.Value.SharkTypeString() != "func<(i64,i64)->i64>" {
+			t.Errorf("stmt.Value is not 'func<(i64,i64)->i64>'. got=%s", stmt.Value.SharkTypeString())
+		}
+	})
+
+	t.Run("should parse alias names in type annotations", func(t *testing.T) {
+		input := `let r: array<Reducer> = [];`
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.LetStatement)
+
+		array, ok := stmt.Name.DefinedType.(types.TSharkArray)
+		if !ok {
+			t.Fatalf("stmt.Name.DefinedType is not array. got=%T", stmt.Name.DefinedType)
+		}
+
+		alias, ok := array.Collection.(types.TSharkAlias)
+		if !ok {
+			t.Fatalf("array.Collection is not an alias. got=%T", array.Collection)
+		}
+
+		if alias.Name != "Reducer" || alias.Type != nil {
+			t.Errorf("expected unresolved alias 'Reducer', got=%+v", alias)
+		}
+	})
+
+	t.Run("should still parse type as builtin call", func(t *testing.T) {
+		input := `type(5);`
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		if _, ok := stmt.Expression.(*ast.CallExpression); !ok {
+			t.Fatalf("stmt.Expression is not *ast.CallExpression. got=%T", stmt.Expression)
+		}
+	})
+}
+
+func TestTestStatementParsing(t *testing.T) {
+	t.Run("should parse test statement", func(t *testing.T) {
+		input := `test "adds numbers" { assert_eq(1 + 2, 3); }`
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.TestStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.TestStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Name.Value != "adds numbers" {
+			t.Errorf("stmt.Name.Value is not 'adds numbers'. got=%s", stmt.Name.Value)
+		}
+
+		if len(stmt.Body.Statements) != 1 {
+			t.Errorf("stmt.Body does not contain 1 statement. got=%d", len(stmt.Body.Statements))
+		}
+	})
+
+	t.Run("should still parse test as identifier", func(t *testing.T) {
+		input := `let test = 1; test + 1;`
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if _, ok := program.Statements[1].(*ast.ExpressionStatement); !ok {
+			t.Fatalf("program.Statements[1] is not *ast.ExpressionStatement. got=%T", program.Statements[1])
+		}
+	})
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	t.Run("should parse call expressions", func(t *testing.T) {
 		input := `add(1, 2 * 3, 4 + 5);`
@@ -1238,6 +1404,105 @@ func TestStringLiteralExpression(t *testing.T) {
 	})
 }
 
+func TestCharLiteralExpression(t *testing.T) {
+	t.Run("should parse char literal expression", func(t *testing.T) {
+		input := `let c: char = '\u{1F988}';`
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+		}
+
+		if _, ok := stmt.Name.DefinedType.(types.TSharkChar); !ok {
+			t.Errorf("stmt.Name.DefinedType not char. got=%T", stmt.Name.DefinedType)
+		}
+
+		literal, ok := stmt.Value.(*ast.CharLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.CharLiteral. got=%T", stmt.Value)
+		}
+
+		if literal.Value != '🦈' {
+			t.Errorf("literal.Value not %q. got=%q", '🦈', literal.Value)
+		}
+	})
+}
+
+func TestInterpolatedStringExpression(t *testing.T) {
+	t.Run("should parse the parts of interpolated strings", func(t *testing.T) {
+		input := `"Hello ${name}, you are ${age + 1}";`
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+
+		expected := []string{"Hello ", "name", ", you are ", "(age + 1)", ""}
+		if len(str.Parts) != len(expected) {
+			t.Fatalf("str.Parts does not contain %d parts. got=%d", len(expected), len(str.Parts))
+		}
+		for i, part := range str.Parts {
+			if _, isText := part.(*ast.StringLiteral); isText != (i%2 == 0) {
+				t.Errorf("part %d is a %T", i, part)
+			}
+			if part.String() != expected[i] {
+				t.Errorf("part %d is not %q. got=%q", i, expected[i], part.String())
+			}
+		}
+	})
+
+	t.Run("should parse raw strings as string literals", func(t *testing.T) {
+		input := "`a\\b\n${c}`;"
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		literal, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.StringLiteral. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+		}
+		if literal.Value != "a\\b\n${c}" {
+			t.Errorf("literal.Value not %q. got=%q", "a\\b\n${c}", literal.Value)
+		}
+	})
+
+	t.Run("should report unclosed interpolations", func(t *testing.T) {
+		for _, input := range []string{`"a ${b c}";`, `"a ${}";`, `"a ${b`} {
+			l := lexer.New(&input)
+			p := New(l)
+			p.ParseProgram()
+
+			if len(p.Errors()) == 0 {
+				t.Errorf("no error for %s", input)
+			}
+		}
+	})
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	t.Run("should parse array literals", func(t *testing.T) {
 		input := "[1, 2 * 2, 3 + 3]"
@@ -1359,6 +1624,28 @@ func TestParsingTupleLiterals(t *testing.T) {
 		testInfixExpression(t, tpl.Elements[1], 2, "-", 1)
 		testInfixExpression(t, tpl.Elements[2], 3, "**", 4)
 	})
+	t.Run("should parse tuple literals starting with an identifier", func(t *testing.T) {
+		input := "(a, (b), c(1))"
+
+		l := lexer.New(&input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		tpl, ok := stmt.Expression.(*ast.TupleLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TupleLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(tpl.Elements) != 3 {
+			t.Fatalf("len(tpl.Values) not 3. got=%d", len(tpl.Elements))
+		}
+
+		testIdentifier(t, tpl.Elements[0], "a")
+		testIdentifier(t, tpl.Elements[1], "b")
+	})
 }
 
 func TestParsingTupleDeconstruct(t *testing.T) {
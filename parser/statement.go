@@ -6,6 +6,9 @@ import (
 	"shark/token"
 )
 
+// Like 'type', the 'test' keyword is contextual. It only starts a test when followed by its name.
+const testKeyword = "test"
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET, token.VAR:
@@ -17,6 +20,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseReturnStatement()
 	case token.WHILE:
 		return p.parseWhileStatement()
+	case token.IDENT:
+		if p.curToken.Literal == typeAliasKeyword && p.peekTokenIs(token.IDENT) {
+			return p.parseTypeAliasStatement()
+		}
+		if p.curToken.Literal == testKeyword && p.peekTokenIs(token.STRING) {
+			return p.parseTestStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -134,6 +145,22 @@ func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	return stmt
 }
 
+func (p *Parser) parseTestStatement() *ast.TestStatement {
+	stmt := &ast.TestStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Name = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
 func (p *Parser) parseTupleDestructuring() *ast.TupleDeconstruction {
 	variadicType := false
 
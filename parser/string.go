@@ -1,7 +1,37 @@
 package parser
 
-import "shark/ast"
+import (
+	"shark/ast"
+	"shark/token"
+	"unicode/utf8"
+)
 
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
+
+// Parses a string with interpolations, from its STRING_HEAD token to its STRING_TAIL token. The
+// text before, between and after the interpolations is kept even when it is empty, so that the
+// parts alternate.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+	for {
+		str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+		if p.curTokenIs(token.STRING_TAIL) {
+			return str
+		}
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+		if !p.peekTokenIs(token.STRING_MIDDLE) && !p.peekTokenIs(token.STRING_TAIL) {
+			p.peekError(token.STRING_TAIL)
+			return nil
+		}
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseCharLiteral() ast.Expression {
+	// The lexer reports a char that does not hold exactly one character
+	value, _ := utf8.DecodeRuneInString(p.curToken.Literal)
+	return &ast.CharLiteral{Token: p.curToken, Value: value}
+}
@@ -1,16 +1,22 @@
 package parser
 
 import (
+	"shark/ast"
 	"shark/exception"
 	"shark/token"
 	"shark/types"
 )
 
+// The 'type' keyword is contextual, so 'type' can still be used as the name of
+// the builtin function. It only starts a type alias when followed by a name.
+const typeAliasKeyword = "type"
+
 var typeMap = map[token.Type]types.ISharkType{
 	token.T_I64:      types.TSharkI64{},
 	token.T_BOOL:     types.TSharkBool{},
 	token.T_ANY:      types.TSharkAny{},
 	token.T_STRING:   types.TSharkString{},
+	token.T_CHAR:     types.TSharkChar{},
 	token.T_TUPLE:    types.TSharkTuple{},
 	token.T_ARRAY:    types.TSharkArray{},
 	token.T_HASHMAP:  types.TSharkHashMap{},
@@ -29,6 +35,8 @@ func (p *Parser) parseType() types.ISharkType {
 		sharkType = types.TSharkAny{}
 	case token.T_STRING:
 		sharkType = types.TSharkString{}
+	case token.T_CHAR:
+		sharkType = types.TSharkChar{}
 	case token.T_HASHMAP:
 		p.nextToken()
 		if p.curToken.Type != token.LT {
@@ -39,7 +47,7 @@ func (p *Parser) parseType() types.ISharkType {
 			return nil
 		}
 		p.nextToken()
-		if sharkType = typeMap[p.curToken.Type]; sharkType == nil {
+		if !p.curTokenIsType() {
 			p.errors = append(p.errors, newSharkError(exception.SharkErrorTypeNotFound, p.curToken.Literal,
 				"Did you mean 'i64', 'bool', 'string' or 'any'?",
 				exception.NewSharkErrorCause("this is not a valid type", p.curToken.Pos),
@@ -77,7 +85,7 @@ func (p *Parser) parseType() types.ISharkType {
 			return nil
 		}
 		p.nextToken()
-		if sharkType = typeMap[p.curToken.Type]; sharkType == nil {
+		if !p.curTokenIsType() {
 			p.errors = append(p.errors, newSharkError(exception.SharkErrorTypeNotFound, p.curToken.Literal,
 				"Did you mean 'i64', 'bool', 'string' or 'any'?",
 				exception.NewSharkErrorCause("this is not a valid type", p.curToken.Pos),
@@ -106,7 +114,7 @@ func (p *Parser) parseType() types.ISharkType {
 			return nil
 		}
 		p.nextToken()
-		if sharkType = typeMap[p.curToken.Type]; sharkType == nil {
+		if !p.curTokenIsType() {
 			p.errors = append(p.errors, newSharkError(exception.SharkErrorTypeNotFound, p.curToken.Literal,
 				"Did you mean 'i64', 'bool', 'string' or 'any'?",
 				exception.NewSharkErrorCause("this is not a valid type", p.curToken.Pos),
@@ -153,6 +161,9 @@ func (p *Parser) parseType() types.ISharkType {
 			ReturnT:  returnType,
 			ArgsList: argTypeList,
 		}
+	case token.IDENT:
+		// the alias is resolved against the type table by the compiler
+		sharkType = types.TSharkAlias{Name: p.curToken.Literal}
 	default:
 		p.errors = append(p.errors, newSharkError(exception.SharkErrorTypeNotFound, p.curToken.Literal,
 			"Did you mean 'i64' or 'string'?",
@@ -188,3 +199,37 @@ func (p *Parser) parseTypeList() []types.ISharkType {
 
 	return sharkTypes
 }
+
+// Checks if the current token can start a type. A type is either a built-in type or a type alias name.
+func (p *Parser) curTokenIsType() bool {
+	_, ok := typeMap[p.curToken.Type]
+	return ok || p.curTokenIs(token.IDENT)
+}
+
+func (p *Parser) parseTypeAliasStatement() *ast.TypeAliasStatement {
+	stmt := &ast.TypeAliasStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseType()
+
+	if stmt.Value == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
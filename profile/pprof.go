@@ -0,0 +1,215 @@
+// Package profile writes what a vm.Profiler recorded, as a text report of the functions, opcodes
+// and memoization cache, and as a pprof profile of the sampled stacks that 'go tool pprof' reads.
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"shark/object"
+	"shark/vm"
+)
+
+// Field numbers of the messages of profile.proto, see
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+	profileDefaultType   = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// MainName is the name of the main function in the profiles. pprof drops what is between angle
+// brackets from the names, like C++ template arguments, so it is not written as <main>.
+const MainName = "main"
+
+// WritePprof writes the sampled stacks of the profiler as a gzipped pprof profile. Each sample
+// has two values, the number of times the stack was seen and the time it stands for. The
+// functions are named after their Shark names and point to the lines of file.
+func WritePprof(w io.Writer, file string, p *vm.Profiler) error {
+	var b pprofBuilder
+	b.strings = map[string]int{"": 0}
+	b.table = []string{""}
+	b.functions = make(map[*object.CompiledFunction]uint64)
+	b.locations = make(map[location]uint64)
+
+	main := make(map[*object.CompiledFunction]bool)
+	for _, f := range p.Functions() {
+		main[f.Fn] = f.Main
+	}
+
+	var out message
+	for _, vt := range [][2]string{{"samples", "count"}, {"time", "nanoseconds"}} {
+		var m message
+		m.int(valueTypeType, int64(b.str(vt[0])))
+		m.int(valueTypeUnit, int64(b.str(vt[1])))
+		out.message(profileSampleType, &m)
+	}
+
+	var functions, locations []*message
+	for _, s := range p.Samples() {
+		ids := make([]uint64, len(s.Stack))
+		for i, frame := range s.Stack {
+			loc := location{fn: frame.Fn, line: frame.Line}
+			id, ok := b.locations[loc]
+			if !ok {
+				fnID, ok := b.functions[frame.Fn]
+				if !ok {
+					fnID = uint64(len(b.functions) + 1)
+					b.functions[frame.Fn] = fnID
+
+					name := frame.Fn.DisplayName()
+					if main[frame.Fn] {
+						name = MainName
+					}
+					var fn message
+					fn.uint(functionID, fnID)
+					fn.int(functionName, int64(b.str(name)))
+					fn.int(functionSystemName, int64(b.str(name)))
+					fn.int(functionFilename, int64(b.str(file)))
+					fn.int(functionStartLine, int64(frame.Fn.FirstLine()))
+					functions = append(functions, &fn)
+				}
+
+				id = uint64(len(b.locations) + 1)
+				b.locations[loc] = id
+
+				var line, l message
+				line.uint(lineFunctionID, fnID)
+				line.int(lineLine, int64(frame.Line))
+				l.uint(locationID, id)
+				l.message(locationLine, &line)
+				locations = append(locations, &l)
+			}
+			ids[i] = id
+		}
+
+		var m message
+		m.packed(sampleLocationID, ids)
+		m.packed(sampleValue, []uint64{uint64(s.Count), uint64(s.Time.Nanoseconds())})
+		out.message(profileSample, &m)
+	}
+
+	for _, l := range locations {
+		out.message(profileLocation, l)
+	}
+	for _, fn := range functions {
+		out.message(profileFunction, fn)
+	}
+
+	var period message
+	period.int(valueTypeType, int64(b.str("instructions")))
+	period.int(valueTypeUnit, int64(b.str("count")))
+	defaultType := b.str("time")
+
+	for _, s := range b.table {
+		out.bytes(profileStringTable, []byte(s))
+	}
+	out.int(profileDurationNanos, p.Duration().Nanoseconds())
+	out.message(profilePeriodType, &period)
+	out.int(profilePeriod, int64(p.Interval()))
+	out.int(profileDefaultType, int64(defaultType))
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(out); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+type location struct {
+	fn   *object.CompiledFunction
+	line int
+}
+
+type pprofBuilder struct {
+	strings   map[string]int
+	table     []string
+	functions map[*object.CompiledFunction]uint64
+	locations map[location]uint64
+}
+
+// Returns the index of s in the string table, adding it if needed.
+func (b *pprofBuilder) str(s string) int {
+	i, ok := b.strings[s]
+	if !ok {
+		i = len(b.table)
+		b.strings[s] = i
+		b.table = append(b.table, s)
+	}
+	return i
+}
+
+// message is an encoded protobuf message. Only the wire types used by profile.proto are
+// supported: varints and length-delimited fields.
+type message []byte
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (m *message) varint(x uint64) {
+	for x >= 0x80 {
+		*m = append(*m, byte(x)|0x80)
+		x >>= 7
+	}
+	*m = append(*m, byte(x))
+}
+
+func (m *message) key(field, wire int) {
+	m.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// Fields with the default value are left out, like protobuf does.
+func (m *message) uint(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	m.key(field, wireVarint)
+	m.varint(x)
+}
+
+func (m *message) int(field int, x int64) {
+	m.uint(field, uint64(x))
+}
+
+func (m *message) bytes(field int, b []byte) {
+	m.key(field, wireBytes)
+	m.varint(uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+func (m *message) message(field int, sub *message) {
+	m.bytes(field, *sub)
+}
+
+func (m *message) packed(field int, xs []uint64) {
+	var values message
+	for _, x := range xs {
+		values.varint(x)
+	}
+	m.bytes(field, values)
+}
@@ -0,0 +1,207 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"shark/code"
+	"shark/compiler"
+	"shark/lexer"
+	"shark/parser"
+	"shark/vm"
+	"strings"
+	"testing"
+)
+
+const input = `let double = (n: i64): i64 => {
+	n * 2
+};
+let count = (n: i64): i64 => {
+	let mut i = 0;
+	while (i < n) {
+		i++;
+	}
+	return i;
+};
+double(1);
+double(1);
+double(2);
+count(500);`
+
+func TestProfiler(t *testing.T) {
+	p := run(t, input, 10)
+
+	calls := make(map[string]int)
+	for _, f := range p.Functions() {
+		name := f.Fn.DisplayName()
+		if f.Main {
+			name = MainName
+		}
+		calls[name] = f.Calls
+		if f.Total < f.Self {
+			t.Errorf("%s: expected the total time %s to include the self time %s", name, f.Total, f.Self)
+		}
+	}
+	// The second call of double(1) is answered by the cache
+	expectedCalls := map[string]int{MainName: 1, "double": 2, "count": 1}
+	for name, expected := range expectedCalls {
+		if calls[name] != expected {
+			t.Errorf("%s: expected %d calls, got %d", name, expected, calls[name])
+		}
+	}
+
+	if hits, misses := p.CacheStats(); hits != 1 || misses != 3 {
+		t.Errorf("expected 1 cache hit and 3 misses, got %d and %d", hits, misses)
+	}
+
+	opcodes := p.Opcodes()
+	if opcodes[code.OpIncrementLocal] != 500 {
+		t.Errorf("expected 500 OpIncrementLocal, got %d", opcodes[code.OpIncrementLocal])
+	}
+	if opcodes[code.OpMul] != 2 {
+		t.Errorf("expected 2 OpMul, got %d", opcodes[code.OpMul])
+	}
+
+	total := 0
+	for _, count := range opcodes {
+		total += count
+	}
+	samples := 0
+	for _, s := range p.Samples() {
+		samples += s.Count
+	}
+	if samples != total/10 {
+		t.Errorf("expected a sample every 10 of the %d instructions, got %d samples", total, samples)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	var out strings.Builder
+	if err := WriteReport(&out, run(t, input, 10), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"         2  double\n",
+		"         1  count\n",
+		"         1  main\n",
+		"         500   12.4%  OpIncrementLocal\n",
+		"cache: 1 hits, 3 misses (25.0% hit rate)\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the report to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	p := run(t, input, 10)
+	var buf bytes.Buffer
+	if err := WritePprof(&buf, "count.shark", p); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := decode(t, data)
+	if len(fields[profileSampleType]) != 2 {
+		t.Errorf("expected 2 sample types, got %d", len(fields[profileSampleType]))
+	}
+	if len(fields[profileSample]) != len(p.Samples()) {
+		t.Errorf("expected %d samples, got %d", len(p.Samples()), len(fields[profileSample]))
+	}
+
+	var table []string
+	for _, s := range fields[profileStringTable] {
+		table = append(table, string(s))
+	}
+	if len(table) == 0 || table[0] != "" {
+		t.Fatalf("expected the string table to start with an empty string, got %q", table)
+	}
+	for _, expected := range []string{"count", MainName, "count.shark", "samples", "time", "nanoseconds"} {
+		if !strings.Contains(strings.Join(table, "\x00")+"\x00", expected+"\x00") {
+			t.Errorf("expected the string table to contain %q, got %q", expected, table)
+		}
+	}
+
+	for _, fn := range fields[profileFunction] {
+		decode(t, fn)
+	}
+	for _, l := range fields[profileLocation] {
+		if len(decode(t, l)[locationLine]) != 1 {
+			t.Errorf("expected each location to have a line")
+		}
+	}
+}
+
+// Decodes the fields of a protobuf message, the varints are returned encoded.
+func decode(t *testing.T, data []byte) map[int][][]byte {
+	t.Helper()
+
+	fields := make(map[int][][]byte)
+	for len(data) > 0 {
+		key, n := uvarint(data)
+		if n == 0 {
+			t.Fatalf("invalid key")
+		}
+		data = data[n:]
+
+		var value []byte
+		switch key & 7 {
+		case wireVarint:
+			_, n = uvarint(data)
+			value, data = data[:n], data[n:]
+		case wireBytes:
+			length, n := uvarint(data)
+			if n == 0 || int(length) > len(data)-n {
+				t.Fatalf("invalid length")
+			}
+			value, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], value)
+	}
+	return fields
+}
+
+func uvarint(data []byte) (uint64, int) {
+	var x uint64
+	for i, b := range data {
+		x |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return x, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func run(t *testing.T, input string, interval int) *vm.Profiler {
+	t.Helper()
+
+	l := lexer.New(&input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	comp := compiler.New()
+	if err, _ := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %+v", err)
+	}
+
+	profiler := vm.NewProfiler(interval)
+	machine := vm.NewDefault(comp.Bytecode())
+	machine.SetProfiler(profiler)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %+v", err)
+	}
+	profiler.Stop()
+
+	return profiler
+}
@@ -0,0 +1,83 @@
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"shark/code"
+	"shark/vm"
+	"sort"
+	"time"
+)
+
+// WriteReport writes the top functions of the profiler by self time, with their total time and
+// calls, the instructions run by opcode and the hit rate of the memoization cache. At most top
+// functions and opcodes are listed, all of them when top is 0.
+func WriteReport(w io.Writer, p *vm.Profiler, top int) error {
+	bw := bufio.NewWriter(w)
+
+	functions := p.Functions()
+	sort.SliceStable(functions, func(i, j int) bool { return functions[i].Self > functions[j].Self })
+	var self time.Duration
+	for _, f := range functions {
+		self += f.Self
+	}
+
+	fmt.Fprintf(bw, "%12s %7s %12s %10s  %s\n", "self", "self%", "total", "calls", "function")
+	for _, f := range limit(functions, top) {
+		name := f.Fn.DisplayName()
+		if f.Main {
+			name = MainName
+		}
+		fmt.Fprintf(bw, "%12s %7s %12s %10d  %s\n", f.Self, percent(int64(f.Self), int64(self)), f.Total, f.Calls, name)
+	}
+
+	type opcode struct {
+		name  string
+		count int
+	}
+	var opcodes []opcode
+	instructions := 0
+	for op, count := range p.Opcodes() {
+		name := fmt.Sprintf("opcode %d", op)
+		if def, err := code.Lookup(byte(op)); err == nil {
+			name = def.Name
+		}
+		opcodes = append(opcodes, opcode{name: name, count: count})
+		instructions += count
+	}
+	sort.Slice(opcodes, func(i, j int) bool {
+		if opcodes[i].count != opcodes[j].count {
+			return opcodes[i].count > opcodes[j].count
+		}
+		return opcodes[i].name < opcodes[j].name
+	})
+
+	fmt.Fprintf(bw, "\n%12s %7s  %s\n", "instructions", "%", "opcode")
+	for _, op := range limit(opcodes, top) {
+		fmt.Fprintf(bw, "%12d %7s  %s\n", op.count, percent(int64(op.count), int64(instructions)), op.name)
+	}
+
+	hits, misses := p.CacheStats()
+	fmt.Fprintf(bw, "\ncache: %d hits, %d misses", hits, misses)
+	if hits+misses > 0 {
+		fmt.Fprintf(bw, " (%s hit rate)", percent(int64(hits), int64(hits+misses)))
+	}
+	fmt.Fprintf(bw, "\n")
+
+	return bw.Flush()
+}
+
+func limit[T any](items []T, top int) []T {
+	if top > 0 && len(items) > top {
+		return items[:top]
+	}
+	return items
+}
+
+func percent(part, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(total))
+}
@@ -0,0 +1,88 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results as a JUnit XML report, with a test suite for each file.
+func WriteJUnit(w io.Writer, results []Result) error {
+	report := junitTestSuites{}
+	var total time.Duration
+	var durations []time.Duration
+	suites := make(map[string]int)
+
+	for _, r := range results {
+		i, ok := suites[r.File]
+		if !ok {
+			i = len(report.Suites)
+			suites[r.File] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: r.File})
+			durations = append(durations, 0)
+		}
+		suite := &report.Suites[i]
+
+		tc := junitTestCase{Name: r.Name, Classname: r.File, Time: seconds(r.Duration)}
+		if !r.Passed() {
+			tc.Failure = &junitFailure{Message: r.Err.ErrMsg, Type: fmt.Sprintf("%04d", r.Err.ErrCode), Text: r.Err.String()}
+			suite.Failures++
+			report.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		report.Tests++
+		durations[i] += r.Duration
+		total += r.Duration
+	}
+
+	report.Time = seconds(total)
+	for i := range report.Suites {
+		report.Suites[i].Time = seconds(durations[i])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
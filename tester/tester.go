@@ -0,0 +1,208 @@
+// Package tester runs the tests of Shark programs. A test is a 'test "name" { ... }' block at
+// the top level of a file, and every test runs in a VM of its own, after the statements before
+// it. Tests fail on a runtime error, like a failed 'assert', or when they run out of time.
+package tester
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"shark/ast"
+	"shark/compiler"
+	"shark/config"
+	"shark/exception"
+	"shark/lexer"
+	"shark/parser"
+	"shark/token"
+	"shark/vm"
+	"strings"
+	"time"
+)
+
+// The suffix of the files run when testing a directory.
+const fileSuffix = "_test.shark"
+
+// Result is the outcome of a test.
+type Result struct {
+	Name string
+	File string
+	// The position of the test in the file, zero when the whole file is the test.
+	Pos      token.Position
+	Duration time.Duration
+	// The error failing the test, nil when it passed.
+	Err *exception.SharkError
+}
+
+func (r Result) Passed() bool { return r.Err == nil }
+
+// Discover returns the files to test at path. A file is tested whatever its name, a directory
+// is searched recursively for the files ending with '_test.shark'.
+func Discover(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), fileSuffix) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// File runs the tests of a file, each test stops with an error after the timeout unless it is
+// zero.
+func File(path string, timeout time.Duration, conf *config.VmConf) ([]Result, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Source(path, string(src), timeout, conf), nil
+}
+
+// Source runs the tests of the source of a file. A file without tests is a test of its own,
+// named after the file. The file fails as a whole when it does not compile.
+func Source(file, src string, timeout time.Duration, conf *config.VmConf) []Result {
+	fail := func(err *exception.SharkError) []Result {
+		err.SetInputName(file)
+		err.SetInputContent(&src)
+		return []Result{{Name: file, File: file, Err: err}}
+	}
+
+	l := lexer.New(&src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return fail(&errs[0])
+	}
+	if err, _ := compiler.New().Compile(program); err != nil {
+		return fail(err)
+	}
+
+	var results []Result
+	for i, stmt := range program.Statements {
+		test, ok := stmt.(*ast.TestStatement)
+		if !ok {
+			continue
+		}
+		result := run(program, i, timeout, conf)
+		result.Name, result.File, result.Pos = test.Name.Value, file, test.Token.Pos
+		if result.Err != nil {
+			result.Err.SetInputName(file)
+			result.Err.SetInputContent(&src)
+		}
+		results = append(results, result)
+	}
+
+	if results == nil {
+		result := run(program, -1, timeout, conf)
+		result.Name, result.File = file, file
+		if result.Err != nil {
+			result.Err.SetInputName(file)
+			result.Err.SetInputContent(&src)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Runs the statements of the program up to the test at index, which is called in place of its
+// declaration. The whole program runs when index is negative.
+func run(program *ast.Program, index int, timeout time.Duration, conf *config.VmConf) Result {
+	statements := program.Statements
+	var test *ast.TestStatement
+	if index >= 0 {
+		test = program.Statements[index].(*ast.TestStatement)
+		statements = append([]ast.Statement{}, program.Statements[:index]...)
+		statements = append(statements, &ast.ExpressionStatement{
+			Token: test.Token,
+			Expression: &ast.CallExpression{
+				Token:    test.Token,
+				Function: &ast.FunctionLiteral{Token: test.Token, Body: test.Body, Name: test.Name.Value},
+			},
+		})
+	}
+
+	c := compiler.New()
+	if err, _ := c.Compile(&ast.Program{Statements: statements}); err != nil {
+		return Result{Err: err}
+	}
+
+	machine := vm.New(c.Bytecode(), conf)
+	start := time.Now()
+	err := runWithTimeout(machine, timeout)
+	result := Result{Duration: time.Since(start), Err: err}
+
+	if err != nil {
+		if pos, ok := machine.Position(); ok {
+			err.AddCause(exception.NewSharkErrorCause("failed here", callee(test, pos)))
+		}
+	}
+
+	return result
+}
+
+func runWithTimeout(machine *vm.VM, timeout time.Duration) *exception.SharkError {
+	done := make(chan *exception.SharkError, 1)
+	go func() {
+		// A test must not stop the other tests, whatever it does to the VM
+		defer func() {
+			if r := recover(); r != nil {
+				err := exception.NewSharkError(exception.SharkErrorTypeRuntime, exception.SharkErrorCodeUnknown)
+				err.SetHelpMsg(fmt.Sprintf("The VM panicked: %v", r))
+				done <- err
+			}
+		}()
+		done <- machine.Run()
+	}()
+
+	if timeout <= 0 {
+		return <-done
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		machine.Interrupt()
+		err := <-done
+		if err != nil && err.ErrCode == exception.SharkErrorVMInterrupted {
+			err.SetHelpMsg(fmt.Sprintf("The test did not finish within %v", timeout))
+		}
+		return err
+	}
+}
+
+// Returns the position of the name of the function called at pos, the instructions of a call
+// are mapped to its opening parenthesis. Returns pos when it is not a call in the test.
+func callee(test *ast.TestStatement, pos token.Position) token.Position {
+	if test == nil {
+		return pos
+	}
+
+	result := pos
+	ast.Inspect(test.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpression); ok && call.Token.Pos == pos {
+			if ident, ok := call.Function.(*ast.Identifier); ok {
+				result = ident.Token.Pos
+			}
+			return false
+		}
+		return true
+	})
+	return result
+}
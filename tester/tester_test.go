@@ -0,0 +1,148 @@
+package tester
+
+import (
+	"os"
+	"path/filepath"
+	"shark/config"
+	"shark/exception"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSource(t *testing.T) {
+	conf := config.NewDefaultVmConf()
+
+	t.Run("should run every test after the statements before it", func(t *testing.T) {
+		input := `let mut count = 0;
+let add = (a: i64, b: i64): i64 => { a + b };
+
+test "adds" {
+	assert_eq(add(1, 2), 3);
+}
+
+count += 1;
+
+test "sees the statements before it" {
+	assert_eq(count, 1);
+}
+
+test "fails" {
+	assert_eq(add(1, 1), 3);
+}`
+
+		results := Source("math_test.shark", input, 0, &conf)
+
+		expected := []struct {
+			name   string
+			line   int
+			passed bool
+		}{
+			{"adds", 4, true},
+			{"sees the statements before it", 10, true},
+			{"fails", 14, false},
+		}
+		if len(results) != len(expected) {
+			t.Fatalf("expected %d results, got %+v", len(expected), results)
+		}
+		for i, r := range results {
+			if r.Name != expected[i].name || r.Pos.Line != expected[i].line || r.Passed() != expected[i].passed {
+				t.Errorf("result %d: expected %+v, got %+v", i, expected[i], r)
+			}
+		}
+
+		err := results[2].Err
+		if err.ErrCode != exception.SharkErrorAssertionFailed {
+			t.Fatalf("expected a failed assertion, got %+v", err)
+		}
+		if len(err.ErrCause) != 1 || err.ErrCause[0].Pos.Line != 15 || err.ErrCause[0].Pos.ColFrom != 2 {
+			t.Errorf("expected the failure at the call of assert_eq, got %+v", err.ErrCause)
+		}
+		if !strings.Contains(err.String(), "--> math_test.shark:15:2") {
+			t.Errorf("expected the failure rendered with the source, got:\n%s", err.String())
+		}
+	})
+
+	t.Run("should run a file without tests as a test", func(t *testing.T) {
+		results := Source("script.shark", `assert(1 == 2);`, 0, &conf)
+		if len(results) != 1 || results[0].Name != "script.shark" || results[0].Passed() {
+			t.Fatalf("expected the file to fail as a test, got %+v", results)
+		}
+	})
+
+	t.Run("should fail the file when it does not compile", func(t *testing.T) {
+		results := Source("broken.shark", `test "a" { assert(true); } test "b" { puts(x); }`, 0, &conf)
+		if len(results) != 1 || results[0].Passed() || results[0].Err.ErrCode != exception.SharkErrorIdentifierNotFound {
+			t.Fatalf("expected a single compiler error, got %+v", results)
+		}
+	})
+
+	t.Run("should stop a test after the timeout", func(t *testing.T) {
+		input := `test "loops" { let mut i = 0; while (true) { i++; } } test "ends" { assert(true); }`
+
+		results := Source("loop_test.shark", input, 50*time.Millisecond, &conf)
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, got %+v", results)
+		}
+		if results[0].Passed() || results[0].Err.ErrCode != exception.SharkErrorVMInterrupted {
+			t.Errorf("expected the first test to time out, got %+v", results[0])
+		}
+		if !results[1].Passed() {
+			t.Errorf("expected the second test to pass, got %+v", results[1].Err)
+		}
+	})
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a_test.shark", "b.shark", filepath.Join("sub", "c_test.shark")} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(`assert(true);`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("should find the test files in a directory", func(t *testing.T) {
+		files, err := Discover(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{filepath.Join(dir, "a_test.shark"), filepath.Join(dir, "sub", "c_test.shark")}
+		if strings.Join(files, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("expected %v, got %v", expected, files)
+		}
+	})
+
+	t.Run("should test a file whatever its name", func(t *testing.T) {
+		path := filepath.Join(dir, "b.shark")
+		files, err := Discover(path)
+		if err != nil || len(files) != 1 || files[0] != path {
+			t.Errorf("expected %v, got %v (%v)", path, files, err)
+		}
+	})
+}
+
+func TestWriteJUnit(t *testing.T) {
+	conf := config.NewDefaultVmConf()
+	results := Source("a_test.shark", `test "passes" { assert(true); } test "fails" { assert(false, "oops"); }`, 0, &conf)
+
+	var out strings.Builder
+	if err := WriteJUnit(&out, results); err != nil {
+		t.Fatal(err)
+	}
+
+	report := out.String()
+	for _, expected := range []string{
+		`<testsuites tests="2" failures="1"`,
+		`<testsuite name="a_test.shark" tests="2" failures="1"`,
+		`<testcase name="passes" classname="a_test.shark"`,
+		`<failure message="assertion failed: oops" type="0048">`,
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("expected the report to contain %q, got:\n%s", expected, report)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package token
+
+// Index holds the tokens of a source in order and finds them by the position they start at,
+// to find the positions the syntax tree does not keep, like where blocks and statements end.
+type Index struct {
+	Tokens []Token
+	// Index of the token starting at a line and column.
+	starts map[[2]int]int
+}
+
+// NewIndex indexes the tokens of a source, in the order the lexer returned them.
+func NewIndex(tokens []Token) *Index {
+	idx := &Index{Tokens: tokens, starts: make(map[[2]int]int, len(tokens))}
+	for i, tok := range tokens {
+		idx.starts[[2]int{tok.Pos.Line, tok.Pos.ColFrom}] = i
+	}
+	return idx
+}
+
+// IndexOf returns the index of the token starting at pos.
+func (idx *Index) IndexOf(pos Position) (int, bool) {
+	i, ok := idx.starts[[2]int{pos.Line, pos.ColFrom}]
+	return i, ok
+}
+
+// Before reports whether the position starts before other in the source.
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || (p.Line == other.Line && p.ColFrom < other.ColFrom)
+}
@@ -26,6 +26,8 @@ const (
 	IDENT       = "IDENT"
 	INT         = "INT"
 	STRING      = "STRING"
+	CHAR        = "CHAR"
+	COMMENT     = "COMMENT"
 	ASSIGN      = "="
 	PLUS        = "+"
 	COMMA       = ","
@@ -69,18 +71,31 @@ const (
 	POINTER     = "->"
 	RANGE       = ".."
 	SPREAD      = "..."
+	AT          = "@"
 	MUTABLE     = "MUTABLE"
 	VAR         = "VAR"
 	T_I64       = "I64"
 	T_BOOL      = "BOOL"
 	T_ANY       = "ANY"
 	T_STRING    = "STRING"
+	T_CHAR      = "T_CHAR"
 	T_ARRAY     = "ARRAY"
 	T_TUPLE     = "TUPLE"
 	T_HASHMAP   = "HASHMAP"
 	T_FUNCTION  = "FUNCTION"
 )
 
+// Shark token types of the strings that are not a single STRING.
+const (
+	// A string between backticks, read as it is written.
+	RAW_STRING = "RAW_STRING"
+	// The text parts of a string with interpolations: before the first '${', between a '}' and
+	// the next '${', and after the last '}'.
+	STRING_HEAD   = "STRING_HEAD"
+	STRING_MIDDLE = "STRING_MIDDLE"
+	STRING_TAIL   = "STRING_TAIL"
+)
+
 // List of reserved Shark keywords.
 var keywords = map[string]Type{
 	"let":     LET,
@@ -96,12 +111,32 @@ var keywords = map[string]Type{
 	"bool":    T_BOOL,
 	"any":     T_ANY,
 	"string":  T_STRING,
+	"char":    T_CHAR,
 	"array":   T_ARRAY,
 	"tuple":   T_TUPLE,
 	"hashmap": T_HASHMAP,
 	"func":    T_FUNCTION,
 }
 
+// Returns the reserved Shark keywords, in no particular order.
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Checks if a keyword names a type, like 'i64' or 'array'.
+func IsTypeKeyword(ident string) bool {
+	switch keywords[ident] {
+	case T_I64, T_BOOL, T_ANY, T_STRING, T_CHAR, T_ARRAY, T_TUPLE, T_HASHMAP, T_FUNCTION:
+		return true
+	default:
+		return false
+	}
+}
+
 // Checks if an identifier is a reserved Shark keyword. If it is, it returns the token type.
 func LookupIdent(ident string) Type {
 	if tok, ok := keywords[ident]; ok {
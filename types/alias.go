@@ -0,0 +1,33 @@
+package types
+
+// TSharkAlias is a named reference to another Shark type, declared with a
+// 'type' statement. An alias is transparent for type checks, but keeps its
+// name when it is printed. An alias without a Type is not resolved yet.
+type TSharkAlias struct {
+	Type ISharkType
+	Name string
+}
+
+func (t TSharkAlias) SharkTypeString() string { return t.Name }
+
+func (t TSharkAlias) Is(sharkType ISharkType) bool {
+	if t.Type == nil {
+		if other, ok := sharkType.(TSharkAlias); ok {
+			return other.Name == t.Name
+		}
+		return false
+	}
+	return t.Type.Is(sharkType)
+}
+
+// Underlying returns the type an alias refers to by following the alias chain.
+// Types that are not resolved aliases are returned as is.
+func Underlying(sharkType ISharkType) ISharkType {
+	for {
+		alias, ok := sharkType.(TSharkAlias)
+		if !ok || alias.Type == nil {
+			return sharkType
+		}
+		sharkType = alias.Type
+	}
+}
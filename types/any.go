@@ -7,6 +7,7 @@ type TSharkAny struct {
 func (TSharkAny) SharkTypeString() string { return "any" }
 
 func (TSharkAny) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch sharkType.(type) {
 	case TSharkSpread, TSharkOptional:
 		return false
@@ -14,6 +14,7 @@ func (t TSharkArray) SharkTypeString() string {
 }
 
 func (t TSharkArray) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch sharkType := sharkType.(type) {
 	case TSharkArray:
 		if sharkType.Collection == nil {
@@ -7,6 +7,7 @@ type TSharkBool struct {
 func (TSharkBool) SharkTypeString() string { return "bool" }
 
 func (TSharkBool) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch t := sharkType.(type) {
 	case TSharkBool:
 		return true
@@ -0,0 +1,20 @@
+package types
+
+// A single Unicode code point, what indexing a string gives.
+type TSharkChar struct {
+	ISharkType
+}
+
+func (TSharkChar) SharkTypeString() string { return "char" }
+
+func (TSharkChar) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
+	switch t := sharkType.(type) {
+	case TSharkChar:
+		return true
+	case TSharkVariadic:
+		return t.Is(TSharkChar{})
+	default:
+		return false
+	}
+}
@@ -13,6 +13,7 @@ func (t TSharkClosure) SharkTypeString() string {
 }
 
 func (t TSharkClosure) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	if tt, ok := sharkType.(TSharkClosure); ok {
 		if tt.FuncType == nil {
 			return true
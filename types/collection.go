@@ -27,6 +27,7 @@ func (t TSharkCollection) SharkTypeString() string {
 }
 
 func (t TSharkCollection) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	if collection, ok := sharkType.(ISharkCollection); ok {
 		if t.Collection == nil {
 			return true
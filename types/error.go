@@ -7,6 +7,7 @@ type TSharkError struct {
 func (TSharkError) SharkTypeString() string { return "error" }
 
 func (TSharkError) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch sharkType.(type) {
 	case TSharkError:
 		return true
@@ -39,6 +39,7 @@ func (t TSharkFuncType) SharkTypeString() string {
 }
 
 func (t TSharkFuncType) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch sharkType := sharkType.(type) {
 	case TSharkFuncType:
 		if sharkType.ArgsList == nil && sharkType.ReturnT == nil {
@@ -15,6 +15,7 @@ func (t TSharkHashMap) SharkTypeString() string {
 }
 
 func (t TSharkHashMap) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch sharkType := sharkType.(type) {
 	case TSharkHashMap:
 		if sharkType.Indexes == nil && sharkType.Collects == nil {
@@ -7,6 +7,7 @@ type TSharkI64 struct {
 func (TSharkI64) SharkTypeString() string { return "i64" }
 
 func (TSharkI64) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch t := sharkType.(type) {
 	case TSharkI64:
 		return true
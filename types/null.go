@@ -7,6 +7,7 @@ type TSharkNull struct {
 func (TSharkNull) SharkTypeString() string { return "null" }
 
 func (TSharkNull) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch t := sharkType.(type) {
 	case TSharkNull:
 		return true
@@ -13,6 +13,7 @@ func (t TSharkOptional) SharkTypeString() string {
 }
 
 func (t TSharkOptional) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch sharkType := sharkType.(type) {
 	case TSharkOptional:
 		if sharkType.Type == nil {
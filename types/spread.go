@@ -13,6 +13,7 @@ func (t TSharkSpread) SharkTypeString() string {
 }
 
 func (t TSharkSpread) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch sharkType := sharkType.(type) {
 	case TSharkSpread:
 		if sharkType.Type == nil {
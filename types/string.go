@@ -8,6 +8,7 @@ type TSharkString struct {
 func (TSharkString) SharkTypeString() string { return "string" }
 
 func (TSharkString) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch t := sharkType.(type) {
 	case TSharkString:
 		return true
@@ -18,6 +19,7 @@ func (TSharkString) Is(sharkType ISharkType) bool {
 	}
 }
 
+// A string is a collection of chars, its length and indexes count code points and not bytes.
 func (t TSharkString) Collects() []ISharkType {
-	return []ISharkType{t}
+	return []ISharkType{TSharkChar{}}
 }
@@ -25,6 +25,7 @@ func (t TSharkTuple) SharkTypeString() string {
 }
 
 func (t TSharkTuple) Is(sharkType ISharkType) bool {
+	sharkType = Underlying(sharkType)
 	switch sharkType := sharkType.(type) {
 	case TSharkTuple:
 		if sharkType.Collection == nil {
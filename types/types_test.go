@@ -89,6 +89,34 @@ func TestPrimitiveTypes(t *testing.T) {
 		}
 	})
 
+	t.Run("should validate type char", func(t *testing.T) {
+		tests_matching := []struct {
+			givenType ISharkType
+			otherType ISharkType
+			expected  bool
+		}{
+			{TSharkChar{}, TSharkChar{}, true},
+			{TSharkChar{}, TSharkString{}, false},
+			{TSharkString{}, TSharkChar{}, false},
+			{TSharkChar{}, TSharkI64{}, false},
+		}
+
+		for _, test := range tests_matching {
+			validateTypeMatching(t, test.givenType, test.otherType, test.expected)
+		}
+
+		tests_rep := []struct {
+			givenType ISharkType
+			stringRep string
+		}{
+			{TSharkChar{}, "char"},
+		}
+
+		for _, test := range tests_rep {
+			validateTypeStringRepresentation(t, test.givenType, test.stringRep)
+		}
+	})
+
 	t.Run("should validate type i64", func(t *testing.T) {
 		tests_matching := []struct {
 			givenType ISharkType
@@ -514,6 +542,63 @@ func TestClosureTypes(t *testing.T) {
 	})
 }
 
+func TestAliasTypes(t *testing.T) {
+	t.Run("should validate type alias", func(t *testing.T) {
+		reducer := TSharkAlias{Name: "Reducer", Type: TSharkFuncType{ArgsList: []ISharkType{TSharkI64{}, TSharkI64{}}, ReturnT: TSharkI64{}}}
+		numbers := TSharkAlias{Name: "Numbers", Type: TSharkArray{Collection: TSharkI64{}}}
+		nested := TSharkAlias{Name: "Ints", Type: numbers}
+
+		tests_matching := []struct {
+			givenType ISharkType
+			otherType ISharkType
+			expected  bool
+		}{
+			{reducer, TSharkFuncType{ArgsList: []ISharkType{TSharkI64{}, TSharkI64{}}, ReturnT: TSharkI64{}}, true},
+			{TSharkFuncType{ArgsList: []ISharkType{TSharkI64{}, TSharkI64{}}, ReturnT: TSharkI64{}}, reducer, true},
+			{reducer, TSharkFuncType{ArgsList: []ISharkType{TSharkI64{}}, ReturnT: TSharkI64{}}, false},
+			{numbers, TSharkArray{Collection: TSharkI64{}}, true},
+			{TSharkArray{Collection: TSharkI64{}}, numbers, true},
+			{nested, numbers, true},
+			{numbers, nested, true},
+			{nested, TSharkArray{Collection: TSharkString{}}, false},
+			{TSharkAny{}, reducer, true},
+			{TSharkAlias{Name: "A"}, TSharkAlias{Name: "A"}, true},
+			{TSharkAlias{Name: "A"}, TSharkAlias{Name: "B"}, false},
+		}
+
+		for _, test := range tests_matching {
+			validateTypeMatching(t, test.givenType, test.otherType, test.expected)
+		}
+
+		tests_rep := []struct {
+			givenType ISharkType
+			stringRep string
+		}{
+			{reducer, "Reducer"},
+			{nested, "Ints"},
+			{TSharkArray{Collection: numbers}, "array<Numbers>"},
+			{TSharkFuncType{ArgsList: []ISharkType{numbers, TSharkI64{}, reducer}, ReturnT: TSharkI64{}}, "func<(Numbers,i64,Reducer)->i64>"},
+		}
+
+		for _, test := range tests_rep {
+			validateTypeStringRepresentation(t, test.givenType, test.stringRep)
+		}
+	})
+
+	t.Run("should unwrap alias to its underlying type", func(t *testing.T) {
+		numbers := TSharkAlias{Name: "Numbers", Type: TSharkArray{Collection: TSharkI64{}}}
+		nested := TSharkAlias{Name: "Ints", Type: numbers}
+
+		if _, ok := Underlying(nested).(TSharkArray); !ok {
+			t.Errorf("expected underlying type to be array, got %T", Underlying(nested))
+		}
+
+		if _, ok := Underlying(TSharkI64{}).(TSharkI64); !ok {
+			t.Errorf("expected underlying type of i64 to be i64, got %T", Underlying(TSharkI64{}))
+		}
+	})
+}
+
 func validateTypeMatching(t *testing.T, givenType ISharkType, otherType ISharkType, expected bool) {
 	t.Helper()
 
@@ -0,0 +1,112 @@
+package vm
+
+import (
+	"shark/code"
+	"shark/object"
+)
+
+// Coverage counts how many times the instructions of the functions run by a VM were run, and
+// which way their conditional jumps went. It can be shared by the VMs running the code of a
+// program piece by piece, like a REPL does.
+type Coverage struct {
+	functions []*object.CompiledFunction
+	main      map[*object.CompiledFunction]bool
+	counts    map[*object.CompiledFunction][]int
+	branches  map[*object.CompiledFunction]map[int]*Branch
+}
+
+// Branch counts the outcomes of a conditional jump.
+type Branch struct {
+	// The condition was truthy, the code after the jump ran.
+	Taken int
+	// The condition was falsy, the VM jumped over the code after the jump.
+	NotTaken int
+}
+
+// FunctionCoverage is the coverage of a function, with the counts of its instructions by offset
+// and its branches by the offset of their jump.
+type FunctionCoverage struct {
+	Fn       *object.CompiledFunction
+	Main     bool
+	Counts   []int
+	Branches map[int]Branch
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{
+		main:     make(map[*object.CompiledFunction]bool),
+		counts:   make(map[*object.CompiledFunction][]int),
+		branches: make(map[*object.CompiledFunction]map[int]*Branch),
+	}
+}
+
+// SetCoverage makes the VM count the instructions it runs in c. The functions of its bytecode
+// are added to c, so the functions never called are part of the coverage.
+func (vm *VM) SetCoverage(c *Coverage) {
+	vm.coverage = c
+	c.add(vm.frames[0].cl.Fn, true)
+	for _, constant := range vm.constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			c.add(fn, false)
+		}
+	}
+}
+
+func (c *Coverage) add(fn *object.CompiledFunction, main bool) {
+	if _, ok := c.counts[fn]; ok {
+		return
+	}
+	c.functions = append(c.functions, fn)
+	c.main[fn] = main
+	c.counts[fn] = make([]int, len(fn.Instructions))
+	c.branches[fn] = make(map[int]*Branch)
+}
+
+// Functions returns the coverage of the functions in the order they were added.
+func (c *Coverage) Functions() []FunctionCoverage {
+	result := make([]FunctionCoverage, 0, len(c.functions))
+	for _, fn := range c.functions {
+		branches := make(map[int]Branch)
+		for offset, b := range c.branches[fn] {
+			branches[offset] = *b
+		}
+		// Jumps never reached have no outcome yet
+		for offset := 0; offset < len(fn.Instructions); {
+			in, err := code.ReadInstruction(fn.Instructions[offset:])
+			if err != nil {
+				break
+			}
+			if code.IsConditionalJump(in.Op) {
+				if _, ok := branches[offset]; !ok {
+					branches[offset] = Branch{}
+				}
+			}
+			offset += in.Size
+		}
+		result = append(result, FunctionCoverage{Fn: fn, Main: c.main[fn], Counts: c.counts[fn], Branches: branches})
+	}
+	return result
+}
+
+func (c *Coverage) hit(fn *object.CompiledFunction, ip int) {
+	counts, ok := c.counts[fn]
+	if !ok {
+		// A function made at run time, like the main function of 'assert_throws'
+		c.add(fn, false)
+		counts = c.counts[fn]
+	}
+	counts[ip]++
+}
+
+func (c *Coverage) branch(fn *object.CompiledFunction, ip int, taken bool) {
+	b, ok := c.branches[fn][ip]
+	if !ok {
+		b = &Branch{}
+		c.branches[fn][ip] = b
+	}
+	if taken {
+		b.Taken++
+	} else {
+		b.NotTaken++
+	}
+}
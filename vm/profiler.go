@@ -0,0 +1,230 @@
+package vm
+
+import (
+	"fmt"
+	"shark/code"
+	"shark/object"
+	"strings"
+	"time"
+)
+
+// DefaultSampleInterval is the number of instructions run between two samples of the stack.
+const DefaultSampleInterval = 1000
+
+// Profiler records where the VMs it is set on spend their time. Calls are instrumented, giving
+// the calls, self time and total time of every function, and the stack is sampled every few
+// instructions, giving the time spent on each line. It also counts the instructions run by
+// opcode and the hits and misses of the memoization cache.
+type Profiler struct {
+	interval    int
+	untilSample int
+	lastSample  time.Time
+	start       time.Time
+	duration    time.Duration
+
+	functions map[*object.CompiledFunction]*FunctionProfile
+	order     []*object.CompiledFunction
+	calls     []profiledCall
+	// How many calls of a function are on the stack, the total time of recursive calls is only
+	// counted by the outermost one.
+	active map[*object.CompiledFunction]int
+
+	samples     map[string]*Sample
+	sampleOrder []string
+
+	opcodes     [256]int
+	cacheHits   int
+	cacheMisses int
+}
+
+// FunctionProfile is the time spent in a function. The self time leaves out the time of the
+// functions it calls, except builtins.
+type FunctionProfile struct {
+	Fn    *object.CompiledFunction
+	Main  bool
+	Calls int
+	Self  time.Duration
+	Total time.Duration
+}
+
+// Sample is a stack seen while sampling, with the number of times it was seen and the time
+// since the sample before each of them.
+type Sample struct {
+	// The calls on the stack, the innermost one first.
+	Stack []StackFrame
+	Count int
+	Time  time.Duration
+}
+
+// StackFrame is a call on the stack and the line it was running.
+type StackFrame struct {
+	Fn   *object.CompiledFunction
+	Line int
+}
+
+type profiledCall struct {
+	fn       *object.CompiledFunction
+	start    time.Time
+	children time.Duration
+}
+
+// NewProfiler returns a profiler sampling the stack every interval instructions.
+func NewProfiler(interval int) *Profiler {
+	if interval <= 0 {
+		interval = DefaultSampleInterval
+	}
+	now := time.Now()
+	return &Profiler{
+		interval:    interval,
+		untilSample: interval,
+		lastSample:  now,
+		start:       now,
+		functions:   make(map[*object.CompiledFunction]*FunctionProfile),
+		active:      make(map[*object.CompiledFunction]int),
+		samples:     make(map[string]*Sample),
+	}
+}
+
+// SetProfiler makes the VM record its calls and instructions in p, starting with a call of its
+// main function. The calls still running when the VM stops are ended by Profiler.Stop.
+func (vm *VM) SetProfiler(p *Profiler) {
+	vm.profiler = p
+	p.function(vm.frames[0].cl.Fn).Main = true
+	p.enter(vm.frames[0].cl.Fn)
+}
+
+// Stop ends the calls still running, like the one of the main function. It is called when a VM
+// is done, the profiler can then be set on the next one.
+func (p *Profiler) Stop() {
+	p.unwind(0)
+	p.duration = time.Since(p.start)
+}
+
+// Functions returns the profiles of the functions in the order of their first call.
+func (p *Profiler) Functions() []FunctionProfile {
+	result := make([]FunctionProfile, len(p.order))
+	for i, fn := range p.order {
+		result[i] = *p.functions[fn]
+	}
+	return result
+}
+
+// Samples returns the stacks seen while sampling in the order they were first seen.
+func (p *Profiler) Samples() []Sample {
+	result := make([]Sample, len(p.sampleOrder))
+	for i, key := range p.sampleOrder {
+		result[i] = *p.samples[key]
+	}
+	return result
+}
+
+// Opcodes returns how many instructions of each opcode were run.
+func (p *Profiler) Opcodes() map[code.Opcode]int {
+	result := make(map[code.Opcode]int)
+	for op, count := range p.opcodes {
+		if count > 0 {
+			result[code.Opcode(op)] = count
+		}
+	}
+	return result
+}
+
+// CacheStats returns the hits and misses of the memoization cache, calls of functions that
+// cannot be memoized are not counted.
+func (p *Profiler) CacheStats() (hits, misses int) {
+	return p.cacheHits, p.cacheMisses
+}
+
+// Interval returns the number of instructions between two samples.
+func (p *Profiler) Interval() int {
+	return p.interval
+}
+
+// Duration returns the time from the creation of the profiler to its last Stop.
+func (p *Profiler) Duration() time.Duration {
+	return p.duration
+}
+
+func (p *Profiler) function(fn *object.CompiledFunction) *FunctionProfile {
+	f, ok := p.functions[fn]
+	if !ok {
+		f = &FunctionProfile{Fn: fn}
+		p.functions[fn] = f
+		p.order = append(p.order, fn)
+	}
+	return f
+}
+
+func (p *Profiler) enter(fn *object.CompiledFunction) {
+	p.function(fn).Calls++
+	p.active[fn]++
+	p.calls = append(p.calls, profiledCall{fn: fn, start: time.Now()})
+}
+
+func (p *Profiler) leave() {
+	if len(p.calls) == 0 {
+		return
+	}
+	call := p.calls[len(p.calls)-1]
+	p.calls = p.calls[:len(p.calls)-1]
+
+	elapsed := time.Since(call.start)
+	f := p.functions[call.fn]
+	f.Self += elapsed - call.children
+	if p.active[call.fn]--; p.active[call.fn] == 0 {
+		f.Total += elapsed
+	}
+	if len(p.calls) > 0 {
+		p.calls[len(p.calls)-1].children += elapsed
+	}
+}
+
+// Ends the calls above depth, which were left by an error.
+func (p *Profiler) unwind(depth int) {
+	for len(p.calls) > depth {
+		p.leave()
+	}
+}
+
+func (p *Profiler) cacheLookup(hit bool) {
+	if hit {
+		p.cacheHits++
+	} else {
+		p.cacheMisses++
+	}
+}
+
+// Counts an instruction, and samples the stack of the VM when it is time to.
+func (p *Profiler) instruction(vm *VM, op code.Opcode) {
+	p.opcodes[op]++
+	if p.untilSample--; p.untilSample > 0 {
+		return
+	}
+	p.untilSample = p.interval
+
+	now := time.Now()
+	elapsed := now.Sub(p.lastSample)
+	p.lastSample = now
+
+	stack := make([]StackFrame, 0, vm.framesIndex)
+	var key strings.Builder
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		line := 0
+		if pos, ok := frame.cl.Fn.SourceMap.PositionAt(frame.ip); ok {
+			line = pos.Line
+		}
+		stack = append(stack, StackFrame{Fn: frame.cl.Fn, Line: line})
+		p.function(frame.cl.Fn)
+		fmt.Fprintf(&key, "%p:%d;", frame.cl.Fn, line)
+	}
+
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &Sample{Stack: stack}
+		p.samples[key.String()] = s
+		p.sampleOrder = append(p.sampleOrder, key.String())
+	}
+	s.Count++
+	s.Time += elapsed
+}
@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"shark/object"
+)
+
+// Value is a value on the stack of the VM or in one of its globals. Integers and booleans are
+// held in it as they are, so computing them allocates nothing, other values are objects. The
+// zero Value is an empty slot, like a local that has no value yet.
+type Value struct {
+	// The object of the value, or the kind of the value held in num.
+	obj object.Object
+	num int64
+}
+
+// The kinds of the values held in num, they are never used as objects.
+type immediate struct{ object.Object }
+
+// Pointers rather than objects, comparing an object to one does not call into the runtime.
+var (
+	intKind  = &immediate{}
+	boolKind = &immediate{}
+)
+
+var nullValue = Value{obj: Null}
+
+func intValue(value int64) Value {
+	return Value{obj: intKind, num: value}
+}
+
+func boolValue(value bool) Value {
+	if value {
+		return Value{obj: boolKind, num: 1}
+	}
+	return Value{obj: boolKind}
+}
+
+// Returns the value of an object, integers and booleans are unboxed.
+func objectValue(obj object.Object) Value {
+	switch obj := obj.(type) {
+	case *object.Int64:
+		return intValue(obj.Value)
+	case *object.Boolean:
+		return boolValue(obj.Value)
+	}
+	return Value{obj: obj}
+}
+
+// Returns the object of the value, integers and booleans are boxed. An empty slot has none.
+func (v Value) toObject() object.Object {
+	switch {
+	case v.isInt():
+		return object.NewInt64(v.num)
+	case v.isBool():
+		return nativeBoolToBooleanObject(v.num != 0)
+	}
+	return v.obj
+}
+
+func (v Value) isInt() bool {
+	return v.obj == intKind
+}
+
+func (v Value) isBool() bool {
+	return v.obj == boolKind
+}
+
+func (v Value) isEmpty() bool {
+	return v.obj == nil
+}
+
+// Returns the objects of the values.
+func toObjects(values []Value) []object.Object {
+	objects := make([]object.Object, len(values))
+	for i, value := range values {
+		objects[i] = value.toObject()
+	}
+	return objects
+}
@@ -7,27 +7,41 @@ import (
 	"shark/config"
 	"shark/exception"
 	"shark/object"
+	"shark/token"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
 )
 
+// The number of values the stack starts with, it grows up to the size of the configuration.
+const initialStackSize = 256
+
 var True = &object.Boolean{Value: true}
 var False = &object.Boolean{Value: false}
 var Null = &object.Null{}
 
 type VM struct {
-	conf        *config.VmConf
+	conf *config.VmConf
+	// Created by the first memoized call, most programs make none.
 	cache       *expirable.LRU[string, object.Object]
 	constants   []object.Object
-	stack       []object.Object
-	globals     []object.Object
+	stack       []Value
+	globals     []Value
 	frames      []*Frame
 	sp          int
 	framesIndex int
+	// Set by Interrupt, shared with the VMs running the functions given to 'assert_throws'.
+	interrupted *atomic.Bool
+	// Counts the instructions run when set with SetCoverage.
+	coverage *Coverage
+	// Records the calls and samples the stack when set with SetProfiler.
+	profiler *Profiler
 }
 
+var assertThrows = object.GetBuiltinByName("assert_throws")
+
 func NewDefault(bytecode *bytecode.Bytecode) *VM {
 	conf := config.NewDefaultVmConf()
 
@@ -35,7 +49,7 @@ func NewDefault(bytecode *bytecode.Bytecode) *VM {
 }
 
 func New(bytecode *bytecode.Bytecode, conf *config.VmConf) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -44,24 +58,37 @@ func New(bytecode *bytecode.Bytecode, conf *config.VmConf) *VM {
 
 	return &VM{
 		constants:   bytecode.Constants,
-		stack:       make([]object.Object, conf.StackSize),
+		stack:       make([]Value, min(initialStackSize, conf.StackSize)),
 		sp:          0,
-		globals:     make([]object.Object, conf.GlobalsSize),
+		globals:     make([]Value, conf.GlobalsSize),
 		frames:      frames,
 		framesIndex: 1,
 		conf:        conf,
-		cache:       expirable.NewLRU[string, object.Object](conf.CacheSize, nil, time.Minute*5),
+		interrupted: new(atomic.Bool),
 	}
 }
 
-func NewWithGlobalsStore(bytecode *bytecode.Bytecode, s []object.Object, conf *config.VmConf) *VM {
+func NewWithGlobalsStore(bytecode *bytecode.Bytecode, s []Value, conf *config.VmConf) *VM {
 	vm := New(bytecode, conf)
 	vm.globals = s
 	return vm
 }
 
+// Interrupt stops a running VM, Run returns an error at the next jump or call. It is safe to
+// call from another goroutine.
+func (vm *VM) Interrupt() {
+	vm.interrupted.Store(true)
+}
+
+// Position returns the source position of the instruction run last, which is where the error
+// returned by Run happened. It is unknown when the bytecode has no source map.
+func (vm *VM) Position() (token.Position, bool) {
+	frame := vm.currentFrame()
+	return frame.cl.Fn.SourceMap.PositionAt(frame.ip)
+}
+
 func (vm *VM) LastPoppedStackElem() object.Object {
-	return vm.stack[vm.sp]
+	return vm.stack[vm.sp].toObject()
 }
 
 func (vm *VM) Run() *exception.SharkError {
@@ -76,12 +103,19 @@ func (vm *VM) Run() *exception.SharkError {
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
 
+		if vm.coverage != nil {
+			vm.coverage.hit(vm.currentFrame().cl.Fn, ip)
+		}
+		if vm.profiler != nil {
+			vm.profiler.instruction(vm, op)
+		}
+
 		switch op {
 		case code.OpConstant:
 			constIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 			value := vm.constants[constIndex]
-			if err := vm.push(value); err != nil {
+			if err := vm.push(objectValue(value)); err != nil {
 				return err
 			}
 		case code.OpPop:
@@ -91,14 +125,15 @@ func (vm *VM) Run() *exception.SharkError {
 				return err
 			}
 		case code.OpTrue:
-			if err := vm.push(True); err != nil {
+			if err := vm.push(boolValue(true)); err != nil {
 				return err
 			}
 		case code.OpFalse:
-			if err := vm.push(False); err != nil {
+			if err := vm.push(boolValue(false)); err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanEqual, code.OpAnd, code.OpOr:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanEqual, code.OpLessThan,
+			code.OpLessThanEqual, code.OpAnd, code.OpOr:
 			if err := vm.executeComparison(op); err != nil {
 				return err
 			}
@@ -113,49 +148,55 @@ func (vm *VM) Run() *exception.SharkError {
 		case code.OpIncrementGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			intVal, ok := vm.globals[globalIndex].(*object.Int64)
-			if !ok {
-				return newSharkError(exception.SharkErrorNonNumberIncrement, vm.globals[globalIndex].Type())
+			if err := step(&vm.globals[globalIndex], 1, exception.SharkErrorNonNumberIncrement); err != nil {
+				return err
 			}
-			vm.globals[globalIndex] = &object.Int64{Value: intVal.Value + 1}
 		case code.OpIncrementLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			frame := vm.currentFrame()
-			intVal, ok := vm.stack[frame.basePointer+int(localIndex)].(*object.Int64)
-			if !ok {
-				return newSharkError(exception.SharkErrorNonNumberIncrement, vm.stack[frame.basePointer+int(localIndex)].Type())
+			if err := step(vm.local(int(localIndex)), 1, exception.SharkErrorNonNumberIncrement); err != nil {
+				return err
 			}
-			vm.stack[frame.basePointer+int(localIndex)] = &object.Int64{Value: intVal.Value + 1}
 		case code.OpDecrementGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			intVal, ok := vm.globals[globalIndex].(*object.Int64)
-			if !ok {
-				return newSharkError(exception.SharkErrorNonNumberDecrement, vm.globals[globalIndex].Type())
+			if err := step(&vm.globals[globalIndex], -1, exception.SharkErrorNonNumberDecrement); err != nil {
+				return err
 			}
-			vm.globals[globalIndex] = &object.Int64{Value: intVal.Value - 1}
 		case code.OpDecrementLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			frame := vm.currentFrame()
-			intVal, ok := vm.stack[frame.basePointer+int(localIndex)].(*object.Int64)
-			if !ok {
-				return newSharkError(exception.SharkErrorNonNumberIncrement, vm.stack[frame.basePointer+int(localIndex)].Type())
+			if err := step(vm.local(int(localIndex)), -1, exception.SharkErrorNonNumberIncrement); err != nil {
+				return err
 			}
-			vm.stack[frame.basePointer+int(localIndex)] = &object.Int64{Value: intVal.Value - 1}
 		case code.OpJump:
+			if vm.interrupted.Load() {
+				return newSharkError(exception.SharkErrorVMInterrupted)
+			}
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip = pos - 1
 		case code.OpJumpNotTruthy:
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
-			condition := vm.pop()
-			if !isTruthy(condition) {
-				vm.currentFrame().ip = pos - 1
+			vm.jumpNotTruthy(ip, pos)
+		case code.OpJumpIfLocalNotLess, code.OpJumpIfLocalNotGreater:
+			left := code.ReadUint8(ins[ip+1:])
+			right := code.ReadUint8(ins[ip+2:])
+			pos := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+			if err := vm.jumpIfNot(op, ip, *vm.local(int(left)), *vm.local(int(right)), pos); err != nil {
+				return err
+			}
+		case code.OpJumpIfLocalNotEqualConst:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			constIndex := code.ReadUint16(ins[ip+2:])
+			pos := int(code.ReadUint16(ins[ip+4:]))
+			vm.currentFrame().ip += 5
+			if err := vm.jumpIfNot(op, ip, *vm.local(int(localIndex)), objectValue(vm.constants[constIndex]), pos); err != nil {
+				return err
 			}
 		case code.OpNull:
-			if err := vm.push(Null); err != nil {
+			if err := vm.push(nullValue); err != nil {
 				return err
 			}
 		case code.OpSetGlobal:
@@ -165,42 +206,19 @@ func (vm *VM) Run() *exception.SharkError {
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			if err := vm.push(vm.globals[globalIndex]); err != nil {
+			if err := vm.pushSlot(&vm.globals[globalIndex]); err != nil {
 				return err
 			}
-		case code.OpArray:
+		case code.OpArray, code.OpTuple, code.OpHash:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
-			array := vm.buildArray(vm.sp-numElements, vm.sp)
-			vm.sp = vm.sp - numElements
-			// clear the stack between sp and sp-numElements with nil
-			for i := vm.sp; i < vm.sp+numElements; i++ {
-				vm.stack[i] = nil
-			}
-			if err := vm.push(array); err != nil {
+			if err := vm.executeCollection(op, numElements); err != nil {
 				return err
 			}
-		case code.OpTuple:
-			numElements := int(code.ReadUint16(ins[ip+1:]))
+		case code.OpConcat:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
-			tpl := vm.buildTuple(vm.sp-numElements, vm.sp)
-			vm.sp = vm.sp - numElements
-			// clear the stack between sp and sp-numElements with nil
-			for i := vm.sp; i < vm.sp+numElements; i++ {
-				vm.stack[i] = nil
-			}
-			if err := vm.push(tpl); err != nil {
-				return err
-			}
-		case code.OpHash:
-			numElements := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
-			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
-			if err != nil {
-				return err
-			}
-			vm.sp -= numElements
-			if err = vm.push(hash); err != nil {
+			if err := vm.executeConcat(numParts); err != nil {
 				return err
 			}
 		case code.OpIndex:
@@ -216,128 +234,106 @@ func (vm *VM) Run() *exception.SharkError {
 			if err := vm.executeIndexAssign(left, index, value); err != nil {
 				return err
 			}
-		case code.OpCall:
+		case code.OpCall, code.OpTailCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			if err := vm.executeCall(int(numArgs)); err != nil {
+			if err := vm.call(op, int(numArgs)); err != nil {
 				return err
 			}
 		case code.OpReturnValue:
 			if vm.currentFrame().basePointer == 0 {
 				return newSharkError(exception.SharkErrorTopLeverReturn)
 			}
-			returnValue := vm.pop()
-			frame := vm.popFrame()
-			// clear the stack between sp and basePointer with nil
-			for i := vm.sp; i < frame.basePointer; i++ {
-				vm.stack[i] = nil
-			}
-			vm.sp = frame.basePointer - 1
-			if err := vm.push(returnValue); err != nil {
+			if err := vm.returnValue(vm.pop()); err != nil {
 				return err
 			}
-			// cache the result if applicable
-			if frame.canCache {
-				vm.cache.Add(frame.cacheKey, returnValue)
-			}
 		case code.OpReturn:
+			if vm.profiler != nil {
+				vm.profiler.leave()
+			}
 			frame := vm.popFrame()
 			// clear the stack between sp and basePointer with nil
 			for i := vm.sp; i < frame.basePointer; i++ {
-				vm.stack[i] = nil
+				vm.stack[i] = Value{}
 			}
 			vm.sp = frame.basePointer - 1
-			if err := vm.push(Null); err != nil {
+			if err := vm.push(nullValue); err != nil {
 				return err
 			}
 		case code.OpTupleDeconstruct:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
-			tpl := vm.pop()
-			tuple, ok := tpl.(*object.Tuple)
-			if !ok {
-				return newSharkError(exception.SharkErrorMismatchedTypes, tpl.Type(), "Tuple")
-			}
-			if len(tuple.Elements) != numElements {
-				return newSharkError(exception.SharkErrorTupleDeconstructMismatch, len(tuple.Elements), numElements)
-			}
-			for i := numElements - 1; i >= 0; i-- {
-				if err := vm.push(tuple.Elements[i]); err != nil {
-					return err
-				}
+			if err := vm.executeTupleDeconstruct(numElements); err != nil {
+				return err
 			}
 		case code.OpSpread:
-			operand := vm.pop()
+			operand := vm.pop().toObject()
 			strObj, ok := operand.(*object.String)
 			if !ok {
 				return newSharkError(exception.SharkErrorMismatchedTypes, operand.Type(), "String")
 			}
-			str := strObj.Value
-			elements := make([]object.Object, 0, len(str))
-			for _, c := range str {
-				elements = append(elements, &object.String{Value: string(c)})
-			}
-			if err := vm.push(&object.Array{Elements: elements}); err != nil {
+			if err := vm.push(objectValue(&object.Array{Elements: strObj.Chars()})); err != nil {
 				return err
 			}
 		case code.OpRange:
-			endObj := vm.pop()
-			startObj := vm.pop()
+			end := vm.pop()
+			start := vm.pop()
 
-			endInt, endOk := endObj.(*object.Int64)
-			startInt, startOk := startObj.(*object.Int64)
-
-			if !startOk || !endOk {
+			if !start.isInt() || !end.isInt() {
 				return newSharkError(exception.SharkErrorMismatchedTypes, "Integer", "Integer")
 			}
 
-			startVal := startInt.Value
-			endVal := endInt.Value
+			startVal := start.num
+			endVal := end.num
 
 			var elements []object.Object
 			if startVal > endVal {
 				elements = make([]object.Object, startVal-endVal+1)
 				for i, v := startVal, 0; i >= endVal; i, v = i-1, v+1 {
-					elements[v] = &object.Int64{Value: i}
+					elements[v] = object.NewInt64(i)
 				}
 			} else {
 				elements = make([]object.Object, endVal-startVal+1)
 				for i, v := startVal, 0; i <= endVal; i, v = i+1, v+1 {
-					elements[v] = &object.Int64{Value: i}
+					elements[v] = object.NewInt64(i)
 				}
 			}
 
-			if err := vm.push(&object.Array{Elements: elements}); err != nil {
+			if err := vm.push(objectValue(&object.Array{Elements: elements})); err != nil {
 				return err
 			}
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			frame := vm.currentFrame()
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			*vm.local(int(localIndex)) = vm.pop()
 		case code.OpSetLocalDefault:
-			if vm.sp == 0 {
-				return newSharkError(exception.SharkErrorNoDefaultValue)
-			}
-			// only set the local if the local's value is null
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			frame := vm.currentFrame()
-			if vm.stack[frame.basePointer+int(localIndex)] == nil {
-				vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			if err := vm.setLocalDefault(int(localIndex)); err != nil {
+				return err
 			}
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			frame := vm.currentFrame()
-			if err := vm.push(vm.stack[frame.basePointer+int(localIndex)]); err != nil {
+			if err := vm.pushSlot(vm.local(int(localIndex))); err != nil {
+				return err
+			}
+		case code.OpGetLocal0, code.OpGetLocal1, code.OpGetLocal2, code.OpGetLocal3:
+			if err := vm.pushSlot(vm.local(int(op - code.OpGetLocal0))); err != nil {
+				return err
+			}
+		case code.OpAddLocalConst, code.OpSubLocalConst:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			constIndex := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+			if err := vm.executeLocalConstOperation(op, *vm.local(int(localIndex)), objectValue(vm.constants[constIndex])); err != nil {
 				return err
 			}
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			definition := object.Builtins[builtinIndex]
-			if err := vm.push(definition.Builtin); err != nil {
+			if err := vm.push(objectValue(definition.Builtin)); err != nil {
 				return err
 			}
 		case code.OpClosure:
@@ -351,12 +347,16 @@ func (vm *VM) Run() *exception.SharkError {
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			currentClosure := vm.currentFrame().cl
-			if err := vm.push(currentClosure.Free[freeIndex]); err != nil {
+			if err := vm.push(objectValue(currentClosure.Free[freeIndex])); err != nil {
+				return err
+			}
+		case code.OpWide:
+			if err := vm.executeWide(ins, ip); err != nil {
 				return err
 			}
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
-			if err := vm.push(currentClosure); err != nil {
+			if err := vm.push(objectValue(currentClosure)); err != nil {
 				return err
 			}
 		}
@@ -365,6 +365,239 @@ func (vm *VM) Run() *exception.SharkError {
 	return nil
 }
 
+// Runs the instruction prefixed by the OpWide at ip, whose operands are twice as wide.
+func (vm *VM) executeWide(ins code.Instructions, ip int) *exception.SharkError {
+	in, err := code.ReadInstruction(ins[ip:])
+	if err != nil {
+		return newSharkError(exception.SharkErrorInvalidOpcode, byte(in.Op), ip)
+	}
+	vm.currentFrame().ip += in.Size - 1
+	operand := in.Operands[0]
+
+	switch in.Op {
+	case code.OpConstant:
+		return vm.push(objectValue(vm.constants[operand]))
+	case code.OpJump:
+		if vm.interrupted.Load() {
+			return newSharkError(exception.SharkErrorVMInterrupted)
+		}
+		vm.currentFrame().ip = operand - 1
+	case code.OpJumpNotTruthy:
+		vm.jumpNotTruthy(ip, operand)
+	case code.OpGetGlobal:
+		return vm.pushSlot(&vm.globals[operand])
+	case code.OpSetGlobal:
+		vm.globals[operand] = vm.pop()
+	case code.OpIncrementGlobal:
+		return step(&vm.globals[operand], 1, exception.SharkErrorNonNumberIncrement)
+	case code.OpDecrementGlobal:
+		return step(&vm.globals[operand], -1, exception.SharkErrorNonNumberDecrement)
+	case code.OpGetLocal:
+		return vm.pushSlot(vm.local(operand))
+	case code.OpSetLocal:
+		*vm.local(operand) = vm.pop()
+	case code.OpSetLocalDefault:
+		return vm.setLocalDefault(operand)
+	case code.OpIncrementLocal:
+		return step(vm.local(operand), 1, exception.SharkErrorNonNumberIncrement)
+	case code.OpDecrementLocal:
+		return step(vm.local(operand), -1, exception.SharkErrorNonNumberIncrement)
+	case code.OpArray, code.OpTuple, code.OpHash:
+		return vm.executeCollection(in.Op, operand)
+	case code.OpConcat:
+		return vm.executeConcat(operand)
+	case code.OpTupleDeconstruct:
+		return vm.executeTupleDeconstruct(operand)
+	case code.OpCall, code.OpTailCall:
+		return vm.call(in.Op, operand)
+	case code.OpGetBuiltin:
+		return vm.push(objectValue(object.Builtins[operand].Builtin))
+	case code.OpClosure:
+		return vm.pushClosure(operand, in.Operands[1])
+	case code.OpGetFree:
+		return vm.push(objectValue(vm.currentFrame().cl.Free[operand]))
+	case code.OpAddLocalConst, code.OpSubLocalConst:
+		return vm.executeLocalConstOperation(in.Op, *vm.local(operand), objectValue(vm.constants[in.Operands[1]]))
+	case code.OpJumpIfLocalNotLess, code.OpJumpIfLocalNotGreater:
+		return vm.jumpIfNot(in.Op, ip, *vm.local(operand), *vm.local(in.Operands[1]), in.Operands[2])
+	case code.OpJumpIfLocalNotEqualConst:
+		return vm.jumpIfNot(in.Op, ip, *vm.local(operand), objectValue(vm.constants[in.Operands[1]]), in.Operands[2])
+	}
+	return nil
+}
+
+// Returns the slot of a local of the current frame.
+func (vm *VM) local(index int) *Value {
+	return &vm.stack[vm.currentFrame().basePointer+index]
+}
+
+// Pushes the value of a global or a local. Compiled code never reads one before setting it,
+// but bytecode written by hand can.
+func (vm *VM) pushSlot(slot *Value) *exception.SharkError {
+	if slot.isEmpty() {
+		return newSharkError(exception.SharkErrorUnsetVariable)
+	}
+	return vm.push(*slot)
+}
+
+// Adds delta to the integer in a slot, in place.
+func step(slot *Value, delta int64, errCode exception.SharkErrorCode) *exception.SharkError {
+	if !slot.isInt() {
+		if slot.isEmpty() {
+			return newSharkError(exception.SharkErrorUnsetVariable)
+		}
+		return newSharkError(errCode, slot.toObject().Type())
+	}
+	slot.num += delta
+	return nil
+}
+
+// Pops the condition of the jump at ip and jumps to pos when it is not truthy.
+func (vm *VM) jumpNotTruthy(ip, pos int) {
+	vm.jumpUnless(ip, pos, isTruthy(vm.pop()))
+}
+
+// Jumps to pos when the condition tested by the jump at ip is false.
+func (vm *VM) jumpUnless(ip, pos int, condition bool) {
+	if vm.coverage != nil {
+		vm.coverage.branch(vm.currentFrame().cl.Fn, ip, condition)
+	}
+	if !condition {
+		vm.currentFrame().ip = pos - 1
+	}
+}
+
+// The instruction each superinstruction ends with or jumps on the result of.
+var superOperators = map[code.Opcode]code.Opcode{
+	code.OpAddLocalConst:            code.OpAdd,
+	code.OpSubLocalConst:            code.OpSub,
+	code.OpJumpIfLocalNotLess:       code.OpLessThan,
+	code.OpJumpIfLocalNotGreater:    code.OpGreaterThan,
+	code.OpJumpIfLocalNotEqualConst: code.OpEqual,
+}
+
+// Runs the comparison of the jump op at ip on two values, and jumps to pos when it is false.
+// Values other than integers are compared like by the comparison instruction itself.
+func (vm *VM) jumpIfNot(op code.Opcode, ip int, left, right Value, pos int) *exception.SharkError {
+	if left.isInt() && right.isInt() {
+		switch op {
+		case code.OpJumpIfLocalNotLess:
+			vm.jumpUnless(ip, pos, left.num < right.num)
+		case code.OpJumpIfLocalNotGreater:
+			vm.jumpUnless(ip, pos, left.num > right.num)
+		default:
+			vm.jumpUnless(ip, pos, left.num == right.num)
+		}
+		return nil
+	}
+
+	if err := vm.pushAll(left, right); err != nil {
+		return err
+	}
+	if err := vm.executeComparison(superOperators[op]); err != nil {
+		return err
+	}
+	vm.jumpNotTruthy(ip, pos)
+	return nil
+}
+
+// Pushes the result of adding a constant to a local, or of subtracting it.
+func (vm *VM) executeLocalConstOperation(op code.Opcode, left, right Value) *exception.SharkError {
+	if left.isInt() && right.isInt() {
+		if op == code.OpAddLocalConst {
+			return vm.push(intValue(left.num + right.num))
+		}
+		return vm.push(intValue(left.num - right.num))
+	}
+
+	if err := vm.pushAll(left, right); err != nil {
+		return err
+	}
+	return vm.executeBinaryOperation(superOperators[op])
+}
+
+func (vm *VM) setLocalDefault(index int) *exception.SharkError {
+	if vm.sp == 0 {
+		return newSharkError(exception.SharkErrorNoDefaultValue)
+	}
+	// only set the local if the local's value is null, the default value is always
+	// popped so the stack has the same depth whether the argument was given or not
+	defaultValue := vm.pop()
+	if vm.local(index).isEmpty() {
+		*vm.local(index) = defaultValue
+	}
+	return nil
+}
+
+// Replaces the numElements values on top of the stack with the array, tuple or hash made of them.
+func (vm *VM) executeCollection(op code.Opcode, numElements int) *exception.SharkError {
+	var collection object.Object
+	switch op {
+	case code.OpArray:
+		collection = vm.buildArray(vm.sp-numElements, vm.sp)
+	case code.OpTuple:
+		collection = vm.buildTuple(vm.sp-numElements, vm.sp)
+	default:
+		hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+		if err != nil {
+			return err
+		}
+		collection = hash
+	}
+	vm.sp = vm.sp - numElements
+	// clear the stack between sp and sp-numElements with nil
+	for i := vm.sp; i < vm.sp+numElements; i++ {
+		vm.stack[i] = Value{}
+	}
+	return vm.push(objectValue(collection))
+}
+
+// Replaces the numParts values on top of the stack with the string they make, each value is
+// written the way puts prints it.
+func (vm *VM) executeConcat(numParts int) *exception.SharkError {
+	var out strings.Builder
+	for i := vm.sp - numParts; i < vm.sp; i++ {
+		if vm.stack[i].isEmpty() {
+			return newSharkError(exception.SharkErrorUnsetVariable)
+		}
+		out.WriteString(vm.stack[i].toObject().Inspect())
+		vm.stack[i] = Value{}
+	}
+	vm.sp = vm.sp - numParts
+	return vm.push(objectValue(&object.String{Value: out.String()}))
+}
+
+func (vm *VM) executeTupleDeconstruct(numElements int) *exception.SharkError {
+	tpl := vm.pop().toObject()
+	tuple, ok := tpl.(*object.Tuple)
+	if !ok {
+		return newSharkError(exception.SharkErrorMismatchedTypes, tpl.Type(), "Tuple")
+	}
+	if len(tuple.Elements) != numElements {
+		return newSharkError(exception.SharkErrorTupleDeconstructMismatch, len(tuple.Elements), numElements)
+	}
+	for i := numElements - 1; i >= 0; i-- {
+		if err := vm.push(objectValue(tuple.Elements[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs an OpCall or an OpTailCall.
+func (vm *VM) call(op code.Opcode, numArgs int) *exception.SharkError {
+	if vm.interrupted.Load() {
+		return newSharkError(exception.SharkErrorVMInterrupted)
+	}
+	if op == code.OpCall {
+		return vm.executeCall(numArgs)
+	}
+	if vm.currentFrame().basePointer == 0 {
+		return newSharkError(exception.SharkErrorTopLeverReturn)
+	}
+	return vm.executeTailCall(numArgs)
+}
+
 func (vm *VM) pushClosure(constIndex, numFree int) *exception.SharkError {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
@@ -375,27 +608,57 @@ func (vm *VM) pushClosure(constIndex, numFree int) *exception.SharkError {
 	free := make([]object.Object, numFree)
 
 	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
+		free[i] = vm.stack[vm.sp-numFree+i].toObject()
 	}
 	vm.sp = vm.sp - numFree
 
 	closure := &object.Closure{Fn: function, Free: free}
 
-	return vm.push(closure)
+	return vm.push(objectValue(closure))
 }
 
-func (vm *VM) push(o object.Object) *exception.SharkError {
-	if vm.sp >= vm.conf.StackSize {
-		return newSharkError(exception.SharkErrorVMStackOverflow)
+func (vm *VM) push(v Value) *exception.SharkError {
+	if vm.sp >= len(vm.stack) {
+		if err := vm.reserve(vm.sp + 1); err != nil {
+			return err
+		}
 	}
 
-	vm.stack[vm.sp] = o
+	vm.stack[vm.sp] = v
 	vm.sp++
 
 	return nil
 }
 
-func (vm *VM) pop() object.Object {
+// Grows the stack to hold size values, up to the size of the stack of the configuration.
+func (vm *VM) reserve(size int) *exception.SharkError {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > vm.conf.StackSize {
+		return newSharkError(exception.SharkErrorVMStackOverflow)
+	}
+	stack := make([]Value, min(max(size, 2*len(vm.stack)), vm.conf.StackSize))
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
+}
+
+// Pushes the values in order, like the instructions a superinstruction stands for would. The
+// locals it reads can be unset like the ones read by OpGetLocal.
+func (vm *VM) pushAll(values ...Value) *exception.SharkError {
+	for _, value := range values {
+		if value.isEmpty() {
+			return newSharkError(exception.SharkErrorUnsetVariable)
+		}
+		if err := vm.push(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (vm *VM) pop() Value {
 	o := vm.stack[vm.sp-1]
 	vm.sp--
 	return o
@@ -405,45 +668,57 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) *exception.SharkError {
 	right := vm.pop()
 	left := vm.pop()
 
-	switch leftValue := left.(type) {
+	if left.isInt() && right.isInt() {
+		return vm.executeBinaryIntegerOperation(op, left.num, right.num)
+	}
+
+	switch leftValue := left.toObject().(type) {
 	case *object.Int64:
-		switch rightValue := right.(type) {
-		case *object.Int64:
-			var result int64
-			switch op {
-			case code.OpAdd:
-				result = leftValue.Value + rightValue.Value
-			case code.OpSub:
-				result = leftValue.Value - rightValue.Value
-			case code.OpMul:
-				result = leftValue.Value * rightValue.Value
-			case code.OpDiv:
-				if rightValue.Value == 0 {
-					return newSharkError(exception.SharkErrorDivisionByZero)
-				}
-				result = leftValue.Value / rightValue.Value
-			case code.OpPower:
-				result = intPow(leftValue.Value, rightValue.Value)
-			default:
-				return newSharkError(exception.SharkErrorUnknownOperator, op)
-			}
-			vm.push(&object.Int64{Value: result})
-			return nil
-		default:
-			return newSharkError(exception.SharkErrorMismatchedTypes, "Integer", right.Type().SharkTypeString())
-		}
+		return newSharkError(exception.SharkErrorMismatchedTypes, "Integer", right.toObject().Type().SharkTypeString())
 	case *object.String:
-		switch rightValue := right.(type) {
+		switch rightValue := right.toObject().(type) {
 		case *object.String:
 			return vm.executeBinaryStringOperation(op, leftValue, rightValue)
+		case *object.Char:
+			return vm.executeBinaryStringOperation(op, leftValue, &object.String{Value: rightValue.Inspect()})
+		default:
+			return newSharkError(exception.SharkErrorMismatchedTypes, "String", rightValue.Type().SharkTypeString())
+		}
+	case *object.Char:
+		// A char is only added to a string, which gives a string
+		switch rightValue := right.toObject().(type) {
+		case *object.String:
+			return vm.executeBinaryStringOperation(op, &object.String{Value: leftValue.Inspect()}, rightValue)
 		default:
-			return newSharkError(exception.SharkErrorMismatchedTypes, "String", right.Type().SharkTypeString())
+			return newSharkError(exception.SharkErrorMismatchedTypes, "String", rightValue.Type().SharkTypeString())
 		}
 	default:
-		return newSharkError(exception.SharkErrorUnknownType, left.Type().SharkTypeString())
+		return newSharkError(exception.SharkErrorUnknownType, leftValue.Type().SharkTypeString())
 	}
 }
 
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right int64) *exception.SharkError {
+	var result int64
+	switch op {
+	case code.OpAdd:
+		result = left + right
+	case code.OpSub:
+		result = left - right
+	case code.OpMul:
+		result = left * right
+	case code.OpDiv:
+		if right == 0 {
+			return newSharkError(exception.SharkErrorDivisionByZero)
+		}
+		result = left / right
+	case code.OpPower:
+		result = intPow(left, right)
+	default:
+		return newSharkError(exception.SharkErrorUnknownOperator, op)
+	}
+	return vm.push(intValue(result))
+}
+
 func intPow(a, b int64) int64 {
 	result := int64(1)
 	for b > 0 {
@@ -460,55 +735,56 @@ func (vm *VM) executeComparison(op code.Opcode) *exception.SharkError {
 	right := vm.pop()
 	left := vm.pop()
 
-	switch leftVal := left.(type) {
-	case *object.Int64:
-		if rightVal, ok := right.(*object.Int64); ok {
-			return vm.executeIntegerComparison(op, leftVal, rightVal)
-		}
-	case *object.Boolean:
-		if rightVal, ok := right.(*object.Boolean); ok {
-			return vm.executeBooleanComparison(op, leftVal, rightVal)
-		}
+	switch {
+	case left.isInt() && right.isInt():
+		return vm.executeIntegerComparison(op, left.num, right.num)
+	case left.isBool() && right.isBool():
+		return vm.executeBooleanComparison(op, left.num != 0, right.num != 0)
+	}
+
+	switch leftVal := left.obj.(type) {
 	case *object.String:
-		if rightVal, ok := right.(*object.String); ok {
+		if rightVal, ok := right.obj.(*object.String); ok {
 			return vm.executeStringComparison(op, leftVal, rightVal)
 		}
+	case *object.Char:
+		if rightVal, ok := right.obj.(*object.Char); ok {
+			return vm.executeCharComparison(op, leftVal, rightVal)
+		}
 	}
 
-	return newSharkError(exception.SharkErrorMismatchedTypes, left.Type().SharkTypeString(), right.Type().SharkTypeString())
+	return newSharkError(exception.SharkErrorMismatchedTypes, left.toObject().Type().SharkTypeString(), right.toObject().Type().SharkTypeString())
 }
 
-func (vm *VM) executeBooleanComparison(op code.Opcode, left, right object.Object) *exception.SharkError {
-	leftValue := left.(*object.Boolean).Value
-	rightValue := right.(*object.Boolean).Value
-
+func (vm *VM) executeBooleanComparison(op code.Opcode, leftValue, rightValue bool) *exception.SharkError {
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(boolValue(rightValue == leftValue))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(boolValue(rightValue != leftValue))
 	case code.OpAnd:
-		return vm.push(nativeBoolToBooleanObject(leftValue && rightValue))
+		return vm.push(boolValue(leftValue && rightValue))
 	case code.OpOr:
-		return vm.push(nativeBoolToBooleanObject(leftValue || rightValue))
+		return vm.push(boolValue(leftValue || rightValue))
 	default:
 		return newSharkError(exception.SharkErrorUnknownBoolOperator, op)
 	}
 }
 
-func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) *exception.SharkError {
-	leftValue := left.(*object.Int64).Value
-	rightValue := right.(*object.Int64).Value
-
+func (vm *VM) executeIntegerComparison(op code.Opcode, leftValue, rightValue int64) *exception.SharkError {
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+		return vm.push(boolValue(rightValue == leftValue))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+		return vm.push(boolValue(rightValue != leftValue))
 	case code.OpGreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		return vm.push(boolValue(leftValue > rightValue))
 	case code.OpGreaterThanEqual:
-		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+		return vm.push(boolValue(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(boolValue(leftValue < rightValue))
+	case code.OpLessThanEqual:
+		return vm.push(boolValue(leftValue <= rightValue))
 	default:
 		return newSharkError(exception.SharkErrorUnknownOperator, op)
 	}
@@ -520,37 +796,53 @@ func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object)
 
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+		return vm.push(boolValue(rightValue == leftValue))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+		return vm.push(boolValue(rightValue != leftValue))
 	default:
 		return newSharkError(exception.SharkErrorUnknownStringOperator, op)
 	}
 }
 
+// Chars are ordered by their code point.
+func (vm *VM) executeCharComparison(op code.Opcode, left, right object.Object) *exception.SharkError {
+	leftValue := left.(*object.Char).Value
+	rightValue := right.(*object.Char).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(boolValue(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(boolValue(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(boolValue(leftValue > rightValue))
+	case code.OpGreaterThanEqual:
+		return vm.push(boolValue(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(boolValue(leftValue < rightValue))
+	case code.OpLessThanEqual:
+		return vm.push(boolValue(leftValue <= rightValue))
+	default:
+		return newSharkError(exception.SharkErrorUnknownOperator, op)
+	}
+}
+
 func (vm *VM) executeBangOperator() *exception.SharkError {
 	operand := vm.pop()
 
-	switch operand {
-	case True:
-		return vm.push(False)
-	case False, Null:
-		return vm.push(True)
-	default:
-		return vm.push(False)
+	if operand.isBool() {
+		return vm.push(boolValue(operand.num == 0))
 	}
+	return vm.push(boolValue(operand.obj == Null))
 }
 
 func (vm *VM) executeMinusOperator() *exception.SharkError {
 	operand := vm.pop()
-	obj, ok := operand.(*object.Int64)
-	if !ok {
-		return newSharkError(exception.SharkErrorMismatchedTypes, operand.Type().SharkTypeString())
+	if !operand.isInt() {
+		return newSharkError(exception.SharkErrorMismatchedTypes, operand.toObject().Type().SharkTypeString())
 	}
 
-	value := obj.Value
-
-	return vm.push(&object.Int64{Value: -value})
+	return vm.push(intValue(-operand.num))
 }
 
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) *exception.SharkError {
@@ -561,14 +853,14 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	return vm.push(objectValue(&object.String{Value: leftValue + rightValue}))
 }
 
 func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 	elements := make([]object.Object, endIndex-startIndex)
 
 	for i := startIndex; i < endIndex; i++ {
-		elements[i-startIndex] = vm.stack[i]
+		elements[i-startIndex] = vm.stack[i].toObject()
 	}
 
 	return &object.Array{Elements: elements}
@@ -578,7 +870,7 @@ func (vm *VM) buildTuple(startIndex, endIndex int) object.Object {
 	elements := make([]object.Object, endIndex-startIndex)
 
 	for i := startIndex; i < endIndex; i++ {
-		elements[i-startIndex] = vm.stack[i]
+		elements[i-startIndex] = vm.stack[i].toObject()
 	}
 
 	return &object.Tuple{Elements: elements}
@@ -588,8 +880,8 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *exception.Sha
 	hashedPairs := make(map[object.HashKey]object.HashPair)
 
 	for i := startIndex; i < endIndex; i += 2 {
-		key := vm.stack[i]
-		value := vm.stack[i+1]
+		key := vm.stack[i].toObject()
+		value := vm.stack[i+1].toObject()
 
 		pair := object.HashPair{Key: key, Value: value}
 
@@ -608,63 +900,55 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *exception.Sha
 	return &object.Hash{Pairs: hashedPairs}, nil
 }
 
-func (vm *VM) executeIndexExpression(left, index object.Object) *exception.SharkError {
-	switch left := left.(type) {
+func (vm *VM) executeIndexExpression(left, index Value) *exception.SharkError {
+	switch leftObj := left.obj.(type) {
 	case *object.Array:
-		if index, ok := index.(*object.Int64); ok {
-			return vm.executeArrayIndex(left, index)
+		if index.isInt() {
+			return vm.executeArrayIndex(leftObj, index.num)
 		}
-		return newSharkError(exception.SharkErrorNonIndexable, left.Type().SharkTypeString())
+		return newSharkError(exception.SharkErrorNonIndexable, leftObj.Type().SharkTypeString())
 	case *object.String:
-		if index, ok := index.(*object.Int64); ok {
-			return vm.executeStringIndex(left, index)
+		if index.isInt() {
+			return vm.executeStringIndex(leftObj, index.num)
 		}
-		return newSharkError(exception.SharkErrorNonIndexable, left.Type().SharkTypeString())
+		return newSharkError(exception.SharkErrorNonIndexable, leftObj.Type().SharkTypeString())
 	case *object.Tuple:
-		if index, ok := index.(*object.Int64); ok {
-			return vm.executeTupleIndex(left, index)
+		if index.isInt() {
+			return vm.executeTupleIndex(leftObj, index.num)
 		}
-		return newSharkError(exception.SharkErrorNonIndexable, left.Type().SharkTypeString())
+		return newSharkError(exception.SharkErrorNonIndexable, leftObj.Type().SharkTypeString())
 	case *object.Hash:
-		return vm.executeHashIndex(left, index)
+		return vm.executeHashIndex(leftObj, index.toObject())
 	default:
-		return newSharkError(exception.SharkErrorNonIndexable, left.Type().SharkTypeString())
+		return newSharkError(exception.SharkErrorNonIndexable, left.toObject().Type().SharkTypeString())
 	}
 }
 
-func (vm *VM) executeArrayIndex(array, index object.Object) *exception.SharkError {
-	arrayObject := array.(*object.Array)
-	i := index.(*object.Int64).Value
+func (vm *VM) executeArrayIndex(arrayObject *object.Array, i int64) *exception.SharkError {
 	m := int64(len(arrayObject.Elements) - 1)
 
 	if i < 0 || i > m {
-		return vm.push(Null)
+		return vm.push(nullValue)
 	}
 
-	return vm.push(arrayObject.Elements[i])
+	return vm.push(objectValue(arrayObject.Elements[i]))
 }
 
-func (vm *VM) executeStringIndex(str, index object.Object) *exception.SharkError {
-	strObject := str.(*object.String)
-	i := index.(*object.Int64).Value
-	m := int64(len(strObject.Value) - 1)
-
-	if i < 0 || i > m {
-		return vm.push(Null)
+func (vm *VM) executeStringIndex(str *object.String, i int64) *exception.SharkError {
+	char, ok := str.CharAt(i)
+	if !ok {
+		return vm.push(nullValue)
 	}
 
-	return vm.push(&object.String{Value: string(strObject.Value[i])})
+	return vm.push(objectValue(char))
 }
 
-func (vm *VM) executeTupleIndex(tpl, index object.Object) *exception.SharkError {
-	tplObject := tpl.(*object.Tuple)
-	i := index.(*object.Int64).Value
-
+func (vm *VM) executeTupleIndex(tplObject *object.Tuple, i int64) *exception.SharkError {
 	if i < 0 || i >= int64(len(tplObject.Elements)) {
-		return vm.push(Null)
+		return vm.push(nullValue)
 	}
 
-	return vm.push(tplObject.Elements[i])
+	return vm.push(objectValue(tplObject.Elements[i]))
 }
 
 func (vm *VM) executeHashIndex(hash, index object.Object) *exception.SharkError {
@@ -677,37 +961,33 @@ func (vm *VM) executeHashIndex(hash, index object.Object) *exception.SharkError
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
-		return vm.push(Null)
+		return vm.push(nullValue)
 	}
 
-	return vm.push(pair.Value)
+	return vm.push(objectValue(pair.Value))
 }
 
-func (vm *VM) executeIndexAssign(left, index, value object.Object) *exception.SharkError {
-	switch left := left.(type) {
+func (vm *VM) executeIndexAssign(left, index, value Value) *exception.SharkError {
+	switch leftObj := left.obj.(type) {
 	case *object.Array:
-		switch index := index.(type) {
-		case *object.Int64:
-			return vm.executeArrayIndexAssign(left, index, value)
-		default:
-			return newSharkError(exception.SharkErrorNonIndexable, index.Type().SharkTypeString())
+		if !index.isInt() {
+			return newSharkError(exception.SharkErrorNonIndexable, index.toObject().Type().SharkTypeString())
 		}
+		return vm.executeArrayIndexAssign(leftObj, index.num, value.toObject())
 	case *object.Hash:
-		return vm.executeHashIndexAssign(left, index, value)
+		return vm.executeHashIndexAssign(leftObj, index.toObject(), value.toObject())
 	default:
-		return newSharkError(exception.SharkErrorNonIndexable, left.Type().SharkTypeString())
+		return newSharkError(exception.SharkErrorNonIndexable, left.toObject().Type().SharkTypeString())
 	}
 }
 
-func (vm *VM) executeArrayIndexAssign(array, index, value object.Object) *exception.SharkError {
-	arrayObject := array.(*object.Array)
-	i := index.(*object.Int64).Value
+func (vm *VM) executeArrayIndexAssign(arrayObject *object.Array, i int64, value object.Object) *exception.SharkError {
 	m := int64(len(arrayObject.Elements) - 1)
 	if i < 0 || i > m {
 		return newSharkError(exception.SharkErrorIndexOutOfBounds, i)
 	}
 	arrayObject.Elements[i] = value
-	return vm.push(arrayObject)
+	return vm.push(objectValue(arrayObject))
 }
 
 func (vm *VM) executeHashIndexAssign(hash, index, value object.Object) *exception.SharkError {
@@ -717,7 +997,7 @@ func (vm *VM) executeHashIndexAssign(hash, index, value object.Object) *exceptio
 		return newSharkError(exception.SharkErrorNonHashable, index.Type().SharkTypeString())
 	}
 	hashObject.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
-	return vm.push(hashObject)
+	return vm.push(objectValue(hashObject))
 }
 
 func (vm *VM) currentFrame() *Frame {
@@ -740,33 +1020,39 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return False
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj := obj.(type) {
-
-	case *object.Boolean:
-		return obj.Value
-
-	case *object.Null:
-		return false
-
-	default:
-		return true
+func isTruthy(value Value) bool {
+	if value.isBool() {
+		return value.num != 0
 	}
+	_, isNull := value.obj.(*object.Null)
+	return !isNull
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *exception.SharkError {
-	args := vm.stack[vm.sp-numArgs : vm.sp]
+	args := toObjects(vm.stack[vm.sp-numArgs : vm.sp])
 
-	result := builtin.Fn(args...)
+	var result object.Object
+	if builtin == assertThrows {
+		var err *exception.SharkError
+		if result, err = vm.assertThrows(args[0]); err != nil {
+			return err
+		}
+	} else {
+		result = builtin.Fn(args...)
+	}
+
+	if failure, ok := result.(*object.AssertionError); ok {
+		return assertionError(failure)
+	}
 
 	vm.sp = vm.sp - numArgs - 1
 
 	if result != nil {
-		if err := vm.push(result); err != nil {
+		if err := vm.push(objectValue(result)); err != nil {
 			return err
 		}
 	} else {
-		if err := vm.push(Null); err != nil {
+		if err := vm.push(nullValue); err != nil {
 			return err
 		}
 	}
@@ -774,6 +1060,53 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *exception.Shark
 	return nil
 }
 
+// Calls a function without arguments in a VM of its own, sharing the constants and globals, and
+// returns an assertion error unless the call fails or returns an error value.
+func (vm *VM) assertThrows(fn object.Object) (object.Object, *exception.SharkError) {
+	sub := &VM{
+		conf:        vm.conf,
+		cache:       vm.memoCache(),
+		constants:   vm.constants,
+		stack:       make([]Value, min(initialStackSize, vm.conf.StackSize)),
+		globals:     vm.globals,
+		frames:      make([]*Frame, vm.conf.MaxFrames),
+		interrupted: vm.interrupted,
+		coverage:    vm.coverage,
+		profiler:    vm.profiler,
+	}
+	// The main function of the VM only calls fn, which is at the bottom of the stack
+	main := &object.CompiledFunction{Instructions: code.Make(code.OpCall, 0)}
+	sub.frames[0] = NewFrame(&object.Closure{Fn: main}, 0)
+	sub.framesIndex = 1
+	sub.stack[0] = objectValue(fn)
+	sub.sp = 1
+
+	if vm.profiler != nil {
+		// The calls left running by an error in fn are ended when it returns
+		defer vm.profiler.unwind(len(vm.profiler.calls))
+	}
+	if err := sub.Run(); err != nil {
+		if err.ErrCode == exception.SharkErrorVMInterrupted {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if _, ok := sub.stack[0].obj.(*object.Error); ok {
+		return nil, nil
+	}
+	return &object.AssertionError{Message: "the function did not throw an error"}, nil
+}
+
+// Returns the runtime error of a failed assertion, the compared values are shown in the help
+// message with a marker under the first difference.
+func assertionError(failure *object.AssertionError) *exception.SharkError {
+	err := newSharkError(exception.SharkErrorAssertionFailed, failure.Message)
+	if failure.Expected != "" || failure.Actual != "" {
+		err.SetHelpMsg(exception.Diff(failure.Expected, failure.Actual))
+	}
+	return err
+}
+
 func (vm *VM) executeCall(numArgs int) *exception.SharkError {
 	callee := vm.stack[vm.sp-1-numArgs]
 
@@ -782,18 +1115,22 @@ func (vm *VM) executeCall(numArgs int) *exception.SharkError {
 	key, canCache := vm.createCacheKey(callee, args)
 
 	if canCache {
-		if result, ok := vm.cache.Get(key); ok {
+		result, ok := vm.memoCache().Get(key)
+		if vm.profiler != nil {
+			vm.profiler.cacheLookup(ok)
+		}
+		if ok {
 			// Pop the callee and arguments off the stack
 			vm.sp = vm.sp - numArgs - 1
 			// Push the cached result onto the stack
-			if err := vm.push(result); err != nil {
+			if err := vm.push(objectValue(result)); err != nil {
 				return err
 			}
 			return nil
 		}
 	}
 
-	switch callee := callee.(type) {
+	switch callee := callee.obj.(type) {
 	case *object.Closure:
 		cl := callee
 
@@ -806,7 +1143,7 @@ func (vm *VM) executeCall(numArgs int) *exception.SharkError {
 		}
 
 		if vm.framesIndex >= vm.conf.MaxFrames {
-			return newSharkError(exception.SharkErrorVMStackOverflow)
+			return newSharkError(exception.SharkErrorVMFrameStackOverflow)
 		}
 
 		frame := vm.frames[vm.framesIndex]
@@ -823,8 +1160,18 @@ func (vm *VM) executeCall(numArgs int) *exception.SharkError {
 
 		vm.framesIndex++
 		vm.currentFrame().ip = frame.ip
+		if vm.profiler != nil {
+			vm.profiler.enter(cl.Fn)
+		}
 
 		vm.sp = frame.basePointer + cl.Fn.NumLocals
+		if err := vm.reserve(vm.sp); err != nil {
+			return err
+		}
+		// clear the locals that are not arguments, so missing arguments are not read from a previous call
+		for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+			vm.stack[i] = Value{}
+		}
 
 		return nil
 
@@ -834,38 +1181,139 @@ func (vm *VM) executeCall(numArgs int) *exception.SharkError {
 		}
 		result := vm.stack[vm.sp-1]
 		if canCache {
-			vm.cache.Add(key, result)
+			vm.memoCache().Add(key, result.toObject())
 		}
 		return nil
 
 	default:
-		return newSharkError(exception.SharkErrorNonFunctionCall, callee.Type().SharkTypeString())
+		return newSharkError(exception.SharkErrorNonFunctionCall, vm.stack[vm.sp-1-numArgs].toObject().Type().SharkTypeString())
+	}
+}
+
+// Calls a function whose result the current function returns right away. A closure is run
+// in the frame of the current function instead of a new one, so recursion in tail position
+// runs in constant frame space.
+func (vm *VM) executeTailCall(numArgs int) *exception.SharkError {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	cl, ok := callee.obj.(*object.Closure)
+	if !ok {
+		// Builtins do not get a frame, their result is returned as soon as they are done
+		if err := vm.executeCall(numArgs); err != nil {
+			return err
+		}
+		return vm.returnValue(vm.pop())
+	}
+
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	key, canCache := vm.createCacheKey(callee, args)
+
+	if canCache {
+		result, ok := vm.memoCache().Get(key)
+		if vm.profiler != nil {
+			vm.profiler.cacheLookup(ok)
+		}
+		if ok {
+			return vm.returnValue(objectValue(result))
+		}
+	}
+
+	requiredArgs := cl.Fn.NumParameters
+	defaultArgs := cl.Fn.NumDefaults
+	minArgs := requiredArgs - defaultArgs
+
+	if numArgs < minArgs || numArgs > requiredArgs {
+		return newSharkError(exception.SharkErrorArgumentNumberMismatch, requiredArgs, numArgs)
+	}
+
+	frame := vm.currentFrame()
+
+	// The callee and the arguments replace those of the current call. The result is cached
+	// under the key of the call that created the frame, both calls have the same result.
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	if !frame.canCache {
+		frame.cacheKey = key
+		frame.canCache = canCache
 	}
+
+	frame.cl = cl
+	frame.ip = -1
+	if vm.profiler != nil {
+		vm.profiler.leave()
+		vm.profiler.enter(cl.Fn)
+	}
+
+	previousSp := vm.sp
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	if err := vm.reserve(vm.sp); err != nil {
+		return err
+	}
+	// clear the locals that are not arguments and what is left of the previous call
+	for i := frame.basePointer + numArgs; i < max(vm.sp, previousSp); i++ {
+		vm.stack[i] = Value{}
+	}
+
+	return nil
+}
+
+// Pops the current frame and pushes the value it returns for the caller.
+func (vm *VM) returnValue(returnValue Value) *exception.SharkError {
+	if vm.profiler != nil {
+		vm.profiler.leave()
+	}
+	frame := vm.popFrame()
+	// clear the stack between sp and basePointer with nil
+	for i := vm.sp; i < frame.basePointer; i++ {
+		vm.stack[i] = Value{}
+	}
+	vm.sp = frame.basePointer - 1
+	if err := vm.push(returnValue); err != nil {
+		return err
+	}
+	// cache the result if applicable
+	if frame.canCache {
+		vm.memoCache().Add(frame.cacheKey, returnValue.toObject())
+	}
+
+	return nil
+}
+
+// Returns the cache of the results of the memoized calls.
+func (vm *VM) memoCache() *expirable.LRU[string, object.Object] {
+	if vm.cache == nil {
+		vm.cache = expirable.NewLRU[string, object.Object](vm.conf.CacheSize, nil, time.Minute*5)
+	}
+	return vm.cache
 }
 
-func (vm *VM) createCacheKey(callee object.Object, args []object.Object) (string, bool) {
+func (vm *VM) createCacheKey(callee Value, args []Value) (string, bool) {
 	var keyBuilder strings.Builder
 
-	switch callee := callee.(type) {
+	switch callee := callee.obj.(type) {
 	case *object.Closure:
+		// Impure functions have to run on every call
+		if !callee.Fn.Memoizable() {
+			return "", false
+		}
 		keyBuilder.WriteString(fmt.Sprintf("%p", callee.Fn))
+		// Closures made from the same function can capture different values
+		keyBuilder.WriteString("[")
+		if !writeCacheKeyValues(&keyBuilder, callee.Free) {
+			return "", false
+		}
+		keyBuilder.WriteString("]")
 	case *object.Builtin:
 		if !callee.CanCache {
 			return "", false
 		}
 		keyBuilder.WriteString(fmt.Sprintf("%p", callee))
 	default:
-		keyBuilder.WriteString(fmt.Sprintf("%p", callee))
+		return "", false
 	}
 
 	keyBuilder.WriteString("(")
 	for i, arg := range args {
-		if i > 0 {
-			keyBuilder.WriteString(",")
-		}
-		if hashableArg, ok := arg.(object.Hashable); ok {
-			keyBuilder.WriteString(fmt.Sprintf("%s:%v", arg.Type().SharkTypeString(), hashableArg.HashKey()))
-		} else {
+		if !writeCacheKeyValue(&keyBuilder, i, arg.toObject()) {
 			return "", false
 		}
 	}
@@ -873,3 +1321,27 @@ func (vm *VM) createCacheKey(callee object.Object, args []object.Object) (string
 
 	return keyBuilder.String(), true
 }
+
+// Writes the hash keys of the values separated by commas, returns false if a value is not hashable.
+func writeCacheKeyValues(keyBuilder *strings.Builder, values []object.Object) bool {
+	for i, value := range values {
+		if !writeCacheKeyValue(keyBuilder, i, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Writes the hash key of the value at index i of a list separated by commas, returns false if it
+// is not hashable.
+func writeCacheKeyValue(keyBuilder *strings.Builder, i int, value object.Object) bool {
+	if i > 0 {
+		keyBuilder.WriteString(",")
+	}
+	hashable, ok := value.(object.Hashable)
+	if !ok {
+		return false
+	}
+	keyBuilder.WriteString(fmt.Sprintf("%s:%v", value.Type().SharkTypeString(), hashable.HashKey()))
+	return true
+}
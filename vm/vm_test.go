@@ -2,11 +2,18 @@ package vm
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"shark/ast"
+	"shark/bytecode"
+	"shark/code"
 	"shark/compiler"
+	"shark/config"
+	"shark/exception"
 	"shark/lexer"
 	"shark/object"
 	"shark/parser"
+	"strings"
 	"testing"
 )
 
@@ -234,24 +241,33 @@ func TestRangeOperator(t *testing.T) {
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
-	for _, tt := range tests {
-		program := parse(tt.input)
+	// The optimizations must not change what a program evaluates to
+	for _, level := range []compiler.OptimizationLevel{compiler.O0, compiler.O1, compiler.O2} {
+		for _, tt := range tests {
+			program := parse(tt.input)
 
-		comp := compiler.New()
+			comp := compiler.New()
+			comp.SetOptimizationLevel(level)
 
-		if err, _ := comp.Compile(program); err != nil {
-			t.Fatalf("compiler error: %+v", err)
-		}
+			if err, _ := comp.Compile(program); err != nil {
+				t.Fatalf("compiler error: %+v", err)
+			}
 
-		vm := NewDefault(comp.Bytecode())
+			conf := config.NewDefaultVmConf()
+			if err := bytecode.Verify(comp.Bytecode(), &conf); err != nil {
+				t.Fatalf("bytecode error at O%d: %s", level, err.Error())
+			}
 
-		if err := vm.Run(); err != nil {
-			t.Fatalf("vm error: %+v", err)
-		}
+			vm := NewDefault(comp.Bytecode())
 
-		stackElem := vm.LastPoppedStackElem()
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error at O%d: %+v", level, err)
+			}
 
-		testExpectedObject(t, tt.expected, stackElem)
+			stackElem := vm.LastPoppedStackElem()
+
+			testExpectedObject(t, tt.expected, stackElem)
+		}
 	}
 }
 
@@ -311,11 +327,15 @@ func TestIndexExpressions(t *testing.T) {
 
 	t.Run("should evaluate string index expressions", func(t *testing.T) {
 		tests := []vmTestCase{
-			{`"shark"[0]`, "s"},
-			{`"shark"[1]`, "h"},
-			{`"shark"[4]`, "k"},
+			{`"shark"[0]`, 's'},
+			{`"shark"[1]`, 'h'},
+			{`"shark"[4]`, 'k'},
 			{`"shark"[10]`, Null},
 			{`"shark"[-1]`, Null},
+			{`"héllo"[1]`, 'é'},
+			{`"héllo"[2]`, 'l'},
+			{`"🦈"[0]`, '🦈'},
+			{`"🦈"[1]`, Null},
 		}
 
 		runVmTests(t, tests)
@@ -632,15 +652,88 @@ func TestVariablePostfix(t *testing.T) {
 
 }
 
+func TestChars(t *testing.T) {
+	t.Run("should evaluate char literals", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`'a'`, 'a'},
+			{`'\n'`, '\n'},
+			{`'\u{1F988}'`, '🦈'},
+			{`let c: char = 'é'; c`, 'é'},
+			{`type('a')`, "char"},
+			{`"sh\u{e9}rk"`, "shérk"},
+		}
+
+		runVmTests(t, tests)
+	})
+
+	t.Run("should compare chars", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`'a' == 'a'`, true},
+			{`'a' != 'b'`, true},
+			{`'a' < 'b'`, true},
+			{`'b' <= 'a'`, false},
+			{`'é' > 'e'`, true},
+			{`"héllo"[1] == 'é'`, true},
+			{`let s = "abc"; let mut n = 0; let mut i = 0; while (i < len(s)) { if (s[i] >= 'b') { n += 1 }; i += 1; }; n`, 2},
+		}
+
+		runVmTests(t, tests)
+	})
+
+	t.Run("should add chars to strings", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`"sh" + 'a'`, "sha"},
+			{`'s' + "hark"`, "shark"},
+			{`let s: string = "caf" + 'é'; s`, "café"},
+		}
+
+		runVmTests(t, tests)
+	})
+
+	t.Run("should use chars as hash keys", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`{'a': 1, 'b': 2}['b']`, 2},
+			{`{'a': 1, "a": 2}['a']`, 1},
+		}
+
+		runVmTests(t, tests)
+	})
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	t.Run("should interpolate values in strings", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`let name = "Shark"; let age = 4; "Hello ${name}, you are ${age + 1}"`, "Hello Shark, you are 5"},
+			{`"${1}${'a'}${true}${[1, 2]}"`, "1atrue[1, 2]"},
+			{`let greet = (who: string): string => { "hi ${who}" }; "${greet("${'a'}b")}!"`, "hi ab!"},
+			{`let h = {"k": "v"}; "${h["k"]}"`, "v"},
+			{`"\${name}"`, "${name}"},
+			{`let f = (n: i64) => { "${n}" }; f(1) + f(2)`, "12"},
+		}
+
+		runVmTests(t, tests)
+	})
+
+	t.Run("should read raw strings as they are written", func(t *testing.T) {
+		tests := []vmTestCase{
+			{"`a\\n${b}`", "a\\n${b}"},
+			{"`line\nnext`", "line\nnext"},
+			{"len(`\n`)", 1},
+		}
+
+		runVmTests(t, tests)
+	})
+}
+
 func TestVariablePrefix(t *testing.T) {
-	t.Run("should spread string to character array", func(t *testing.T) {
+	t.Run("should spread string to char array", func(t *testing.T) {
 		tests := []vmTestCase{
 			{
 				input: `
-			let a = "shark";
-			[...a];
+			let a = "shårk";
+			...a;
 			`,
-				expected: []string{"s", "h", "a", "r", "k"},
+				expected: []rune{'s', 'h', 'å', 'r', 'k'},
 			},
 		}
 
@@ -846,6 +939,8 @@ func TestBuiltinFunctions(t *testing.T) {
 			{`len("")`, 0},
 			{`len("four")`, 4},
 			{`len("hello world")`, 11},
+			{`len("héllo")`, 5},
+			{`len("🦈")`, 1},
 			{`len((true, 2, "a"))`, 3},
 			{`len([1, 2, 3])`, 3},
 			{`len([])`, 0},
@@ -859,7 +954,8 @@ func TestBuiltinFunctions(t *testing.T) {
 			{`first([1, 2, 3])`, 1},
 			{`first([])`, Null},
 			{`first((1, true, "a"))`, 1},
-			{`first("hello")`, "h"},
+			{`first("hello")`, 'h'},
+			{`first("élan")`, 'é'},
 		}
 
 		runVmTests(t, tests)
@@ -869,13 +965,25 @@ func TestBuiltinFunctions(t *testing.T) {
 		tests := []vmTestCase{
 			{`last([1, 2, 3])`, 3},
 			{`last([])`, Null},
-			{`last("hello")`, "o"},
+			{`last("hello")`, 'o'},
+			{`last("café")`, 'é'},
 			{`last((1, true, "a"))`, "a"},
 		}
 
 		runVmTests(t, tests)
 	})
 
+	t.Run("should evaluate byte builtin functions", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`byte_len("héllo")`, 6},
+			{`byte_len("")`, 0},
+			{`bytes("hé")`, []int{104, 195, 169}},
+			{`len(bytes("🦈"))`, 4},
+		}
+
+		runVmTests(t, tests)
+	})
+
 	t.Run("should evaluate rest builtin functions", func(t *testing.T) {
 		tests := []vmTestCase{
 			{`rest([1, 2, 3])`, []int{2, 3}},
@@ -909,6 +1017,236 @@ func TestBuiltinFunctions(t *testing.T) {
 	})
 }
 
+func TestAssertions(t *testing.T) {
+	t.Run("should evaluate the assertions that hold to null", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`assert(1 < 2)`, Null},
+			{`assert(true, "message")`, Null},
+			{`assert_eq([1, (2, "a")], [1, (2, "a")])`, Null},
+			{`assert_eq({"a": 1, "b": 2}, {"b": 2, "a": 1})`, Null},
+			{`assert_throws(() => { 1 / 0 })`, Null},
+			{`assert_throws(() => { assert(false) })`, Null},
+		}
+
+		runVmTests(t, tests)
+	})
+
+	t.Run("should stop the program when an assertion fails", func(t *testing.T) {
+		tests := []struct {
+			input   string
+			message string
+			help    string
+		}{
+			{`assert(1 > 2); puts(1);`, "assertion failed: condition is false", ""},
+			{`assert(false, "not true")`, "assertion failed: not true", ""},
+			{`assert_eq([1, 2, 3], [1, 4, 3])`, "assertion failed: values are not equal", "expected: [1, 4, 3]\n  actual: [1, 2, 3]\n              ^"},
+			{`assert_eq(1, "1")`, "assertion failed: values have different types 'i64' and 'string'", "expected: \"1\": string\n  actual: 1: i64\n          ^"},
+			{`assert_throws(() => { 1 })`, "assertion failed: the function did not throw an error", ""},
+		}
+
+		for _, tt := range tests {
+			comp := compiler.New()
+			if err, _ := comp.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error: %+v", err)
+			}
+
+			err := NewDefault(comp.Bytecode()).Run()
+			if err == nil || err.ErrCode != exception.SharkErrorAssertionFailed {
+				t.Fatalf("expected a failed assertion for %q, got %+v", tt.input, err)
+			}
+			if err.ErrMsg != tt.message {
+				t.Errorf("wrong message. expected=%q, got=%q", tt.message, err.ErrMsg)
+			}
+			help := ""
+			if err.ErrHelpMsg != nil {
+				help = *err.ErrHelpMsg
+			}
+			if help != tt.help {
+				t.Errorf("wrong help message. expected=%q, got=%q", tt.help, help)
+			}
+		}
+	})
+}
+
+func TestWideOperands(t *testing.T) {
+	var constants strings.Builder
+	constants.WriteString("let mut a = 0;\n")
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&constants, "a = %d;\n", i)
+	}
+	constants.WriteString("a")
+
+	var locals, sum strings.Builder
+	locals.WriteString("let f = () => {\n")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&locals, "\tlet mut v%d = %d;\n", i, i)
+		if i > 0 {
+			sum.WriteString(" + ")
+		}
+		fmt.Fprintf(&sum, "v%d", i)
+	}
+	locals.WriteString("\tv299++;\n\tv299--;\n\tv299 = v299 + 1;\n")
+	fmt.Fprintf(&locals, "\tlet g = () => { %s };\n\tg()\n};\nf()", sum.String())
+
+	var params, args strings.Builder
+	for i := 0; i < 300; i++ {
+		if i > 0 {
+			params.WriteString(", ")
+			args.WriteString(", ")
+		}
+		fmt.Fprintf(&params, "p%d", i)
+		fmt.Fprintf(&args, "%d", i)
+	}
+	calls := fmt.Sprintf("let h = (%s) => { p299 };\nlet k = () => { h(%s) };\nh(%s) + k()", params.String(), args.String(), args.String())
+
+	var jumps strings.Builder
+	jumps.WriteString("let mut x = 0;\nif (x == 0) {\n")
+	for i := 0; i < 8000; i++ {
+		jumps.WriteString("\tx = x + 1;\n")
+	}
+	jumps.WriteString("} else {\n\tx = 2;\n}\nwhile (x > 5000) { x = x - 1; }\nx")
+
+	tests := []vmTestCase{
+		{constants.String(), 69999},
+		// The closure is made with 300 free variables
+		{locals.String(), 44851},
+		{calls, 598},
+		{jumps.String(), 5000},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSuperinstructions(t *testing.T) {
+	run := func(t *testing.T, input string, level compiler.OptimizationLevel) (*VM, *exception.SharkError) {
+		t.Helper()
+		comp := compiler.New()
+		comp.SetOptimizationLevel(level)
+		if err, _ := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %+v", err)
+		}
+		conf := config.NewDefaultVmConf()
+		if err := bytecode.Verify(comp.Bytecode(), &conf); err != nil {
+			t.Fatalf("bytecode error: %s", err.Error())
+		}
+		vm := NewDefault(comp.Bytecode())
+		return vm, vm.Run()
+	}
+
+	t.Run("should evaluate the superinstructions like the instructions they stand for", func(t *testing.T) {
+		tests := []vmTestCase{
+			{
+				input: `
+				let sum = (n) => {
+					let mut total = 0;
+					let mut i = 0;
+					while (i < n) {
+						total = total + i;
+						i = i + 1;
+					};
+					total
+				};
+				sum(10);
+				`,
+				expected: 45,
+			},
+			{
+				input: `
+				let fib = @nomemo (x) => {
+					if (x == 0) { return 0; };
+					if (x == 1) { return 1; };
+					fib(x - 1) + fib(x - 2)
+				};
+				fib(15);
+				`,
+				expected: 610,
+			},
+			{
+				input:    `let max = (a, b) => { if (a > b) { a } else { b } }; max(3, 7) + max(9, 2);`,
+				expected: 16,
+			},
+			{
+				input:    `let shout = (s) => { s + "!" }; shout("shark");`,
+				expected: "shark!",
+			},
+			{
+				input:    `let isA = (s) => { if (s == "a") { 1 } else { 2 } }; isA("a") + isA("b");`,
+				expected: 3,
+			},
+		}
+
+		for _, tt := range tests {
+			vm, err := run(t, tt.input, compiler.O2)
+			if err != nil {
+				t.Fatalf("vm error: %+v", err)
+			}
+			testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+		}
+	})
+
+	t.Run("should report errors where the operator is", func(t *testing.T) {
+		input := `let less = (a: i64, b) => { if (a < b) { 1 } else { 2 } }; less(1, "x");`
+
+		expected, err := run(t, input, compiler.O0)
+		if err == nil || err.ErrCode != exception.SharkErrorMismatchedTypes {
+			t.Fatalf("expected mismatched types, got %+v", err)
+		}
+		expectedPos, _ := expected.Position()
+
+		vm, err := run(t, input, compiler.O2)
+		if err == nil || err.ErrCode != exception.SharkErrorMismatchedTypes {
+			t.Fatalf("expected mismatched types, got %+v", err)
+		}
+		if pos, ok := vm.Position(); !ok || pos != expectedPos {
+			t.Errorf("wrong position. want=%+v, got=%+v", expectedPos, pos)
+		}
+	})
+}
+
+func TestInterrupt(t *testing.T) {
+	input := `let mut i = 0; while (true) { i++; }`
+
+	comp := compiler.New()
+	if err, _ := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %+v", err)
+	}
+
+	vm := NewDefault(comp.Bytecode())
+	vm.Interrupt()
+
+	err := vm.Run()
+	if err == nil || err.ErrCode != exception.SharkErrorVMInterrupted {
+		t.Fatalf("expected an interrupted VM, got %+v", err)
+	}
+	pos, ok := vm.Position()
+	if !ok || pos.Line != 1 || pos.ColFrom != 16 {
+		t.Errorf("expected the position of the loop, got %+v", pos)
+	}
+}
+
+func TestUnsetVariables(t *testing.T) {
+	// Compiled code sets its variables before reading them, bytecode written by hand may not
+	instructions := map[string][][]byte{
+		"get global":       {code.Make(code.OpGetGlobal, 0), code.Make(code.OpPop)},
+		"increment global": {code.Make(code.OpIncrementGlobal, 0)},
+		"concat":           {code.Make(code.OpGetGlobal, 0), code.Make(code.OpConcat, 1), code.Make(code.OpPop)},
+	}
+
+	for name, ins := range instructions {
+		t.Run("should report reading an unset variable with "+name, func(t *testing.T) {
+			bc := &bytecode.Bytecode{}
+			for _, in := range ins {
+				bc.Instructions = append(bc.Instructions, in...)
+			}
+
+			err := NewDefault(bc).Run()
+			if err == nil || err.ErrCode != exception.SharkErrorUnsetVariable {
+				t.Fatalf("expected an unset variable error, got %+v", err)
+			}
+		})
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -1103,6 +1441,127 @@ func TestRecursiveFibonacci(t *testing.T) {
 	})
 }
 
+func TestTailCalls(t *testing.T) {
+	t.Run("should run recursion in tail position in constant frame space", func(t *testing.T) {
+		tests := []vmTestCase{
+			{
+				input: `
+			let count = (n: i64): i64 => {
+				if (n == 0) {
+					return 0;
+				};
+				return count(n - 1);
+			};
+			count(100000);
+			`,
+				expected: 0,
+			},
+			{
+				input: `
+			let reduce = (arr: array<i64>, initial: i64, f: func<(i64, any)->i64>) => {
+				let n = len(arr);
+				let iter = (i: i64, result: i64) => {
+					if (i == n) {
+						result
+					} else {
+						iter(i + 1, f(result, arr[i]))
+					}
+				};
+				iter(0, initial)
+			};
+			reduce(1..100000, 0, (a: i64, b): i64 => { a + b });
+			`,
+				expected: 5000050000,
+			},
+			{
+				input: `
+			let loop = (n: i64, acc: i64): i64 => {
+				if (n == 0) { acc } else { loop(n - 1, acc + 2) }
+			};
+			let wrapper = () => { loop(50000, 0) };
+			wrapper();
+			`,
+				expected: 100000,
+			},
+		}
+
+		for _, tt := range tests {
+			comp := compiler.New()
+			if err, _ := comp.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error: %+v", err)
+			}
+
+			// Far fewer frames than the depth of the recursion
+			conf := config.NewDefaultVmConf()
+			conf.MaxFrames = 8
+			vm := New(comp.Bytecode(), &conf)
+
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error: %+v", err)
+			}
+
+			testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+		}
+	})
+
+	t.Run("should still run out of frames when the recursive call is not in tail position", func(t *testing.T) {
+		input := `
+			let sum = (n: i64): i64 => {
+				if (n == 0) { 0 } else { n + sum(n - 1) }
+			};
+			sum(100);
+			`
+
+		comp := compiler.New()
+		if err, _ := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %+v", err)
+		}
+
+		conf := config.NewDefaultVmConf()
+		conf.MaxFrames = 8
+		vm := New(comp.Bytecode(), &conf)
+
+		err := vm.Run()
+		if err == nil || err.ErrCode != exception.SharkErrorVMFrameStackOverflow {
+			t.Fatalf("expected a frame stack overflow, got %+v", err)
+		}
+	})
+}
+
+func TestStackSize(t *testing.T) {
+	// Each call keeps a few values on the stack, more than it starts with
+	input := `
+		let sum = (n: i64): i64 => {
+			if (n == 0) { 0 } else { n + sum(n - 1) }
+		};
+		sum(200);
+		`
+
+	comp := compiler.New()
+	if err, _ := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %+v", err)
+	}
+
+	t.Run("should grow the stack up to its size", func(t *testing.T) {
+		vm := NewDefault(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %+v", err)
+		}
+		testExpectedObject(t, 20100, vm.LastPoppedStackElem())
+	})
+
+	t.Run("should overflow past its size", func(t *testing.T) {
+		conf := config.NewDefaultVmConf()
+		conf.StackSize = 300
+		vm := New(comp.Bytecode(), &conf)
+
+		err := vm.Run()
+		if err == nil || err.ErrCode != exception.SharkErrorVMStackOverflow {
+			t.Fatalf("expected a stack overflow, got %+v", err)
+		}
+	})
+}
+
 func TestCache(t *testing.T) {
 	t.Run("should get the result from the func when called twice", func(t *testing.T) {
 		tests := []vmTestCase{
@@ -1119,6 +1578,71 @@ func TestCache(t *testing.T) {
 
 		runVmTests(t, tests)
 	})
+
+	t.Run("should not share results between closures over different values", func(t *testing.T) {
+		tests := []vmTestCase{
+			{
+				input: `
+			let adder = (n: i64): func<(i64)->i64> => { (x: i64): i64 => { x + n } };
+			let addOne = adder(1);
+			let addTen = adder(10);
+			addOne(5) + addTen(5);
+			`,
+				expected: 21,
+			},
+		}
+
+		runVmTests(t, tests)
+	})
+
+	t.Run("should run impure functions on every call", func(t *testing.T) {
+		tests := []vmTestCase{
+			{
+				input: `
+			let mut count = 0;
+			let tick = (x: i64) => { count++; x };
+			tick(1) + tick(1);
+			count;
+			`,
+				expected: 2,
+			},
+			{
+				input: `
+			let mut base = 1;
+			let f = (x: i64) => { x + base };
+			let a = f(1);
+			base = 10;
+			a + f(1);
+			`,
+				expected: 13,
+			},
+		}
+
+		runVmTests(t, tests)
+	})
+
+	t.Run("should follow the memo annotations", func(t *testing.T) {
+		tests := []vmTestCase{
+			{
+				input: `
+			let mut count = 0;
+			let tick = @memo (x: i64) => { count++; x };
+			tick(1) + tick(1) + tick(2);
+			count;
+			`,
+				expected: 2,
+			},
+			{
+				input: `
+			let sq = @nomemo (x: i64) => { x * x };
+			sq(3) + sq(3);
+			`,
+				expected: 18,
+			},
+		}
+
+		runVmTests(t, tests)
+	})
 }
 
 func TestNullIfStatements(t *testing.T) {
@@ -1166,6 +1690,107 @@ func TestNullIfStatements(t *testing.T) {
 	})
 }
 
+func BenchmarkFibonacci(b *testing.B) {
+	paths, err := filepath.Glob("../examples/fibonacci*.shark")
+	if err != nil || len(paths) == 0 {
+		b.Fatalf("no fibonacci examples found: %v", err)
+	}
+
+	// The examples print their result, keep it out of the benchmark output
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		devNull.Close()
+	}()
+
+	for _, path := range paths {
+		// The tests of the examples are run by 'shark test', they are not programs
+		if strings.HasSuffix(path, "_test.shark") {
+			continue
+		}
+
+		source, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		comp := compiler.New()
+		if err, _ := comp.Compile(parse(string(source))); err != nil {
+			b.Fatalf("compiler error: %+v", err)
+		}
+		bc := comp.Bytecode()
+
+		b.Run(filepath.Base(path), func(b *testing.B) {
+			runBenchmark(b, bc)
+		})
+	}
+
+	// The recursive example is memoized, most of its calls are cache lookups. Without the
+	// cache, the calls and the arithmetic are measured.
+	b.Run("recursive", func(b *testing.B) {
+		input := `
+		let fibonacci = @nomemo (x: i64): i64 => {
+			if (x < 2) { return x; };
+			fibonacci(x - 1) + fibonacci(x - 2)
+		};
+		fibonacci(20);
+		`
+		comp := compiler.New()
+		if err, _ := comp.Compile(parse(input)); err != nil {
+			b.Fatalf("compiler error: %+v", err)
+		}
+
+		if err := testIntegerObject(6765, runBenchmark(b, comp.Bytecode())); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+func BenchmarkCounterLoop(b *testing.B) {
+	comp := compiler.New()
+	input := `
+	let mut sum = 0;
+	let mut i = 0;
+	while (i < 100000) {
+		sum = sum + i;
+		i++;
+	}
+	sum;
+	`
+	if err, _ := comp.Compile(parse(input)); err != nil {
+		b.Fatalf("compiler error: %+v", err)
+	}
+
+	if err := testIntegerObject(4999950000, runBenchmark(b, comp.Bytecode())); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// Runs the bytecode b.N times and returns the value of the program. The programs have few
+// globals, a VM with the default number of them would spend most of a run allocating them.
+func runBenchmark(b *testing.B, bc *bytecode.Bytecode) object.Object {
+	b.Helper()
+
+	conf := config.NewDefaultVmConf()
+	conf.GlobalsSize = 64
+
+	var result object.Object
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		machine := New(bc, &conf)
+		if err := machine.Run(); err != nil {
+			b.Fatalf("vm error: %+v", err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+	return result
+}
+
 func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
 	t.Helper()
 
@@ -1186,6 +1811,23 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err := testStringObject(expected, actual); err != nil {
 			t.Fatalf("testStringObject failed: %s", err)
 		}
+	case rune:
+		if err := testCharObject(expected, actual); err != nil {
+			t.Fatalf("testCharObject failed: %s", err)
+		}
+	case []rune:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array. got=%T (%+v)", actual, actual)
+		}
+		if len(array.Elements) != len(expected) {
+			t.Fatalf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		}
+		for i, expectedElem := range expected {
+			if err := testCharObject(expectedElem, array.Elements[i]); err != nil {
+				t.Fatalf("testCharObject failed: %s", err)
+			}
+		}
 	case object.Tuple:
 		tuple, ok := actual.(*object.Tuple)
 		if !ok {
@@ -1273,6 +1915,18 @@ func testStringObject(expected string, actual object.Object) error {
 	return nil
 }
 
+func testCharObject(expected rune, actual object.Object) error {
+	result, ok := actual.(*object.Char)
+	if !ok {
+		return fmt.Errorf("object is not Char. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
 	result, ok := actual.(*object.Boolean)
 	if !ok {